@@ -0,0 +1,157 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// --- GitHub Actions ---
+
+// inActions reports whether the tool runs as a GitHub Actions step.
+func inActions() bool {
+	return os.Getenv("GITHUB_ACTIONS") == "true"
+}
+
+// escapeWorkflowData escapes a workflow command message.
+func escapeWorkflowData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+// escapeWorkflowProperty escapes a workflow command property value.
+func escapeWorkflowProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+// appendToEnvFile appends text to the file named by the environment variable
+// name, such as GITHUB_STEP_SUMMARY, if the runner set it.
+func appendToEnvFile(name, text string) error {
+	path := os.Getenv(name)
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(text)
+	return err
+}
+
+// reportToActions writes the run to the step summary, annotates every
+// failure, and sets the step outputs. With several branches the outputs
+// describe the first one that committed.
+func reportToActions(outcomes []repoOutcome) {
+	if err := appendToEnvFile("GITHUB_STEP_SUMMARY", formatMarkdownReport(reportRows(outcomes))+"\n"); err != nil {
+		log.Printf("Failed to write job summary: %v", err)
+	}
+
+	var commitSHA, commitURL, prURL, mergeSHA string
+	changed, failed := 0, 0
+	for _, out := range outcomes {
+		if out.Err != nil {
+			failed++
+			fmt.Printf("::error title=%s::%s\n", escapeWorkflowProperty(out.Target.String()), escapeWorkflowData(out.Err.Error()))
+			continue
+		}
+		for _, b := range out.Branches {
+			for _, status := range b.Result {
+				if status == "created" || status == "updated" || status == "deleted" {
+					changed++
+				}
+			}
+			if b.Err != nil {
+				failed++
+				annotateFailure(out.Target, b)
+				continue
+			}
+			if commitSHA == "" && b.Commit != nil {
+				commitSHA, commitURL = b.Commit.GetSHA(), b.Commit.GetHTMLURL()
+				prURL, mergeSHA = b.PR.GetHTMLURL(), b.Merged
+			}
+		}
+	}
+
+	outputs := fmt.Sprintf("commit-sha=%s\ncommit-url=%s\npr-url=%s\nmerge-sha=%s\nchanged-files=%d\nfailed=%d\n",
+		commitSHA, commitURL, prURL, mergeSHA, changed, failed)
+	if err := appendToEnvFile("GITHUB_OUTPUT", outputs); err != nil {
+		log.Printf("Failed to set step outputs: %v", err)
+	}
+}
+
+// annotateFailure emits an error annotation for each file the branch failed
+// on, or one for the branch when no file is to blame.
+func annotateFailure(target repoTarget, b branchOutcome) {
+	title := escapeWorkflowProperty(target.String() + "@" + b.Branch)
+	message := escapeWorkflowData(b.Err.Error())
+
+	var files []string
+	for path, status := range b.Result {
+		if status == "error" || status == compareFailed {
+			files = append(files, path)
+		}
+	}
+	if len(files) == 0 {
+		fmt.Printf("::error title=%s::%s\n", title, message)
+		return
+	}
+	sort.Strings(files)
+	for _, path := range files {
+		fmt.Printf("::error file=%s,title=%s::%s\n", escapeWorkflowProperty(path), title, message)
+	}
+}
+
+// actionCommand is the argument the action's entrypoint passes, switching the
+// tool to reading its flags from the step's inputs.
+const actionCommand = "action"
+
+// applyActionInputs sets every flag of fs that has a step input, which the
+// runner passes as INPUT_<NAME> with the name upper-cased. Repeatable flags
+// take one value per line. It returns the files input, also one per line.
+func applyActionInputs(fs *flag.FlagSet) ([]string, error) {
+	input := func(name string) string {
+		return strings.TrimSpace(os.Getenv("INPUT_" + strings.ToUpper(name)))
+	}
+
+	var err error
+	fs.VisitAll(func(f *flag.Flag) {
+		value := input(f.Name)
+		if value == "" || err != nil {
+			return
+		}
+		values := []string{value}
+		if _, repeatable := f.Value.(*stringList); repeatable {
+			values = inputLines(value)
+		}
+		for _, v := range values {
+			if setErr := fs.Set(f.Name, v); setErr != nil {
+				err = fmt.Errorf("input %s: %w", f.Name, setErr)
+				return
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The token input defaults to the job's token in action.yml.
+	if token := input("token"); token != "" && os.Getenv("GITHUB_TOKEN") == "" {
+		os.Setenv("GITHUB_TOKEN", token)
+	}
+	return inputLines(input("files")), nil
+}
+
+// inputLines splits a multi-line input, dropping blank lines.
+func inputLines(value string) []string {
+	var lines []string
+	for _, line := range strings.Split(value, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+	"golang.org/x/oauth2"
+)
+
+// --- GitHub App ---
+
+// appID and appKeyPath, set by -app-id and -app-key, authenticate as a
+// GitHub App instead of with a token. Every installation of the app has its
+// own token and its own rate limit, so requests are sent with the token of
+// the installation on the account they are about.
+var (
+	appID      int64
+	appKeyPath string
+)
+
+// sharedApp is the routing transport of the run's client when it
+// authenticates as an app, which fan-out consults to schedule repositories.
+var sharedApp *appTransport
+
+// appTransport sends each request with the token of the installation on the
+// account in its path, and tracks each installation's rate limit. Requests
+// about no account, such as for the rate limit, go to the first installation
+// by account name.
+type appTransport struct {
+	installations map[string]*appInstallation
+	fallback      *appInstallation
+}
+
+// appInstallation is one installation of the app, with a transport that
+// authenticates as it and holds its requests to its own rate budget.
+type appInstallation struct {
+	ID      int64
+	Account string
+	rt      http.RoundTripper
+
+	mu        sync.Mutex
+	remaining int
+	reset     time.Time
+	known     bool
+}
+
+// newAppTransport lists the app's installations and prepares a transport
+// for each; their tokens are only created once they are used.
+func newAppTransport() (*appTransport, error) {
+	key, err := readAppKey(appKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	// The app's own endpoints take a JWT rather than a token.
+	appClient := github.NewClient(&http.Client{Transport: &appJWTTransport{id: appID, key: key, base: apiTransport()}, Timeout: httpTimeout})
+
+	ctx := context.Background()
+	t := &appTransport{installations: make(map[string]*appInstallation)}
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := appClient.Apps.ListInstallations(ctx, opts)
+		if err != nil {
+			return nil, fmt.Errorf("ListInstallations: %w", err)
+		}
+		for _, inst := range page {
+			i := &appInstallation{ID: inst.GetID(), Account: inst.GetAccount().GetLogin()}
+			tokens := oauth2.ReuseTokenSource(nil, installationTokenSource{client: appClient, id: i.ID})
+			i.rt = newRateBudget(&oauth2.Transport{Source: tokens, Base: newCacheTransport(apiTransport())})
+			t.installations[strings.ToLower(i.Account)] = i
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	if len(t.installations) == 0 {
+		return nil, fmt.Errorf("app %d has no installations", appID)
+	}
+	accounts := make([]string, 0, len(t.installations))
+	for account := range t.installations {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+	t.fallback = t.installations[accounts[0]]
+	log.Printf("Authenticated as app %d, installed on %s", appID, strings.Join(accounts, ", "))
+	return t, nil
+}
+
+// requestOwner returns the account a request is about, from its
+// /repos/{owner}, /orgs/{org} or /users/{user} path, or "".
+func requestOwner(req *http.Request) string {
+	parts := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/"), "/", 3)
+	if len(parts) < 2 {
+		return ""
+	}
+	switch parts[0] {
+	case "repos", "orgs", "users":
+		return parts[1]
+	}
+	return ""
+}
+
+func (t *appTransport) installation(owner string) (*appInstallation, error) {
+	if owner == "" {
+		return t.fallback, nil
+	}
+	if i, ok := t.installations[strings.ToLower(owner)]; ok {
+		return i, nil
+	}
+	return nil, fmt.Errorf("app %d is not installed on %s", appID, owner)
+}
+
+func (t *appTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	i, err := t.installation(requestOwner(req))
+	if err != nil {
+		return nil, err
+	}
+	resp, err := i.rt.RoundTrip(req)
+	if err == nil && rateResource(req) == "core" {
+		i.update(resp.Header)
+	}
+	return resp, err
+}
+
+func (i *appInstallation) update(header http.Header) {
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.remaining, i.reset, i.known = remaining, time.Unix(reset, 0), true
+}
+
+// ready reports whether owner's installation has quota above the rate floor,
+// and if not, when its window resets. Accounts without an installation are
+// ready, so that their repositories fail right away.
+func (t *appTransport) ready(owner string) (bool, time.Time) {
+	i, err := t.installation(owner)
+	if err != nil {
+		return true, time.Time{}
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if !i.known || i.remaining >= max(rateFloor, 1) || !time.Now().Before(i.reset) {
+		return true, time.Time{}
+	}
+	return false, i.reset
+}
+
+// installationTokenSource creates installation tokens, which last an hour;
+// oauth2.ReuseTokenSource asks for a new one when the last one expires.
+type installationTokenSource struct {
+	client *github.Client
+	id     int64
+}
+
+func (s installationTokenSource) Token() (*oauth2.Token, error) {
+	token, _, err := s.client.Apps.CreateInstallationToken(context.Background(), s.id, nil)
+	if err != nil {
+		return nil, fmt.Errorf("CreateInstallationToken %d: %w", s.id, err)
+	}
+	// Renew a minute early, so no request goes out with a token that
+	// expires on the way.
+	return &oauth2.Token{AccessToken: token.GetToken(), Expiry: token.GetExpiresAt().Add(-time.Minute)}, nil
+}
+
+// appJWTTransport authenticates as the app itself, with a JWT signed by its
+// private key.
+type appJWTTransport struct {
+	id   int64
+	key  *rsa.PrivateKey
+	base http.RoundTripper
+}
+
+func (t *appJWTTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	jwt, err := appJWT(t.id, t.key, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	return t.base.RoundTrip(req)
+}
+
+// appJWT returns a JWT for app id, valid for nine minutes. GitHub allows ten,
+// and its issue time is set a minute back for clock drift.
+func appJWT(id int64, key *rsa.PrivateKey, now time.Time) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`))
+	claims, err := json.Marshal(map[string]int64{
+		"iat": now.Add(-time.Minute).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": id,
+	})
+	if err != nil {
+		return "", err
+	}
+	signed := header + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// readAppKey reads the app's private key, in the PKCS#1 PEM GitHub hands out
+// or in PKCS#8.
+func readAppKey(p string) (*rsa.PrivateKey, error) {
+	if p == "" {
+		return nil, errors.New("-app-id needs -app-key")
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read -app-key: %w", err)
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("-app-key %s is not a PEM file", p)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("-app-key %s: %w", p, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("-app-key %s is not an RSA key", p)
+	}
+	return key, nil
+}
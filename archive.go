@@ -0,0 +1,281 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+	"golang.org/x/text/unicode/norm"
+)
+
+// --- Archive Import ---
+
+// readArchive expands a .tar, .tar.gz/.tgz or .zip file in memory. Leading
+// path components are dropped as with tar --strip-components, and expansion
+// stops with an error once the uncompressed contents exceed maxBytes.
+func readArchive(archivePath string, maxBytes int64, strip int) (map[string]string, error) {
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	lower := strings.ToLower(archivePath)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		info, err := f.Stat()
+		if err != nil {
+			return nil, err
+		}
+		return readZip(f, info.Size(), maxBytes, strip)
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read gzip stream: %w", err)
+		}
+		defer gz.Close()
+		return readTar(gz, maxBytes, strip)
+	case strings.HasSuffix(lower, ".tar"):
+		return readTar(f, maxBytes, strip)
+	}
+	return nil, fmt.Errorf("unsupported archive type: %s", archivePath)
+}
+
+// archiveBudget enforces the uncompressed size limit across all entries.
+type archiveBudget struct {
+	remaining int64
+}
+
+func (b *archiveBudget) read(name string, r io.Reader) (string, error) {
+	var buf bytes.Buffer
+	n, err := io.Copy(&buf, io.LimitReader(r, b.remaining+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s from archive: %w", name, err)
+	}
+	if n > b.remaining {
+		return "", fmt.Errorf("archive contents exceed size limit (at %s)", name)
+	}
+	b.remaining -= n
+	return buf.String(), nil
+}
+
+// archiveEntryPath cleans an entry name and applies strip. It returns "" for
+// entries that should be ignored, including any that would escape the
+// destination.
+func archiveEntryPath(name string, strip int) string {
+	name = strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(name, "\\", "/")), "/")
+	name = norm.NFC.String(name)
+	parts := strings.Split(name, "/")
+	if len(parts) <= strip {
+		return ""
+	}
+	return strings.Join(parts[strip:], "/")
+}
+
+func readTar(r io.Reader, maxBytes int64, strip int) (map[string]string, error) {
+	files := make(map[string]string)
+	budget := &archiveBudget{remaining: maxBytes}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read tar archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		p := archiveEntryPath(hdr.Name, strip)
+		if p == "" {
+			continue
+		}
+		content, err := budget.read(hdr.Name, tr)
+		if err != nil {
+			return nil, err
+		}
+		files[p] = content
+	}
+	return files, nil
+}
+
+func readZip(r io.ReaderAt, size, maxBytes int64, strip int) (map[string]string, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read zip archive: %w", err)
+	}
+	files := make(map[string]string)
+	budget := &archiveBudget{remaining: maxBytes}
+	for _, zf := range zr.File {
+		if !zf.Mode().IsRegular() {
+			continue
+		}
+		p := archiveEntryPath(zf.Name, strip)
+		if p == "" {
+			continue
+		}
+		rc, err := zf.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s in archive: %w", zf.Name, err)
+		}
+		content, err := budget.read(zf.Name, rc)
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		files[p] = content
+	}
+	return files, nil
+}
+
+// --- Archive Export ---
+
+func runArchiveCommand(args []string) error {
+	fs := flag.NewFlagSet("archive", flag.ExitOnError)
+	owner, repo := repoFlags(fs)
+	ref := fs.String("ref", defaultBranch, "branch, tag or commit to download")
+	format := fs.String("format", "tar", "archive format: tar (gzipped) or zip")
+	prefix := fs.String("prefix", "", "only keep files under this repository directory")
+	output := fs.String("o", "", "output file (default <repo>-<ref>.tar.gz or .zip)")
+	fs.Parse(args)
+
+	client, err := newGitHubClient()
+	if err != nil {
+		return err
+	}
+
+	archiveFormat, ext := github.Tarball, ".tar.gz"
+	if *format == "zip" {
+		archiveFormat, ext = github.Zipball, ".zip"
+	} else if *format != "tar" {
+		return fmt.Errorf("unknown archive format %q", *format)
+	}
+	outPath := *output
+	if outPath == "" {
+		outPath = *repo + "-" + strings.ReplaceAll(*ref, "/", "-") + ext
+	}
+
+	return downloadArchive(client, *owner, *repo, *ref, archiveFormat, cleanDestPrefix(*prefix), outPath)
+}
+
+// downloadArchive saves the tarball or zipball of ref to outPath. With a
+// prefix, only entries below that repository directory are kept; GitHub
+// wraps every entry in a single top-level directory, which is preserved.
+func downloadArchive(client *github.Client, owner, repo, ref string, format github.ArchiveFormat, prefix, outPath string) error {
+	ctx := context.Background()
+
+	link, _, err := client.Repositories.GetArchiveLink(ctx, owner, repo, format, &github.RepositoryContentGetOptions{Ref: ref}, true)
+	if err != nil {
+		return fmt.Errorf("GetArchiveLink: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Client().Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download archive: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download archive: %s", resp.Status)
+	}
+
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	switch {
+	case prefix == "":
+		_, err = io.Copy(out, resp.Body)
+	case format == github.Zipball:
+		err = filterZip(resp.Body, out, prefix)
+	default:
+		err = filterTarGz(resp.Body, out, prefix)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", outPath, err)
+	}
+
+	fmt.Println("Archive saved:", outPath)
+	return out.Close()
+}
+
+// inArchivePrefix reports whether an entry name, including GitHub's
+// top-level directory, lies within the repository directory prefix.
+func inArchivePrefix(name, prefix string) bool {
+	_, rest, _ := strings.Cut(name, "/")
+	rest = strings.TrimSuffix(rest, "/")
+	return rest == prefix || underPrefix(rest, prefix)
+}
+
+func filterTarGz(r io.Reader, w io.Writer, prefix string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	gzw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gzw)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !inArchivePrefix(hdr.Name, prefix) {
+			continue
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.Copy(tw, tr); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gzw.Close()
+}
+
+func filterZip(r io.Reader, w io.Writer, prefix string) error {
+	// zip needs random access to its central directory, so buffer it.
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	for _, zf := range zr.File {
+		if !inArchivePrefix(zf.Name, prefix) {
+			continue
+		}
+		if err := zw.Copy(zf); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
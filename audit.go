@@ -0,0 +1,167 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Audit Log ---
+
+// auditLogPath is the JSONL file mutations are appended to, set by -audit-log.
+var auditLogPath string
+
+const auditLogUsage = "append every mutating API call to this JSONL file"
+
+type auditEntry struct {
+	Time      time.Time `json:"time"`
+	Actor     string    `json:"actor,omitempty"`
+	Method    string    `json:"method"`
+	URL       string    `json:"url"`
+	Status    int       `json:"status,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	// Resource fields are picked from the response when present: the commit,
+	// tree or blob SHA, the ref and where it points, or the repository name.
+	SHA      string `json:"sha,omitempty"`
+	Ref      string `json:"ref,omitempty"`
+	Target   string `json:"target,omitempty"`
+	FullName string `json:"full_name,omitempty"`
+	HTMLURL  string `json:"html_url,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// auditTransport appends an entry to the audit log for every request that can
+// change state, which is every method but GET and HEAD and every GraphQL
+// mutation. Logging failures are reported but never fail the request.
+type auditTransport struct {
+	base http.RoundTripper
+
+	mu    sync.Mutex
+	actor string
+}
+
+func newAuditTransport(base http.RoundTripper) http.RoundTripper {
+	if auditLogPath == "" {
+		return base
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &auditTransport{base: base, actor: os.Getenv("GITHUB_ACTOR")}
+}
+
+func (t *auditTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method == http.MethodGet || req.Method == http.MethodHead || !isMutation(req) {
+		return t.base.RoundTrip(req)
+	}
+
+	entry := auditEntry{Time: time.Now().UTC(), Actor: t.lookupActor(req), Method: req.Method, URL: req.URL.String()}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		entry.Status = resp.StatusCode
+		entry.RequestID = resp.Header.Get("X-GitHub-Request-Id")
+		resp.Body = auditResource(resp.Body, &entry)
+	}
+	t.write(entry)
+	return resp, err
+}
+
+// isMutation tells GraphQL queries, which are POSTs, apart from mutations.
+func isMutation(req *http.Request) bool {
+	if !strings.HasSuffix(req.URL.Path, "/graphql") || req.GetBody == nil {
+		return true
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return true
+	}
+	defer body.Close()
+	var payload struct {
+		Query string `json:"query"`
+	}
+	if json.NewDecoder(body).Decode(&payload) != nil {
+		return true
+	}
+	return strings.HasPrefix(strings.TrimSpace(payload.Query), "mutation")
+}
+
+// lookupActor resolves the token's login once, for tokens run outside
+// Actions where GITHUB_ACTOR is not set.
+func (t *auditTransport) lookupActor(orig *http.Request) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.actor != "" || orig.URL.Host != "api.github.com" {
+		return t.actor
+	}
+	t.actor = "unknown"
+	req, err := http.NewRequestWithContext(orig.Context(), http.MethodGet, "https://api.github.com/user", nil)
+	if err != nil {
+		return t.actor
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return t.actor
+	}
+	defer resp.Body.Close()
+	var user struct {
+		Login string `json:"login"`
+	}
+	if resp.StatusCode == http.StatusOK && json.NewDecoder(resp.Body).Decode(&user) == nil && user.Login != "" {
+		t.actor = user.Login
+	}
+	return t.actor
+}
+
+// auditResource copies the identifying fields of a JSON response into entry
+// and returns an equivalent body for the caller.
+func auditResource(body io.ReadCloser, entry *auditEntry) io.ReadCloser {
+	b, err := io.ReadAll(body)
+	body.Close()
+	var resource struct {
+		SHA    string `json:"sha"`
+		Ref    string `json:"ref"`
+		Object struct {
+			SHA string `json:"sha"`
+		} `json:"object"`
+		FullName string `json:"full_name"`
+		HTMLURL  string `json:"html_url"`
+	}
+	if json.Unmarshal(b, &resource) == nil {
+		entry.SHA = resource.SHA
+		entry.Ref = resource.Ref
+		entry.Target = resource.Object.SHA
+		entry.FullName = resource.FullName
+		entry.HTMLURL = resource.HTMLURL
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	return io.NopCloser(bytes.NewReader(b))
+}
+
+func (t *auditTransport) write(entry auditEntry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("⚠️ Failed to encode audit entry: %v", err)
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f, err := os.OpenFile(auditLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		log.Printf("⚠️ Failed to open audit log: %v", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		log.Printf("⚠️ Failed to write audit log: %v", err)
+	}
+}
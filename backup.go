@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Backup and Restore ---
+
+// A backup directory holds backup.json, with the repository's settings,
+// releases and issues, and a bare git repository, backupGitDir, mirroring
+// every branch and tag with its whole history. Restoring pushes them back
+// as they were, so commit SHAs and annotated tags survive. LFS objects are
+// not part of the git history and are not backed up.
+type repoBackup struct {
+	Repository *github.Repository          `json:"repository"`
+	Releases   []*github.RepositoryRelease `json:"releases"`
+	Issues     []*github.Issue             `json:"issues,omitempty"`
+}
+
+// backupGitDir is the bare repository of a backup directory.
+const backupGitDir = "repo.git"
+
+// backupRefSpecs are the refs a backup mirrors, forced on fetch so that a
+// backup taken again follows rewritten branches. GitHub's other refs, such
+// as refs/pull/*, cannot be pushed back.
+var backupRefSpecs = []config.RefSpec{"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*"}
+
+func runBackupCommand(args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	owner, repo := repoFlags(fs)
+	dir := fs.String("dir", "", "backup directory (default <repo>-backup)")
+	issues := fs.Bool("issues", false, "include issues")
+	fs.Parse(args)
+
+	client, err := newGitHubClient()
+	if err != nil {
+		return err
+	}
+	if *dir == "" {
+		*dir = *repo + "-backup"
+	}
+	return backupRepository(client, *owner, *repo, *dir, *issues)
+}
+
+func runRestoreCommand(args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	owner, repo := repoFlags(fs)
+	dir := fs.String("dir", "", "backup directory (default <repo>-backup)")
+	issues := fs.Bool("issues", false, "recreate issues from the backup")
+	force := fs.Bool("force", false, "restore into an existing repository, force-pushing the backed-up branches and tags over its own")
+	fs.Parse(args)
+
+	client, err := newGitHubClient()
+	if err != nil {
+		return err
+	}
+	if *dir == "" {
+		*dir = *repo + "-backup"
+	}
+	return restoreRepository(client, *owner, *repo, *dir, *issues, *force)
+}
+
+func backupRepository(client *github.Client, owner, repo, dir string, includeIssues bool) error {
+	ctx := context.Background()
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	repository, _, err := client.Repositories.Get(ctx, owner, repo)
+	if err != nil {
+		return fmt.Errorf("Get repository: %w", err)
+	}
+	backup := &repoBackup{Repository: repository}
+
+	refs, err := mirrorRefs(filepath.Join(dir, backupGitDir), repository.GetCloneURL())
+	if err != nil {
+		return err
+	}
+
+	releaseOpts := &github.ListOptions{PerPage: 100}
+	for {
+		releases, resp, err := client.Repositories.ListReleases(ctx, owner, repo, releaseOpts)
+		if err != nil {
+			return fmt.Errorf("ListReleases: %w", err)
+		}
+		backup.Releases = append(backup.Releases, releases...)
+		if resp.NextPage == 0 {
+			break
+		}
+		releaseOpts.Page = resp.NextPage
+	}
+
+	if includeIssues {
+		issueOpts := &github.IssueListByRepoOptions{State: "all", ListOptions: github.ListOptions{PerPage: 100}}
+		for {
+			issues, resp, err := client.Issues.ListByRepo(ctx, owner, repo, issueOpts)
+			if err != nil {
+				return fmt.Errorf("ListByRepo: %w", err)
+			}
+			for _, issue := range issues {
+				if !issue.IsPullRequest() {
+					backup.Issues = append(backup.Issues, issue)
+				}
+			}
+			if resp.NextPage == 0 {
+				break
+			}
+			issueOpts.Page = resp.NextPage
+		}
+	}
+
+	b, err := json.MarshalIndent(backup, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "backup.json"), b, 0o644); err != nil {
+		return err
+	}
+
+	fmt.Printf("✅ Backed up %d refs, %d releases, %d issues to %s\n",
+		refs, len(backup.Releases), len(backup.Issues), dir)
+	return nil
+}
+
+func restoreRepository(client *github.Client, owner, repo, dir string, includeIssues, force bool) error {
+	ctx := context.Background()
+
+	b, err := os.ReadFile(filepath.Join(dir, "backup.json"))
+	if err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+	var backup repoBackup
+	if err := json.Unmarshal(b, &backup); err != nil {
+		return fmt.Errorf("failed to parse backup: %w", err)
+	}
+
+	target, resp, err := client.Repositories.Get(ctx, owner, repo)
+	if err == nil && !force {
+		return fmt.Errorf("repository %s/%s already exists, use -force to restore into it", owner, repo)
+	}
+	if err != nil && (resp == nil || resp.StatusCode != 404) {
+		return fmt.Errorf("Error checking if repo exists: %w", err)
+	}
+	if err != nil {
+		if target, err = createRestoredRepo(client, owner, repo, backup.Repository); err != nil {
+			return err
+		}
+	}
+
+	refs, err := pushMirroredRefs(filepath.Join(dir, backupGitDir), target.GetCloneURL(), force)
+	if err != nil {
+		return err
+	}
+
+	if r := backup.Repository; r != nil {
+		_, _, err := client.Repositories.Edit(ctx, owner, repo, &github.Repository{
+			Description:   r.Description,
+			Homepage:      r.Homepage,
+			Private:       r.Private,
+			DefaultBranch: r.DefaultBranch,
+		})
+		if err != nil {
+			return fmt.Errorf("Edit repository: %w", err)
+		}
+	}
+
+	for _, release := range backup.Releases {
+		_, _, err := client.Repositories.CreateRelease(ctx, owner, repo, &github.RepositoryRelease{
+			TagName:    release.TagName,
+			Name:       release.Name,
+			Body:       release.Body,
+			Draft:      release.Draft,
+			Prerelease: release.Prerelease,
+		})
+		if err != nil {
+			return fmt.Errorf("CreateRelease %s: %w", release.GetTagName(), err)
+		}
+	}
+
+	if includeIssues {
+		for _, issue := range backup.Issues {
+			var labels []string
+			for _, label := range issue.Labels {
+				labels = append(labels, label.GetName())
+			}
+			created, _, err := client.Issues.Create(ctx, owner, repo, &github.IssueRequest{
+				Title:  issue.Title,
+				Body:   issue.Body,
+				Labels: &labels,
+			})
+			if err != nil {
+				return fmt.Errorf("Create issue #%d: %w", issue.GetNumber(), err)
+			}
+			if issue.GetState() == "closed" {
+				_, _, err = client.Issues.Edit(ctx, owner, repo, created.GetNumber(), &github.IssueRequest{State: github.String("closed")})
+				if err != nil {
+					return fmt.Errorf("Close issue #%d: %w", created.GetNumber(), err)
+				}
+			}
+		}
+	}
+
+	fmt.Printf("✅ Restored %d refs and %d releases into %s/%s\n", refs, len(backup.Releases), owner, repo)
+	return nil
+}
+
+// createRestoredRepo creates the empty repository a backup is restored
+// into, with the backup's visibility from the start so a private
+// repository's contents are never public while they upload. A backup
+// without repository settings is restored private.
+func createRestoredRepo(client *github.Client, owner, repo string, settings *github.Repository) (*github.Repository, error) {
+	org := ""
+	if isOrg, err := isOrganization(client, owner); err != nil {
+		return nil, err
+	} else if isOrg {
+		org = owner
+	}
+	created := &github.Repository{Name: github.String(repo), Private: github.Bool(true)}
+	if settings != nil {
+		created.Private, created.Description = github.Bool(settings.GetPrivate()), settings.Description
+	}
+	r, _, err := client.Repositories.Create(context.Background(), org, created)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating repo: %w", err)
+	}
+	log.Println("Repo created:", r.GetHTMLURL())
+	return r, nil
+}
+
+// mirrorRefs fetches the branches and tags of remoteURL, with their history,
+// into the bare repository at path, creating it on the first backup. Refs
+// since deleted from the remote are deleted from the mirror. It returns how
+// many refs the mirror holds.
+func mirrorRefs(path, remoteURL string) (int, error) {
+	auth, err := gitAuth(remoteURL)
+	if err != nil {
+		return 0, err
+	}
+	r, err := git.PlainInit(path, true)
+	if errors.Is(err, git.ErrRepositoryAlreadyExists) {
+		r, err = git.PlainOpen(path)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("opening %s: %w", path, err)
+	}
+	remote := git.NewRemote(r.Storer, &config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{remoteURL}})
+	err = remote.Fetch(&git.FetchOptions{RefSpecs: backupRefSpecs, Auth: auth, Tags: git.NoTags, Prune: true})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) && !errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		return 0, fmt.Errorf("fetching %s: %w", remoteURL, err)
+	}
+	return countMirroredRefs(r)
+}
+
+// pushMirroredRefs pushes the branches and tags of the mirror at path to
+// remoteURL, over the remote's own refs if force is set. Remote refs the
+// backup lacks are left alone.
+func pushMirroredRefs(path, remoteURL string, force bool) (int, error) {
+	r, err := git.PlainOpen(path)
+	if err != nil {
+		return 0, fmt.Errorf("backup has no %s: %w", backupGitDir, err)
+	}
+	refs, err := countMirroredRefs(r)
+	if err != nil || refs == 0 {
+		return 0, err
+	}
+	auth, err := gitAuth(remoteURL)
+	if err != nil {
+		return 0, err
+	}
+	specs := make([]config.RefSpec, len(backupRefSpecs))
+	for i, spec := range backupRefSpecs {
+		if specs[i] = spec; !force {
+			specs[i] = config.RefSpec(strings.TrimPrefix(spec.String(), "+"))
+		}
+	}
+	remote := git.NewRemote(r.Storer, &config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{remoteURL}})
+	err = remote.Push(&git.PushOptions{RefSpecs: specs, Auth: auth})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return 0, fmt.Errorf("pushing to %s: %w", remoteURL, err)
+	}
+	return refs, nil
+}
+
+func countMirroredRefs(r *git.Repository) (int, error) {
+	iter, err := r.References()
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		if ref.Name().IsBranch() || ref.Name().IsTag() {
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// --- Bitbucket Forge ---
+
+const defaultBitbucketURL = "https://api.bitbucket.org/2.0"
+
+// bitbucketForge implements forge with the Bitbucket Cloud API, committing
+// every change in one form post to the src endpoint. owner is the workspace
+// and repo the repository slug.
+type bitbucketForge struct {
+	baseURL     string
+	owner, repo string
+	auth        func(*http.Request)
+	http        *http.Client
+}
+
+// newBitbucketForge authenticates with the access token in BITBUCKET_TOKEN, or
+// with BITBUCKET_USERNAME and BITBUCKET_APP_PASSWORD.
+func newBitbucketForge(baseURL, owner, repo string) (*bitbucketForge, error) {
+	f := &bitbucketForge{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		owner:   owner,
+		repo:    repo,
+		http:    newHTTPClient(),
+	}
+	if f.baseURL == "" {
+		f.baseURL = defaultBitbucketURL
+	}
+	if token := os.Getenv("BITBUCKET_TOKEN"); token != "" {
+		f.auth = func(req *http.Request) { req.Header.Set("Authorization", "Bearer "+token) }
+		return f, nil
+	}
+	user, password := os.Getenv("BITBUCKET_USERNAME"), os.Getenv("BITBUCKET_APP_PASSWORD")
+	if user == "" || password == "" {
+		return nil, fmt.Errorf("set BITBUCKET_TOKEN, or BITBUCKET_USERNAME and BITBUCKET_APP_PASSWORD")
+	}
+	f.auth = func(req *http.Request) { req.SetBasicAuth(user, password) }
+	return f, nil
+}
+
+func (f *bitbucketForge) repoURL(p string) string {
+	return f.baseURL + "/repositories/" + url.PathEscape(f.owner) + "/" + url.PathEscape(f.repo) + p
+}
+
+// send performs req and decodes the JSON response into out.
+func (f *bitbucketForge) send(req *http.Request, out interface{}) (*http.Response, error) {
+	f.auth(req)
+	resp, err := f.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return resp, readAPIError(resp)
+	}
+	if out == nil {
+		return resp, nil
+	}
+	return resp, json.NewDecoder(resp.Body).Decode(out)
+}
+
+// get fetches rawURL, which is either a path under the repository or an
+// absolute "next" link from a paginated response.
+func (f *bitbucketForge) get(rawURL string, out interface{}) error {
+	if !strings.HasPrefix(rawURL, "http") {
+		rawURL = f.repoURL(rawURL)
+	}
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return err
+	}
+	_, err = f.send(req, out)
+	return err
+}
+
+func (f *bitbucketForge) Target() (string, string) { return f.owner, f.repo }
+
+func (f *bitbucketForge) Repository() (bool, string, error) {
+	var repository struct {
+		MainBranch struct {
+			Name string `json:"name"`
+		} `json:"mainbranch"`
+	}
+	if err := f.get("", &repository); err != nil {
+		return false, "", fmt.Errorf("GetRepository: %w", err)
+	}
+	var branches struct {
+		Size int `json:"size"`
+	}
+	if err := f.get("/refs/branches?pagelen=1", &branches); err != nil {
+		return false, "", fmt.Errorf("ListBranches: %w", err)
+	}
+	return branches.Size == 0, repository.MainBranch.Name, nil
+}
+
+func (f *bitbucketForge) BranchHead(branch string) (string, error) {
+	var ref struct {
+		Target struct {
+			Hash string `json:"hash"`
+		} `json:"target"`
+	}
+	err := f.get("/refs/branches/"+url.PathEscape(branch), &ref)
+	if isNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("GetBranch: %w", err)
+	}
+	return ref.Target.Hash, nil
+}
+
+func (f *bitbucketForge) ResolveRef(name string) (string, error) {
+	var commit struct {
+		Hash string `json:"hash"`
+	}
+	if err := f.get("/commit/"+url.PathEscape(name), &commit); err != nil {
+		return "", fmt.Errorf("GetCommit %s: %w", name, err)
+	}
+	return commit.Hash, nil
+}
+
+func (f *bitbucketForge) CreateBranch(branch, sha string) error {
+	body, err := json.Marshal(map[string]interface{}{"name": branch, "target": map[string]string{"hash": sha}})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest("POST", f.repoURL("/refs/branches"), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if _, err := f.send(req, nil); err != nil {
+		return fmt.Errorf("CreateBranch: %w", err)
+	}
+	return nil
+}
+
+// Tree lists the files of commit sha. Bitbucket's listing carries no blob
+// SHAs, so files are compared through ReadFile instead.
+func (f *bitbucketForge) Tree(sha string) (*forgeTree, error) {
+	tree := &forgeTree{Entries: make(map[string]treeFile)}
+	next := "/src/" + url.PathEscape(sha) + "/?max_depth=100&pagelen=100"
+	for next != "" {
+		var page struct {
+			Values []struct {
+				Type       string   `json:"type"`
+				Path       string   `json:"path"`
+				Attributes []string `json:"attributes"`
+			} `json:"values"`
+			Next string `json:"next"`
+		}
+		if err := f.get(next, &page); err != nil {
+			return nil, fmt.Errorf("ListSource: %w", err)
+		}
+		for _, entry := range page.Values {
+			if entry.Type != "commit_file" {
+				continue
+			}
+			mode := "100644"
+			for _, attr := range entry.Attributes {
+				switch attr {
+				case "executable":
+					mode = "100755"
+				case "link":
+					mode = "120000"
+				}
+			}
+			tree.Entries[entry.Path] = treeFile{Mode: mode, Type: "blob"}
+		}
+		next = page.Next
+	}
+	return tree, nil
+}
+
+func (f *bitbucketForge) ReadFile(sha, p string) (string, error) {
+	req, err := http.NewRequest("GET", f.repoURL("/src/"+url.PathEscape(sha)+"/"+escapePath(p)), nil)
+	if err != nil {
+		return "", err
+	}
+	f.auth(req)
+	resp, err := f.http.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("GetFile %s: %w", p, readAPIError(resp))
+	}
+	b, err := io.ReadAll(resp.Body)
+	return string(b), err
+}
+
+// Commit posts every change as one form: a field per written file, named by
+// its path, and the deleted paths in "files". The parent pins the commit to
+// the head that was compared against.
+func (f *bitbucketForge) Commit(branch, parent, message string, changes []fileChange) (*forgeCommit, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("message", message)
+	form.WriteField("branch", branch)
+	if parent != "" {
+		form.WriteField("parents", parent)
+	}
+	for _, change := range changes {
+		if change.Delete {
+			form.WriteField("files", change.Path)
+			continue
+		}
+		w, err := form.CreateFormFile(change.Path, path.Base(change.Path))
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(w, change.Content); err != nil {
+			return nil, err
+		}
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest("POST", f.repoURL("/src"), &body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	resp, err := f.send(req, nil)
+	if err != nil {
+		return nil, fmt.Errorf("CreateCommit: %w", err)
+	}
+
+	// The new commit is only reported through its Location.
+	location := resp.Header.Get("Location")
+	if location == "" {
+		return nil, fmt.Errorf("CreateCommit: response has no Location")
+	}
+	sha := path.Base(location)
+	return &forgeCommit{SHA: sha, URL: "https://bitbucket.org/" + f.owner + "/" + f.repo + "/commits/" + sha}, nil
+}
+
+// escapePath escapes each segment of a slash-separated repository path.
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
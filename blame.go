@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- File History and Blame ---
+
+// fileHistory returns the commits on ref that touched path, newest first.
+func fileHistory(client *github.Client, owner, repo, ref, path string, limit int) ([]logEntry, error) {
+	return listCommits(client, owner, repo, &github.CommitsListOptions{SHA: ref, Path: path}, limit)
+}
+
+// lastChanges returns the most recent commit touching each of paths on ref,
+// omitting paths without history.
+func lastChanges(client *github.Client, owner, repo, ref string, paths []string) (map[string]logEntry, error) {
+	changes := make(map[string]logEntry)
+	for _, path := range paths {
+		history, err := fileHistory(client, owner, repo, ref, path, 1)
+		if err != nil {
+			return nil, fmt.Errorf("history of %s: %w", path, err)
+		}
+		if len(history) > 0 {
+			changes[path] = history[0]
+		}
+	}
+	return changes, nil
+}
+
+type blameRange struct {
+	StartingLine int `json:"startingLine"`
+	EndingLine   int `json:"endingLine"`
+	Age          int `json:"age"`
+	Commit       struct {
+		OID             string    `json:"oid"`
+		CommittedDate   time.Time `json:"committedDate"`
+		MessageHeadline string    `json:"messageHeadline"`
+		Author          struct {
+			Name  string `json:"name"`
+			Email string `json:"email"`
+			User  *struct {
+				Login string `json:"login"`
+			} `json:"user"`
+		} `json:"author"`
+	} `json:"commit"`
+}
+
+const blameQuery = `query($owner: String!, $repo: String!, $ref: String!, $path: String!) {
+  repository(owner: $owner, name: $repo) {
+    object(expression: $ref) {
+      ... on Commit {
+        blame(path: $path) {
+          ranges {
+            startingLine
+            endingLine
+            age
+            commit {
+              oid
+              committedDate
+              messageHeadline
+              author { name email user { login } }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+// graphQLURL derives the GraphQL endpoint from the REST base URL, which is
+// /api/v3/ on GitHub Enterprise Server and /api/graphql for GraphQL.
+func graphQLURL(client *github.Client) string {
+	base := client.BaseURL.String()
+	if strings.HasSuffix(base, "/api/v3/") {
+		return strings.TrimSuffix(base, "v3/") + "graphql"
+	}
+	return base + "graphql"
+}
+
+// blameFile fetches line-range blame for path at ref via the GraphQL API,
+// which has no REST equivalent.
+func blameFile(client *github.Client, owner, repo, ref, path string) ([]blameRange, error) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"query":     blameQuery,
+		"variables": map[string]string{"owner": owner, "repo": repo, "ref": ref, "path": path},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, graphQLURL(client), bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Client().Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("GraphQL blame: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GraphQL blame: %s", resp.Status)
+	}
+
+	var out struct {
+		Data struct {
+			Repository struct {
+				Object *struct {
+					Blame struct {
+						Ranges []blameRange `json:"ranges"`
+					} `json:"blame"`
+				} `json:"object"`
+			} `json:"repository"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("GraphQL blame: %w", err)
+	}
+	if len(out.Errors) > 0 {
+		return nil, fmt.Errorf("GraphQL blame: %s", out.Errors[0].Message)
+	}
+	if out.Data.Repository.Object == nil {
+		return nil, fmt.Errorf("ref %s not found", ref)
+	}
+	return out.Data.Repository.Object.Blame.Ranges, nil
+}
+
+func runBlameCommand(args []string) error {
+	fs := flag.NewFlagSet("blame", flag.ExitOnError)
+	owner, repo := repoFlags(fs)
+	ref := fs.String("ref", defaultBranch, "branch, tag or commit")
+	format := fs.String("format", "text", "output format: text or json")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: blame [flags] <path>")
+	}
+	client, err := newGitHubClient()
+	if err != nil {
+		return err
+	}
+	ranges, err := blameFile(client, *owner, *repo, *ref, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		b, err := json.MarshalIndent(ranges, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+	for _, r := range ranges {
+		who := r.Commit.Author.Name
+		if r.Commit.Author.User != nil {
+			who = r.Commit.Author.User.Login
+		}
+		fmt.Printf("%5d-%-5d %s %s %-20s %s\n", r.StartingLine, r.EndingLine, shortSHA(r.Commit.OID),
+			r.Commit.CommittedDate.Format("2006-01-02"), who, r.Commit.MessageHeadline)
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Blob Journal ---
+
+// blobJournalPath is a file recording every blob the tool creates, so a run
+// retried after a failure skips uploading them again; empty disables it.
+// Blobs are content-addressed, so a recorded SHA stands for the same content
+// in every later run.
+var blobJournalPath string
+
+const blobJournalUsage = "record created blobs in this file so a retried run skips uploading them again"
+
+// blobJournalMaxAge bounds how long a recorded blob is trusted. A blob that
+// no commit references is eventually garbage collected by GitHub.
+const blobJournalMaxAge = 24 * time.Hour
+
+var blobJournal struct {
+	mu sync.Mutex
+	// blobs holds the recorded SHAs of each owner/repo, loaded on first use.
+	blobs map[string]map[string]bool
+}
+
+// journaledBlobs returns a copy of the SHAs recorded for owner/repo, which
+// the caller may read without the lock while journalBlob adds to them.
+func journaledBlobs(owner, repo string) map[string]bool {
+	if blobJournalPath == "" {
+		return nil
+	}
+	blobJournal.mu.Lock()
+	defer blobJournal.mu.Unlock()
+	if blobJournal.blobs == nil {
+		blobs, err := readBlobJournal(blobJournalPath)
+		if err != nil {
+			log.Printf("⚠️ Ignoring blob journal: %v", err)
+		}
+		blobJournal.blobs = blobs
+	}
+	recorded := blobJournal.blobs[owner+"/"+repo]
+	blobs := make(map[string]bool, len(recorded))
+	for sha := range recorded {
+		blobs[sha] = true
+	}
+	return blobs
+}
+
+// readBlobJournal parses the journal's "owner/repo sha unix-time" lines,
+// dropping entries older than blobJournalMaxAge.
+func readBlobJournal(path string) (map[string]map[string]bool, error) {
+	blobs := make(map[string]map[string]bool)
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return blobs, nil
+	}
+	if err != nil {
+		return blobs, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		created, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil || time.Since(time.Unix(created, 0)) > blobJournalMaxAge {
+			continue
+		}
+		if blobs[fields[0]] == nil {
+			blobs[fields[0]] = make(map[string]bool)
+		}
+		blobs[fields[0]][fields[1]] = true
+	}
+	return blobs, scanner.Err()
+}
+
+// journalBlob records that sha was created in owner/repo. A failure only
+// costs a re-upload on retry, so it is logged rather than returned.
+func journalBlob(owner, repo, sha string) {
+	if blobJournalPath == "" {
+		return
+	}
+	blobJournal.mu.Lock()
+	defer blobJournal.mu.Unlock()
+	if blobJournal.blobs != nil {
+		key := owner + "/" + repo
+		if blobJournal.blobs[key] == nil {
+			blobJournal.blobs[key] = make(map[string]bool)
+		}
+		blobJournal.blobs[key][sha] = true
+	}
+
+	f, err := os.OpenFile(blobJournalPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err == nil {
+		_, err = fmt.Fprintf(f, "%s/%s %s %d\n", owner, repo, sha, time.Now().Unix())
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		log.Printf("⚠️ Failed to journal blob %s: %v", shortSHA(sha), err)
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/base64"
+	"fmt"
+	"log"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Blobs ---
+
+// gitBlobSHA computes the object ID git assigns to content, letting the tool
+// recognize unchanged files from tree listings without downloading them.
+func gitBlobSHA(content string) string {
+	h := sha1.New()
+	fmt.Fprintf(h, "blob %d\x00", len(content))
+	h.Write([]byte(content))
+	return fmt.Sprintf("%x", h.Sum(nil))
+}
+
+// blobUploader creates each distinct blob at most once per run. Blobs already
+// present in the base tree, uploaded earlier in the run, or in the blob
+// journal from an earlier run are reused by SHA.
+type blobUploader struct {
+	client      *github.Client
+	owner, repo string
+	known       map[string]bool
+	journaled   map[string]bool
+	uploaded    int
+	reused      int
+	resumed     int
+	// deferred, when set, collects new blobs for a plan instead of creating
+	// them.
+	deferred map[string]string
+}
+
+func newBlobUploader(client *github.Client, owner, repo string, baseEntries []*github.TreeEntry) *blobUploader {
+	u := &blobUploader{client: client, owner: owner, repo: repo, known: make(map[string]bool), journaled: journaledBlobs(owner, repo)}
+	for _, entry := range baseEntries {
+		if entry.GetType() == "blob" {
+			u.known[entry.GetSHA()] = true
+		}
+	}
+	return u
+}
+
+// upload returns the blob SHA for content, creating the blob only if needed.
+// Content is sent base64-encoded so binary files survive the JSON request.
+func (u *blobUploader) upload(content string) (string, error) {
+	sha := gitBlobSHA(content)
+	if u.known[sha] {
+		u.reused++
+		return sha, nil
+	}
+	if u.journaled[sha] {
+		u.known[sha] = true
+		u.resumed++
+		return sha, nil
+	}
+	if u.deferred != nil {
+		u.deferred[sha] = content
+		u.known[sha] = true
+		return sha, nil
+	}
+
+	blob, _, err := u.client.Git.CreateBlob(context.Background(), u.owner, u.repo, &github.Blob{
+		Content:  github.String(base64.StdEncoding.EncodeToString([]byte(content))),
+		Encoding: github.String("base64"),
+	})
+	if err != nil {
+		return "", err
+	}
+	u.known[blob.GetSHA()] = true
+	u.uploaded++
+	journalBlob(u.owner, u.repo, blob.GetSHA())
+	return blob.GetSHA(), nil
+}
+
+func (u *blobUploader) logStats() {
+	if u.reused > 0 {
+		log.Printf("Uploaded %d blobs, reused %d existing ones", u.uploaded, u.reused)
+	}
+	if u.resumed > 0 {
+		log.Printf("Skipped %d blobs already uploaded by an earlier run", u.resumed)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// --- Checksum Manifest ---
+
+const defaultChecksumsPath = "CHECKSUMS.txt"
+
+// checksumConfig asks for a manifest of SHA-256 digests of the synced files
+// in every sync commit. A Path ending in .json gets a JSON object of path to
+// digest; anything else the sha256sum format, so `sha256sum -c` can check a
+// checkout.
+type checksumConfig struct {
+	Path string
+}
+
+type checksumManifest struct {
+	Algorithm string            `json:"algorithm"`
+	Files     map[string]string `json:"files"`
+}
+
+// buildChecksums renders the manifest of files, leaving out the manifest
+// itself. Digests are of the content as synced, before any encryption, which
+// is what verify-checksums compares after decrypting.
+func buildChecksums(cfg *checksumConfig, files map[string]string) (string, error) {
+	digests := make(map[string]string, len(files))
+	for path, content := range files {
+		if path == cfg.Path {
+			continue
+		}
+		sum := sha256.Sum256([]byte(content))
+		digests[path] = hex.EncodeToString(sum[:])
+	}
+
+	if strings.HasSuffix(cfg.Path, ".json") {
+		b, err := json.MarshalIndent(checksumManifest{Algorithm: "sha256", Files: digests}, "", "  ")
+		if err != nil {
+			return "", err
+		}
+		return string(b) + "\n", nil
+	}
+	paths := make([]string, 0, len(digests))
+	for path := range digests {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var b strings.Builder
+	for _, path := range paths {
+		fmt.Fprintf(&b, "%s  %s\n", digests[path], path)
+	}
+	return b.String(), nil
+}
+
+// parseChecksums reads a manifest written by buildChecksums.
+func parseChecksums(path, content string) (map[string]string, error) {
+	if strings.HasSuffix(path, ".json") {
+		var m checksumManifest
+		if err := json.Unmarshal([]byte(content), &m); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if m.Algorithm != "sha256" {
+			return nil, fmt.Errorf("%s: unsupported algorithm %q", path, m.Algorithm)
+		}
+		return m.Files, nil
+	}
+	digests := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		digest, file, ok := strings.Cut(scanner.Text(), "  ")
+		if !ok || len(digest) != sha256.Size*2 {
+			return nil, fmt.Errorf("%s:%d: expected \"<sha256>  <path>\"", path, line)
+		}
+		digests[file] = digest
+	}
+	return digests, scanner.Err()
+}
+
+// runVerifyChecksumsCommand checks every file listed in a ref's manifest
+// against its digest, decrypting files that match -encrypt first.
+func runVerifyChecksumsCommand(args []string) error {
+	fs := flag.NewFlagSet("verify-checksums", flag.ExitOnError)
+	owner, repo := repoFlags(fs)
+	ref := fs.String("ref", defaultBranch, "branch, tag or commit to verify")
+	manifestPath := fs.String("manifest", defaultChecksumsPath, "repository path of the checksum manifest")
+	encryption := encryptionFlags(fs)
+	fs.Parse(args)
+
+	enc, err := encryption()
+	if err != nil {
+		return err
+	}
+	client, err := newGitHubClient()
+	if err != nil {
+		return err
+	}
+	f := newGitHubForge(client, *owner, *repo)
+	sha, err := f.ResolveRef(*ref)
+	if err != nil {
+		return err
+	}
+	tree, err := f.Tree(sha)
+	if err != nil {
+		return err
+	}
+	if _, ok := tree.Entries[*manifestPath]; !ok {
+		return fmt.Errorf("%s@%s has no %s", *repo, shortSHA(sha), *manifestPath)
+	}
+	manifest, err := f.ReadFile(sha, *manifestPath)
+	if err != nil {
+		return err
+	}
+	digests, err := parseChecksums(*manifestPath, manifest)
+	if err != nil {
+		return err
+	}
+
+	paths := make([]string, 0, len(digests))
+	for path := range digests {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var failures []string
+	for _, path := range paths {
+		if _, ok := tree.Entries[path]; !ok {
+			failures = append(failures, path+": missing")
+			continue
+		}
+		content, err := f.ReadFile(sha, path)
+		if err != nil {
+			return err
+		}
+		if enc.matches(path) {
+			if content, err = enc.Cipher.Decrypt(path, content); err != nil {
+				failures = append(failures, fmt.Sprintf("%s: cannot decrypt: %v", path, err))
+				continue
+			}
+		}
+		if sum := sha256.Sum256([]byte(content)); hex.EncodeToString(sum[:]) != digests[path] {
+			failures = append(failures, path+": checksum mismatch")
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("%d of %d files failed verification at %s:\n  - %s",
+			len(failures), len(paths), shortSHA(sha), strings.Join(failures, "\n  - "))
+	}
+	fmt.Printf("✅ %d files match %s at %s\n", len(paths), *manifestPath, shortSHA(sha))
+	return nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Cherry-pick ---
+
+func runCherryPickCommand(args []string) error {
+	fs := flag.NewFlagSet("cherry-pick", flag.ExitOnError)
+	owner, repo := repoFlags(fs)
+	branch := fs.String("branch", defaultBranch, "branch to apply the commit to")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: cherry-pick [flags] <sha>")
+	}
+	client, err := newGitHubClient()
+	if err != nil {
+		return err
+	}
+
+	result, _, err := cherryPick(client, *owner, *repo, *branch, fs.Arg(0))
+	printSummary(result)
+	return err
+}
+
+// cherryPick replays the file changes of sha on top of branch as a new
+// commit, entirely through the API.
+func cherryPick(client *github.Client, owner, repo, branch, sha string) (map[string]string, *github.Commit, error) {
+	ctx := context.Background()
+
+	commit, _, err := client.Git.GetCommit(ctx, owner, repo, sha)
+	if err != nil {
+		return nil, nil, fmt.Errorf("GetCommit: %w", err)
+	}
+	if len(commit.Parents) != 1 {
+		return nil, nil, fmt.Errorf("commit %s has %d parents, only single-parent commits can be cherry-picked", sha, len(commit.Parents))
+	}
+	parentSHA := commit.Parents[0].GetSHA()
+
+	parent, _, err := client.Git.GetCommit(ctx, owner, repo, parentSHA)
+	if err != nil {
+		return nil, nil, fmt.Errorf("GetCommit parent: %w", err)
+	}
+	paths, err := changedPaths(client, owner, repo, parentSHA, commit.GetSHA())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	message := fmt.Sprintf("%s\n\n(cherry picked from commit %s)", strings.TrimRight(commit.GetMessage(), "\n"), commit.GetSHA())
+	return applyTreeDelta(client, owner, repo, branch, paths, parent.Tree.GetSHA(), commit.Tree.GetSHA(), message)
+}
+
+// changedPaths lists every path touched between two commits, including the
+// old name of renamed files, using the compare API.
+func changedPaths(client *github.Client, owner, repo, base, head string) ([]string, error) {
+	comparison, err := compareRefs(client, owner, repo, base, head, false)
+	if err != nil {
+		return nil, err
+	}
+	// The compare API stops listing files at 300.
+	if len(comparison.Files) >= 300 {
+		return nil, fmt.Errorf("%s...%s changes too many files to replay via the API", base, head)
+	}
+
+	var paths []string
+	for _, f := range comparison.Files {
+		paths = append(paths, f.Filename)
+		if f.PreviousFilename != "" {
+			paths = append(paths, f.PreviousFilename)
+		}
+	}
+	return paths, nil
+}
+
+// treeEntries returns the non-directory entries of a tree, keyed by path.
+func treeEntries(client *github.Client, owner, repo, treeSHA string) (map[string]*github.TreeEntry, error) {
+	tree, _, err := client.Git.GetTree(context.Background(), owner, repo, treeSHA, true)
+	if err != nil {
+		return nil, fmt.Errorf("GetTree: %w", err)
+	}
+	if tree.GetTruncated() {
+		return nil, fmt.Errorf("tree %s is too large to list via the API", treeSHA)
+	}
+	entries := make(map[string]*github.TreeEntry)
+	for _, entry := range tree.Entries {
+		if entry.GetType() != "tree" {
+			entries[entry.GetPath()] = entry
+		}
+	}
+	return entries, nil
+}
+
+func sameTreeEntry(a, b *github.TreeEntry) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.GetSHA() == b.GetSHA() && a.GetMode() == b.GetMode()
+}
+
+// applyTreeDelta commits the change of paths from fromTree to toTree onto
+// branch. A path whose current content on branch matches neither side is a
+// conflict and aborts the commit; one that already matches toTree is skipped.
+func applyTreeDelta(client *github.Client, owner, repo, branch string, paths []string, fromTree, toTree, message string) (map[string]string, *github.Commit, error) {
+	ctx := context.Background()
+	result := make(map[string]string)
+
+	from, err := treeEntries(client, owner, repo, fromTree)
+	if err != nil {
+		return result, nil, err
+	}
+	to, err := treeEntries(client, owner, repo, toTree)
+	if err != nil {
+		return result, nil, err
+	}
+
+	ref, _, err := client.Git.GetRef(ctx, owner, repo, "refs/heads/"+branch)
+	if err != nil {
+		return result, nil, fmt.Errorf("GetRef: %w", err)
+	}
+	head, _, err := client.Git.GetCommit(ctx, owner, repo, ref.Object.GetSHA())
+	if err != nil {
+		return result, nil, fmt.Errorf("GetCommit: %w", err)
+	}
+	current, err := treeEntries(client, owner, repo, head.Tree.GetSHA())
+	if err != nil {
+		return result, nil, err
+	}
+
+	sort.Strings(paths)
+	var entries []*github.TreeEntry
+	var conflicts []string
+	for _, path := range paths {
+		cur, want := current[path], to[path]
+		switch {
+		case sameTreeEntry(cur, want):
+			result[path] = "skipped"
+			continue
+		case !sameTreeEntry(cur, from[path]):
+			result[path] = "conflict"
+			conflicts = append(conflicts, path)
+			continue
+		case want == nil:
+			result[path] = "deleted"
+			entries = append(entries, &github.TreeEntry{Path: github.String(path), Mode: cur.Mode, Type: cur.Type})
+			continue
+		case cur == nil:
+			result[path] = "created"
+		default:
+			result[path] = "updated"
+		}
+		entries = append(entries, &github.TreeEntry{Path: github.String(path), Mode: want.Mode, Type: want.Type, SHA: want.SHA})
+	}
+
+	if len(conflicts) > 0 {
+		return result, nil, fmt.Errorf("conflicts on %s: %s", branch, strings.Join(conflicts, ", "))
+	}
+	if len(entries) == 0 {
+		fmt.Println("No changes to commit.")
+		return result, nil, nil
+	}
+
+	tree, err := createTree(client, owner, repo, head.Tree.GetSHA(), entries)
+	if err != nil {
+		return result, nil, fmt.Errorf("CreateTree: %w", err)
+	}
+	commit, _, err := client.Git.CreateCommit(ctx, owner, repo, &github.Commit{
+		Message: github.String(message),
+		Tree:    tree,
+		Parents: []*github.Commit{{SHA: head.SHA}},
+	})
+	if err != nil {
+		return result, nil, fmt.Errorf("CreateCommit: %w", err)
+	}
+
+	ref.Object.SHA = commit.SHA
+	if _, _, err := client.Git.UpdateRef(ctx, owner, repo, ref, false); err != nil {
+		return result, nil, fmt.Errorf("UpdateRef: %w", err)
+	}
+
+	fmt.Println("Commit created:", commit.GetHTMLURL())
+	return result, commit, nil
+}
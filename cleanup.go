@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Cleanup ---
+
+// defaultCleanupPrefix is the prefix of the head branches every pull request
+// this tool opens is pushed to, unless -pr-branch names another.
+const defaultCleanupPrefix = "gitapis/"
+
+// staleBranch is a branch of the tool's that cleanup deletes, and why.
+type staleBranch struct {
+	Name   string
+	Reason string
+}
+
+// runCleanupCommand deletes the branches this tool pushed that nothing
+// needs anymore: those whose pull requests were merged or closed, and those
+// that never got one and have not moved for -older-than. Without -apply the
+// branches are only listed.
+func runCleanupCommand(args []string) error {
+	fs := flag.NewFlagSet("cleanup", flag.ExitOnError)
+	owner, repo := repoFlags(fs)
+	reposFlag := fs.String("repos", "", "comma-separated owner/repo list, or @file with one per line, to clean instead of -owner/-repo")
+	var prefixes stringList
+	fs.Var(&prefixes, "prefix", "name prefix of the tool's branches (default "+defaultCleanupPrefix+"); repeatable")
+	trailer := fs.String("trailer", "", "also clean branches whose head commit has a trailer with this key, as the sync's -trailer adds, whatever their names")
+	olderThan := fs.Duration("older-than", 14*24*time.Hour, "delete branches without a pull request once their head commit is this old")
+	apply := fs.Bool("apply", false, "delete the branches; without it they are only listed")
+	fs.Parse(args)
+
+	if len(prefixes) == 0 {
+		prefixes = stringList{defaultCleanupPrefix}
+	}
+	targets := []repoTarget{{Owner: *owner, Repo: *repo}}
+	if *reposFlag != "" {
+		var err error
+		if targets, err = parseTargets(*reposFlag, *owner); err != nil {
+			return fmt.Errorf("invalid -repos: %w", err)
+		}
+	}
+
+	client, err := newGitHubClient()
+	if err != nil {
+		return err
+	}
+	failed, deleted := 0, 0
+	for _, t := range targets {
+		stale, err := findStaleBranches(client, t.Owner, t.Repo, prefixes, *trailer, *olderThan)
+		if err != nil {
+			log.Printf("%s: %v", t, err)
+			failed++
+			continue
+		}
+		for _, b := range stale {
+			fmt.Printf("%s: %s (%s)\n", t, b.Name, b.Reason)
+			if !*apply {
+				continue
+			}
+			if _, err := client.Git.DeleteRef(context.Background(), t.Owner, t.Repo, "heads/"+b.Name); err != nil {
+				log.Printf("%s: DeleteRef %s: %v", t, b.Name, err)
+				failed++
+				continue
+			}
+			deleted++
+		}
+		if !*apply {
+			deleted += len(stale)
+		}
+	}
+	verb := "would be deleted"
+	if *apply {
+		verb = "deleted"
+	}
+	fmt.Printf("%d repositories checked, %d branches %s, %d failed\n", len(targets), deleted, verb, failed)
+	if !*apply && deleted > 0 {
+		fmt.Println("Run again with -apply to delete them.")
+	}
+	if failed > 0 {
+		return errors.New("cleanup failed for some repositories or branches")
+	}
+	return nil
+}
+
+// findStaleBranches lists the tool's branches of owner/repo that can go. The
+// default branch and protected branches are never touched, whatever their
+// names, and neither is a branch with an open pull request.
+func findStaleBranches(client *github.Client, owner, repo string, prefixes []string, trailer string, olderThan time.Duration) ([]staleBranch, error) {
+	ctx := context.Background()
+	repository, _, err := client.Repositories.Get(ctx, owner, repo)
+	if err != nil {
+		return nil, fmt.Errorf("Get repository: %w", err)
+	}
+
+	var stale []staleBranch
+	opts := &github.BranchListOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		branches, resp, err := client.Repositories.ListBranches(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, fmt.Errorf("ListBranches: %w", err)
+		}
+		for _, b := range branches {
+			name := b.GetName()
+			if name == repository.GetDefaultBranch() || b.GetProtected() {
+				continue
+			}
+			var commit *github.Commit
+			if !hasAnyPrefix(name, prefixes) {
+				if trailer == "" {
+					continue
+				}
+				if commit, _, err = client.Git.GetCommit(ctx, owner, repo, b.GetCommit().GetSHA()); err != nil {
+					return nil, fmt.Errorf("GetCommit %s: %w", name, err)
+				}
+				if _, ok := parseTrailers(commit.GetMessage())[trailer]; !ok {
+					continue
+				}
+			}
+			reason, err := staleReason(client, owner, repo, b, commit, olderThan)
+			if err != nil {
+				return nil, err
+			}
+			if reason != "" {
+				stale = append(stale, staleBranch{Name: name, Reason: reason})
+			}
+		}
+		if resp.NextPage == 0 {
+			return stale, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// staleReason says why branch b can be deleted, or returns "" to keep it.
+// commit is its head commit, if already fetched.
+func staleReason(client *github.Client, owner, repo string, b *github.Branch, commit *github.Commit, olderThan time.Duration) (string, error) {
+	ctx := context.Background()
+	prs, _, err := client.PullRequests.List(ctx, owner, repo, &github.PullRequestListOptions{
+		State: "all",
+		Head:  owner + ":" + b.GetName(),
+	})
+	if err != nil {
+		return "", fmt.Errorf("List pull requests: %w", err)
+	}
+	for _, pr := range prs {
+		if pr.GetState() == "open" {
+			return "", nil
+		}
+	}
+	// A branch pushed to after its pull request closed holds work the pull
+	// request never had, so only its age can make it stale.
+	if len(prs) > 0 && prs[0].GetHead().GetSHA() == b.GetCommit().GetSHA() {
+		pr := prs[0]
+		if pr.MergedAt != nil {
+			return fmt.Sprintf("pull request #%d merged", pr.GetNumber()), nil
+		}
+		return fmt.Sprintf("pull request #%d closed", pr.GetNumber()), nil
+	}
+
+	if commit == nil {
+		if commit, _, err = client.Git.GetCommit(ctx, owner, repo, b.GetCommit().GetSHA()); err != nil {
+			return "", fmt.Errorf("GetCommit %s: %w", b.GetName(), err)
+		}
+	}
+	age := time.Since(commit.GetCommitter().GetDate().Time)
+	if age < olderThan {
+		return "", nil
+	}
+	return fmt.Sprintf("no pull request, last commit %d days ago", int(age.Hours()/24)), nil
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
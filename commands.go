@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/v55/github"
+	"golang.org/x/oauth2"
+)
+
+// --- Subcommands ---
+
+const (
+	defaultOwner  = "Santosh-etailify" // change this
+	defaultRepo   = "gitapis10"        // change this
+	defaultBranch = "main"             // change if needed
+)
+
+// version is set at build time with -ldflags "-X main.version=...".
+var version = "dev"
+
+// commands maps a subcommand name to its entry point, which receives the
+// arguments following the name. Without a known subcommand the tool upserts
+// files as before.
+var commands = map[string]func(args []string) error{
+	"apply":            runApplyCommand,
+	"archive":          runArchiveCommand,
+	"backup":           runBackupCommand,
+	"blame":            runBlameCommand,
+	"cherry-pick":      runCherryPickCommand,
+	"cleanup":          runCleanupCommand,
+	"compare":          runCompareCommand,
+	"dashboard":        runDashboardCommand,
+	"doctor":           runDoctorCommand,
+	"kube-export":      runKubeExportCommand,
+	"log":              runLogCommand,
+	"patch":            runPatchCommand,
+	"pull":             runPullCommand,
+	"remind":           runRemindCommand,
+	"restore":          runRestoreCommand,
+	"revert":           runRevertCommand,
+	"rollback":         runRollbackCommand,
+	"search-replace":   runSearchReplaceCommand,
+	"serve":            runServeCommand,
+	"snapshot":         runSnapshotCommand,
+	"status":           runStatusCommand,
+	"submodule":        runSubmoduleCommand,
+	"sync-fork":        runSyncForkCommand,
+	"verify-checksums": runVerifyChecksumsCommand,
+}
+
+// repoFlags registers the -owner and -repo flags shared by all subcommands,
+// along with -audit-log, the token flags and the HTTP client flags.
+func repoFlags(fs *flag.FlagSet) (owner, repo *string) {
+	owner = fs.String("owner", defaultOwner, "repository owner")
+	repo = fs.String("repo", defaultRepo, "repository name")
+	fs.StringVar(&auditLogPath, "audit-log", "", auditLogUsage)
+	tokenFlags(fs)
+	httpClientFlags(fs)
+	return owner, repo
+}
+
+// tokenFile is where -token-file reads the token from, for CI systems that
+// mount secrets as files rather than putting them in the environment.
+var tokenFile string
+
+// tokenFlags registers the flags that say where the GitHub token comes from.
+func tokenFlags(fs *flag.FlagSet) {
+	fs.StringVar(&tokenFile, "token-file", "", "read the GitHub token from this file instead of GITHUB_TOKEN or GH_TOKEN")
+	fs.StringVar(&tokenBroker, "token-broker", "", "exchange the CI job's OIDC token for a GitHub App installation token at this URL, instead of using a stored token")
+	fs.StringVar(&oidcAudience, "oidc-audience", "", "audience of the OIDC token sent to -token-broker (default the broker URL)")
+	fs.StringVar(&oidcTokenEnv, "oidc-token-env", "GITLAB_OIDC_TOKEN", "outside GitHub Actions, the variable holding the job's OIDC token for -token-broker")
+	fs.Int64Var(&appID, "app-id", 0, "authenticate as this GitHub App, with a token and rate limit per installation, instead of with a token")
+	fs.StringVar(&appKeyPath, "app-key", "", "PEM file with the private key of the -app-id app")
+}
+
+// githubToken returns the token from -token-broker, -token-file,
+// GITHUB_TOKEN or GH_TOKEN, the first one set. GH_TOKEN is what the gh CLI
+// and some CI systems use.
+func githubToken() (string, error) {
+	if tokenBroker != "" {
+		token, err := brokerTokens().Token()
+		if err != nil {
+			return "", err
+		}
+		return token.AccessToken, nil
+	}
+	if tokenFile != "" {
+		b, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return "", fmt.Errorf("failed to read -token-file: %w", err)
+		}
+		token := strings.TrimSpace(string(b))
+		if token == "" {
+			return "", fmt.Errorf("-token-file %s is empty", tokenFile)
+		}
+		return token, nil
+	}
+	for _, name := range []string{"GITHUB_TOKEN", "GH_TOKEN"} {
+		if token := strings.TrimSpace(os.Getenv(name)); token != "" {
+			return token, nil
+		}
+	}
+	return "", fmt.Errorf("no GitHub token: set GITHUB_TOKEN or GH_TOKEN, or pass -token-file")
+}
+
+var (
+	sharedClientMu sync.Mutex
+	sharedClient   *github.Client
+)
+
+// newGitHubClient returns the run's GitHub client. There is one, so that
+// every command and fan-out worker shares its connections and rate budget.
+func newGitHubClient() (*github.Client, error) {
+	sharedClientMu.Lock()
+	defer sharedClientMu.Unlock()
+	if sharedClient != nil {
+		return sharedClient, nil
+	}
+	if appID != 0 {
+		app, err := newAppTransport()
+		if err != nil {
+			return nil, err
+		}
+		sharedApp = app
+		sharedClient = github.NewClient(&http.Client{Transport: newAuditTransport(app), Timeout: httpTimeout})
+		return sharedClient, nil
+	}
+	// Broker tokens are short-lived and renewed as they expire.
+	var ts oauth2.TokenSource
+	if tokenBroker != "" {
+		ts = brokerTokens()
+	} else {
+		token, err := githubToken()
+		if err != nil {
+			return nil, err
+		}
+		ts = oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+	}
+	if _, err := ts.Token(); err != nil {
+		return nil, err
+	}
+
+	// The cache goes below the token, which is part of its keys.
+	ctx := context.WithValue(context.Background(), oauth2.HTTPClient, &http.Client{Transport: newCacheTransport(apiTransport())})
+	tc := oauth2.NewClient(ctx, ts)
+	tc.Transport = newAuditTransport(newRateBudget(tc.Transport))
+	tc.Timeout = httpTimeout
+	sharedClient = github.NewClient(tc)
+	return sharedClient, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Change Summary Comment ---
+
+// formatChangeSummary renders the upsert result as a Markdown table, linking
+// every changed file to its diff in the commit. Files marked
+// linguist-generated are listed in a collapsed table of their own.
+func formatChangeSummary(owner, repo string, result map[string]string, commitSHA string, attrs *gitAttributes) string {
+	var paths, generated []string
+	counts := make(map[string]int)
+	for path, status := range result {
+		if attrs.isGenerated(path) {
+			generated = append(generated, path)
+		} else {
+			paths = append(paths, path)
+		}
+		counts[status]++
+	}
+	sort.Strings(paths)
+	sort.Strings(generated)
+
+	var b strings.Builder
+	b.WriteString("### Sync summary\n\n")
+	fmt.Fprintf(&b, "%d created, %d updated, %d deleted, %d skipped, %d error\n\n",
+		counts["created"], counts["updated"], counts["deleted"], counts["skipped"], counts["error"])
+	writeSummaryTable(&b, owner, repo, result, commitSHA, paths)
+	if len(generated) > 0 {
+		fmt.Fprintf(&b, "\n<details><summary>%d generated file(s)</summary>\n\n", len(generated))
+		writeSummaryTable(&b, owner, repo, result, commitSHA, generated)
+		b.WriteString("\n</details>\n")
+	}
+	return b.String()
+}
+
+func writeSummaryTable(b *strings.Builder, owner, repo string, result map[string]string, commitSHA string, paths []string) {
+	b.WriteString("| File | Status |\n")
+	b.WriteString("| --- | --- |\n")
+	for _, path := range paths {
+		status := result[path]
+		name := "`" + path + "`"
+		if commitSHA != "" && (status == "created" || status == "updated" || status == "deleted") {
+			// GitHub anchors each file in a commit view by the SHA-256 of its path.
+			anchor := fmt.Sprintf("%x", sha256.Sum256([]byte(path)))
+			name = fmt.Sprintf("[%s](https://github.com/%s/%s/commit/%s#diff-%s)", name, owner, repo, commitSHA, anchor)
+		}
+		fmt.Fprintf(b, "| %s | %s |\n", name, status)
+	}
+}
+
+func postCommitComment(client *github.Client, owner, repo, sha, body string) error {
+	ctx := context.Background()
+
+	comment, _, err := client.Repositories.CreateComment(ctx, owner, repo, sha, &github.RepositoryComment{
+		Body: github.String(body),
+	})
+	if err != nil {
+		return fmt.Errorf("CreateComment: %w", err)
+	}
+
+	fmt.Println("Summary comment posted:", comment.GetHTMLURL())
+	return nil
+}
+
+func postPullRequestComment(client *github.Client, owner, repo string, number int, body string) error {
+	ctx := context.Background()
+
+	comment, _, err := client.Issues.CreateComment(ctx, owner, repo, number, &github.IssueComment{
+		Body: github.String(body),
+	})
+	if err != nil {
+		return fmt.Errorf("CreateComment: %w", err)
+	}
+
+	fmt.Println("Summary comment posted:", comment.GetHTMLURL())
+	return nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Compare ---
+
+type compareResult struct {
+	Base     string          `json:"base"`
+	Head     string          `json:"head"`
+	Status   string          `json:"status"`
+	AheadBy  int             `json:"ahead_by"`
+	BehindBy int             `json:"behind_by"`
+	Commits  []compareCommit `json:"commits"`
+	Files    []compareFile   `json:"files"`
+}
+
+type compareCommit struct {
+	SHA     string `json:"sha"`
+	Author  string `json:"author"`
+	Message string `json:"message"`
+}
+
+type compareFile struct {
+	Filename         string `json:"filename"`
+	PreviousFilename string `json:"previous_filename,omitempty"`
+	Status           string `json:"status"`
+	Additions        int    `json:"additions"`
+	Deletions        int    `json:"deletions"`
+	Patch            string `json:"patch,omitempty"`
+}
+
+func runCompareCommand(args []string) error {
+	fs := flag.NewFlagSet("compare", flag.ExitOnError)
+	owner, repo := repoFlags(fs)
+	format := fs.String("format", "text", "output format: text or json")
+	patches := fs.Bool("patch", false, "include per-file patches")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: compare [flags] base...head")
+	}
+	base, head, ok := strings.Cut(fs.Arg(0), "...")
+	if !ok {
+		base, head, ok = strings.Cut(fs.Arg(0), "..")
+	}
+	if !ok || base == "" || head == "" {
+		return fmt.Errorf("invalid range %q, expected base...head", fs.Arg(0))
+	}
+
+	client, err := newGitHubClient()
+	if err != nil {
+		return err
+	}
+	result, err := compareRefs(client, *owner, *repo, base, head, *patches)
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(result)
+	}
+	printCompareResult(result)
+	return nil
+}
+
+// compareRefs lists the commits and changed files between base and head.
+// Commits are paginated; GitHub returns at most 300 files.
+func compareRefs(client *github.Client, owner, repo, base, head string, withPatches bool) (*compareResult, error) {
+	ctx := context.Background()
+	opts := &github.ListOptions{PerPage: 100}
+
+	var result *compareResult
+	for {
+		comparison, resp, err := client.Repositories.CompareCommits(ctx, owner, repo, base, head, opts)
+		if err != nil {
+			return nil, fmt.Errorf("CompareCommits: %w", err)
+		}
+
+		if result == nil {
+			result = &compareResult{
+				Base:     base,
+				Head:     head,
+				Status:   comparison.GetStatus(),
+				AheadBy:  comparison.GetAheadBy(),
+				BehindBy: comparison.GetBehindBy(),
+			}
+			for _, f := range comparison.Files {
+				file := compareFile{
+					Filename:         f.GetFilename(),
+					PreviousFilename: f.GetPreviousFilename(),
+					Status:           f.GetStatus(),
+					Additions:        f.GetAdditions(),
+					Deletions:        f.GetDeletions(),
+				}
+				if withPatches {
+					file.Patch = f.GetPatch()
+				}
+				result.Files = append(result.Files, file)
+			}
+		}
+		for _, c := range comparison.Commits {
+			result.Commits = append(result.Commits, compareCommit{
+				SHA:     c.GetSHA(),
+				Author:  c.GetCommit().GetAuthor().GetName(),
+				Message: c.GetCommit().GetMessage(),
+			})
+		}
+
+		if resp.NextPage == 0 {
+			return result, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func printCompareResult(r *compareResult) {
+	fmt.Printf("%s...%s: %s (%d ahead, %d behind)\n", r.Base, r.Head, r.Status, r.AheadBy, r.BehindBy)
+
+	fmt.Printf("\nCommits (%d):\n", len(r.Commits))
+	for _, c := range r.Commits {
+		subject, _, _ := strings.Cut(c.Message, "\n")
+		fmt.Printf("  %s %s (%s)\n", shortSHA(c.SHA), subject, c.Author)
+	}
+
+	fmt.Printf("\nFiles (%d):\n", len(r.Files))
+	for _, f := range r.Files {
+		name := f.Filename
+		if f.PreviousFilename != "" {
+			name = f.PreviousFilename + " → " + f.Filename
+		}
+		fmt.Printf("  %-9s %s (+%d -%d)\n", f.Status, name, f.Additions, f.Deletions)
+		if f.Patch != "" {
+			fmt.Println(f.Patch)
+		}
+	}
+}
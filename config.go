@@ -0,0 +1,475 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+// --- Config File ---
+
+// configCommand is the subcommand that checks config files. It is handled in
+// main rather than through commands, since the sync flags are its schema.
+const configCommand = "config"
+
+// configFilesKey lists the files to sync, like the arguments or the action's
+// files input.
+const configFilesKey = "files"
+
+// A config file is a YAML mapping of flag names, without the dash, to their
+// values: a list for repeatable flags, a scalar otherwise.
+//
+//	branch: main,release/*
+//	pr: true
+//	merge:
+//	  - "*.json"
+//	files: [README.md, .github/CODEOWNERS]
+//
+// A file ending in .toml holds the same settings as TOML, with overrides as
+// tables:
+//
+//	branch = "main,release/*"
+//	pr = true
+//	files = ["README.md", ".github/CODEOWNERS"]
+//
+//	[overrides."acme/api"]
+//	branch = "develop"
+
+// flagConflicts are the pairs of flags that cannot be combined. main checks
+// them once the command line and any config file are applied, and
+// parseConfig within a config file, so that it is rejected with all of its
+// problems at once.
+var flagConflicts = [][2]string{
+	{"orphan", "pr"},
+	{"orphan", "fork"},
+	{"orphan", "group-by"},
+	{"orphan", "land-first"},
+	{"orphan", "land-last"},
+	{"orphan", "protect-external"},
+	{"orphan", "checksums"},
+	{"orphan", "linguist-generated"},
+	{"orphan", "policy"},
+	{"orphan", "encrypt"},
+	{"orphan", "provenance"},
+	{"orphan", "managed-region"},
+	{"orphan", "merge"},
+	{"orphan", "stamp"},
+	{"dest-prefix", "policy"},
+	{"checksums", "group-by"},
+	{"checksums", "land-first"},
+	{"checksums", "land-last"},
+	{"checksums", "managed-region"},
+	{"checksums", "linguist-generated"},
+	{"checksums", "merge"},
+	{"checksums", "stamp"},
+	{"merge-queue", "pr-draft"},
+}
+
+// checkFlagConflicts returns an error for the first pair of flagConflicts
+// that are both set in fs.
+func checkFlagConflicts(fs *flag.FlagSet) error {
+	for _, pair := range flagConflicts {
+		if flagChanged(fs.Lookup(pair[0])) && flagChanged(fs.Lookup(pair[1])) {
+			return fmt.Errorf("-%s cannot be combined with -%s", pair[1], pair[0])
+		}
+	}
+	return nil
+}
+
+// flagChanged reports whether f holds something other than its default.
+func flagChanged(f *flag.Flag) bool {
+	return f != nil && f.Value.String() != f.DefValue
+}
+
+// configProblem is one thing wrong with a config file.
+type configProblem struct {
+	Line int
+	Msg  string
+}
+
+// configError reports every problem found in a config file.
+type configError struct {
+	Path     string
+	Problems []configProblem
+}
+
+func (e *configError) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		lines[i] = fmt.Sprintf("%s:%d: %s", e.Path, p.Line, p.Msg)
+	}
+	noun := "problems"
+	if len(lines) == 1 {
+		noun = "problem"
+	}
+	return fmt.Sprintf("%s has %d %s:\n  %s", e.Path, len(lines), noun, strings.Join(lines, "\n  "))
+}
+
+// configEntry is a flag setting read from a config file.
+type configEntry struct {
+	Flag   *flag.Flag
+	Values []string
+	Line   int
+}
+
+// parseConfig reads the config file at p and checks it against fs: that every
+// key is a flag, that values have the right shape and type, that patterns
+// are valid and that no two settings conflict. Checking types sets the
+// flags, which callers put back with saveFlags. It also returns the files
+// and the per-repository overrides the config lists.
+func parseConfig(fs *flag.FlagSet, p string) ([]configEntry, []string, map[repoTarget]*repoOverride, error) {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	var doc yaml.Node
+	if strings.EqualFold(path.Ext(p), ".toml") {
+		root, err := tomlConfig(data)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%s:%w", p, err)
+		}
+		doc.Content = []*yaml.Node{root}
+	} else if err := yaml.Unmarshal(data, &doc); err != nil {
+		// yaml.v3 puts the line in its message already.
+		return nil, nil, nil, fmt.Errorf("%s: %w", p, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil, nil, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, nil, nil, &configError{Path: p, Problems: []configProblem{{Line: root.Line, Msg: "must be a mapping of flag names to values"}}}
+	}
+
+	var problems []configProblem
+	problem := func(line int, format string, a ...any) {
+		problems = append(problems, configProblem{Line: line, Msg: fmt.Sprintf(format, a...)})
+	}
+	var entries []configEntry
+	var files []string
+	var overrides map[repoTarget]*repoOverride
+	seen := make(map[string]int)
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		name := key.Value
+		if first, dup := seen[name]; dup {
+			problem(key.Line, "%s is already set on line %d", name, first)
+			continue
+		}
+		seen[name] = key.Line
+
+		if name == configOverridesKey {
+			var more []configProblem
+			overrides, more = parseOverrides(value)
+			problems = append(problems, more...)
+			continue
+		}
+		scalars, ok := configValues(value)
+		if !ok {
+			problem(value.Line, "%s must be a scalar or a list of scalars", name)
+			continue
+		}
+		values := make([]string, len(scalars))
+		for i, scalar := range scalars {
+			values[i] = scalar.Value
+		}
+		if name == configFilesKey {
+			files = values
+			continue
+		}
+		f := fs.Lookup(strings.TrimPrefix(name, "-"))
+		if f == nil {
+			msg := fmt.Sprintf("unknown key %s", name)
+			if near := nearestFlag(fs, name); near != "" {
+				msg += fmt.Sprintf("; did you mean %s?", near)
+			}
+			problem(key.Line, "%s", msg)
+			continue
+		}
+		if value.Kind == yaml.SequenceNode && !repeatableFlag(f) {
+			problem(value.Line, "%s takes a single value, not a list", name)
+			continue
+		}
+		bad := false
+		for _, scalar := range scalars {
+			v := scalar.Value
+			if err := f.Value.Set(v); err != nil {
+				problem(scalar.Line, "invalid value %q for %s: %v", v, name, err)
+				bad = true
+			}
+			if strings.Contains(f.Usage, ".gitattributes-style pattern") {
+				if _, err := path.Match(strings.TrimPrefix(v, "**/"), ""); err != nil {
+					problem(scalar.Line, "%s: bad pattern %q", name, v)
+					bad = true
+				}
+			}
+		}
+		if !bad {
+			entries = append(entries, configEntry{Flag: f, Values: values, Line: key.Line})
+		}
+	}
+
+	set := make(map[string]int)
+	for _, e := range entries {
+		if len(e.Values) > 0 && (repeatableFlag(e.Flag) || e.Values[0] != e.Flag.DefValue) {
+			set[e.Flag.Name] = e.Line
+		}
+	}
+	for _, pair := range flagConflicts {
+		if a, ok := set[pair[0]]; ok {
+			if b, ok := set[pair[1]]; ok {
+				problem(max(a, b), "%s cannot be combined with %s (line %d)", pair[1], pair[0], min(a, b))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.SliceStable(problems, func(i, j int) bool { return problems[i].Line < problems[j].Line })
+		return nil, nil, nil, &configError{Path: p, Problems: problems}
+	}
+	return entries, files, overrides, nil
+}
+
+// tomlConfig turns a TOML config into the YAML nodes parseConfig checks,
+// with the line of every key and value, so that both formats are checked and
+// reported alike. Errors start with the line they are on.
+func tomlConfig(data []byte) (*yaml.Node, error) {
+	var p unstable.Parser
+	p.Reset(data)
+	root := &yaml.Node{Kind: yaml.MappingNode, Line: 1}
+	table := root
+	for p.NextExpression() {
+		e := p.Expression()
+		switch e.Kind {
+		case unstable.Table:
+			table = tomlTable(&p, root, tomlKey(e))
+		case unstable.ArrayTable:
+			return nil, fmt.Errorf("%d: arrays of tables are not supported", tomlLine(&p, tomlKey(e)[0], 0))
+		case unstable.KeyValue:
+			tomlKeyValue(&p, table, e)
+		}
+	}
+	if err := p.Error(); err != nil {
+		var perr *unstable.ParserError
+		if errors.As(err, &perr) {
+			return nil, fmt.Errorf("%d: %s", p.Shape(p.Range(perr.Highlight)).Start.Line, perr.Message)
+		}
+		return nil, err
+	}
+	return root, nil
+}
+
+// tomlKey returns the parts of the dotted key of a table or key/value.
+func tomlKey(e *unstable.Node) []*unstable.Node {
+	var parts []*unstable.Node
+	for it := e.Key(); it.Next(); {
+		parts = append(parts, it.Node())
+	}
+	return parts
+}
+
+// tomlTable returns the mapping below table that the key parts name,
+// creating those missing.
+func tomlTable(p *unstable.Parser, table *yaml.Node, parts []*unstable.Node) *yaml.Node {
+	for _, part := range parts {
+		name := string(part.Data)
+		var next *yaml.Node
+		for i := 0; i+1 < len(table.Content); i += 2 {
+			if table.Content[i].Value == name && table.Content[i+1].Kind == yaml.MappingNode {
+				next = table.Content[i+1]
+			}
+		}
+		if next == nil {
+			line := tomlLine(p, part, table.Line)
+			next = &yaml.Node{Kind: yaml.MappingNode, Line: line}
+			table.Content = append(table.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name, Line: line}, next)
+		}
+		table = next
+	}
+	return table
+}
+
+// tomlKeyValue adds the key/value e to table. A key set twice is added
+// twice, for parseConfig to report.
+func tomlKeyValue(p *unstable.Parser, table *yaml.Node, e *unstable.Node) {
+	parts := tomlKey(e)
+	last := parts[len(parts)-1]
+	table = tomlTable(p, table, parts[:len(parts)-1])
+	line := tomlLine(p, last, table.Line)
+	table.Content = append(table.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: string(last.Data), Line: line},
+		tomlValue(p, e.Value(), line))
+}
+
+// tomlValue converts a TOML value; line is where it is when the parser kept
+// no position for it, as for arrays.
+func tomlValue(p *unstable.Parser, v *unstable.Node, line int) *yaml.Node {
+	line = tomlLine(p, v, line)
+	n := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: string(v.Data), Line: line}
+	switch v.Kind {
+	case unstable.Bool:
+		n.Tag = "!!bool"
+	case unstable.Integer:
+		n.Tag = "!!int"
+	case unstable.Float:
+		n.Tag = "!!float"
+	case unstable.Array:
+		n = &yaml.Node{Kind: yaml.SequenceNode, Line: line}
+		for it := v.Children(); it.Next(); {
+			n.Content = append(n.Content, tomlValue(p, it.Node(), line))
+		}
+	case unstable.InlineTable:
+		n = &yaml.Node{Kind: yaml.MappingNode, Line: line}
+		for it := v.Children(); it.Next(); {
+			tomlKeyValue(p, n, it.Node())
+		}
+	}
+	return n
+}
+
+// tomlLine is the line n starts on, or fallback if its position is unknown.
+func tomlLine(p *unstable.Parser, n *unstable.Node, fallback int) int {
+	if n.Raw.Length == 0 {
+		return fallback
+	}
+	return p.Shape(n.Raw).Start.Line
+}
+
+// configValues returns the scalars of a scalar or sequence node.
+func configValues(n *yaml.Node) ([]*yaml.Node, bool) {
+	switch n.Kind {
+	case yaml.ScalarNode:
+		return []*yaml.Node{n}, true
+	case yaml.SequenceNode:
+		for _, item := range n.Content {
+			if item.Kind != yaml.ScalarNode {
+				return nil, false
+			}
+		}
+		return n.Content, true
+	}
+	return nil, false
+}
+
+func repeatableFlag(f *flag.Flag) bool {
+	switch f.Value.(type) {
+	case *stringList, *headerList:
+		return true
+	}
+	return false
+}
+
+// nearestFlag returns the flag name closest to name, if any is close enough
+// to be a typo of it.
+func nearestFlag(fs *flag.FlagSet, name string) string {
+	best, bestDistance := "", 3
+	fs.VisitAll(func(f *flag.Flag) {
+		if d := editDistance(name, f.Name); d < bestDistance {
+			best, bestDistance = f.Name, d
+		}
+	})
+	return best
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// applyConfig sets the flags of fs from the config file at p, except those
+// already set on the command line, which take precedence. It returns the
+// files and the per-repository overrides the config lists.
+func applyConfig(fs *flag.FlagSet, p string) ([]string, map[repoTarget]*repoOverride, error) {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	restore := saveFlags(fs)
+	entries, files, overrides, err := parseConfig(fs, p)
+	restore()
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, e := range entries {
+		if explicit[e.Flag.Name] {
+			continue
+		}
+		for _, v := range e.Values {
+			if err := fs.Set(e.Flag.Name, v); err != nil {
+				return nil, nil, fmt.Errorf("%s:%d: %w", p, e.Line, err)
+			}
+		}
+	}
+	return files, overrides, nil
+}
+
+// saveFlags returns a function that puts the values of fs back to what they
+// are now.
+func saveFlags(fs *flag.FlagSet) func() {
+	var restores []func()
+	fs.VisitAll(func(f *flag.Flag) {
+		switch l := f.Value.(type) {
+		case *stringList:
+			saved := append(stringList(nil), *l...)
+			restores = append(restores, func() { *l = saved })
+		case *headerList:
+			saved := append(headerList(nil), *l...)
+			restores = append(restores, func() { *l = saved })
+		default:
+			saved := f.Value.String()
+			restores = append(restores, func() { f.Value.Set(saved) })
+		}
+	})
+	return func() {
+		for _, restore := range restores {
+			restore()
+		}
+	}
+}
+
+// runConfigCommand runs "config validate FILE...", checking sync configs
+// against the sync flags in fs without talking to GitHub, for linting them
+// in CI.
+func runConfigCommand(fs *flag.FlagSet, args []string) error {
+	if len(args) < 2 || args[0] != "validate" {
+		return errors.New("usage: config validate FILE...")
+	}
+	failed := 0
+	for _, p := range args[1:] {
+		restore := saveFlags(fs)
+		_, _, _, err := parseConfig(fs, p)
+		restore()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			failed++
+			continue
+		}
+		fmt.Printf("%s: ok\n", p)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d config files are invalid", failed, len(args)-1)
+	}
+	return nil
+}
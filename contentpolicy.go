@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Content Policy ---
+
+// What a run does with a change set that violates the content policy.
+const (
+	contentPolicyBlock = "block"
+	contentPolicyPR    = "pr"
+)
+
+// contentPolicy is a set of rules the change set of every branch must pass
+// before anything is committed:
+//
+//	{
+//	  "action": "block",
+//	  "max_file_bytes": 1048576,
+//	  "forbidden": ["*.pem", "secrets/**"],
+//	  "headers": [{"glob": "*.go", "pattern": "^// Copyright \\d{4} Acme"}],
+//	  "required": ["LICENSE*"]
+//	}
+//
+// Patterns are .gitattributes-style. Required patterns must match a file of
+// the change set or of the target branch. With action pr, a violating
+// branch gets a pull request listing the violations instead of a commit.
+type contentPolicy struct {
+	Action       string       `json:"action"`
+	MaxFileBytes int          `json:"max_file_bytes,omitempty"`
+	Forbidden    []string     `json:"forbidden,omitempty"`
+	Headers      []headerRule `json:"headers,omitempty"`
+	Required     []string     `json:"required,omitempty"`
+
+	// headers are the compiled patterns of Headers.
+	headers []*regexp.Regexp
+}
+
+// headerRule requires files matching Glob to start with a match of Pattern.
+type headerRule struct {
+	Glob    string `json:"glob"`
+	Pattern string `json:"pattern"`
+}
+
+// contentViolation is one rule a file, or the change set, breaks.
+type contentViolation struct {
+	Path string
+	Msg  string
+}
+
+func (v contentViolation) String() string {
+	if v.Path == "" {
+		return v.Msg
+	}
+	return v.Path + ": " + v.Msg
+}
+
+// contentPolicyError is returned for a change set that violates the policy.
+type contentPolicyError struct {
+	Violations []contentViolation
+}
+
+func (e *contentPolicyError) Error() string {
+	lines := make([]string, len(e.Violations))
+	for i, v := range e.Violations {
+		lines[i] = v.String()
+	}
+	return fmt.Sprintf("content policy violated, refusing to commit:\n  %s", strings.Join(lines, "\n  "))
+}
+
+func loadContentPolicy(path string) (*contentPolicy, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read content policy: %w", err)
+	}
+	var p contentPolicy
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse content policy: %w", err)
+	}
+	switch p.Action {
+	case "":
+		p.Action = contentPolicyBlock
+	case contentPolicyBlock, contentPolicyPR:
+	default:
+		return nil, fmt.Errorf("content policy action must be %q or %q", contentPolicyBlock, contentPolicyPR)
+	}
+	for _, h := range p.Headers {
+		// Anchored, since a header is what a file starts with.
+		re, err := regexp.Compile(`\A(?:` + h.Pattern + `)`)
+		if err != nil {
+			return nil, fmt.Errorf("content policy header for %s: %w", h.Glob, err)
+		}
+		p.headers = append(p.headers, re)
+	}
+	return &p, nil
+}
+
+// check returns the violations of files, the change set for branch. A nil
+// client checks required files against the change set alone.
+func (p *contentPolicy) check(client *github.Client, owner, repo, branch string, files map[string]string) ([]contentViolation, error) {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var violations []contentViolation
+	for _, path := range paths {
+		content := files[path]
+		if p.MaxFileBytes > 0 && len(content) > p.MaxFileBytes {
+			violations = append(violations, contentViolation{path, fmt.Sprintf("%d bytes, over the limit of %d", len(content), p.MaxFileBytes)})
+		}
+		for _, pattern := range p.Forbidden {
+			if matchAttrPattern(pattern, path) {
+				violations = append(violations, contentViolation{path, "forbidden by " + pattern})
+				break
+			}
+		}
+		for i, h := range p.Headers {
+			if matchAttrPattern(h.Glob, path) && !p.headers[i].MatchString(content) {
+				violations = append(violations, contentViolation{path, "missing the required header for " + h.Glob})
+			}
+		}
+	}
+
+	var missing []string
+	for _, pattern := range p.Required {
+		if !anyPathMatches(pattern, paths) {
+			missing = append(missing, pattern)
+		}
+	}
+	if len(missing) > 0 && client != nil {
+		remote, err := branchPaths(client, owner, repo, branch)
+		if err != nil {
+			return nil, err
+		}
+		kept := missing[:0]
+		for _, pattern := range missing {
+			if !anyPathMatches(pattern, remote) {
+				kept = append(kept, pattern)
+			}
+		}
+		missing = kept
+	}
+	for _, pattern := range missing {
+		violations = append(violations, contentViolation{Msg: "no file matches required " + pattern})
+	}
+	return violations, nil
+}
+
+func anyPathMatches(pattern string, paths []string) bool {
+	for _, p := range paths {
+		if matchAttrPattern(pattern, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// branchPaths lists the files of branch, none for a branch or repository
+// that does not exist yet.
+func branchPaths(client *github.Client, owner, repo, branch string) ([]string, error) {
+	tree, resp, err := client.Git.GetTree(context.Background(), owner, repo, branch, true)
+	if err != nil {
+		if resp != nil && (resp.StatusCode == 404 || resp.StatusCode == 409) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("GetTree: %w", err)
+	}
+	var paths []string
+	for _, entry := range tree.Entries {
+		if entry.GetType() == "blob" {
+			paths = append(paths, entry.GetPath())
+		}
+	}
+	return paths, nil
+}
+
+// formatViolations lists violations for a pull request body.
+func formatViolations(violations []contentViolation) string {
+	var b strings.Builder
+	b.WriteString("\n### Content policy violations\n\n")
+	b.WriteString("This change breaks the content policy, so it needs a review before it lands:\n\n")
+	for _, v := range violations {
+		if v.Path == "" {
+			fmt.Fprintf(&b, "- %s\n", v.Msg)
+		} else {
+			fmt.Fprintf(&b, "- `%s`: %s\n", v.Path, v.Msg)
+		}
+	}
+	return b.String()
+}
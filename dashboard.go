@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Dashboard ---
+
+// dashboardRow is one repository branch on the dashboard.
+type dashboardRow struct {
+	Repo, Branch string
+	LastRun      string
+	Status       string
+	Link         string
+	Commit       string
+	PendingPR    int
+	Drift        string
+}
+
+// dashboardRate is one rate limit resource of the token.
+type dashboardRate struct {
+	Resource         string
+	Remaining, Limit int
+	Reset            string
+	Low              bool
+}
+
+var dashboardPage = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta http-equiv="refresh" content="60"><title>gitapis</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+.failed, .low { background: #fdd; }
+</style>
+</head>
+<body>
+<h1>Sync status</h1>
+<p>{{len .Rows}} repository branches in {{.File}}, as of {{.Now}}</p>
+<table>
+<tr><th>Repository</th><th>Branch</th><th>Last run</th><th>Result</th><th>Last commit</th><th>Pending PR</th><th>Out of sync for</th></tr>
+{{- range .Rows}}
+<tr{{if eq .Status "failed"}} class="failed"{{end}}><td>{{.Repo}}</td><td>{{.Branch}}</td><td>{{.LastRun}} ago</td><td>{{if .Link}}<a href="{{.Link}}">{{.Status}}</a>{{else}}{{.Status}}{{end}}</td><td><code>{{.Commit}}</code></td><td>{{if .PendingPR}}<a href="https://github.com/{{.Repo}}/pull/{{.PendingPR}}">#{{.PendingPR}}</a>{{end}}</td><td>{{.Drift}}</td></tr>
+{{- end}}
+</table>
+<h2>Recent errors</h2>
+{{- if .Errors}}
+<table>
+<tr><th>Time</th><th>Repository</th><th>Branch</th><th>Error</th></tr>
+{{- range .Errors}}
+<tr><td>{{.Time.Format "2006-01-02 15:04"}}</td><td>{{.Repo}}</td><td>{{.Branch}}</td><td>{{.Error}}</td></tr>
+{{- end}}
+</table>
+{{- else}}
+<p>None.</p>
+{{- end}}
+<h2>Rate limits</h2>
+{{- if .RateError}}
+<p>Could not be read: {{.RateError}}</p>
+{{- else}}
+<table>
+<tr><th>Resource</th><th>Remaining</th><th>Resets</th></tr>
+{{- range .Rates}}
+<tr{{if .Low}} class="low"{{end}}><td>{{.Resource}}</td><td>{{.Remaining}} of {{.Limit}}</td><td>{{.Reset}}</td></tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`))
+
+// runDashboardCommand serves a read-only page of the run history: the last
+// result and drift of every repository branch, recent errors, and the rate
+// limits of the token the syncs use. The history is read on each request,
+// so the page follows syncs run from cron, CI or remind -every alike.
+func runDashboardCommand(args []string) error {
+	fs := flag.NewFlagSet("dashboard", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8080", "address to serve the dashboard on")
+	file := fs.String("file", defaultRunsFile, "run history the syncs recorded to")
+	tokenFlags(fs)
+	httpClientFlags(fs)
+	fs.Parse(args)
+
+	// Without a token the page still shows the history, just not the limits.
+	client, err := newGitHubClient()
+	if err != nil {
+		log.Printf("⚠️ No GitHub client, rate limits will not be shown: %v", err)
+		client = nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		serveDashboard(w, client, *file)
+	})
+	mux.HandleFunc("GET /status.json", func(w http.ResponseWriter, r *http.Request) {
+		state, err := loadRunState(*file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(state.Branches)
+	})
+	log.Printf("Serving the dashboard of %s on http://%s/", *file, *addr)
+	server := &http.Server{Addr: *addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	return server.ListenAndServe()
+}
+
+func serveDashboard(w http.ResponseWriter, client *github.Client, file string) {
+	state, err := loadRunState(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	data := struct {
+		File, Now string
+		Rows      []dashboardRow
+		Errors    []runRecord
+		Rates     []dashboardRate
+		RateError string
+	}{File: file, Now: now.Format(time.RFC1123), Errors: state.Errors}
+
+	for _, s := range state.Branches {
+		row := dashboardRow{
+			Repo:      s.Last.Repo,
+			Branch:    s.Last.Branch,
+			LastRun:   formatAge(now.Sub(s.Last.Time)),
+			Status:    s.Last.Status,
+			Link:      s.Last.Link,
+			Commit:    shortSHA(s.Last.Commit),
+			PendingPR: s.PendingPR,
+			Drift:     s.drift(now),
+		}
+		data.Rows = append(data.Rows, row)
+	}
+	sort.Slice(data.Rows, func(i, j int) bool {
+		if data.Rows[i].Repo != data.Rows[j].Repo {
+			return data.Rows[i].Repo < data.Rows[j].Repo
+		}
+		return data.Rows[i].Branch < data.Rows[j].Branch
+	})
+
+	if client == nil {
+		data.RateError = "no token"
+	} else if limits, _, err := client.RateLimits(context.Background()); err != nil {
+		data.RateError = err.Error()
+	} else {
+		for _, l := range []struct {
+			name string
+			rate *github.Rate
+		}{{"core", limits.GetCore()}, {"search", limits.GetSearch()}, {"graphql", limits.GetGraphQL()}} {
+			if l.rate == nil {
+				continue
+			}
+			data.Rates = append(data.Rates, dashboardRate{
+				Resource:  l.name,
+				Remaining: l.rate.Remaining,
+				Limit:     l.rate.Limit,
+				Reset:     l.rate.Reset.Format(time.RFC1123),
+				Low:       l.rate.Remaining < l.rate.Limit/10,
+			})
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardPage.Execute(w, data); err != nil {
+		log.Printf("Failed to render the dashboard: %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Doctor ---
+
+// doctorCheck is one line of the doctor table. A warning is a problem that
+// does not stop a sync by itself, such as a branch that will be created.
+type doctorCheck struct {
+	Name   string
+	Status string
+	Detail string
+}
+
+const (
+	checkPass = "pass"
+	checkWarn = "warn"
+	checkFail = "fail"
+)
+
+// runDoctorCommand checks, before a sync runs, the things that otherwise make
+// it fail one run at a time: the token, its scopes, the repository, the
+// branches, their protection and the rate limit.
+func runDoctorCommand(args []string) error {
+	fs := flag.NewFlagSet("doctor", flag.ExitOnError)
+	owner, repo := repoFlags(fs)
+	var branches stringList
+	fs.Var(&branches, "branch", "branch the sync will commit to; repeatable (default "+defaultBranch+")")
+	fs.Parse(args)
+	if len(branches) == 0 {
+		branches = stringList{defaultBranch}
+	}
+
+	checks := doctorChecks(*owner, *repo, branches)
+	failed := 0
+	fmt.Println("Doctor:")
+	for _, c := range checks {
+		mark := "✅"
+		switch c.Status {
+		case checkWarn:
+			mark = "⚠️"
+		case checkFail:
+			mark = "❌"
+			failed++
+		}
+		fmt.Printf("  %s %-22s %s\n", mark, c.Name, c.Detail)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
+
+// doctorChecks runs the checks in order, skipping those that depend on one
+// that failed.
+func doctorChecks(owner, repo string, branches []string) []doctorCheck {
+	ctx := context.Background()
+	var checks []doctorCheck
+	add := func(name, status, format string, a ...any) {
+		checks = append(checks, doctorCheck{Name: name, Status: status, Detail: fmt.Sprintf(format, a...)})
+	}
+
+	client, err := newGitHubClient()
+	if err != nil {
+		add("token", checkFail, "%v", err)
+		return checks
+	}
+
+	start := time.Now()
+	user, resp, err := client.Users.Get(ctx, "")
+	if resp == nil {
+		add("API reachable", checkFail, "%v", err)
+		return checks
+	}
+	add("API reachable", checkPass, "%s answered in %s", client.BaseURL.Host, time.Since(start).Round(time.Millisecond))
+	if err != nil {
+		// Installation tokens cannot read /user but are otherwise fine.
+		if resp.StatusCode == 401 {
+			add("token", checkFail, "rejected: %v", err)
+			return checks
+		}
+		add("token", checkWarn, "valid, but cannot identify its user (%d)", resp.StatusCode)
+	} else {
+		add("token", checkPass, "authenticated as %s", user.GetLogin())
+	}
+
+	// Fine-grained and app tokens do not report scopes; their permissions
+	// show in the repository check below.
+	if _, ok := resp.Header["X-Oauth-Scopes"]; ok {
+		list := resp.Header.Get("X-OAuth-Scopes")
+		scopes := make(map[string]bool)
+		for _, scope := range strings.Split(list, ",") {
+			scopes[strings.TrimSpace(scope)] = true
+		}
+		switch {
+		case scopes["repo"]:
+			add("token scopes", checkPass, "%s", list)
+		case scopes["public_repo"]:
+			add("token scopes", checkWarn, "%s: only public repositories can be written", list)
+		default:
+			add("token scopes", checkFail, "%q lacks repo or public_repo", list)
+		}
+	}
+
+	if limits, _, err := client.RateLimits(ctx); err != nil {
+		add("rate limit", checkWarn, "could not be read: %v", err)
+	} else {
+		core := limits.GetCore()
+		status := checkPass
+		if core.Remaining < core.Limit/10 {
+			status = checkWarn
+		}
+		if core.Remaining == 0 {
+			status = checkFail
+		}
+		add("rate limit", status, "%d of %d left, resets %s", core.Remaining, core.Limit, core.Reset.Format(time.RFC3339))
+	}
+
+	repository, resp, err := client.Repositories.Get(ctx, owner, repo)
+	if err != nil {
+		if resp != nil && resp.StatusCode == 404 {
+			add("repository", checkFail, "%s/%s does not exist or the token cannot see it", owner, repo)
+		} else {
+			add("repository", checkFail, "%v", err)
+		}
+		return checks
+	}
+	switch {
+	case repository.GetArchived():
+		add("repository", checkFail, "%s is archived and read-only", repository.GetFullName())
+	case !repository.GetPermissions()["push"]:
+		add("repository", checkWarn, "%s exists, but the token cannot push; only -fork works", repository.GetFullName())
+	default:
+		add("repository", checkPass, "%s, default branch %s", repository.GetFullName(), repository.GetDefaultBranch())
+	}
+
+	for _, branch := range branches {
+		checkBranch(ctx, client, owner, repo, branch, repository.GetDefaultBranch(), add)
+	}
+	return checks
+}
+
+func checkBranch(ctx context.Context, client *github.Client, owner, repo, branch, defaultBranch string, add func(name, status, format string, a ...any)) {
+	name := "branch " + branch
+	b, resp, err := client.Repositories.GetBranch(ctx, owner, repo, branch, true)
+	if err != nil {
+		if resp != nil && resp.StatusCode == 404 {
+			add(name, checkWarn, "does not exist; a sync creates it from %s", defaultBranch)
+			return
+		}
+		add(name, checkFail, "%v", err)
+		return
+	}
+	add(name, checkPass, "at %s", shortSHA(b.GetCommit().GetSHA()))
+	if !b.GetProtected() {
+		add(name+" protection", checkPass, "none")
+		return
+	}
+
+	protection, resp, err := client.Repositories.GetBranchProtection(ctx, owner, repo, branch)
+	if err != nil {
+		// Reading protection needs admin rights, which a sync does not.
+		if resp != nil && (resp.StatusCode == 403 || resp.StatusCode == 404) {
+			add(name+" protection", checkWarn, "protected, but the rules cannot be read; a direct push may be refused")
+			return
+		}
+		add(name+" protection", checkFail, "%v", err)
+		return
+	}
+	var rules []string
+	if protection.GetRequiredPullRequestReviews() != nil {
+		rules = append(rules, "pull request reviews (use -pr)")
+	}
+	if protection.GetRequiredStatusChecks() != nil {
+		rules = append(rules, "status checks")
+	}
+	if protection.GetRequiredSignatures().GetEnabled() {
+		rules = append(rules, "signed commits")
+	}
+	if protection.GetRequireLinearHistory().Enabled {
+		rules = append(rules, "linear history")
+	}
+	if len(rules) == 0 {
+		add(name+" protection", checkPass, "protected, no rules that block a sync")
+		return
+	}
+	add(name+" protection", checkWarn, "requires %s", strings.Join(rules, ", "))
+}
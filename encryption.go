@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// --- File Encryption ---
+
+// fileCipher encrypts files before they are committed and decrypts them when
+// they are read back. path is the repository path, for ciphers that choose
+// keys by file name.
+type fileCipher interface {
+	Encrypt(path, plaintext string) (string, error)
+	Decrypt(path, ciphertext string) (string, error)
+}
+
+// encryptionConfig selects which files are committed encrypted. Encryption is
+// randomized, so matching files are compared by decrypting the remote copy;
+// without a way to decrypt, they are re-encrypted on every run.
+type encryptionConfig struct {
+	Globs  []string
+	Cipher fileCipher
+}
+
+func (c *encryptionConfig) matches(path string) bool {
+	if c == nil {
+		return false
+	}
+	for _, glob := range c.Globs {
+		if matchAttrPattern(glob, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// encryptChange returns the status and content to commit for a file that
+// matches the encryption globs. A remote copy that decrypts to content is
+// left alone.
+func (c *encryptionConfig) encryptChange(f forge, head, path, content string, exists bool) (string, string, error) {
+	if exists {
+		if reader, ok := f.(contentReader); ok {
+			remote, err := readRemoteFile(reader, head, path)
+			if err != nil {
+				return "", "", err
+			}
+			plaintext, err := c.Cipher.Decrypt(path, remote)
+			if err == nil && plaintext == content {
+				return "skipped", "", nil
+			}
+			if err != nil {
+				log.Printf("⚠️ Cannot decrypt the remote %s to compare it, encrypting it again: %v", path, err)
+			}
+		}
+	}
+	ciphertext, err := c.Cipher.Encrypt(path, content)
+	if err != nil {
+		return "", "", &fileError{Path: path, Err: fmt.Errorf("encrypting: %w", err)}
+	}
+	if exists {
+		return "updated", ciphertext, nil
+	}
+	return "created", ciphertext, nil
+}
+
+// ageCipher encrypts to age recipients, ASCII-armored so the files diff as
+// text, and decrypts with the identities, if any were given.
+type ageCipher struct {
+	recipients []age.Recipient
+	identities []age.Identity
+}
+
+// newAgeCipher parses recipients, each a public key or @file of them, and
+// the identity file at identityPath, if set.
+func newAgeCipher(recipients []string, identityPath string) (*ageCipher, error) {
+	c := &ageCipher{}
+	for _, value := range recipients {
+		if !strings.HasPrefix(value, "@") {
+			r, err := age.ParseX25519Recipient(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid age recipient %q: %w", value, err)
+			}
+			c.recipients = append(c.recipients, r)
+			continue
+		}
+		b, err := os.ReadFile(value[1:])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read age recipients: %w", err)
+		}
+		parsed, err := age.ParseRecipients(bytes.NewReader(b))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse age recipients %s: %w", value[1:], err)
+		}
+		c.recipients = append(c.recipients, parsed...)
+	}
+	if identityPath != "" {
+		b, err := os.ReadFile(identityPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read age identity: %w", err)
+		}
+		if c.identities, err = age.ParseIdentities(bytes.NewReader(b)); err != nil {
+			return nil, fmt.Errorf("failed to parse age identity %s: %w", identityPath, err)
+		}
+	}
+	return c, nil
+}
+
+func (c *ageCipher) Encrypt(path, plaintext string) (string, error) {
+	if len(c.recipients) == 0 {
+		return "", errors.New("no -age-recipient to encrypt to")
+	}
+	var out bytes.Buffer
+	aw := armor.NewWriter(&out)
+	w, err := age.Encrypt(aw, c.recipients...)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.WriteString(w, plaintext); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+	if err := aw.Close(); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func (c *ageCipher) Decrypt(path, ciphertext string) (string, error) {
+	if len(c.identities) == 0 {
+		return "", errors.New("no -age-identity to decrypt with")
+	}
+	var in io.Reader = strings.NewReader(ciphertext)
+	if strings.HasPrefix(ciphertext, armor.Header) {
+		in = armor.NewReader(in)
+	}
+	r, err := age.Decrypt(in, c.identities...)
+	if err != nil {
+		return "", err
+	}
+	b, err := io.ReadAll(r)
+	return string(b), err
+}
+
+// sopsCipher runs the sops binary, which picks keys from the creation rules
+// in .sops.yaml by file name and reads its own key configuration.
+type sopsCipher struct{}
+
+func (sopsCipher) run(mode, path, input string) (string, error) {
+	cmd := exec.Command("sops", mode, "--filename-override", path, "/dev/stdin")
+	cmd.Stdin = strings.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("sops %s: %w: %s", mode, err, msg)
+		}
+		return "", fmt.Errorf("sops %s: %w", mode, err)
+	}
+	return stdout.String(), nil
+}
+
+func (c sopsCipher) Encrypt(path, plaintext string) (string, error) {
+	return c.run("--encrypt", path, plaintext)
+}
+
+func (c sopsCipher) Decrypt(path, ciphertext string) (string, error) {
+	return c.run("--decrypt", path, ciphertext)
+}
+
+// encryptionFlags registers the encryption flags on fs. The returned function
+// builds the configuration once fs is parsed; it is nil without -encrypt.
+func encryptionFlags(fs *flag.FlagSet) func() (*encryptionConfig, error) {
+	var globs, recipients stringList
+	fs.Var(&globs, "encrypt", "commit files matching this .gitattributes-style pattern encrypted; repeatable")
+	fs.Var(&recipients, "age-recipient", "age public key, or @file of them, to -encrypt to; repeatable")
+	identity := fs.String("age-identity", os.Getenv("SOPS_AGE_KEY_FILE"), "age identity file to decrypt with, used to compare -encrypt files and to pull them")
+	useSOPS := fs.Bool("sops", false, "encrypt with the sops binary and its .sops.yaml rules instead of -age-recipient")
+	return func() (*encryptionConfig, error) {
+		if len(globs) == 0 {
+			if len(recipients) > 0 || *useSOPS {
+				return nil, errors.New("-age-recipient and -sops need -encrypt")
+			}
+			return nil, nil
+		}
+		if *useSOPS {
+			if len(recipients) > 0 {
+				return nil, errors.New("-sops and -age-recipient are mutually exclusive")
+			}
+			return &encryptionConfig{Globs: globs, Cipher: sopsCipher{}}, nil
+		}
+		c, err := newAgeCipher(recipients, *identity)
+		if err != nil {
+			return nil, err
+		}
+		return &encryptionConfig{Globs: globs, Cipher: c}, nil
+	}
+}
+
+// --- Pull ---
+
+// runPullCommand writes the files of a ref to a local directory, decrypting
+// those that match -encrypt.
+func runPullCommand(args []string) error {
+	fs := flag.NewFlagSet("pull", flag.ExitOnError)
+	owner, repo := repoFlags(fs)
+	ref := fs.String("ref", defaultBranch, "branch, tag or commit to pull")
+	prefix := fs.String("prefix", "", "only pull files under this repository directory")
+	dir := fs.String("o", ".", "directory to write the files to")
+	encryption := encryptionFlags(fs)
+	fs.Parse(args)
+
+	enc, err := encryption()
+	if err != nil {
+		return err
+	}
+	client, err := newGitHubClient()
+	if err != nil {
+		return err
+	}
+	f := newGitHubForge(client, *owner, *repo)
+	sha, err := f.ResolveRef(*ref)
+	if err != nil {
+		return err
+	}
+	tree, err := f.Tree(sha)
+	if err != nil {
+		return err
+	}
+
+	base := cleanDestPrefix(*prefix)
+	paths := make([]string, 0, len(tree.Entries))
+	for p, entry := range tree.Entries {
+		if entry.Type == "blob" && entry.Mode != symlinkMode && underPrefix(p, base) {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+
+	decrypted := 0
+	for _, p := range paths {
+		content, err := f.ReadFile(sha, p)
+		if err != nil {
+			return err
+		}
+		if enc.matches(p) {
+			if content, err = enc.Cipher.Decrypt(p, content); err != nil {
+				return fmt.Errorf("decrypting %s: %w", p, err)
+			}
+			decrypted++
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(p, base), "/")
+		local := filepath.Join(*dir, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(local), 0o755); err != nil {
+			return err
+		}
+		mode := os.FileMode(0o644)
+		if tree.Entries[p].Mode == "100755" {
+			mode = 0o755
+		}
+		if err := os.WriteFile(local, []byte(content), mode); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Pulled %d files (%d decrypted) from %s/%s@%s to %s\n", len(paths), decrypted, *owner, *repo, shortSHA(sha), *dir)
+	return nil
+}
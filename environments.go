@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/v55/github"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// --- Deployment Environments ---
+
+// environmentSpec is a deployment environment to set up on each synced
+// repository. Reviewers are user logins or org/team slugs, at most six, as
+// GitHub allows. Branches, when given, are the exact set of branch name
+// patterns that may deploy; ProtectedBranches instead allows the protected
+// branches, and neither allows every branch.
+//
+// Secrets maps each secret name to the environment variable holding its
+// value, so the file can be committed without the values in it.
+type environmentSpec struct {
+	Name              string            `json:"name"`
+	WaitTimer         int               `json:"wait_timer,omitempty"`
+	Reviewers         []string          `json:"reviewers,omitempty"`
+	CanAdminsBypass   *bool             `json:"can_admins_bypass,omitempty"`
+	ProtectedBranches bool              `json:"protected_branches,omitempty"`
+	Branches          []string          `json:"branches,omitempty"`
+	Secrets           map[string]string `json:"secrets,omitempty"`
+
+	// values holds the secrets' values, read when the file is loaded.
+	values map[string]string
+}
+
+// environmentProvisioner provisions environments across a run, looking up
+// each reviewer once however many repositories name them.
+type environmentProvisioner struct {
+	envs []environmentSpec
+
+	mu        sync.Mutex
+	reviewers map[string]*github.EnvReviewers
+}
+
+func loadEnvironments(path string) (*environmentProvisioner, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read environments: %w", err)
+	}
+	var envs []environmentSpec
+	if err := json.Unmarshal(b, &envs); err != nil {
+		return nil, fmt.Errorf("failed to parse environments: %w", err)
+	}
+	seen := make(map[string]bool)
+	for i := range envs {
+		e := &envs[i]
+		if e.Name == "" {
+			return nil, fmt.Errorf("environment %d: missing name", i+1)
+		}
+		if seen[e.Name] {
+			return nil, fmt.Errorf("environment %s is listed twice", e.Name)
+		}
+		seen[e.Name] = true
+		if e.WaitTimer < 0 || e.WaitTimer > 43200 {
+			return nil, fmt.Errorf("environment %s: wait_timer must be between 0 and 43200 minutes", e.Name)
+		}
+		if len(e.Reviewers) > 6 {
+			return nil, fmt.Errorf("environment %s: at most 6 reviewers", e.Name)
+		}
+		if e.ProtectedBranches && len(e.Branches) > 0 {
+			return nil, fmt.Errorf("environment %s: protected_branches and branches are exclusive", e.Name)
+		}
+		e.values = make(map[string]string, len(e.Secrets))
+		for name, variable := range e.Secrets {
+			value, ok := os.LookupEnv(variable)
+			if !ok {
+				return nil, fmt.Errorf("environment %s: secret %s: %s is not set", e.Name, name, variable)
+			}
+			e.values[name] = value
+		}
+	}
+	return &environmentProvisioner{envs: envs, reviewers: make(map[string]*github.EnvReviewers)}, nil
+}
+
+// provision creates or updates every environment on owner/repo, with its
+// branch policies and secrets.
+func (p *environmentProvisioner) provision(client *github.Client, owner, repo string) error {
+	if p == nil {
+		return nil
+	}
+	ctx := context.Background()
+	var repoID int64
+	for _, e := range p.envs {
+		update := &github.CreateUpdateEnvironment{WaitTimer: github.Int(e.WaitTimer), CanAdminsBypass: e.CanAdminsBypass}
+		for _, name := range e.Reviewers {
+			r, err := p.reviewer(client, name)
+			if err != nil {
+				return fmt.Errorf("environment %s: %w", e.Name, err)
+			}
+			update.Reviewers = append(update.Reviewers, r)
+		}
+		if e.ProtectedBranches || len(e.Branches) > 0 {
+			update.DeploymentBranchPolicy = &github.BranchPolicy{
+				ProtectedBranches:    github.Bool(e.ProtectedBranches),
+				CustomBranchPolicies: github.Bool(len(e.Branches) > 0),
+			}
+		}
+		if _, _, err := client.Repositories.CreateUpdateEnvironment(ctx, owner, repo, e.Name, update); err != nil {
+			return fmt.Errorf("CreateUpdateEnvironment %s: %w", e.Name, err)
+		}
+		if len(e.Branches) > 0 {
+			if err := setBranchPolicies(client, owner, repo, e.Name, e.Branches); err != nil {
+				return err
+			}
+		}
+		if len(e.values) > 0 {
+			if repoID == 0 {
+				r, _, err := client.Repositories.Get(ctx, owner, repo)
+				if err != nil {
+					return fmt.Errorf("Get repository: %w", err)
+				}
+				repoID = r.GetID()
+			}
+			if err := setEnvironmentSecrets(client, int(repoID), e.Name, e.values); err != nil {
+				return err
+			}
+		}
+		log.Printf("Provisioned environment %s on %s/%s", e.Name, owner, repo)
+	}
+	return nil
+}
+
+// reviewer resolves a reviewer to the ID the environments API takes: a user
+// login, or an org/team slug.
+func (p *environmentProvisioner) reviewer(client *github.Client, name string) (*github.EnvReviewers, error) {
+	name = strings.TrimPrefix(name, "@")
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if r, ok := p.reviewers[name]; ok {
+		return r, nil
+	}
+	ctx := context.Background()
+	var r *github.EnvReviewers
+	if org, slug, isTeam := strings.Cut(name, "/"); isTeam {
+		team, _, err := client.Teams.GetTeamBySlug(ctx, org, slug)
+		if err != nil {
+			return nil, fmt.Errorf("GetTeam %s: %w", name, err)
+		}
+		r = &github.EnvReviewers{Type: github.String("Team"), ID: team.ID}
+	} else {
+		user, _, err := client.Users.Get(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("GetUser %s: %w", name, err)
+		}
+		r = &github.EnvReviewers{Type: github.String("User"), ID: user.ID}
+	}
+	p.reviewers[name] = r
+	return r, nil
+}
+
+// setBranchPolicies gives environment exactly the branch name patterns in
+// branches.
+func setBranchPolicies(client *github.Client, owner, repo, environment string, branches []string) error {
+	ctx := context.Background()
+	current, _, err := client.Repositories.ListDeploymentBranchPolicies(ctx, owner, repo, environment)
+	if err != nil {
+		return fmt.Errorf("ListDeploymentBranchPolicies %s: %w", environment, err)
+	}
+	want := make(map[string]bool, len(branches))
+	for _, b := range branches {
+		want[b] = true
+	}
+	for _, policy := range current.BranchPolicies {
+		if want[policy.GetName()] {
+			delete(want, policy.GetName())
+			continue
+		}
+		if _, err := client.Repositories.DeleteDeploymentBranchPolicy(ctx, owner, repo, environment, policy.GetID()); err != nil {
+			return fmt.Errorf("DeleteDeploymentBranchPolicy %s: %w", policy.GetName(), err)
+		}
+	}
+	missing := make([]string, 0, len(want))
+	for b := range want {
+		missing = append(missing, b)
+	}
+	sort.Strings(missing)
+	for _, b := range missing {
+		req := &github.DeploymentBranchPolicyRequest{Name: github.String(b)}
+		if _, _, err := client.Repositories.CreateDeploymentBranchPolicy(ctx, owner, repo, environment, req); err != nil {
+			return fmt.Errorf("CreateDeploymentBranchPolicy %s: %w", b, err)
+		}
+	}
+	return nil
+}
+
+// setEnvironmentSecrets writes every secret to environment, sealed with its
+// public key. Secret values cannot be read back to compare, so all of them
+// are written on every run.
+func setEnvironmentSecrets(client *github.Client, repoID int, environment string, values map[string]string) error {
+	ctx := context.Background()
+	key, _, err := client.Actions.GetEnvPublicKey(ctx, repoID, environment)
+	if err != nil {
+		return fmt.Errorf("GetEnvPublicKey %s: %w", environment, err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(key.GetKey())
+	if err != nil || len(raw) != 32 {
+		return fmt.Errorf("environment %s has an invalid public key", environment)
+	}
+	var recipient [32]byte
+	copy(recipient[:], raw)
+	for name, value := range values {
+		sealed, err := box.SealAnonymous(nil, []byte(value), &recipient, rand.Reader)
+		if err != nil {
+			return fmt.Errorf("sealing secret %s: %w", name, err)
+		}
+		secret := &github.EncryptedSecret{Name: name, KeyID: key.GetKeyID(), EncryptedValue: base64.StdEncoding.EncodeToString(sealed)}
+		if _, err := client.Actions.CreateOrUpdateEnvSecret(ctx, repoID, environment, secret); err != nil {
+			return fmt.Errorf("CreateOrUpdateEnvSecret %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Error Explanations ---
+
+// explainedError puts what to do about a GitHub API failure in front of the
+// raw error, which stays reachable through Unwrap.
+type explainedError struct {
+	Hint      string
+	RequestID string
+	Err       error
+}
+
+func (e *explainedError) Error() string {
+	msg := e.Hint + ": " + e.Err.Error()
+	if e.RequestID != "" {
+		msg += " (GitHub request ID " + e.RequestID + ")"
+	}
+	return msg
+}
+
+func (e *explainedError) Unwrap() error { return e.Err }
+
+// explainError translates the common GitHub failures in err into actionable
+// messages. With a client, a missing branch is reported along with the
+// branches that do exist. Errors it does not recognize are returned as-is.
+func explainError(err error, client *github.Client, owner, repo string) error {
+	var explained *explainedError
+	if err == nil || errors.As(err, &explained) {
+		return err
+	}
+
+	var rateErr *github.RateLimitError
+	if errors.As(err, &rateErr) {
+		reset := rateErr.Rate.Reset.Time
+		return &explainedError{
+			Hint:      fmt.Sprintf("rate limit of %d requests exhausted, it resets at %s (in %s)", rateErr.Rate.Limit, reset.Format(time.RFC3339), time.Until(reset).Round(time.Second)),
+			RequestID: requestID(rateErr.Response),
+			Err:       err,
+		}
+	}
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		hint := "secondary rate limit hit; slow down, e.g. with a lower -parallel"
+		if after := abuseErr.GetRetryAfter(); after > 0 {
+			hint += fmt.Sprintf(", and retry in %s", after)
+		}
+		return &explainedError{Hint: hint, RequestID: requestID(abuseErr.Response), Err: err}
+	}
+
+	var apiErr *github.ErrorResponse
+	if !errors.As(err, &apiErr) || apiErr.Response == nil {
+		return err
+	}
+	resp := apiErr.Response
+	path := ""
+	if resp.Request != nil {
+		path = resp.Request.URL.Path
+	}
+	var hint string
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized:
+		hint = "the token was rejected; check that GITHUB_TOKEN, GH_TOKEN or -token-file holds a token that has not expired"
+	case resp.StatusCode == http.StatusNotFound && refBranch(path) != "":
+		branch := refBranch(path)
+		hint = fmt.Sprintf("branch %s not found", branch)
+		if client != nil {
+			if names := branchNames(client, owner, repo); len(names) > 0 {
+				hint += " (available: " + strings.Join(names, ", ") + ")"
+			}
+		}
+	case resp.StatusCode == http.StatusNotFound:
+		hint = "the repository, or what was asked of it, does not exist or the token cannot see it"
+	case resp.StatusCode == http.StatusForbidden && strings.Contains(apiErr.Message, "Resource not accessible"):
+		hint = "the token lacks a permission this needs; grant the app or fine-grained token write access to contents"
+	case resp.StatusCode == http.StatusForbidden:
+		hint = "access denied; the token may lack the repo scope, or a rule forbids this"
+	case resp.StatusCode == http.StatusUnprocessableEntity && strings.Contains(apiErr.Message, "not a fast forward"):
+		hint = "the branch moved while committing; run again to retry on its new head, or use -lock or -pr to avoid the race"
+	case resp.StatusCode == http.StatusConflict && strings.Contains(apiErr.Message, "empty"):
+		hint = "the repository is empty"
+	case resp.StatusCode >= 500:
+		hint = "GitHub had an internal error; retry, and check https://www.githubstatus.com if it persists"
+	default:
+		return err
+	}
+	return &explainedError{Hint: hint, RequestID: requestID(resp), Err: err}
+}
+
+// refBranch returns the branch of a ref or branch API path, or "".
+func refBranch(path string) string {
+	for _, marker := range []string{"/git/ref/heads/", "/git/refs/heads/", "/branches/"} {
+		if _, branch, ok := strings.Cut(path, marker); ok {
+			branch, _, _ = strings.Cut(branch, "/protection")
+			return branch
+		}
+	}
+	return ""
+}
+
+// branchNames lists up to ten of the repository's branches, best-effort.
+func branchNames(client *github.Client, owner, repo string) []string {
+	refs, err := listRefs(client, owner, repo, "heads/")
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(refs))
+	for _, ref := range refs {
+		names = append(names, strings.TrimPrefix(ref.GetRef(), "refs/heads/"))
+	}
+	sort.Strings(names)
+	if len(names) > 10 {
+		names = append(names[:10], fmt.Sprintf("and %d more", len(names)-10))
+	}
+	return names
+}
+
+func requestID(resp *http.Response) string {
+	if resp == nil {
+		return ""
+	}
+	return resp.Header.Get("X-GitHub-Request-Id")
+}
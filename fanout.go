@@ -0,0 +1,262 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Fan-out ---
+
+// repoTarget is one repository of a run.
+type repoTarget struct {
+	Owner string
+	Repo  string
+}
+
+func (t repoTarget) String() string { return t.Owner + "/" + t.Repo }
+
+// repoOutcome is what happened to one repository of a run.
+type repoOutcome struct {
+	Target   repoTarget
+	Branches []branchOutcome
+	// Err is a failure before any branch was synced.
+	Err error
+}
+
+func (o repoOutcome) failed() bool {
+	if o.Err != nil {
+		return true
+	}
+	for _, b := range o.Branches {
+		if b.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// parseTargets reads the -repos value: a comma-separated list of owner/repo,
+// or @file naming a file with one per line. Bare names use defaultOwner.
+func parseTargets(value, defaultOwner string) ([]repoTarget, error) {
+	items := splitList(value)
+	if strings.HasPrefix(value, "@") {
+		f, err := os.Open(value[1:])
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		items = nil
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line != "" && !strings.HasPrefix(line, "#") {
+				items = append(items, line)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	seen := make(map[repoTarget]bool)
+	var targets []repoTarget
+	for _, item := range items {
+		owner, repo, ok := strings.Cut(item, "/")
+		if !ok {
+			owner, repo = defaultOwner, item
+		}
+		if owner == "" || repo == "" || strings.Contains(repo, "/") {
+			return nil, fmt.Errorf("invalid repository %q, expected owner/repo", item)
+		}
+		t := repoTarget{Owner: owner, Repo: repo}
+		if !seen[t] {
+			seen[t] = true
+			targets = append(targets, t)
+		}
+	}
+	return targets, nil
+}
+
+// prepareRepo expands the branch patterns for one repository and prepares
+// every branch, so nothing is pushed unless all of them are valid.
+func prepareRepo(client *github.Client, cfg *syncConfig, owner, repo string, patterns []string, source map[string]string) ([]*preparedBranch, error) {
+	branches, err := expandBranches(client, owner, repo, patterns)
+	if err != nil {
+		return nil, err
+	}
+	if len(branches) == 0 {
+		return nil, fmt.Errorf("no branches to sync")
+	}
+	if cfg.Pages != nil && len(branches) > 1 {
+		return nil, fmt.Errorf("-pages takes a single -branch")
+	}
+	prepared := make([]*preparedBranch, 0, len(branches))
+	for _, branch := range branches {
+		p, err := prepareBranch(client, cfg, owner, repo, branch, source)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", branch, err)
+		}
+		prepared = append(prepared, p)
+	}
+	return prepared, nil
+}
+
+// syncRepo syncs source to every matching branch of one repository, creating
+// the repository, enabling its security features, provisioning its teams and
+// environments and reconciling its settings and rulesets first.
+func syncRepo(client *github.Client, cfg *syncConfig, target repoTarget, patterns []string, source map[string]string) repoOutcome {
+	out := repoOutcome{Target: target}
+	if o := cfg.Overrides[target]; o != nil {
+		cfg, patterns, source = o.apply(cfg, patterns, source)
+	}
+	prepared, err := prepareRepo(client, cfg, target.Owner, target.Repo, patterns, source)
+	if err != nil {
+		out.Err = err
+		return out
+	}
+	if err := createRepo(client, target.Owner, target.Repo); err != nil {
+		cfg.notify(target.Owner, target.Repo, prepared[0].Branch, nil, nil, err)
+		out.Err = fmt.Errorf("failed to create repo: %w", err)
+		return out
+	}
+	if err := cfg.Security.apply(client, target.Owner, target.Repo); err != nil {
+		out.Err = fmt.Errorf("failed to enable security settings: %w", err)
+		return out
+	}
+	if err := cfg.Teams.provision(client, target.Owner, target.Repo); err != nil {
+		out.Err = fmt.Errorf("failed to provision teams: %w", err)
+		return out
+	}
+	if err := cfg.Environments.provision(client, target.Owner, target.Repo); err != nil {
+		out.Err = fmt.Errorf("failed to provision environments: %w", err)
+		return out
+	}
+	if err := cfg.Settings.apply(client, target.Owner, target.Repo); err != nil {
+		out.Err = fmt.Errorf("failed to reconcile repo settings: %w", err)
+		return out
+	}
+	if err := reconcileRulesets(client, target.Owner, target.Repo, cfg.Rulesets); err != nil {
+		out.Err = fmt.Errorf("failed to reconcile rulesets: %w", err)
+		return out
+	}
+
+	// Each branch has its own base and conflict check, so a failure on one
+	// does not stop the others.
+	for _, p := range prepared {
+		b := syncBranch(client, cfg, target.Owner, target.Repo, p)
+		if b.Err != nil {
+			log.Printf("%s@%s: %v", target, p.Branch, b.Err)
+		}
+		out.Branches = append(out.Branches, b)
+	}
+	return out
+}
+
+// fanOut syncs every target with a pool of parallel workers. The workers
+// share the client, and with it the rate budget.
+func fanOut(client *github.Client, cfg *syncConfig, targets []repoTarget, patterns []string, source map[string]string, parallel int) []repoOutcome {
+	if parallel < 1 {
+		parallel = 1
+	}
+	queue := &targetQueue{targets: targets}
+	for i := range targets {
+		queue.pending = append(queue.pending, i)
+	}
+	if sharedApp != nil {
+		queue.ready = sharedApp.ready
+	}
+	outcomes := make([]repoOutcome, len(targets))
+	var wg sync.WaitGroup
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i, ok := queue.next()
+				if !ok {
+					return
+				}
+				outcomes[i] = syncRepo(client, cfg, targets[i], patterns, source)
+				if err := outcomes[i].Err; err != nil {
+					log.Printf("%s: %v", targets[i], err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return outcomes
+}
+
+// targetQueue hands out targets in order. With ready set, as when
+// authenticated as an app, targets whose installation is out of quota are
+// passed over for the others', so that one busy installation holds up only
+// its own repositories.
+type targetQueue struct {
+	mu      sync.Mutex
+	targets []repoTarget
+	pending []int
+	ready   func(owner string) (bool, time.Time)
+}
+
+// next returns the index of the next target to sync, and false once there
+// are none left. When every remaining target waits on a rate limit, it
+// sleeps until the first of them resets.
+func (q *targetQueue) next() (int, bool) {
+	for {
+		q.mu.Lock()
+		if len(q.pending) == 0 {
+			q.mu.Unlock()
+			return 0, false
+		}
+		var wake time.Time
+		for n, i := range q.pending {
+			if q.ready != nil {
+				ok, reset := q.ready(q.targets[i].Owner)
+				if !ok {
+					if wake.IsZero() || reset.Before(wake) {
+						wake = reset
+					}
+					continue
+				}
+			}
+			q.pending = append(q.pending[:n], q.pending[n+1:]...)
+			q.mu.Unlock()
+			return i, true
+		}
+		q.mu.Unlock()
+		pause := time.Until(wake) + time.Second
+		log.Printf("⏸ Every installation left to sync is out of quota; pausing %s", pause.Round(time.Second))
+		time.Sleep(pause)
+	}
+}
+
+// printRepoReport summarizes a run over several repositories, one line each.
+func printRepoReport(outcomes []repoOutcome) {
+	sort.Slice(outcomes, func(i, j int) bool { return outcomes[i].Target.String() < outcomes[j].Target.String() })
+	fmt.Println("Repository Summary:")
+	for _, out := range outcomes {
+		if out.Err != nil {
+			fmt.Printf("  %s → failed: %v\n", out.Target, out.Err)
+			continue
+		}
+		failed := 0
+		for _, b := range out.Branches {
+			if b.Err != nil {
+				failed++
+			}
+		}
+		state := "ok"
+		if failed > 0 {
+			state = fmt.Sprintf("%d of %d branches failed", failed, len(out.Branches))
+		}
+		fmt.Printf("  %s → %s\n", out.Target, state)
+	}
+}
@@ -0,0 +1,760 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Forge Backends ---
+
+const (
+	forgeGitHub    = "github"
+	forgeGitLab    = "gitlab"
+	forgeBitbucket = "bitbucket"
+	forgeGitea     = "gitea"
+	forgeGit       = "git"
+)
+
+// newForge returns the forge for a -forge name other than GitHub, whose
+// forge needs an API client and is made with newGitHubForge.
+func newForge(name, baseURL, owner, repo string) (forge, error) {
+	switch name {
+	case forgeGitLab:
+		return newGitLabForge(baseURL, owner, repo)
+	case forgeBitbucket:
+		return newBitbucketForge(baseURL, owner, repo)
+	case forgeGitea, "forgejo":
+		return newGiteaForge(baseURL, owner, repo)
+	case forgeGit:
+		return newGitForge(baseURL, owner, repo)
+	default:
+		return nil, fmt.Errorf("unknown forge %q", name)
+	}
+}
+
+// forge is the set of hosting operations the upsert is built on, so the same
+// comparison, hook and prune logic can target any platform.
+type forge interface {
+	// Target returns the repository the forge operates on.
+	Target() (owner, repo string)
+	// Repository reports whether the repository has no commits yet, and its
+	// default branch.
+	Repository() (empty bool, defaultBranch string, err error)
+	// BranchHead returns the commit branch points at, or "" if it doesn't
+	// exist.
+	BranchHead(branch string) (string, error)
+	// ResolveRef returns the commit a branch, tag or SHA refers to.
+	ResolveRef(name string) (string, error)
+	// CreateBranch creates branch at the commit sha.
+	CreateBranch(branch, sha string) error
+	// Tree lists every file of the commit sha.
+	Tree(sha string) (*forgeTree, error)
+	// Commit commits changes on top of parent, or as the first commit when
+	// parent is "", and moves branch to it. It returns a nil commit when the
+	// forge only records what it would do, and the commit along with the
+	// error when a check after pushing fails.
+	Commit(branch, parent, message string, changes []fileChange) (*forgeCommit, error)
+}
+
+// contentReader is implemented by forges that can read a file back. Forges
+// whose tree listings carry no blob SHAs need it to compare files at all, and
+// encrypted files are compared by decrypting what it reads.
+type contentReader interface {
+	ReadFile(sha, path string) (string, error)
+}
+
+type forgeTree struct {
+	// SHA is the tree's object ID.
+	SHA     string
+	Entries map[string]treeFile
+	// Truncated means Entries is incomplete.
+	Truncated bool
+}
+
+// treeFile is a tree entry: a blob, or a "commit" for submodules.
+type treeFile struct {
+	SHA  string `json:"sha,omitempty"`
+	Mode string `json:"mode"`
+	Type string `json:"type"`
+}
+
+type fileChange struct {
+	Path    string
+	Content string
+	// Mode is the file mode, kept from the parent for deletions.
+	Mode   string
+	Delete bool
+	// Exists tells create from update for forges that distinguish them.
+	Exists bool
+}
+
+type forgeCommit struct {
+	SHA     string
+	URL     string
+	TreeSHA string
+}
+
+// fileError is a Commit failure caused by one file.
+type fileError struct {
+	Path string
+	Err  error
+	// Status is the file's result status, "error" when empty.
+	Status string
+}
+
+func (e *fileError) Error() string { return fmt.Sprintf("%s: %v", e.Path, e.Err) }
+func (e *fileError) Unwrap() error { return e.Err }
+
+// fileErrors is a Commit failure caused by several files. Returned along with
+// a commit, it names the files the commit was made without.
+type fileErrors []*fileError
+
+func (e fileErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Error()
+	}
+	return fmt.Sprintf("%d files failed: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// What Commit does when a file fails part way through: stop at once, commit
+// the files that succeeded, or try every file and commit none if any failed.
+const (
+	onErrorFailFast        = "fail-fast"
+	onErrorCommitSucceeded = "commit-succeeded"
+	onErrorAllOrNothing    = "all-or-nothing"
+)
+
+var fileErrorPolicy = onErrorFailFast
+
+const fileErrorPolicyUsage = "when a file fails mid-commit: fail-fast, commit-succeeded (commit the rest) or all-or-nothing (try every file, commit none)"
+
+// validFileErrorPolicy reports whether policy is one of the -on-error values.
+func validFileErrorPolicy(policy string) bool {
+	return policy == onErrorFailFast || policy == onErrorCommitSucceeded || policy == onErrorAllOrNothing
+}
+
+func (e *fileError) status() string {
+	if e.Status == "" {
+		return "error"
+	}
+	return e.Status
+}
+
+// markFileErrors marks every file err blames with its status in result.
+func markFileErrors(result map[string]string, err error) {
+	var fe *fileError
+	var fes fileErrors
+	switch {
+	case errors.As(err, &fes):
+		for _, fe := range fes {
+			result[fe.Path] = fe.status()
+		}
+	case errors.As(err, &fe):
+		result[fe.Path] = fe.status()
+	}
+}
+
+// compareFailed is the status of a file whose remote copy could not be read
+// to compare it, so it is left out rather than committed blind.
+const compareFailed = "compare-failed"
+
+// compareRetries is how many times a transient failure to read a remote file
+// is retried before the file is marked compareFailed.
+const compareRetries = 3
+
+// readRemoteFile reads path at head to compare it, retrying transient
+// failures with backoff. A read that still fails is a compareFailed
+// fileError.
+func readRemoteFile(reader contentReader, head, path string) (string, error) {
+	delay := 500 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		content, err := reader.ReadFile(head, path)
+		if err == nil {
+			return content, nil
+		}
+		if attempt == compareRetries || !isTransient(err) {
+			return "", &fileError{Path: path, Err: fmt.Errorf("reading the remote copy: %w", err), Status: compareFailed}
+		}
+		log.Printf("⚠️ Reading %s failed, retrying in %s: %v", path, delay, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// isTransient reports whether err is worth retrying: a server error, a
+// timeout or a dropped connection, but not a missing file or a rate limit.
+func isTransient(err error) bool {
+	var ghErr *github.ErrorResponse
+	if errors.As(err, &ghErr) && ghErr.Response != nil {
+		return ghErr.Response.StatusCode >= 500
+	}
+	var forgeErr *apiError
+	if errors.As(err, &forgeErr) {
+		return forgeErr.StatusCode >= 500 || forgeErr.StatusCode == http.StatusTooManyRequests
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// holdCompareFailure marks the file err blames in result. Unless -on-error is
+// fail-fast, a compareFailed file is added to failures and the run goes on
+// without it; anything else is returned to stop the run.
+func holdCompareFailure(result map[string]string, failures *fileErrors, err error) error {
+	markFileErrors(result, err)
+	if stopsCompare(err) {
+		return err
+	}
+	var fe *fileError
+	errors.As(err, &fe)
+	log.Printf("⚠️ Leaving %s out: %v", fe.Path, fe.Err)
+	*failures = append(*failures, fe)
+	return nil
+}
+
+// stopsCompare reports whether err, from comparing a file, fails the sync
+// rather than leaving the file out.
+func stopsCompare(err error) bool {
+	var fe *fileError
+	return fileErrorPolicy == onErrorFailFast || !errors.As(err, &fe) || fe.Status != compareFailed
+}
+
+// compareParallel bounds how many files are compared with the remote at once.
+var compareParallel = 8
+
+// comparison is the outcome of comparing one file: its status and, unless it
+// is skipped, the content to commit.
+type comparison struct {
+	path, status, content string
+	err                   error
+}
+
+// compareFiles runs compare on every file, parallel at a time, and returns
+// the outcomes sorted by path so that they do not depend on timing. Files
+// are started in path order and none is started once one has failed the
+// sync, so every outcome before the first such failure is complete.
+func compareFiles(files map[string]string, parallel int, compare func(path, content string) (string, string, error)) []comparison {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	outcomes := make([]comparison, len(paths))
+	var stopped atomic.Bool
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(parallel, len(paths)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				path := paths[i]
+				status, content, err := compare(path, files[path])
+				outcomes[i] = comparison{path: path, status: status, content: content, err: err}
+				if err != nil && stopsCompare(err) {
+					stopped.Store(true)
+				}
+			}
+		}()
+	}
+	for i := range paths {
+		if stopped.Load() {
+			break
+		}
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return outcomes
+}
+
+// apiError is a non-2xx response from a forge's REST API.
+type apiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *apiError) Error() string { return fmt.Sprintf("%d %s", e.StatusCode, e.Message) }
+
+// readAPIError returns the apiError for resp, keeping the start of its body.
+func readAPIError(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return &apiError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+}
+
+func isNotFound(err error) bool {
+	var e *apiError
+	return errors.As(err, &e) && e.StatusCode == 404
+}
+
+// upsertFiles commits files to branch through f, creating or updating every
+// file whose content differs and, with opts.Prune, deleting remote files
+// missing locally. It returns the per-file result and the commit made, which
+// is nil when nothing changed.
+func upsertFiles(f forge, branch string, files map[string]string, commitMessage string, opts upsertOptions) (map[string]string, *forgeCommit, error) {
+	owner, repo := f.Target()
+	result := make(map[string]string)
+
+	local := make(map[string]string, len(files))
+	for path, content := range files {
+		local[path] = content
+	}
+	files = local
+	if err := runHooks(&hookContext{Stage: hookPreCompare, Owner: owner, Repo: repo, Branch: branch, Files: files, Result: result}); err != nil {
+		return result, nil, err
+	}
+	if opts.Provenance != nil {
+		// The provenance file is generated below, never synced as-is.
+		delete(files, opts.Provenance.Path)
+	}
+	if opts.Checksums != nil {
+		// Unlike provenance, the manifest only changes with the files, so
+		// it is compared like any other.
+		manifest, err := buildChecksums(opts.Checksums, files)
+		if err != nil {
+			return result, nil, err
+		}
+		files[opts.Checksums.Path] = manifest
+	}
+
+	head, err := f.BranchHead(branch)
+	if err != nil {
+		return result, nil, err
+	}
+	if head == "" {
+		// A missing branch means either an empty repository or just a
+		// missing branch; ask the repository which one it is.
+		empty, defaultBranch, err := f.Repository()
+		if err != nil {
+			return result, nil, err
+		}
+		if empty && opts.Plan != nil {
+			return result, nil, fmt.Errorf("cannot plan against an empty repository")
+		}
+		if empty {
+			log.Println("Repository is empty. Creating initial commit...")
+			return commitInitial(f, branch, files, result, opts)
+		}
+
+		base := opts.Base
+		if base == "" {
+			base = defaultBranch
+		}
+		if head, err = f.ResolveRef(base); err != nil {
+			return result, nil, fmt.Errorf("branch %q does not exist and its base could not be resolved: %w", branch, err)
+		}
+		if opts.Plan != nil {
+			// Planning must not write, so the branch is only created on apply.
+			opts.Plan.NewBranch = true
+		} else {
+			if err := f.CreateBranch(branch, head); err != nil {
+				return result, nil, err
+			}
+			log.Printf("Created branch %s from %s at %s", branch, base, shortSHA(head))
+		}
+	}
+
+	tree, err := f.Tree(head)
+	if err != nil {
+		return result, nil, err
+	}
+
+	replaced, err := resolveTypeMismatches(tree, files, result, opts.ReplaceTypes)
+	if err != nil {
+		return result, nil, err
+	}
+
+	// The state file is kept up to date wherever there is one, so a sync
+	// without protection, which overwrites, reconciles the files it holds.
+	var state *managedState
+	if _, tracked := tree.Entries[managedStatePath]; tracked || opts.Protect != "" {
+		if state, err = readManagedState(f, head, tree); err != nil {
+			return result, nil, err
+		}
+		delete(files, managedStatePath)
+	}
+
+	// Comparing is mostly waiting on reads of remote files, so files are
+	// compared concurrently and the outcomes applied in path order.
+	reader, _ := f.(contentReader)
+	compare := func(path, content string) (string, string, error) {
+		entry, exists := tree.Entries[path]
+		switch {
+		case opts.Encryption.matches(path):
+			return opts.Encryption.encryptChange(f, head, path, content, exists)
+		case opts.Regions.matches(path):
+			return opts.Regions.regionChange(f, head, path, content, exists)
+		case opts.Merge.matches(path):
+			return opts.Merge.mergeChange(f, head, path, content, exists)
+		}
+		if opts.Stamp.matches(path) {
+			data := opts.Stamp.stampData(owner, repo, branch, opts.PrunePrefix, path)
+			status, stamped, err := opts.Stamp.stampChange(f, head, path, content, exists, data)
+			if err != nil || status != "" {
+				return status, stamped, err
+			}
+		}
+		if exists && entry.SHA == "" && reader != nil {
+			remote, err := readRemoteFile(reader, head, path)
+			if err != nil {
+				return "", "", err
+			}
+			entry.SHA = gitBlobSHA(remote)
+		}
+		switch {
+		case exists && entry.Type == "blob" && entry.SHA == gitBlobSHA(content) && (entry.Mode == symlinkMode) == opts.Links[path]:
+			return "skipped", "", nil
+		case exists:
+			return "updated", content, nil
+		case tree.Truncated:
+			return "", "", fmt.Errorf("remote tree is too large to list, cannot compare %s", path)
+		}
+		return "created", content, nil
+	}
+	changes := make(map[string]string)
+	var compareFailures fileErrors
+	for _, c := range compareFiles(files, compareParallel, compare) {
+		if c.err != nil {
+			if err := holdCompareFailure(result, &compareFailures, c.err); err != nil {
+				return result, nil, err
+			}
+			continue
+		}
+		if result[c.path] = c.status; c.status != "skipped" {
+			changes[c.path] = c.content
+		}
+	}
+
+	if len(compareFailures) > 0 && fileErrorPolicy == onErrorAllOrNothing {
+		return result, nil, compareFailures
+	}
+
+	if opts.Protect != "" {
+		// People are meant to edit around managed regions and merged keys.
+		state.holdExternalChanges(tree, changes, result, func(path string) bool {
+			return opts.Regions.matches(path) || opts.Merge.matches(path)
+		})
+	}
+
+	if err := applyPreCommitHooks(owner, repo, branch, changes, result); err != nil {
+		return result, nil, err
+	}
+
+	var entries []fileChange
+	for path, content := range changes {
+		_, exists := tree.Entries[path]
+		entries = append(entries, fileChange{Path: path, Content: content, Mode: opts.fileMode(path), Exists: exists})
+	}
+	for _, path := range replaced {
+		entries = append(entries, fileChange{Path: path, Mode: tree.Entries[path].Mode, Delete: true, Exists: true})
+	}
+
+	if opts.Prune {
+		if tree.Truncated {
+			return result, nil, fmt.Errorf("remote tree is too large to list, refusing to prune")
+		}
+		for path, entry := range tree.Entries {
+			if entry.Type != "blob" || !underPrefix(path, opts.PrunePrefix) {
+				continue
+			}
+			if _, ok := files[path]; ok || result[path] == "deleted" {
+				continue
+			}
+			if opts.Provenance != nil && path == opts.Provenance.Path || state != nil && path == managedStatePath {
+				continue
+			}
+			if opts.Protect != "" && state.modified(path, entry.SHA) {
+				result[path] = externallyModified
+				continue
+			}
+			result[path] = "deleted"
+			entries = append(entries, fileChange{Path: path, Mode: entry.Mode, Delete: true, Exists: true})
+		}
+	}
+
+	if opts.GitKeep {
+		for path, entry := range tree.Entries {
+			if !strings.HasSuffix("/"+path, "/"+gitKeepFile) || result[path] != "" {
+				continue
+			}
+			if _, synced := files[path]; !synced && dirHasSyncedFiles(files, parentDir(path)) {
+				result[path] = "deleted"
+				entries = append(entries, fileChange{Path: path, Mode: entry.Mode, Delete: true, Exists: true})
+			}
+		}
+	}
+
+	if opts.Protect != "" {
+		if err := reportExternalChanges(result, opts.Protect); err != nil {
+			return result, nil, err
+		}
+	}
+	if state != nil {
+		change, changed, err := state.change(tree, files, changes, result)
+		if err != nil {
+			return result, nil, err
+		}
+		if changed {
+			entries = append(entries, change)
+		}
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No changes to commit.")
+		if len(compareFailures) > 0 {
+			return result, nil, compareFailures
+		}
+		return result, nil, nil
+	}
+
+	if !tree.Truncated {
+		remaining := make([]string, 0, len(tree.Entries))
+		for path := range tree.Entries {
+			if _, synced := files[path]; !synced && result[path] != "deleted" {
+				remaining = append(remaining, path)
+			}
+		}
+		paths := make([]string, 0, len(files))
+		for path := range files {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		if collisions := caseCollisions(remaining, paths); len(collisions) > 0 {
+			return result, nil, fmt.Errorf("synced paths differ only by case from remote ones, which breaks checkouts on macOS and Windows: %s",
+				strings.Join(collisions, "; "))
+		}
+	}
+
+	// Added only once there is something to commit, since its timestamp
+	// would otherwise make every run a change.
+	if opts.Provenance != nil {
+		change, err := provenanceChange(opts.Provenance, owner, repo, branch, files, tree, result)
+		if err != nil {
+			return result, nil, err
+		}
+		entries = append(entries, change)
+	}
+
+	if opts.Plan == nil {
+		current, err := f.BranchHead(branch)
+		if err != nil {
+			return result, nil, fmt.Errorf("Recheck: %w", err)
+		}
+		if current != head {
+			return result, nil, fmt.Errorf("Branch was updated during operation (SHA mismatch)")
+		}
+	}
+
+	commit, err := f.Commit(branch, head, commitMessage, entries)
+	markFileErrors(result, err)
+	var skipped fileErrors
+	if commit != nil && errors.As(err, &skipped) {
+		// The commit was made without the failed files; finish it as usual
+		// and report them at the end.
+		err = nil
+	}
+	if err != nil {
+		return result, commit, err
+	}
+	skipped = append(compareFailures, skipped...)
+	if commit == nil {
+		if opts.Plan != nil {
+			opts.Plan.Result = result
+		}
+		return result, nil, nil
+	}
+
+	fmt.Println("Commit created:", commit.URL)
+	if err := runHooks(&hookContext{Stage: hookPostCommit, Owner: owner, Repo: repo, Branch: branch, Files: changes, Result: result, CommitSHA: commit.SHA}); err != nil {
+		return result, commit, err
+	}
+	if len(skipped) > 0 {
+		return result, commit, skipped
+	}
+	return result, commit, nil
+}
+
+// symlinkMode is the tree entry mode of a symbolic link.
+const symlinkMode = "120000"
+
+// fileMode is the tree entry mode path is committed with.
+func (opts upsertOptions) fileMode(path string) string {
+	if opts.Links[path] {
+		return symlinkMode
+	}
+	return "100644"
+}
+
+// typeMismatch is the status of a file whose path is a directory in the
+// remote, or lies under a path that is a file there.
+const typeMismatch = "conflict: type mismatch"
+
+// resolveTypeMismatches finds the remote files in the way of files: those
+// under a path that is synced as a file, and those at a path that is a
+// directory of a synced file. Without replace they fail the sync; with it
+// they are returned for deletion and marked deleted in result.
+func resolveTypeMismatches(tree *forgeTree, files, result map[string]string, replace bool) ([]string, error) {
+	remoteDirs := make(map[string]bool)
+	for path := range tree.Entries {
+		for dir := parentDir(path); dir != ""; dir = parentDir(dir) {
+			remoteDirs[dir] = true
+		}
+	}
+
+	var mismatched, inTheWay []string
+	for path := range files {
+		var blocking []string
+		if remoteDirs[path] {
+			for remote := range tree.Entries {
+				if strings.HasPrefix(remote, path+"/") {
+					blocking = append(blocking, remote)
+				}
+			}
+		}
+		for dir := parentDir(path); dir != ""; dir = parentDir(dir) {
+			if _, ok := tree.Entries[dir]; ok {
+				blocking = append(blocking, dir)
+			}
+		}
+		if len(blocking) > 0 {
+			mismatched = append(mismatched, path)
+			inTheWay = append(inTheWay, blocking...)
+		}
+	}
+	if len(mismatched) == 0 {
+		return nil, nil
+	}
+	sort.Strings(mismatched)
+	if !replace {
+		for _, path := range mismatched {
+			result[path] = typeMismatch
+		}
+		return nil, fmt.Errorf("%d paths are a file on one side and a directory on the other: %s (use -replace-type-mismatch to replace them)",
+			len(mismatched), strings.Join(mismatched, ", "))
+	}
+
+	sort.Strings(inTheWay)
+	var replaced []string
+	for i, path := range inTheWay {
+		if i > 0 && inTheWay[i-1] == path {
+			continue
+		}
+		if _, synced := files[path]; synced {
+			continue
+		}
+		log.Printf("Replacing remote %s, which is in the way of a synced path", path)
+		result[path] = "deleted"
+		replaced = append(replaced, path)
+	}
+	return replaced, nil
+}
+
+// dirHasSyncedFiles reports whether files holds anything below dir other
+// than its own gitKeepFile.
+func dirHasSyncedFiles(files map[string]string, dir string) bool {
+	prefix := ""
+	if dir != "" {
+		prefix = dir + "/"
+	}
+	for path := range files {
+		if strings.HasPrefix(path, prefix) && path != prefix+gitKeepFile {
+			return true
+		}
+	}
+	return false
+}
+
+// parentDir returns the directory of a repository path, or "" at the root.
+func parentDir(path string) string {
+	i := strings.LastIndex(path, "/")
+	if i < 0 {
+		return ""
+	}
+	return path[:i]
+}
+
+// commitInitial makes the first commit of an empty repository and creates
+// branch pointing at it.
+func commitInitial(f forge, branch string, files, result map[string]string, opts upsertOptions) (map[string]string, *forgeCommit, error) {
+	owner, repo := f.Target()
+
+	changes := make(map[string]string, len(files))
+	for path, content := range files {
+		result[path] = "created"
+		changes[path] = content
+		if opts.Encryption.matches(path) {
+			_, ciphertext, err := opts.Encryption.encryptChange(f, "", path, content, false)
+			if err != nil {
+				markFileErrors(result, err)
+				return result, nil, err
+			}
+			changes[path] = ciphertext
+			continue
+		}
+		if opts.Regions.matches(path) {
+			changes[path] = mergeRegion(path, "", content)
+			continue
+		}
+		if opts.Stamp.matches(path) {
+			data := opts.Stamp.stampData(owner, repo, branch, opts.PrunePrefix, path)
+			_, stamped, err := opts.Stamp.stampChange(f, "", path, content, false, data)
+			if err != nil {
+				markFileErrors(result, err)
+				return result, nil, err
+			}
+			changes[path] = stamped
+		}
+	}
+
+	if err := applyPreCommitHooks(owner, repo, branch, changes, result); err != nil {
+		return result, nil, err
+	}
+
+	entries := make([]fileChange, 0, len(changes)+1)
+	for path, content := range changes {
+		entries = append(entries, fileChange{Path: path, Content: content, Mode: opts.fileMode(path)})
+	}
+	if opts.Provenance != nil {
+		change, err := provenanceChange(opts.Provenance, owner, repo, branch, files, &forgeTree{}, result)
+		if err != nil {
+			return result, nil, err
+		}
+		entries = append(entries, change)
+	}
+	if opts.Protect != "" {
+		state := &managedState{Files: map[string]string{}}
+		change, _, err := state.change(&forgeTree{}, files, changes, result)
+		if err != nil {
+			return result, nil, err
+		}
+		entries = append(entries, change)
+	}
+
+	commit, err := f.Commit(branch, "", "Initial commit", entries)
+	markFileErrors(result, err)
+	if err != nil {
+		return result, commit, err
+	}
+
+	log.Println("Initial commit and branch created.")
+	if err := runHooks(&hookContext{Stage: hookPostCommit, Owner: owner, Repo: repo, Branch: branch, Files: changes, Result: result, CommitSHA: commit.SHA}); err != nil {
+		return result, commit, err
+	}
+	return result, commit, nil
+}
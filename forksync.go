@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Fork Sync ---
+
+func runSyncForkCommand(args []string) error {
+	fs := flag.NewFlagSet("sync-fork", flag.ExitOnError)
+	owner, repo := repoFlags(fs)
+	branch := fs.String("branch", defaultBranch, "fork branch to bring up to date")
+	upstreamBranch := fs.String("upstream-branch", "", "upstream branch to sync from (default -branch); forces -method ff")
+	method := fs.String("method", "merge", "merge (GitHub merge-upstream API) or ff (fast-forward the ref only)")
+	fs.Parse(args)
+
+	client, err := newGitHubClient()
+	if err != nil {
+		return err
+	}
+
+	if *method == "merge" && (*upstreamBranch == "" || *upstreamBranch == *branch) {
+		return mergeUpstream(client, *owner, *repo, *branch)
+	}
+	if *method != "merge" && *method != "ff" {
+		return fmt.Errorf("unknown sync method %q", *method)
+	}
+	if *upstreamBranch == "" {
+		*upstreamBranch = *branch
+	}
+	return fastForwardFork(client, *owner, *repo, *branch, *upstreamBranch)
+}
+
+// mergeUpstream asks GitHub to sync the fork branch, which fast-forwards or
+// creates a merge commit as needed.
+func mergeUpstream(client *github.Client, owner, repo, branch string) error {
+	ctx := context.Background()
+
+	result, resp, err := client.Repositories.MergeUpstream(ctx, owner, repo, &github.RepoMergeUpstreamRequest{
+		Branch: github.String(branch),
+	})
+	if err != nil {
+		if resp != nil && resp.StatusCode == 409 {
+			return fmt.Errorf("%s/%s@%s conflicts with upstream, resolve it manually: %w", owner, repo, branch, err)
+		}
+		return fmt.Errorf("MergeUpstream: %w", err)
+	}
+
+	fmt.Printf("✅ %s (%s)\n", result.GetMessage(), result.GetMergeType())
+	return nil
+}
+
+// fastForwardFork moves the fork branch to the head of the upstream branch,
+// refusing if the fork has commits of its own.
+func fastForwardFork(client *github.Client, owner, repo, branch, upstreamBranch string) error {
+	ctx := context.Background()
+
+	fork, _, err := client.Repositories.Get(ctx, owner, repo)
+	if err != nil {
+		return fmt.Errorf("Get repository: %w", err)
+	}
+	parent := fork.GetParent()
+	if parent == nil {
+		return fmt.Errorf("%s/%s is not a fork", owner, repo)
+	}
+
+	upstreamRef, _, err := client.Git.GetRef(ctx, parent.GetOwner().GetLogin(), parent.GetName(), "refs/heads/"+upstreamBranch)
+	if err != nil {
+		return fmt.Errorf("GetRef upstream %s: %w", upstreamBranch, err)
+	}
+	forkRef, _, err := client.Git.GetRef(ctx, owner, repo, "refs/heads/"+branch)
+	if err != nil {
+		return fmt.Errorf("GetRef %s: %w", branch, err)
+	}
+
+	upstreamSHA := upstreamRef.Object.GetSHA()
+	comparison, _, err := client.Repositories.CompareCommits(ctx, owner, repo, forkRef.Object.GetSHA(), upstreamSHA, nil)
+	if err != nil {
+		return fmt.Errorf("CompareCommits: %w", err)
+	}
+
+	switch comparison.GetStatus() {
+	case "identical", "behind":
+		fmt.Printf("✅ %s/%s@%s is already up to date with %s\n", owner, repo, branch, parent.GetFullName())
+		return nil
+	case "diverged":
+		return fmt.Errorf("%s/%s@%s has diverged from %s@%s (%d ahead, %d behind), cannot fast-forward",
+			owner, repo, branch, parent.GetFullName(), upstreamBranch, comparison.GetBehindBy(), comparison.GetAheadBy())
+	}
+
+	forkRef.Object.SHA = github.String(upstreamSHA)
+	if _, _, err := client.Git.UpdateRef(ctx, owner, repo, forkRef, false); err != nil {
+		return fmt.Errorf("UpdateRef: %w", err)
+	}
+	fmt.Printf("✅ Fast-forwarded %s/%s@%s by %d commits to %s\n", owner, repo, branch, comparison.GetAheadBy(), upstreamSHA)
+	return nil
+}
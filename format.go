@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/format"
+	"io"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// --- Formatting ---
+
+// formatCommand formats files matching Glob with Command, which reads the
+// file on stdin and writes it formatted to stdout, like the command step of
+// a transform. The path is in GITAPIS_PATH, for formatters such as
+// prettier --stdin-filepath that pick a parser by name.
+type formatCommand struct {
+	Glob    string
+	Command string
+}
+
+func parseFormatCommand(value string) (formatCommand, error) {
+	glob, command, ok := strings.Cut(value, "=")
+	if !ok || glob == "" || command == "" {
+		return formatCommand{}, fmt.Errorf("invalid -format-command %q, expected pattern=command", value)
+	}
+	return formatCommand{Glob: glob, Command: command}, nil
+}
+
+// formatBuiltin formats Go, JSON and YAML the way their usual checks
+// expect: gofmt, two-space indented JSON, and two-space indented YAML with
+// its comments kept. Other files are returned as they are.
+func formatBuiltin(p, content string) (string, error) {
+	switch strings.ToLower(path.Ext(p)) {
+	case ".go":
+		out, err := format.Source([]byte(content))
+		return string(out), err
+	case ".json":
+		var out bytes.Buffer
+		if err := json.Indent(&out, bytes.TrimSpace([]byte(content)), "", "  "); err != nil {
+			return "", err
+		}
+		out.WriteByte('\n')
+		return out.String(), nil
+	case ".yml", ".yaml":
+		return formatYAML(content)
+	}
+	return content, nil
+}
+
+// formatYAML re-encodes every document of content with two-space indents.
+// Node styles, such as quoting and flow mappings, and comments survive.
+func formatYAML(content string) (string, error) {
+	dec := yaml.NewDecoder(strings.NewReader(content))
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	for {
+		var doc yaml.Node
+		err := dec.Decode(&doc)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		if err := enc.Encode(&doc); err != nil {
+			return "", err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	// An empty file has no documents, and stays empty.
+	if out.Len() == 0 {
+		return content, nil
+	}
+	return out.String(), nil
+}
+
+// formatHook formats the change set before it is compared, so formatted
+// content is what gets compared and committed. With builtin, Go, JSON and
+// YAML files are formatted in-process; commands format the files their
+// patterns match, the first matching command winning over the built-in
+// formatting.
+func formatHook(builtin bool, commands []formatCommand) hookFunc {
+	return func(hc *hookContext) error {
+		paths := make([]string, 0, len(hc.Files))
+		for p := range hc.Files {
+			paths = append(paths, p)
+		}
+		sort.Strings(paths)
+
+		var failed []string
+		for _, p := range paths {
+			content := hc.Files[p]
+			if isBinary(content) {
+				continue
+			}
+			out, err := content, error(nil)
+			if c, ok := matchFormatCommand(commands, p); ok {
+				out, err = applyTransform(transformStep{Type: "command", Command: c.Command}, p, content)
+			} else if builtin {
+				out, err = formatBuiltin(p, content)
+			}
+			if err != nil {
+				failed = append(failed, fmt.Sprintf("%s: %v", p, err))
+				continue
+			}
+			hc.Files[p] = out
+		}
+		if len(failed) > 0 {
+			return fmt.Errorf("failed to format, refusing to commit:\n  %s", strings.Join(failed, "\n  "))
+		}
+		return nil
+	}
+}
+
+func matchFormatCommand(commands []formatCommand, p string) (formatCommand, bool) {
+	for _, c := range commands {
+		if matchAttrPattern(c.Glob, p) {
+			return c, true
+		}
+	}
+	return formatCommand{}, false
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// --- Generated File Attributes ---
+
+// generatedAttributes returns the .gitattributes lines marking the files of
+// the change set that match globs as linguist-generated, so pull request
+// diffs collapse them. The lines go into the managed region of the root
+// .gitattributes, which is rewritten with exactly the current set on every
+// run: files that stop being synced lose their mark.
+func generatedAttributes(files map[string]string, globs []string) string {
+	var paths []string
+	for p := range files {
+		if p == ".gitattributes" {
+			continue
+		}
+		for _, glob := range globs {
+			if matchAttrPattern(glob, p) {
+				paths = append(paths, p)
+				break
+			}
+		}
+	}
+	sort.Strings(paths)
+	var b strings.Builder
+	for _, p := range paths {
+		b.WriteString(attrPathPattern(p))
+		b.WriteString(" linguist-generated=true\n")
+	}
+	return b.String()
+}
+
+// attrPathPattern returns a .gitattributes pattern matching exactly the file
+// p: anchored at the root, with glob characters escaped, and quoted if it
+// has spaces.
+func attrPathPattern(p string) string {
+	var b strings.Builder
+	b.WriteByte('/')
+	for _, r := range p {
+		if strings.ContainsRune(`*?[\`, r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	pattern := b.String()
+	if strings.ContainsAny(pattern, " \t\"") {
+		return strconv.Quote(pattern)
+	}
+	return pattern
+}
+
+// addGeneratedAttributes adds lines to the synced .gitattributes content,
+// inside its managed region if it has one of its own.
+func addGeneratedAttributes(content, lines string) string {
+	if _, _, stop, _, ok := findRegion(content); ok {
+		return content[:stop] + lines + content[stop:]
+	}
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	return content + lines
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- .gitattributes ---
+
+type attrRule struct {
+	// dir is the directory of the .gitattributes file the rule came from.
+	dir     string
+	pattern string
+	attrs   map[string]string
+}
+
+// gitAttributes is a set of parsed .gitattributes files. Attribute values are
+// "set" for plain attributes, "unset" for -attr, "unspecified" for !attr, or
+// the value given as attr=value.
+type gitAttributes struct {
+	rules []attrRule
+}
+
+// add appends the rules of the .gitattributes file in dir. Files must be added
+// from the root down so deeper files take precedence, as in git.
+func (ga *gitAttributes) add(dir, content string) {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		rule := attrRule{dir: dir, pattern: fields[0], attrs: make(map[string]string)}
+		for _, attr := range fields[1:] {
+			switch {
+			case strings.HasPrefix(attr, "-"):
+				rule.attrs[attr[1:]] = "unset"
+			case strings.HasPrefix(attr, "!"):
+				rule.attrs[attr[1:]] = "unspecified"
+			case strings.Contains(attr, "="):
+				k, v, _ := strings.Cut(attr, "=")
+				rule.attrs[k] = v
+			case attr == "binary":
+				// binary is a macro for -diff -merge -text.
+				rule.attrs["binary"] = "set"
+				rule.attrs["diff"] = "unset"
+				rule.attrs["merge"] = "unset"
+				rule.attrs["text"] = "unset"
+			default:
+				rule.attrs[attr] = "set"
+			}
+		}
+		ga.rules = append(ga.rules, rule)
+	}
+}
+
+// lookup returns the value of attr for the repository path p, applying the
+// last matching rule as git does. It returns "" when no rule sets it.
+func (ga *gitAttributes) lookup(p, attr string) string {
+	if ga == nil {
+		return ""
+	}
+	value := ""
+	for _, rule := range ga.rules {
+		v, ok := rule.attrs[attr]
+		if !ok || !underPrefix(p, rule.dir) {
+			continue
+		}
+		rel := p
+		if rule.dir != "" {
+			rel = strings.TrimPrefix(p, rule.dir+"/")
+		}
+		if !matchAttrPattern(rule.pattern, rel) {
+			continue
+		}
+		value = v
+	}
+	if value == "unspecified" {
+		return ""
+	}
+	return value
+}
+
+// matchAttrPattern matches p against a .gitattributes pattern. Patterns
+// without a slash match the base name at any depth; others are anchored at
+// the repository root, with a leading "**/" matching any directory prefix.
+func matchAttrPattern(pattern, p string) bool {
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(p))
+		return ok
+	}
+	pattern = strings.TrimPrefix(pattern, "/")
+	if strings.HasSuffix(pattern, "/**") {
+		return strings.HasPrefix(p, strings.TrimSuffix(pattern, "**"))
+	}
+	if strings.HasPrefix(pattern, "**/") {
+		rest := strings.TrimPrefix(pattern, "**/")
+		segments := strings.Split(p, "/")
+		for i := range segments {
+			if ok, _ := path.Match(rest, strings.Join(segments[i:], "/")); ok {
+				return true
+			}
+		}
+		return false
+	}
+	ok, _ := path.Match(pattern, p)
+	return ok
+}
+
+// loadGitAttributes collects every .gitattributes file on branch, with the
+// versions being synced in files taking their place. A missing repository or
+// branch simply contributes no rules, and a nil client only the synced files.
+func loadGitAttributes(client *github.Client, owner, repo, branch string, files map[string]string) (*gitAttributes, error) {
+	sources := make(map[string]string)
+	if client != nil {
+		if err := readRemoteGitAttributes(client, owner, repo, branch, sources); err != nil {
+			return nil, err
+		}
+	}
+	for p, content := range files {
+		if path.Base(p) == ".gitattributes" {
+			sources[p] = content
+		}
+	}
+
+	paths := make([]string, 0, len(sources))
+	for p := range sources {
+		paths = append(paths, p)
+	}
+	sort.Slice(paths, func(i, j int) bool {
+		di, dj := strings.Count(paths[i], "/"), strings.Count(paths[j], "/")
+		if di != dj {
+			return di < dj
+		}
+		return paths[i] < paths[j]
+	})
+
+	ga := &gitAttributes{}
+	for _, p := range paths {
+		dir := path.Dir(p)
+		if dir == "." {
+			dir = ""
+		}
+		ga.add(dir, sources[p])
+	}
+	return ga, nil
+}
+
+// readRemoteGitAttributes adds the content of every .gitattributes file on
+// branch to sources, keyed by path.
+func readRemoteGitAttributes(client *github.Client, owner, repo, branch string, sources map[string]string) error {
+	ctx := context.Background()
+	tree, resp, err := client.Git.GetTree(ctx, owner, repo, branch, true)
+	if err != nil {
+		if resp != nil && (resp.StatusCode == 404 || resp.StatusCode == 409) {
+			return nil
+		}
+		return fmt.Errorf("GetTree: %w", err)
+	}
+	if tree.GetTruncated() {
+		log.Printf("⚠️ Tree of %s is truncated; nested .gitattributes files may be missed", branch)
+	}
+	for _, entry := range tree.Entries {
+		if entry.GetType() != "blob" || path.Base(entry.GetPath()) != ".gitattributes" {
+			continue
+		}
+		b, _, err := client.Git.GetBlobRaw(ctx, owner, repo, entry.GetSHA())
+		if err != nil {
+			return fmt.Errorf("GetBlobRaw %s: %w", entry.GetPath(), err)
+		}
+		sources[entry.GetPath()] = string(b)
+	}
+	return nil
+}
+
+// isGenerated reports whether linguist-generated is set for p.
+func (ga *gitAttributes) isGenerated(p string) bool {
+	v := ga.lookup(p, "linguist-generated")
+	return v == "set" || v == "true"
+}
+
+// isLFS reports whether p is tracked by Git LFS.
+func (ga *gitAttributes) isLFS(p string) bool {
+	return ga.lookup(p, "filter") == "lfs"
+}
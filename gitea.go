@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// --- Gitea Forge ---
+
+const defaultGiteaURL = "https://gitea.com/api/v1"
+
+// giteaForge implements forge with the Gitea API, which Forgejo and Codeberg
+// share. Its trees mirror GitHub's, and every change is committed in one call
+// to the change-files endpoint.
+type giteaForge struct {
+	baseURL     string
+	token       string
+	owner, repo string
+	http        *http.Client
+	// trees caches listings by commit, since updates and deletions must
+	// name the blob they replace.
+	trees map[string]*forgeTree
+}
+
+// newGiteaForge uses the token in GITEA_TOKEN.
+func newGiteaForge(baseURL, owner, repo string) (*giteaForge, error) {
+	token := os.Getenv("GITEA_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("GITEA_TOKEN environment variable is not set")
+	}
+	if baseURL == "" {
+		baseURL = defaultGiteaURL
+	}
+	return &giteaForge{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		owner:   owner,
+		repo:    repo,
+		http:    newHTTPClient(),
+		trees:   make(map[string]*forgeTree),
+	}, nil
+}
+
+// do sends a request to the repository API and decodes the JSON response
+// into out.
+func (f *giteaForge) do(method, path string, body, out interface{}) error {
+	var payload io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		payload = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, f.baseURL+"/repos/"+url.PathEscape(f.owner)+"/"+url.PathEscape(f.repo)+path, payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "token "+f.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := f.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return readAPIError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (f *giteaForge) Target() (string, string) { return f.owner, f.repo }
+
+func (f *giteaForge) Repository() (bool, string, error) {
+	var repository struct {
+		Empty         bool   `json:"empty"`
+		DefaultBranch string `json:"default_branch"`
+	}
+	if err := f.do("GET", "", nil, &repository); err != nil {
+		return false, "", fmt.Errorf("GetRepository: %w", err)
+	}
+	return repository.Empty, repository.DefaultBranch, nil
+}
+
+func (f *giteaForge) BranchHead(branch string) (string, error) {
+	var b struct {
+		Commit struct {
+			ID string `json:"id"`
+		} `json:"commit"`
+	}
+	err := f.do("GET", "/branches/"+url.PathEscape(branch), nil, &b)
+	if isNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("GetBranch: %w", err)
+	}
+	return b.Commit.ID, nil
+}
+
+func (f *giteaForge) ResolveRef(name string) (string, error) {
+	var commits []struct {
+		SHA string `json:"sha"`
+	}
+	query := url.Values{"sha": {name}, "limit": {"1"}, "stat": {"false"}}
+	if err := f.do("GET", "/commits?"+query.Encode(), nil, &commits); err != nil {
+		return "", fmt.Errorf("ListCommits %s: %w", name, err)
+	}
+	if len(commits) == 0 {
+		return "", fmt.Errorf("cannot resolve %s", name)
+	}
+	return commits[0].SHA, nil
+}
+
+func (f *giteaForge) CreateBranch(branch, sha string) error {
+	body := map[string]string{"new_branch_name": branch, "old_ref_name": sha}
+	if err := f.do("POST", "/branches", body, nil); err != nil {
+		return fmt.Errorf("CreateBranch: %w", err)
+	}
+	return nil
+}
+
+func (f *giteaForge) Tree(sha string) (*forgeTree, error) {
+	if tree, ok := f.trees[sha]; ok {
+		return tree, nil
+	}
+	tree := &forgeTree{Entries: make(map[string]treeFile)}
+	for page := 1; ; page++ {
+		var listing struct {
+			SHA  string `json:"sha"`
+			Tree []struct {
+				Path string `json:"path"`
+				Mode string `json:"mode"`
+				Type string `json:"type"`
+				SHA  string `json:"sha"`
+			} `json:"tree"`
+			Truncated bool `json:"truncated"`
+		}
+		query := url.Values{"recursive": {"true"}, "per_page": {"1000"}, "page": {strconv.Itoa(page)}}
+		if err := f.do("GET", "/git/trees/"+url.PathEscape(sha)+"?"+query.Encode(), nil, &listing); err != nil {
+			return nil, fmt.Errorf("GetTree: %w", err)
+		}
+		tree.SHA = listing.SHA
+		for _, entry := range listing.Tree {
+			if entry.Type != "tree" {
+				tree.Entries[entry.Path] = treeFile{SHA: entry.SHA, Mode: entry.Mode, Type: entry.Type}
+			}
+		}
+		// Gitea pages a large tree rather than cutting it off.
+		if !listing.Truncated {
+			break
+		}
+	}
+	f.trees[sha] = tree
+	return tree, nil
+}
+
+type giteaFileChange struct {
+	Operation string `json:"operation"`
+	Path      string `json:"path"`
+	Content   string `json:"content,omitempty"`
+	SHA       string `json:"sha,omitempty"`
+}
+
+func (f *giteaForge) Commit(branch, parent, message string, changes []fileChange) (*forgeCommit, error) {
+	var base map[string]treeFile
+	if parent != "" {
+		tree, err := f.Tree(parent)
+		if err != nil {
+			return nil, err
+		}
+		base = tree.Entries
+	}
+
+	files := make([]giteaFileChange, 0, len(changes))
+	for _, change := range changes {
+		// The SHA of the replaced blob also makes Gitea reject the change if
+		// the file moved on since the comparison.
+		fc := giteaFileChange{Path: change.Path, SHA: base[change.Path].SHA}
+		switch {
+		case change.Delete:
+			fc.Operation = "delete"
+		case change.Exists:
+			fc.Operation = "update"
+		default:
+			fc.Operation = "create"
+		}
+		if !change.Delete {
+			fc.Content = base64.StdEncoding.EncodeToString([]byte(change.Content))
+		}
+		files = append(files, fc)
+	}
+
+	body := map[string]interface{}{"branch": branch, "message": message, "files": files}
+	var resp struct {
+		Commit struct {
+			SHA     string `json:"sha"`
+			HTMLURL string `json:"html_url"`
+			Tree    struct {
+				SHA string `json:"sha"`
+			} `json:"tree"`
+		} `json:"commit"`
+	}
+	if err := f.do("POST", "/contents", body, &resp); err != nil {
+		return nil, fmt.Errorf("ChangeFiles: %w", err)
+	}
+	return &forgeCommit{SHA: resp.Commit.SHA, URL: resp.Commit.HTMLURL, TreeSHA: resp.Commit.Tree.SHA}, nil
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/storage/memory"
+)
+
+// --- Local Git Forge ---
+
+// gitForge implements forge with plain git instead of a hosting API: a bare
+// in-memory clone of the remote, commits built from its objects, and a push
+// over HTTPS or SSH. It suits hosts whose API is rate limited or restricted.
+type gitForge struct {
+	url         string
+	owner, repo string
+	auth        transport.AuthMethod
+	r           *git.Repository
+}
+
+// newGitForge clones remoteURL, defaulting to the GitHub repository
+// owner/repo over HTTPS.
+func newGitForge(remoteURL, owner, repo string) (*gitForge, error) {
+	if remoteURL == "" {
+		remoteURL = "https://github.com/" + owner + "/" + repo + ".git"
+	}
+	auth, err := gitAuth(remoteURL)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := git.Clone(memory.NewStorage(), nil, &git.CloneOptions{URL: remoteURL, Auth: auth, Tags: git.AllTags})
+	if errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		r, err = git.Init(memory.NewStorage(), nil)
+		if err == nil {
+			_, err = r.CreateRemote(&config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{remoteURL}})
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cloning %s: %w", remoteURL, err)
+	}
+	return &gitForge{url: remoteURL, owner: owner, repo: repo, auth: auth, r: r}, nil
+}
+
+// gitAuth picks credentials for remoteURL: over HTTPS the token in GIT_TOKEN
+// or else the GitHub token, if any; over SSH the key file in GIT_SSH_KEY, or
+// the agent.
+func gitAuth(remoteURL string) (transport.AuthMethod, error) {
+	if strings.HasPrefix(remoteURL, "https://") || strings.HasPrefix(remoteURL, "http://") {
+		token := os.Getenv("GIT_TOKEN")
+		if token == "" {
+			token, _ = githubToken()
+		}
+		if token == "" {
+			return nil, nil
+		}
+		return &githttp.BasicAuth{Username: "x-access-token", Password: token}, nil
+	}
+	if !strings.HasPrefix(remoteURL, "ssh://") && !strings.Contains(remoteURL, "@") {
+		// A local path or file:// URL needs no credentials.
+		return nil, nil
+	}
+	if key := os.Getenv("GIT_SSH_KEY"); key != "" {
+		return gitssh.NewPublicKeysFromFile("git", key, os.Getenv("GIT_SSH_KEY_PASSPHRASE"))
+	}
+	return gitssh.NewSSHAgentAuth("git")
+}
+
+func (f *gitForge) Target() (string, string) { return f.owner, f.repo }
+
+// remoteRefs lists the remote's refs, which is empty for an empty repository.
+func (f *gitForge) remoteRefs() ([]*plumbing.Reference, error) {
+	remote, err := f.r.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := remote.List(&git.ListOptions{Auth: f.auth})
+	if errors.Is(err, transport.ErrEmptyRemoteRepository) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listing %s: %w", f.url, err)
+	}
+	return refs, nil
+}
+
+func (f *gitForge) Repository() (bool, string, error) {
+	refs, err := f.remoteRefs()
+	if err != nil || len(refs) == 0 {
+		return true, "", err
+	}
+	// The clone's HEAD is the remote's default branch.
+	head, err := f.r.Reference(plumbing.HEAD, false)
+	if err != nil {
+		return false, "", err
+	}
+	return false, head.Target().Short(), nil
+}
+
+func (f *gitForge) BranchHead(branch string) (string, error) {
+	refs, err := f.remoteRefs()
+	if err != nil {
+		return "", err
+	}
+	name := plumbing.NewBranchReferenceName(branch)
+	for _, ref := range refs {
+		if ref.Name() == name {
+			return ref.Hash().String(), nil
+		}
+	}
+	return "", nil
+}
+
+func (f *gitForge) ResolveRef(name string) (string, error) {
+	for _, rev := range []string{"refs/remotes/" + git.DefaultRemoteName + "/" + name, name} {
+		if h, err := f.r.ResolveRevision(plumbing.Revision(rev)); err == nil {
+			return h.String(), nil
+		}
+	}
+	return "", fmt.Errorf("cannot resolve %s", name)
+}
+
+func (f *gitForge) CreateBranch(branch, sha string) error {
+	return f.push(branch, plumbing.NewHash(sha))
+}
+
+// push points the local branch at h and pushes it. The push is not forced,
+// so it fails if the remote branch moved anywhere but forward to h.
+func (f *gitForge) push(branch string, h plumbing.Hash) error {
+	name := plumbing.NewBranchReferenceName(branch)
+	if err := f.r.Storer.SetReference(plumbing.NewHashReference(name, h)); err != nil {
+		return err
+	}
+	err := f.r.Push(&git.PushOptions{
+		RemoteName: git.DefaultRemoteName,
+		RefSpecs:   []config.RefSpec{config.RefSpec(name + ":" + name)},
+		Auth:       f.auth,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("pushing %s: %w", branch, err)
+	}
+	return nil
+}
+
+// commit returns the commit sha, fetching first if it is newer than the clone.
+func (f *gitForge) commit(sha string) (*object.Commit, error) {
+	c, err := f.r.CommitObject(plumbing.NewHash(sha))
+	if !errors.Is(err, plumbing.ErrObjectNotFound) {
+		return c, err
+	}
+	err = f.r.Fetch(&git.FetchOptions{
+		RefSpecs: []config.RefSpec{"+refs/heads/*:refs/remotes/origin/*"},
+		Auth:     f.auth,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return nil, fmt.Errorf("fetching %s: %w", f.url, err)
+	}
+	return f.r.CommitObject(plumbing.NewHash(sha))
+}
+
+// files lists every non-directory entry of commit sha by path.
+func (f *gitForge) files(sha string) (map[string]object.TreeEntry, error) {
+	c, err := f.commit(sha)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := c.Tree()
+	if err != nil {
+		return nil, err
+	}
+	walker := object.NewTreeWalker(tree, true, nil)
+	defer walker.Close()
+
+	files := make(map[string]object.TreeEntry)
+	for {
+		name, entry, err := walker.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return files, nil
+			}
+			return nil, err
+		}
+		if entry.Mode != filemode.Dir {
+			files[name] = entry
+		}
+	}
+}
+
+func (f *gitForge) Tree(sha string) (*forgeTree, error) {
+	c, err := f.commit(sha)
+	if err != nil {
+		return nil, err
+	}
+	files, err := f.files(sha)
+	if err != nil {
+		return nil, err
+	}
+	tree := &forgeTree{SHA: c.TreeHash.String(), Entries: make(map[string]treeFile, len(files))}
+	for p, entry := range files {
+		typ := "blob"
+		if entry.Mode == filemode.Submodule {
+			typ = "commit"
+		}
+		tree.Entries[p] = treeFile{SHA: entry.Hash.String(), Mode: fmt.Sprintf("%o", uint32(entry.Mode)), Type: typ}
+	}
+	return tree, nil
+}
+
+// ReadFile returns the content of p in commit sha.
+func (f *gitForge) ReadFile(sha, p string) (string, error) {
+	files, err := f.files(sha)
+	if err != nil {
+		return "", err
+	}
+	entry, ok := files[p]
+	if !ok {
+		return "", fmt.Errorf("%s not found in %s", p, shortSHA(sha))
+	}
+	blob, err := f.r.BlobObject(entry.Hash)
+	if err != nil {
+		return "", err
+	}
+	r, err := blob.Reader()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	return string(b), err
+}
+
+func (f *gitForge) Commit(branch, parent, message string, changes []fileChange) (*forgeCommit, error) {
+	files := make(map[string]object.TreeEntry)
+	var parents []plumbing.Hash
+	if parent != "" {
+		var err error
+		if files, err = f.files(parent); err != nil {
+			return nil, err
+		}
+		parents = []plumbing.Hash{plumbing.NewHash(parent)}
+	}
+
+	for _, change := range changes {
+		if change.Delete {
+			delete(files, change.Path)
+			continue
+		}
+		mode, err := filemode.New(change.Mode)
+		if err != nil {
+			return nil, &fileError{Path: change.Path, Err: err}
+		}
+		h, err := f.writeBlob(change.Content)
+		if err != nil {
+			return nil, &fileError{Path: change.Path, Err: err}
+		}
+		files[change.Path] = object.TreeEntry{Mode: mode, Hash: h}
+	}
+
+	treeHash, err := f.writeTree(files)
+	if err != nil {
+		return nil, err
+	}
+	sig := gitSignature()
+	commit := &object.Commit{Author: sig, Committer: sig, Message: message, TreeHash: treeHash, ParentHashes: parents}
+	obj := f.r.Storer.NewEncodedObject()
+	if err := commit.Encode(obj); err != nil {
+		return nil, err
+	}
+	h, err := f.r.Storer.SetEncodedObject(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := f.push(branch, h); err != nil {
+		return nil, err
+	}
+	made := &forgeCommit{SHA: h.String(), TreeSHA: treeHash.String()}
+	if strings.HasPrefix(f.url, "https://") {
+		made.URL = strings.TrimSuffix(f.url, ".git") + "/commit/" + made.SHA
+	}
+	return made, nil
+}
+
+func (f *gitForge) writeBlob(content string) (plumbing.Hash, error) {
+	obj := f.r.Storer.NewEncodedObject()
+	obj.SetType(plumbing.BlobObject)
+	w, err := obj.Writer()
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if _, err := w.Write([]byte(content)); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	if err := w.Close(); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return f.r.Storer.SetEncodedObject(obj)
+}
+
+// writeTree stores the tree of files, keyed by path relative to it, along
+// with every subtree.
+func (f *gitForge) writeTree(files map[string]object.TreeEntry) (plumbing.Hash, error) {
+	tree := &object.Tree{}
+	dirs := make(map[string]map[string]object.TreeEntry)
+	for p, entry := range files {
+		dir, rest, nested := strings.Cut(p, "/")
+		if !nested {
+			entry.Name = p
+			tree.Entries = append(tree.Entries, entry)
+			continue
+		}
+		if dirs[dir] == nil {
+			dirs[dir] = make(map[string]object.TreeEntry)
+		}
+		dirs[dir][rest] = entry
+	}
+	for dir, sub := range dirs {
+		h, err := f.writeTree(sub)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		tree.Entries = append(tree.Entries, object.TreeEntry{Name: dir, Mode: filemode.Dir, Hash: h})
+	}
+
+	// Git orders entries by name, comparing directories as if they ended
+	// in a slash.
+	key := func(e object.TreeEntry) string {
+		if e.Mode == filemode.Dir {
+			return e.Name + "/"
+		}
+		return e.Name
+	}
+	sort.Slice(tree.Entries, func(i, j int) bool { return key(tree.Entries[i]) < key(tree.Entries[j]) })
+
+	obj := f.r.Storer.NewEncodedObject()
+	if err := tree.Encode(obj); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return f.r.Storer.SetEncodedObject(obj)
+}
+
+// gitSignature is the author of commits made by gitForge: GIT_AUTHOR_NAME and
+// GIT_AUTHOR_EMAIL, else the user's git config.
+func gitSignature() object.Signature {
+	sig := object.Signature{Name: os.Getenv("GIT_AUTHOR_NAME"), Email: os.Getenv("GIT_AUTHOR_EMAIL"), When: time.Now()}
+	if sig.Name == "" || sig.Email == "" {
+		if cfg, err := config.LoadConfig(config.GlobalScope); err == nil {
+			if sig.Name == "" {
+				sig.Name = cfg.User.Name
+			}
+			if sig.Email == "" {
+				sig.Email = cfg.User.Email
+			}
+		}
+	}
+	if sig.Name == "" {
+		sig.Name = "gitapis"
+	}
+	return sig
+}
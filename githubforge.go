@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"sync"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- GitHub Forge ---
+
+// githubForge implements forge with the Git Data API: blobs, a tree on top of
+// the parent's, a commit and a ref update.
+type githubForge struct {
+	client      *github.Client
+	owner, repo string
+	// trees caches listings by commit, which also seeds blob reuse. Files
+	// are read concurrently while comparing, so it is guarded by mu.
+	mu    sync.Mutex
+	trees map[string]*github.Tree
+	// plan, when set, records the commit instead of making it.
+	plan *syncPlan
+	// verify is the verifyCommit level for each commit made.
+	verify string
+}
+
+func newGitHubForge(client *github.Client, owner, repo string) *githubForge {
+	return &githubForge{client: client, owner: owner, repo: repo, trees: make(map[string]*github.Tree)}
+}
+
+func (f *githubForge) Target() (string, string) { return f.owner, f.repo }
+
+func (f *githubForge) Repository() (bool, string, error) {
+	empty, repository, err := repositoryIsEmpty(f.client, f.owner, f.repo)
+	return empty, repository.GetDefaultBranch(), err
+}
+
+func (f *githubForge) BranchHead(branch string) (string, error) {
+	return branchHead(f.client, f.owner, f.repo, branch)
+}
+
+func (f *githubForge) ResolveRef(name string) (string, error) {
+	return resolveRef(f.client, f.owner, f.repo, name)
+}
+
+func (f *githubForge) CreateBranch(branch, sha string) error {
+	_, _, err := f.client.Git.CreateRef(context.Background(), f.owner, f.repo, &github.Reference{
+		Ref:    github.String("refs/heads/" + branch),
+		Object: &github.GitObject{SHA: github.String(sha)},
+	})
+	if err != nil {
+		return fmt.Errorf("CreateRef: %w", err)
+	}
+	return nil
+}
+
+func (f *githubForge) Tree(sha string) (*forgeTree, error) {
+	tree, err := f.tree(sha)
+	if err != nil {
+		return nil, err
+	}
+	out := &forgeTree{SHA: tree.GetSHA(), Entries: make(map[string]treeFile, len(tree.Entries)), Truncated: tree.GetTruncated()}
+	for _, entry := range tree.Entries {
+		if entry.GetType() == "tree" {
+			continue
+		}
+		out.Entries[entry.GetPath()] = treeFile{SHA: entry.GetSHA(), Mode: entry.GetMode(), Type: entry.GetType()}
+	}
+	return out, nil
+}
+
+// tree returns the recursive listing of commit sha. When GitHub truncates it,
+// the tree is listed again one directory at a time.
+func (f *githubForge) tree(sha string) (*github.Tree, error) {
+	f.mu.Lock()
+	tree, ok := f.trees[sha]
+	f.mu.Unlock()
+	if ok {
+		return tree, nil
+	}
+	if tree := loadCachedTree(f.owner, f.repo, sha); tree != nil {
+		f.cacheTree(sha, tree)
+		return tree, nil
+	}
+	ctx := context.Background()
+	commit, _, err := f.client.Git.GetCommit(ctx, f.owner, f.repo, sha)
+	if err != nil {
+		return nil, fmt.Errorf("GetCommit: %w", err)
+	}
+	tree, _, err = f.client.Git.GetTree(ctx, f.owner, f.repo, commit.Tree.GetSHA(), true)
+	if err != nil {
+		return nil, fmt.Errorf("GetTree: %w", err)
+	}
+	if tree.GetTruncated() {
+		entries, err := f.walkTree(commit.Tree.GetSHA(), "")
+		if err != nil {
+			return nil, err
+		}
+		tree = &github.Tree{SHA: tree.SHA, Entries: entries, Truncated: github.Bool(false)}
+	}
+	f.cacheTree(sha, tree)
+	storeCachedTree(f.owner, f.repo, sha, tree)
+	return tree, nil
+}
+
+func (f *githubForge) cacheTree(sha string, tree *github.Tree) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.trees[sha] = tree
+}
+
+func (f *githubForge) walkTree(treeSHA, dir string) ([]*github.TreeEntry, error) {
+	tree, _, err := f.client.Git.GetTree(context.Background(), f.owner, f.repo, treeSHA, false)
+	if err != nil {
+		return nil, fmt.Errorf("GetTree %s: %w", dir, err)
+	}
+	var entries []*github.TreeEntry
+	for _, entry := range tree.Entries {
+		entry.Path = github.String(path.Join(dir, entry.GetPath()))
+		entries = append(entries, entry)
+		if entry.GetType() != "tree" {
+			continue
+		}
+		sub, err := f.walkTree(entry.GetSHA(), entry.GetPath())
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, sub...)
+	}
+	return entries, nil
+}
+
+// ReadFile returns the content of path in commit sha.
+func (f *githubForge) ReadFile(sha, p string) (string, error) {
+	tree, err := f.tree(sha)
+	if err != nil {
+		return "", err
+	}
+	for _, entry := range tree.Entries {
+		if entry.GetPath() != p {
+			continue
+		}
+		b, _, err := f.client.Git.GetBlobRaw(context.Background(), f.owner, f.repo, entry.GetSHA())
+		if err != nil {
+			return "", fmt.Errorf("GetBlobRaw %s: %w", p, err)
+		}
+		return string(b), nil
+	}
+	return "", fmt.Errorf("%s not found in %s", p, shortSHA(sha))
+}
+
+func (f *githubForge) Commit(branch, parent, message string, changes []fileChange) (*forgeCommit, error) {
+	ctx := context.Background()
+
+	baseTree := ""
+	var baseEntries []*github.TreeEntry
+	if parent != "" {
+		tree, err := f.tree(parent)
+		if err != nil {
+			return nil, err
+		}
+		baseTree, baseEntries = tree.GetSHA(), tree.Entries
+	}
+
+	blobs := newBlobUploader(f.client, f.owner, f.repo, baseEntries)
+	if f.plan != nil {
+		blobs.deferred = make(map[string]string)
+	}
+	var entries []*github.TreeEntry
+	var failed fileErrors
+	for _, change := range changes {
+		entry := &github.TreeEntry{Path: github.String(change.Path), Mode: github.String(change.Mode), Type: github.String("blob")}
+		if !change.Delete {
+			sha, err := blobs.upload(change.Content)
+			if err != nil {
+				fe := &fileError{Path: change.Path, Err: fmt.Errorf("CreateBlob: %w", err)}
+				if fileErrorPolicy == onErrorFailFast {
+					return nil, fe
+				}
+				log.Printf("⚠️ %v", fe)
+				failed = append(failed, fe)
+				continue
+			}
+			entry.SHA = github.String(sha)
+		}
+		entries = append(entries, entry)
+	}
+	blobs.logStats()
+	if len(failed) > 0 && (fileErrorPolicy == onErrorAllOrNothing || len(entries) == 0) {
+		return nil, failed
+	}
+
+	if f.plan != nil {
+		f.plan.fill(f.owner, f.repo, branch, parent, baseTree, message, entries, blobs.deferred)
+		return nil, nil
+	}
+
+	tree, err := createTree(f.client, f.owner, f.repo, baseTree, entries)
+	if err != nil {
+		return nil, fmt.Errorf("CreateTree: %w", err)
+	}
+	newCommit := &github.Commit{Message: github.String(message), Tree: tree}
+	if parent != "" {
+		newCommit.Parents = []*github.Commit{{SHA: github.String(parent)}}
+	}
+	commit, _, err := f.client.Git.CreateCommit(ctx, f.owner, f.repo, newCommit)
+	if err != nil {
+		return nil, fmt.Errorf("CreateCommit: %w", err)
+	}
+
+	ref := &github.Reference{Ref: github.String("refs/heads/" + branch), Object: &github.GitObject{SHA: commit.SHA}}
+	if parent == "" {
+		_, _, err = f.client.Git.CreateRef(ctx, f.owner, f.repo, ref)
+	} else {
+		_, _, err = f.client.Git.UpdateRef(ctx, f.owner, f.repo, ref, false)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("updating %s: %w", branch, err)
+	}
+
+	if parent != "" {
+		// The branch has moved on from parent, and the next run compares
+		// against the new commit, whose listing follows from the changes.
+		invalidateCachedTree(f.owner, f.repo, parent)
+		listing := newTreeListing(tree.GetSHA(), baseEntries, entries)
+		f.cacheTree(commit.GetSHA(), listing)
+		storeCachedTree(f.owner, f.repo, commit.GetSHA(), listing)
+	}
+
+	made := &forgeCommit{SHA: commit.GetSHA(), URL: commit.GetHTMLURL(), TreeSHA: tree.GetSHA()}
+	if err := verifyCommit(f.client, f.owner, f.repo, branch, commit, f.verify); err != nil {
+		return made, err
+	}
+	if len(failed) > 0 {
+		return made, failed
+	}
+	return made, nil
+}
+
+// newTreeListing derives the file listing of a new tree from its base's and
+// the entries applied to it. Directory entries are left out, as their SHAs are
+// not known without listing the tree.
+func newTreeListing(sha string, base, changes []*github.TreeEntry) *github.Tree {
+	files := make(map[string]*github.TreeEntry, len(base))
+	for _, entry := range base {
+		if entry.GetType() != "tree" {
+			files[entry.GetPath()] = entry
+		}
+	}
+	for _, entry := range changes {
+		if entry.SHA == nil {
+			delete(files, entry.GetPath())
+		} else {
+			files[entry.GetPath()] = entry
+		}
+	}
+	listing := &github.Tree{SHA: github.String(sha), Truncated: github.Bool(false)}
+	for _, entry := range files {
+		listing.Entries = append(listing.Entries, entry)
+	}
+	return listing
+}
+
+// gitHubCommit adapts a forge commit for the GitHub-only steps after it.
+func gitHubCommit(c *forgeCommit) *github.Commit {
+	if c == nil {
+		return nil
+	}
+	return &github.Commit{SHA: github.String(c.SHA), HTMLURL: github.String(c.URL), Tree: &github.Tree{SHA: github.String(c.TreeSHA)}}
+}
+
+// maxTreeBytes caps the estimated size of one CreateTree request; larger
+// entry sets are split into a chain of trees, each on top of the previous.
+// GitHub answers very large tree requests with 502s.
+var maxTreeBytes = 512 << 10
+
+// treeEntryBytes estimates the JSON size of entry in a CreateTree request.
+func treeEntryBytes(entry *github.TreeEntry) int {
+	const overhead = 48 // keys, quotes and punctuation
+	return overhead + len(entry.GetPath()) + len(entry.GetMode()) + len(entry.GetType()) + len(entry.GetSHA()) + len(entry.GetContent())
+}
+
+// createTree is CreateTree in batches of at most maxTreeBytes. Since each
+// batch is applied on top of the tree from the batch before, the result is
+// the same tree a single request would make.
+func createTree(client *github.Client, owner, repo, baseTree string, entries []*github.TreeEntry) (*github.Tree, error) {
+	ctx := context.Background()
+	var tree *github.Tree
+	for start := 0; start < len(entries) || tree == nil; {
+		end, size := start, 0
+		for end < len(entries) && (end == start || size+treeEntryBytes(entries[end]) <= maxTreeBytes) {
+			size += treeEntryBytes(entries[end])
+			end++
+		}
+		var err error
+		if tree, _, err = client.Git.CreateTree(ctx, owner, repo, baseTree, entries[start:end]); err != nil {
+			return nil, err
+		}
+		if end < len(entries) {
+			log.Printf("Created tree batch of %d entries (%d bytes)", end-start, size)
+		}
+		baseTree, start = tree.GetSHA(), end
+	}
+	return tree, nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// --- GitLab Forge ---
+
+const defaultGitLabURL = "https://gitlab.com/api/v4"
+
+// gitlabForge implements forge with the GitLab REST API, committing every
+// change in one call to the Commits API.
+type gitlabForge struct {
+	baseURL     string
+	token       string
+	owner, repo string
+	http        *http.Client
+}
+
+// newGitLabForge targets the project owner/repo, where owner may be a nested
+// group path, using the token in GITLAB_TOKEN.
+func newGitLabForge(baseURL, owner, repo string) (*gitlabForge, error) {
+	token := os.Getenv("GITLAB_TOKEN")
+	if token == "" {
+		return nil, fmt.Errorf("GITLAB_TOKEN environment variable is not set")
+	}
+	if baseURL == "" {
+		baseURL = defaultGitLabURL
+	}
+	return &gitlabForge{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		token:   token,
+		owner:   owner,
+		repo:    repo,
+		http:    newHTTPClient(),
+	}, nil
+}
+
+func (f *gitlabForge) projectURL(path string) string {
+	return f.baseURL + "/projects/" + url.PathEscape(f.owner+"/"+f.repo) + path
+}
+
+// do sends a request to the project API and decodes the JSON response into
+// out, returning the response headers for pagination.
+func (f *gitlabForge) do(method, path string, body, out interface{}) (http.Header, error) {
+	var payload io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		payload = bytes.NewReader(b)
+	}
+	req, err := http.NewRequest(method, f.projectURL(path), payload)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("PRIVATE-TOKEN", f.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := f.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return resp.Header, readAPIError(resp)
+	}
+	if out == nil {
+		return resp.Header, nil
+	}
+	return resp.Header, json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (f *gitlabForge) Target() (string, string) { return f.owner, f.repo }
+
+func (f *gitlabForge) Repository() (bool, string, error) {
+	var project struct {
+		EmptyRepo     bool   `json:"empty_repo"`
+		DefaultBranch string `json:"default_branch"`
+	}
+	if _, err := f.do("GET", "", nil, &project); err != nil {
+		return false, "", fmt.Errorf("GetProject: %w", err)
+	}
+	return project.EmptyRepo, project.DefaultBranch, nil
+}
+
+func (f *gitlabForge) BranchHead(branch string) (string, error) {
+	var b struct {
+		Commit struct {
+			ID string `json:"id"`
+		} `json:"commit"`
+	}
+	_, err := f.do("GET", "/repository/branches/"+url.PathEscape(branch), nil, &b)
+	if isNotFound(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("GetBranch: %w", err)
+	}
+	return b.Commit.ID, nil
+}
+
+func (f *gitlabForge) ResolveRef(name string) (string, error) {
+	var commit struct {
+		ID string `json:"id"`
+	}
+	if _, err := f.do("GET", "/repository/commits/"+url.PathEscape(name), nil, &commit); err != nil {
+		return "", fmt.Errorf("GetCommit %s: %w", name, err)
+	}
+	return commit.ID, nil
+}
+
+func (f *gitlabForge) CreateBranch(branch, sha string) error {
+	query := url.Values{"branch": {branch}, "ref": {sha}}
+	if _, err := f.do("POST", "/repository/branches?"+query.Encode(), nil, nil); err != nil {
+		return fmt.Errorf("CreateBranch: %w", err)
+	}
+	return nil
+}
+
+// Tree lists the files of commit sha page by page. GitLab has no root tree ID
+// in this listing, so the tree's SHA is left empty.
+func (f *gitlabForge) Tree(sha string) (*forgeTree, error) {
+	tree := &forgeTree{Entries: make(map[string]treeFile)}
+	page := "1"
+	for page != "" {
+		query := url.Values{"ref": {sha}, "recursive": {"true"}, "per_page": {"100"}, "page": {page}}
+		var entries []struct {
+			ID   string `json:"id"`
+			Type string `json:"type"`
+			Path string `json:"path"`
+			Mode string `json:"mode"`
+		}
+		header, err := f.do("GET", "/repository/tree?"+query.Encode(), nil, &entries)
+		if err != nil {
+			return nil, fmt.Errorf("GetTree: %w", err)
+		}
+		for _, entry := range entries {
+			if entry.Type == "tree" {
+				continue
+			}
+			tree.Entries[entry.Path] = treeFile{SHA: entry.ID, Mode: entry.Mode, Type: entry.Type}
+		}
+		page = header.Get("X-Next-Page")
+	}
+	return tree, nil
+}
+
+type gitlabAction struct {
+	Action   string `json:"action"`
+	FilePath string `json:"file_path"`
+	Content  string `json:"content,omitempty"`
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// Commit appends to the branch's current head; GitLab takes no parent, so the
+// recheck in upsertFiles is what guards against a concurrent push.
+func (f *gitlabForge) Commit(branch, parent, message string, changes []fileChange) (*forgeCommit, error) {
+	actions := make([]gitlabAction, 0, len(changes))
+	for _, change := range changes {
+		action := gitlabAction{FilePath: change.Path}
+		switch {
+		case change.Delete:
+			action.Action = "delete"
+		case change.Exists:
+			action.Action = "update"
+		default:
+			action.Action = "create"
+		}
+		if !change.Delete {
+			// Base64 keeps binary content intact.
+			action.Content = base64.StdEncoding.EncodeToString([]byte(change.Content))
+			action.Encoding = "base64"
+		}
+		actions = append(actions, action)
+	}
+
+	body := map[string]interface{}{
+		"branch":         branch,
+		"commit_message": message,
+		"actions":        actions,
+	}
+	var commit struct {
+		ID     string `json:"id"`
+		WebURL string `json:"web_url"`
+	}
+	if _, err := f.do("POST", "/repository/commits", body, &commit); err != nil {
+		return nil, fmt.Errorf("CreateCommit: %w", err)
+	}
+	return &forgeCommit{SHA: commit.ID, URL: commit.WebURL}, nil
+}
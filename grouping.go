@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Commit Grouping ---
+
+// Grouping policies for splitting one run into several commits.
+const (
+	groupSingle    = "single"
+	groupDirectory = "directory"
+	groupFile      = "file"
+)
+
+const defaultGroupMessage = "{{.Message}} ({{.Group}})"
+
+type commitGroup struct {
+	Name  string
+	Files map[string]string
+}
+
+// groupFiles splits files according to policy, in a stable order. With the
+// directory policy, files are grouped by their first directory below prefix,
+// and files directly in it form the "." group.
+func groupFiles(files map[string]string, policy, prefix string) ([]commitGroup, error) {
+	byName := make(map[string]map[string]string)
+	for p, content := range files {
+		var name string
+		switch policy {
+		case groupSingle:
+			name = ""
+		case groupFile:
+			name = p
+		case groupDirectory:
+			rel := strings.TrimPrefix(p, prefix+"/")
+			if prefix == "" {
+				rel = p
+			}
+			name = "."
+			if dir, _, ok := strings.Cut(rel, "/"); ok {
+				name = dir
+			}
+		default:
+			return nil, fmt.Errorf("unknown grouping policy %q", policy)
+		}
+		if byName[name] == nil {
+			byName[name] = make(map[string]string)
+		}
+		byName[name][p] = content
+	}
+
+	groups := make([]commitGroup, 0, len(byName))
+	for name, groupFiles := range byName {
+		groups = append(groups, commitGroup{Name: name, Files: groupFiles})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Name < groups[j].Name })
+	return groups, nil
+}
+
+// landingOrder names the files that must land before and after the rest of
+// a run, each set in its own commit, so that someone watching the branch
+// never sees, say, data files without the schema they follow.
+type landingOrder struct {
+	First, Last []string
+}
+
+func (o landingOrder) set() bool {
+	return len(o.First) > 0 || len(o.Last) > 0
+}
+
+// split takes the files matching First and Last out of files, into the
+// "first" and "last" groups. A file matching both lands first.
+func (o landingOrder) split(files map[string]string) (first, rest, last commitGroup) {
+	first = commitGroup{Name: "first", Files: make(map[string]string)}
+	rest = commitGroup{Name: "files", Files: make(map[string]string)}
+	last = commitGroup{Name: "last", Files: make(map[string]string)}
+	matches := func(globs []string, p string) bool {
+		for _, glob := range globs {
+			if matchAttrPattern(glob, p) {
+				return true
+			}
+		}
+		return false
+	}
+	for p, content := range files {
+		switch {
+		case matches(o.First, p):
+			first.Files[p] = content
+		case matches(o.Last, p):
+			last.Files[p] = content
+		default:
+			rest.Files[p] = content
+		}
+	}
+	return first, rest, last
+}
+
+// renderGroupMessage renders the per-group commit message template, which can
+// use .Message (the -message value), .Group, .Files and .Count.
+func renderGroupMessage(text, message string, group commitGroup) (string, error) {
+	paths := make([]string, 0, len(group.Files))
+	for p := range group.Files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	tmpl, err := template.New("group").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse group message template: %w", err)
+	}
+	var out bytes.Buffer
+	err = tmpl.Execute(&out, map[string]interface{}{
+		"Message": message,
+		"Group":   group.Name,
+		"Files":   paths,
+		"Count":   len(paths),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to render group message template: %w", err)
+	}
+	return out.String(), nil
+}
+
+// upsertGrouped commits each group of files separately, in order, stopping at
+// the first failure. The files order lands first and last bracket the
+// policy's groups. Deletions from pruning are committed after everything as
+// the "deletions" group, since they cannot be attributed to a local group.
+func upsertGrouped(
+	client *github.Client,
+	target prTarget,
+	files map[string]string,
+	opts upsertOptions,
+	policy string,
+	order landingOrder,
+	messageTemplate, message string,
+	finalize func(string) (string, error),
+) (map[string]string, *github.Commit, error) {
+	result := make(map[string]string)
+	var last *github.Commit
+
+	first, rest, final := order.split(files)
+	groups, err := groupFiles(rest.Files, policy, opts.PrunePrefix)
+	if err != nil {
+		return result, nil, err
+	}
+	if policy == groupSingle && len(groups) == 1 {
+		groups[0].Name = rest.Name
+	}
+	if len(first.Files) > 0 {
+		groups = append([]commitGroup{first}, groups...)
+	}
+	if len(final.Files) > 0 {
+		groups = append(groups, final)
+	}
+	prune := opts.Prune
+	opts.Prune = false
+
+	commitOne := func(group commitGroup, o upsertOptions, keep func(status string) bool) error {
+		text, err := renderGroupMessage(messageTemplate, message, group)
+		if err != nil {
+			return err
+		}
+		if text, err = finalize(text); err != nil {
+			return err
+		}
+		r, c, err := upsertMultipleFilesSafe(client, target.Owner, target.Repo, target.Branch, group.Files, text, o)
+		for p, status := range r {
+			if keep(status) {
+				result[p] = status
+			}
+		}
+		if c != nil {
+			last = c
+		}
+		return err
+	}
+
+	for _, group := range groups {
+		if err := commitOne(group, opts, func(string) bool { return true }); err != nil {
+			return result, last, fmt.Errorf("group %s: %w", group.Name, err)
+		}
+	}
+	if prune {
+		// Every local file is already committed, so this pass only deletes.
+		opts.Prune = true
+		deletions := commitGroup{Name: "deletions", Files: files}
+		if err := commitOne(deletions, opts, func(status string) bool { return status == "deleted" }); err != nil {
+			return result, last, fmt.Errorf("group deletions: %w", err)
+		}
+	}
+	return result, last, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Commit History ---
+
+type logEntry struct {
+	SHA      string            `json:"sha"`
+	Author   string            `json:"author"`
+	Email    string            `json:"email"`
+	Date     time.Time         `json:"date"`
+	Message  string            `json:"message"`
+	Trailers map[string]string `json:"trailers,omitempty"`
+	URL      string            `json:"url"`
+}
+
+func runLogCommand(args []string) error {
+	fs := flag.NewFlagSet("log", flag.ExitOnError)
+	owner, repo := repoFlags(fs)
+	branch := fs.String("branch", defaultBranch, "branch or SHA to list commits from")
+	path := fs.String("path", "", "only commits touching this path")
+	author := fs.String("author", "", "only commits by this GitHub login or email")
+	since := fs.String("since", "", "only commits after this date (YYYY-MM-DD or RFC 3339)")
+	until := fs.String("until", "", "only commits before this date (YYYY-MM-DD or RFC 3339)")
+	limit := fs.Int("limit", 0, "maximum number of commits (0 for all)")
+	format := fs.String("format", "text", "output format: text or json")
+	fs.Parse(args)
+
+	opts := &github.CommitsListOptions{SHA: *branch, Path: *path, Author: *author}
+	var err error
+	if opts.Since, err = parseDateFlag(*since); err != nil {
+		return err
+	}
+	if opts.Until, err = parseDateFlag(*until); err != nil {
+		return err
+	}
+
+	client, err := newGitHubClient()
+	if err != nil {
+		return err
+	}
+	entries, err := listCommits(client, *owner, *repo, opts, *limit)
+	if err != nil {
+		return err
+	}
+
+	if *format == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(entries)
+	}
+	for _, e := range entries {
+		subject, _, _ := strings.Cut(e.Message, "\n")
+		fmt.Printf("%s %s %-20s %s\n", shortSHA(e.SHA), e.Date.Format("2006-01-02"), e.Author, subject)
+	}
+	return nil
+}
+
+func parseDateFlag(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date %q, expected YYYY-MM-DD or RFC 3339", value)
+	}
+	return t, nil
+}
+
+// listCommits pages through the commits matching opts, stopping after limit
+// entries when limit is positive.
+func listCommits(client *github.Client, owner, repo string, opts *github.CommitsListOptions, limit int) ([]logEntry, error) {
+	ctx := context.Background()
+	opts.PerPage = 100
+
+	var entries []logEntry
+	for {
+		commits, resp, err := client.Repositories.ListCommits(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, fmt.Errorf("ListCommits: %w", err)
+		}
+		for _, c := range commits {
+			author := c.GetCommit().GetAuthor()
+			entries = append(entries, logEntry{
+				SHA:      c.GetSHA(),
+				Author:   author.GetName(),
+				Email:    author.GetEmail(),
+				Date:     author.GetDate().Time,
+				Message:  c.GetCommit().GetMessage(),
+				Trailers: parseTrailers(c.GetCommit().GetMessage()),
+				URL:      c.GetHTMLURL(),
+			})
+			if limit > 0 && len(entries) == limit {
+				return entries, nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return entries, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// parseTrailers returns the "Key: value" lines of a commit message's final
+// paragraph, when every line in it has that form.
+func parseTrailers(message string) map[string]string {
+	paragraphs := strings.Split(strings.TrimSpace(message), "\n\n")
+	if len(paragraphs) < 2 {
+		return nil
+	}
+	trailers := make(map[string]string)
+	for _, line := range strings.Split(paragraphs[len(paragraphs)-1], "\n") {
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil
+		}
+		trailers[key] = value
+	}
+	return trailers
+}
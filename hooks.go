@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// --- Plugin Hooks ---
+
+type hookStage string
+
+const (
+	hookPreCompare hookStage = "pre-compare"
+	hookPreCommit  hookStage = "pre-commit"
+	hookPostCommit hookStage = "post-commit"
+)
+
+// hookContext is handed to every hook. Files holds the change set for the
+// stage: the full local file set before comparison, the files about to be
+// committed before the commit, and the committed files afterwards. Hooks may
+// edit or delete entries in pre-compare and pre-commit; returning an error
+// vetoes the run.
+type hookContext struct {
+	Stage     hookStage
+	Owner     string
+	Repo      string
+	Branch    string
+	Files     map[string]string
+	Result    map[string]string
+	CommitSHA string
+}
+
+type hookFunc func(hc *hookContext) error
+
+var hooks = make(map[hookStage][]hookFunc)
+
+// registerHook adds a hook for the given stage. Go hooks are typically
+// registered from an init function in a file added to this package.
+func registerHook(stage hookStage, hook hookFunc) {
+	hooks[stage] = append(hooks[stage], hook)
+}
+
+func runHooks(hc *hookContext) error {
+	for _, hook := range hooks[hc.Stage] {
+		if err := hook(hc); err != nil {
+			return fmt.Errorf("%s hook: %w", hc.Stage, err)
+		}
+	}
+	return nil
+}
+
+// parseHookFlag parses a -hook value of the form "stage=command".
+func parseHookFlag(value string) (hookStage, string, error) {
+	stage, command, ok := strings.Cut(value, "=")
+	if !ok || command == "" {
+		return "", "", fmt.Errorf("invalid hook %q, expected stage=command", value)
+	}
+	switch hookStage(stage) {
+	case hookPreCompare, hookPreCommit, hookPostCommit:
+		return hookStage(stage), command, nil
+	}
+	return "", "", fmt.Errorf("unknown hook stage %q", stage)
+}
+
+// externalHook runs command through the shell with the change set written to
+// a temporary directory (its working directory) and the file paths listed on
+// stdin, one per line. A non-zero exit vetoes the run. Before the commit,
+// files the command rewrites or deletes are reflected in the change set.
+func externalHook(command string) hookFunc {
+	return func(hc *hookContext) error {
+		dir, err := os.MkdirTemp("", "gitapis-hook-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(dir)
+
+		paths := make([]string, 0, len(hc.Files))
+		for path, content := range hc.Files {
+			local := filepath.Join(dir, filepath.FromSlash(path))
+			if err := os.MkdirAll(filepath.Dir(local), 0o755); err != nil {
+				return err
+			}
+			if err := os.WriteFile(local, []byte(content), 0o644); err != nil {
+				return err
+			}
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Dir = dir
+		cmd.Stdin = strings.NewReader(strings.Join(paths, "\n") + "\n")
+		cmd.Stdout = os.Stdout
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		cmd.Env = append(os.Environ(),
+			"GITAPIS_HOOK_STAGE="+string(hc.Stage),
+			"GITAPIS_OWNER="+hc.Owner,
+			"GITAPIS_REPO="+hc.Repo,
+			"GITAPIS_BRANCH="+hc.Branch,
+			"GITAPIS_COMMIT_SHA="+hc.CommitSHA,
+		)
+		if err := cmd.Run(); err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return fmt.Errorf("%q failed: %w: %s", command, err, msg)
+			}
+			return fmt.Errorf("%q failed: %w", command, err)
+		}
+
+		if hc.Stage == hookPostCommit {
+			return nil
+		}
+		for _, path := range paths {
+			content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+			if os.IsNotExist(err) {
+				delete(hc.Files, path)
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			hc.Files[path] = string(content)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path/filepath"
+)
+
+// --- HTTP Cache ---
+
+// httpCacheDir is where GET responses are cached between runs, set by
+// -http-cache-dir; empty disables the cache.
+var httpCacheDir string
+
+// cacheTransport revalidates GET requests against the responses it has on
+// disk: a request whose cached response has an ETag is sent with
+// If-None-Match, and a 304 is answered with the cached response. GitHub does
+// not count 304s against the rate limit, so unchanged refs, trees and
+// contents cost nothing. Entries are written atomically, so any number of
+// runs and processes can share a directory.
+type cacheTransport struct {
+	base http.RoundTripper
+	dir  string
+}
+
+func newCacheTransport(base http.RoundTripper) http.RoundTripper {
+	if httpCacheDir == "" {
+		return base
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &cacheTransport{base: base, dir: httpCacheDir}
+}
+
+// cacheKey names the entry for req. Responses depend on who asks and in
+// what media type, so both count along with the URL.
+func (t *cacheTransport) cacheKey(req *http.Request) string {
+	h := sha256.New()
+	for _, part := range []string{req.URL.String(), req.Header.Get("Accept"), req.Header.Get("Authorization")} {
+		io.WriteString(h, part)
+		h.Write([]byte{0})
+	}
+	sum := hex.EncodeToString(h.Sum(nil))
+	return filepath.Join(t.dir, sum[:2], sum[2:])
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return t.base.RoundTrip(req)
+	}
+
+	key := t.cacheKey(req)
+	cached := t.load(key, req)
+	if cached != nil {
+		// The caller's request must not change under it.
+		req = req.Clone(req.Context())
+		req.Header.Set("If-None-Match", cached.Header.Get("ETag"))
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		// A 304 carries the current rate limit and may update the
+		// validators, which the cached headers would otherwise hide.
+		for name, values := range resp.Header {
+			cached.Header[name] = values
+		}
+		cached.Header.Set("X-From-Cache", "1")
+		cached.Request = req
+		return cached, nil
+	}
+	if cached != nil {
+		cached.Body.Close()
+	}
+	if resp.StatusCode == http.StatusOK && resp.Header.Get("ETag") != "" {
+		t.store(key, resp)
+	}
+	return resp, nil
+}
+
+// load returns the cached response for key, or nil.
+func (t *cacheTransport) load(key string, req *http.Request) *http.Response {
+	b, err := os.ReadFile(key)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	var resp *http.Response
+	if err == nil {
+		resp, err = http.ReadResponse(bufio.NewReader(bytes.NewReader(b)), req)
+	}
+	if err != nil {
+		log.Printf("⚠️ Ignoring cached response for %s: %v", req.URL.Path, err)
+		os.Remove(key)
+		return nil
+	}
+	if resp.Header.Get("ETag") == "" {
+		resp.Body.Close()
+		return nil
+	}
+	return resp
+}
+
+// store reads resp into the cache, replacing its body with the bytes read.
+// A failure only costs a full response next time, so it is logged.
+func (t *cacheTransport) store(key string, resp *http.Response) {
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		// The caller sees the same error reading the body.
+		resp.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), errReader{err}))
+		return
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	// DumpResponse reads and restores the body, so dump a copy of resp
+	// whose body is decoded already and whose length is known.
+	copied := *resp
+	copied.Body = io.NopCloser(bytes.NewReader(body))
+	copied.ContentLength = int64(len(body))
+	copied.TransferEncoding = nil
+	copied.Header = resp.Header.Clone()
+	copied.Header.Del("Content-Encoding")
+	dump, err := httputil.DumpResponse(&copied, true)
+	if err == nil {
+		err = writeFileAtomic(key, dump)
+	}
+	if err != nil {
+		log.Printf("⚠️ Failed to cache response for %s: %v", resp.Request.URL.Path, err)
+	}
+}
+
+type errReader struct{ err error }
+
+func (r errReader) Read([]byte) (int, error) { return 0, r.err }
+
+// writeFileAtomic writes b to p through a temporary file in its directory,
+// so concurrent readers see the old content or the new, never part of it.
+func writeFileAtomic(p string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
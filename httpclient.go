@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- HTTP Client ---
+
+// Connection tuning, set by the -http-* flags. The defaults keep enough idle
+// connections per host for a fan-out run to reuse them instead of dialing,
+// and leaving behind sockets in TIME_WAIT, for most requests.
+var (
+	httpMaxIdlePerHost = 64
+	httpTimeout        time.Duration
+	httpDialTimeout    = 30 * time.Second
+	httpIdleTimeout    = 90 * time.Second
+	httpUseHTTP2       = true
+)
+
+// httpClientFlags registers the connection tuning flags on fs.
+func httpClientFlags(fs *flag.FlagSet) {
+	fs.IntVar(&httpMaxIdlePerHost, "http-max-idle-per-host", httpMaxIdlePerHost, "idle connections kept open per host for reuse")
+	fs.DurationVar(&httpTimeout, "http-timeout", httpTimeout, "time limit for each API request, including reading the response (0 for none)")
+	fs.DurationVar(&httpDialTimeout, "http-dial-timeout", httpDialTimeout, "time limit for opening a connection and its TLS handshake")
+	fs.DurationVar(&httpIdleTimeout, "http-idle-timeout", httpIdleTimeout, "how long an idle connection is kept open")
+	fs.BoolVar(&httpUseHTTP2, "http2", httpUseHTTP2, "use HTTP/2 where the server supports it, multiplexing requests over one connection")
+	fs.StringVar(&userAgent, "user-agent", userAgent, "User-Agent of API requests")
+	fs.Var(&extraHeaders, "header", "add this \"Name: value\" header to every API request, e.g. for an authenticating proxy; repeatable")
+	fs.BoolVar(&logRequests, "log-requests", false, "log every API request that goes over the network, with its status and duration")
+}
+
+var (
+	userAgent    = "gitapis/" + version
+	extraHeaders headerList
+	logRequests  bool
+)
+
+// headerList collects the values of -header.
+type headerList []string
+
+func (l *headerList) String() string { return strings.Join(*l, ", ") }
+
+func (l *headerList) Set(value string) error {
+	name, _, ok := strings.Cut(value, ":")
+	if !ok || strings.TrimSpace(name) == "" || strings.ContainsAny(name, " \t") {
+		return fmt.Errorf("%q is not a \"Name: value\" header", value)
+	}
+	*l = append(*l, value)
+	return nil
+}
+
+// middleware wraps the transport of the API clients, to change or watch
+// their requests. Middleware must not modify a request in place.
+type middleware func(http.RoundTripper) http.RoundTripper
+
+// clientMiddleware is applied to every API request after the flags' own,
+// the first entry outermost. It sits below the cache, the rate budget and
+// the audit log, so it sees requests as they go over the network, with the
+// token in place: a build that signs requests or adds its own credentials
+// appends to it from an init function in a file of its own.
+var clientMiddleware []middleware
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// setHeaders adds the -user-agent and -header headers.
+func setHeaders(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		req = req.Clone(req.Context())
+		if userAgent != "" {
+			req.Header.Set("User-Agent", userAgent)
+		}
+		for _, header := range extraHeaders {
+			name, value, _ := strings.Cut(header, ":")
+			req.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+		return next.RoundTrip(req)
+	})
+}
+
+// logRequest logs each request made through next. Only the path is logged,
+// since query strings may carry tokens.
+func logRequest(next http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+		resp, err := next.RoundTrip(req)
+		took := time.Since(start).Round(time.Millisecond)
+		if err != nil {
+			log.Printf("%s %s%s: %v (%s)", req.Method, req.URL.Host, req.URL.Path, err, took)
+		} else {
+			log.Printf("%s %s%s: %d (%s)", req.Method, req.URL.Host, req.URL.Path, resp.StatusCode, took)
+		}
+		return resp, err
+	})
+}
+
+// apiTransport is the shared transport wrapped in the middleware.
+func apiTransport() http.RoundTripper {
+	stack := []middleware{setHeaders}
+	if logRequests {
+		stack = append(stack, logRequest)
+	}
+	stack = append(stack, clientMiddleware...)
+	var rt http.RoundTripper = baseTransport()
+	for i := len(stack) - 1; i >= 0; i-- {
+		rt = stack[i](rt)
+	}
+	return rt
+}
+
+var (
+	sharedTransportOnce sync.Once
+	sharedTransport     *http.Transport
+)
+
+// baseTransport returns the one transport every client of the run shares,
+// built from the tuning flags the first time it is asked for, so that all
+// clients draw on the same pool of connections.
+func baseTransport() *http.Transport {
+	sharedTransportOnce.Do(func() {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.DialContext = (&net.Dialer{Timeout: httpDialTimeout, KeepAlive: 30 * time.Second}).DialContext
+		t.TLSHandshakeTimeout = httpDialTimeout
+		t.IdleConnTimeout = httpIdleTimeout
+		t.MaxIdleConnsPerHost = httpMaxIdlePerHost
+		if t.MaxIdleConns < httpMaxIdlePerHost {
+			t.MaxIdleConns = httpMaxIdlePerHost
+		}
+		if !httpUseHTTP2 {
+			// A non-nil, empty map is how net/http is told not to
+			// negotiate HTTP/2.
+			t.ForceAttemptHTTP2 = false
+			t.TLSNextProto = make(map[string]func(string, *tls.Conn) http.RoundTripper)
+		}
+		sharedTransport = t
+	})
+	return sharedTransport
+}
+
+// newHTTPClient returns a client on the shared transport for the APIs
+// outside the GitHub client, recording mutations in the audit log.
+func newHTTPClient() *http.Client {
+	return &http.Client{Transport: newAuditTransport(apiTransport()), Timeout: httpTimeout}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Idempotency Keys ---
+
+// idempotencyTrailer carries the -idempotency-key of the run that made a
+// commit, so a retried job can tell its work is already on the branch.
+const idempotencyTrailer = "Gitapis-Idempotency-Key"
+
+// idempotencyDepth is how many commits back from a branch head are searched
+// for a key; a retry that finds the branch moved further than this on is
+// treated as a new run.
+const idempotencyDepth = 100
+
+// findAppliedCommit returns the commit among the latest on branch whose
+// trailer carries key, or nil.
+func findAppliedCommit(client *github.Client, owner, repo, branch, key string) (*logEntry, error) {
+	head, err := branchHead(client, owner, repo, branch)
+	if err != nil || head == "" {
+		return nil, err
+	}
+	entries, err := listCommits(client, owner, repo, &github.CommitsListOptions{SHA: head}, idempotencyDepth)
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		if entries[i].Trailers[idempotencyTrailer] == key {
+			return &entries[i], nil
+		}
+	}
+	return nil, nil
+}
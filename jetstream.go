@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// --- NATS JetStream Consumer ---
+
+// jetStreamConsumer commits the requests published to a JetStream stream,
+// one commitRequest per message, through a durable consumer that several
+// instances of serve may share. A message is acknowledged once committed,
+// so delivery is at least once; redelivery is safe, as requests are keyed
+// like those of the spool. The stream is the producers' to create.
+type jetStreamConsumer struct {
+	conn     *nats.Conn
+	consumer jetstream.Consumer
+	service  *commitService
+}
+
+// newJetStreamConsumer connects to the NATS servers at url, authenticating
+// with the credentials file creds if given, and binds the durable consumer
+// name to stream, creating it if needed. subject, when set, narrows the
+// messages it takes.
+func newJetStreamConsumer(url, creds, stream, name, subject string, service *commitService) (*jetStreamConsumer, error) {
+	opts := []nats.Option{nats.Name("gitapis serve"), nats.MaxReconnects(-1)}
+	if creds != "" {
+		opts = append(opts, nats.UserCredentials(creds))
+	}
+	conn, err := nats.Connect(url, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// A commit holds its message for as long as a spooled request may stay
+	// claimed, and is tried as often.
+	consumer, err := js.CreateOrUpdateConsumer(context.Background(), stream, jetstream.ConsumerConfig{
+		Durable:       name,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+		AckWait:       spoolLease,
+		MaxDeliver:    spoolAttempts,
+		FilterSubject: subject,
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to bind consumer %s of stream %s: %w", name, stream, err)
+	}
+	return &jetStreamConsumer{conn: conn, consumer: consumer, service: service}, nil
+}
+
+// consume commits messages as they arrive, one at a time, until the
+// connection closes for good.
+func (c *jetStreamConsumer) consume() error {
+	// One message at a time, so none waits out its ack deadline in a buffer
+	// while an earlier commit runs.
+	cc, err := c.consumer.Consume(c.handle, jetstream.PullMaxMessages(1), jetstream.ConsumeErrHandler(func(_ jetstream.ConsumeContext, err error) {
+		log.Printf("⚠️ JetStream: %v", err)
+	}))
+	if err != nil {
+		return err
+	}
+	defer cc.Stop()
+	closed := make(chan struct{})
+	c.conn.SetClosedHandler(func(*nats.Conn) { close(closed) })
+	<-closed
+	return errors.New("NATS connection closed")
+}
+
+// handle commits one message. A request no retry fixes is terminated, and
+// others are handed back for redelivery, up to spoolAttempts deliveries.
+func (c *jetStreamConsumer) handle(msg jetstream.Msg) {
+	name, attempt := msg.Subject(), uint64(1)
+	if meta, err := msg.Metadata(); err == nil {
+		name += "#" + strconv.FormatUint(meta.Sequence.Stream, 10)
+		attempt = meta.NumDelivered
+	}
+	err := commitQueued(c.service, name, msg.Data())
+	var bad *requestError
+	switch {
+	case err == nil:
+		if err := msg.Ack(); err != nil {
+			log.Printf("⚠️ JetStream: committed %s but failed to acknowledge it: %v", name, err)
+		}
+	case errors.As(err, &bad) || attempt >= spoolAttempts:
+		log.Printf("❌ JetStream: %s failed: %v", name, err)
+		msg.TermWithReason(err.Error())
+	default:
+		log.Printf("⚠️ JetStream: %s failed, will retry (attempt %d of %d): %v", name, attempt, spoolAttempts, err)
+		msg.Nak()
+	}
+}
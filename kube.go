@@ -0,0 +1,459 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Kubernetes Export ---
+
+// kubeServiceAccount is where pods get the credentials of their service
+// account mounted.
+const kubeServiceAccount = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// errKubeGone is a watch the API server can no longer resume, because the
+// resource version it started from was compacted away.
+var errKubeGone = errors.New("resource version expired")
+
+// kubeClient talks to the Kubernetes API with a bearer token. It covers the
+// few read calls exporting needs, which keeps client-go out of the build.
+type kubeClient struct {
+	server string
+	// tokenFile is read on every request, as projected service account
+	// tokens are rotated in place. token is used when it is empty.
+	tokenFile string
+	token     string
+	http      *http.Client
+}
+
+// newKubeClient connects to server with the token in tokenFile, or in
+// KUBE_TOKEN, trusting caFile. Without a server it uses the service
+// account of the pod it runs in.
+func newKubeClient(server, tokenFile, caFile string) (*kubeClient, error) {
+	if server == "" {
+		host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+		if host == "" || port == "" {
+			return nil, errors.New("not running in a cluster; set -kube-server")
+		}
+		server = "https://" + net.JoinHostPort(host, port)
+		if tokenFile == "" {
+			tokenFile = kubeServiceAccount + "/token"
+		}
+		if caFile == "" {
+			caFile = kubeServiceAccount + "/ca.crt"
+		}
+	}
+	k := &kubeClient{server: strings.TrimSuffix(server, "/"), tokenFile: tokenFile, token: os.Getenv("KUBE_TOKEN")}
+	if k.tokenFile == "" && k.token == "" {
+		return nil, errors.New("no Kubernetes token; set -kube-token-file or KUBE_TOKEN")
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the cluster CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", caFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	// No timeout: watches stay open until the server ends them.
+	k.http = &http.Client{Transport: transport}
+	return k, nil
+}
+
+// kubeNamespace is the namespace of the pod it runs in, or "default".
+func kubeNamespace() string {
+	if b, err := os.ReadFile(kubeServiceAccount + "/namespace"); err == nil {
+		return strings.TrimSpace(string(b))
+	}
+	return "default"
+}
+
+func (k *kubeClient) get(p string, query url.Values) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, k.server+p+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	token := k.token
+	if k.tokenFile != "" {
+		b, err := os.ReadFile(k.tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read the Kubernetes token: %w", err)
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+	resp, err := k.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("GET %s: %w", p, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		var status kubeStatus
+		json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&status)
+		if resp.StatusCode == http.StatusGone {
+			return nil, errKubeGone
+		}
+		return nil, fmt.Errorf("GET %s: %s: %s", p, resp.Status, status.Message)
+	}
+	return resp, nil
+}
+
+// kubeObject is a ConfigMap or Secret; Secrets have their data base64
+// encoded, like the binaryData of ConfigMaps.
+type kubeObject struct {
+	Metadata struct {
+		Name            string `json:"name"`
+		Namespace       string `json:"namespace"`
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Data       map[string]string `json:"data"`
+	BinaryData map[string]string `json:"binaryData"`
+}
+
+type kubeStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// kubeResource is one kind of object exported from the namespaces it is
+// listed in, e.g. configmaps of every namespace.
+type kubeResource struct {
+	Kind      string
+	Namespace string
+	Selector  string
+}
+
+func (r kubeResource) path() string {
+	if r.Namespace == "" {
+		return "/api/v1/" + r.Kind
+	}
+	return "/api/v1/namespaces/" + url.PathEscape(r.Namespace) + "/" + r.Kind
+}
+
+func (r kubeResource) query() url.Values {
+	query := url.Values{}
+	if r.Selector != "" {
+		query.Set("labelSelector", r.Selector)
+	}
+	return query
+}
+
+// list returns the objects of r and the resource version to watch from.
+func (k *kubeClient) list(r kubeResource) ([]kubeObject, string, error) {
+	resp, err := k.get(r.path(), r.query())
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	var list struct {
+		Metadata struct {
+			ResourceVersion string `json:"resourceVersion"`
+		} `json:"metadata"`
+		Items []kubeObject `json:"items"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, "", fmt.Errorf("failed to parse %s: %w", r.Kind, err)
+	}
+	return list.Items, list.Metadata.ResourceVersion, nil
+}
+
+// watch streams the changes of r after resourceVersion to fn, until the
+// server ends the watch. Bookmarks, which only move the resource version
+// on, are passed as well.
+func (k *kubeClient) watch(r kubeResource, resourceVersion string, fn func(event string, obj kubeObject)) error {
+	query := r.query()
+	query.Set("watch", "true")
+	query.Set("resourceVersion", resourceVersion)
+	query.Set("allowWatchBookmarks", "true")
+	resp, err := k.get(r.path(), query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), 4<<20)
+	for scanner.Scan() {
+		var event struct {
+			Type   string          `json:"type"`
+			Object json.RawMessage `json:"object"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return fmt.Errorf("failed to parse a %s watch event: %w", r.Kind, err)
+		}
+		switch event.Type {
+		case "ERROR":
+			var status kubeStatus
+			json.Unmarshal(event.Object, &status)
+			if status.Code == http.StatusGone {
+				return errKubeGone
+			}
+			return fmt.Errorf("watch %s: %s", r.Kind, status.Message)
+		case "ADDED", "MODIFIED", "DELETED", "BOOKMARK":
+			var obj kubeObject
+			if err := json.Unmarshal(event.Object, &obj); err != nil {
+				return fmt.Errorf("failed to parse a %s watch event: %w", r.Kind, err)
+			}
+			fn(event.Type, obj)
+		}
+	}
+	return scanner.Err()
+}
+
+// kubeFiles lays out objs of kind as files below prefix, one per key:
+// <prefix>/<namespace>/<kind>/<name>/<key>.
+func kubeFiles(prefix, kind string, objs []kubeObject, files map[string]string) error {
+	for _, obj := range objs {
+		dir := path.Join(prefix, obj.Metadata.Namespace, kind, obj.Metadata.Name)
+		add := func(key, content string) error {
+			p := dir + "/" + key
+			if reason := validatePath(p); reason != "" {
+				return fmt.Errorf("%s/%s key %q: %s", obj.Metadata.Namespace, obj.Metadata.Name, key, reason)
+			}
+			files[p] = content
+			return nil
+		}
+		encoded := obj.BinaryData
+		if kind == "secrets" {
+			encoded = obj.Data
+		} else {
+			for key, value := range obj.Data {
+				if err := add(key, value); err != nil {
+					return err
+				}
+			}
+		}
+		for key, value := range encoded {
+			b, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return fmt.Errorf("%s/%s key %q: %w", obj.Metadata.Namespace, obj.Metadata.Name, key, err)
+			}
+			if err := add(key, string(b)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// kubeExport publishes the objects of the exported resources to a branch.
+type kubeExport struct {
+	kube   *kubeClient
+	client *github.Client
+	owner  string
+	repo   string
+	branch string
+	prefix string
+	// message is the commit message of every export.
+	message string
+	opts    upsertOptions
+	// objects holds the current objects of every resource, by name.
+	objects map[kubeResource]map[string]kubeObject
+}
+
+// publish commits the current objects below prefix, deleting the files of
+// objects and keys that are gone.
+func (e *kubeExport) publish() error {
+	files := make(map[string]string)
+	for r, byName := range e.objects {
+		names := make([]string, 0, len(byName))
+		for name := range byName {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		objs := make([]kubeObject, len(names))
+		for i, name := range names {
+			objs[i] = byName[name]
+		}
+		if err := kubeFiles(e.prefix, r.Kind, objs, files); err != nil {
+			return err
+		}
+	}
+	result, commit, err := upsertMultipleFilesSafe(e.client, e.owner, e.repo, e.branch, files, e.message, e.opts)
+	printSummary(result)
+	if err != nil {
+		return err
+	}
+	if commit != nil {
+		fmt.Printf("Committed %s\n", commit.GetHTMLURL())
+	}
+	return nil
+}
+
+// relist replaces the objects of r with a fresh list and returns the
+// resource version to watch from.
+func (e *kubeExport) relist(r kubeResource) (string, error) {
+	objs, rv, err := e.kube.list(r)
+	if err != nil {
+		return "", err
+	}
+	byName := make(map[string]kubeObject, len(objs))
+	for _, obj := range objs {
+		byName[obj.Metadata.Namespace+"/"+obj.Metadata.Name] = obj
+	}
+	e.objects[r] = byName
+	return rv, nil
+}
+
+// follow watches r for good, sending every change to changes. A watch the
+// server ends is resumed, and one that can no longer be is replaced by a
+// new list.
+func (e *kubeExport) follow(r kubeResource, rv string, changes chan<- func()) {
+	for {
+		err := e.kube.watch(r, rv, func(event string, obj kubeObject) {
+			rv = obj.Metadata.ResourceVersion
+			if event == "BOOKMARK" {
+				return
+			}
+			key := obj.Metadata.Namespace + "/" + obj.Metadata.Name
+			changes <- func() {
+				if event == "DELETED" {
+					delete(e.objects[r], key)
+				} else {
+					e.objects[r][key] = obj
+				}
+			}
+		})
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, errKubeGone) {
+			log.Printf("⚠️ Watch of %s: %v", r.Kind, err)
+			time.Sleep(5 * time.Second)
+		}
+		// Lists touch e.objects, so they run where the changes are applied.
+		done := make(chan string)
+		changes <- func() {
+			fresh, err := e.relist(r)
+			if err != nil {
+				log.Printf("⚠️ List of %s: %v", r.Kind, err)
+			}
+			done <- fresh
+		}
+		if fresh := <-done; fresh != "" {
+			rv = fresh
+		} else {
+			time.Sleep(5 * time.Second)
+		}
+	}
+}
+
+// runKubeExportCommand publishes Kubernetes ConfigMaps, and Secrets when
+// they are encrypted, to a directory of a repository, one file per key.
+// With -watch it keeps following the cluster, committing each burst of
+// changes once it settles.
+func runKubeExportCommand(args []string) error {
+	fs := flag.NewFlagSet("kube-export", flag.ExitOnError)
+	owner, repo := repoFlags(fs)
+	branch := fs.String("branch", defaultBranch, "branch to commit to")
+	dir := fs.String("path", "", "repository directory to publish below, replacing what is there (required)")
+	message := fs.String("message", "Export Kubernetes objects", "commit message")
+	namespace := fs.String("namespace", "", "namespace to export (default the namespace of the pod)")
+	allNamespaces := fs.Bool("all-namespaces", false, "export every namespace")
+	selector := fs.String("selector", "", "only export objects matching this label selector, e.g. gitops/export=true")
+	kinds := fs.String("kinds", "configmaps", "comma-separated kinds to export: configmaps, secrets")
+	watch := fs.Bool("watch", false, "keep watching and publish every change")
+	debounce := fs.Duration("debounce", 10*time.Second, "with -watch, how long changes must settle before they are committed")
+	server := fs.String("kube-server", "", "Kubernetes API server URL (default the cluster the pod runs in)")
+	tokenFile := fs.String("kube-token-file", "", "file with the Kubernetes bearer token (default the pod's service account, or KUBE_TOKEN)")
+	caFile := fs.String("kube-ca", "", "CA certificate of the API server")
+	encryption := encryptionFlags(fs)
+	fs.Parse(args)
+
+	prefix := cleanDestPrefix(*dir)
+	if prefix == "" {
+		return errors.New("kube-export needs -path, the directory whose contents it replaces")
+	}
+	enc, err := encryption()
+	if err != nil {
+		return err
+	}
+	ns := *namespace
+	switch {
+	case *allNamespaces && ns != "":
+		return errors.New("-namespace and -all-namespaces are mutually exclusive")
+	case *allNamespaces:
+	case ns == "":
+		ns = kubeNamespace()
+	}
+	// Secrets are only ever committed encrypted.
+	secretsGlob := "/" + prefix + "/*/secrets/*/*"
+	var resources []kubeResource
+	for _, kind := range splitList(*kinds) {
+		switch kind {
+		case "configmaps":
+		case "secrets":
+			if enc == nil {
+				return fmt.Errorf("exporting secrets needs them encrypted: -encrypt '%s' with -age-recipient or -sops", secretsGlob)
+			}
+			enc.Globs = append(enc.Globs, secretsGlob)
+		default:
+			return fmt.Errorf("unknown kind %q, expected configmaps or secrets", kind)
+		}
+		resources = append(resources, kubeResource{Kind: kind, Namespace: ns, Selector: *selector})
+	}
+
+	kube, err := newKubeClient(*server, *tokenFile, *caFile)
+	if err != nil {
+		return err
+	}
+	client, err := newGitHubClient()
+	if err != nil {
+		return err
+	}
+	e := &kubeExport{
+		kube: kube, client: client, owner: *owner, repo: *repo, branch: *branch, prefix: prefix, message: *message,
+		opts:    upsertOptions{Prune: true, PrunePrefix: prefix, Encryption: enc},
+		objects: make(map[kubeResource]map[string]kubeObject),
+	}
+	versions := make(map[kubeResource]string)
+	for _, r := range resources {
+		if versions[r], err = e.relist(r); err != nil {
+			return err
+		}
+	}
+	if err := e.publish(); err != nil || !*watch {
+		return err
+	}
+
+	changes := make(chan func())
+	for _, r := range resources {
+		go e.follow(r, versions[r], changes)
+	}
+	var settle <-chan time.Time
+	for {
+		select {
+		case apply := <-changes:
+			apply()
+			settle = time.After(*debounce)
+		case <-settle:
+			settle = nil
+			if err := e.publish(); err != nil {
+				log.Printf("❌ Publishing to %s/%s@%s, will retry: %v", *owner, *repo, *branch, err)
+				settle = time.After(*debounce)
+			}
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// --- Git LFS ---
+
+const lfsPointerVersion = "version https://git-lfs.github.com/spec/v1\n"
+
+type lfsObject struct {
+	OID     string               `json:"oid"`
+	Size    int64                `json:"size"`
+	Actions map[string]lfsAction `json:"actions,omitempty"`
+	Error   *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+type lfsAction struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header"`
+}
+
+func isLFSPointer(content string) bool {
+	return len(content) < 1024 && strings.HasPrefix(content, lfsPointerVersion)
+}
+
+func lfsPointer(oid string, size int64) string {
+	return fmt.Sprintf("%soid sha256:%s\nsize %d\n", lfsPointerVersion, oid, size)
+}
+
+// storeLFSObjects uploads the content of every LFS-tracked file to the
+// repository's LFS store and replaces it with a pointer, as git-lfs would on
+// commit. Files that already are pointers are left alone.
+func storeLFSObjects(owner, repo string, files map[string]string, attrs *gitAttributes) (map[string]string, error) {
+	var paths []string
+	for p, content := range files {
+		if attrs.isLFS(p) && !isLFSPointer(content) {
+			paths = append(paths, p)
+		}
+	}
+	if len(paths) == 0 {
+		return files, nil
+	}
+	sort.Strings(paths)
+
+	objects := make([]lfsObject, 0, len(paths))
+	byOID := make(map[string]string)
+	for _, p := range paths {
+		sum := sha256.Sum256([]byte(files[p]))
+		oid := hex.EncodeToString(sum[:])
+		if _, dup := byOID[oid]; !dup {
+			objects = append(objects, lfsObject{OID: oid, Size: int64(len(files[p]))})
+		}
+		byOID[oid] = files[p]
+	}
+
+	endpoint := fmt.Sprintf("https://github.com/%s/%s.git/info/lfs/objects/batch", owner, repo)
+	var batch struct {
+		Objects []lfsObject `json:"objects"`
+	}
+	err := lfsRequest("POST", endpoint, nil, map[string]interface{}{
+		"operation": "upload",
+		"transfers": []string{"basic"},
+		"objects":   objects,
+	}, &batch)
+	if err != nil {
+		return nil, fmt.Errorf("LFS batch: %w", err)
+	}
+
+	for _, obj := range batch.Objects {
+		if obj.Error != nil {
+			return nil, fmt.Errorf("LFS object %s: %d %s", obj.OID, obj.Error.Code, obj.Error.Message)
+		}
+		// Without an upload action the server already has the object.
+		upload, ok := obj.Actions["upload"]
+		if !ok {
+			continue
+		}
+		if err := lfsUpload(upload, byOID[obj.OID]); err != nil {
+			return nil, fmt.Errorf("LFS upload %s: %w", obj.OID, err)
+		}
+		if verify, ok := obj.Actions["verify"]; ok {
+			if err := lfsRequest("POST", verify.Href, verify.Header, lfsObject{OID: obj.OID, Size: obj.Size}, nil); err != nil {
+				return nil, fmt.Errorf("LFS verify %s: %w", obj.OID, err)
+			}
+		}
+	}
+
+	out := make(map[string]string, len(files))
+	for p, content := range files {
+		out[p] = content
+	}
+	for _, p := range paths {
+		sum := sha256.Sum256([]byte(files[p]))
+		out[p] = lfsPointer(hex.EncodeToString(sum[:]), int64(len(files[p])))
+	}
+	log.Printf("Stored %d file(s) in Git LFS", len(paths))
+	return out, nil
+}
+
+// lfsRequest sends a JSON request to the LFS API. Requests without their own
+// headers authenticate with the GitHub token.
+func lfsRequest(method, url string, header map[string]string, body, out interface{}) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(method, url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.git-lfs+json")
+	req.Header.Set("Content-Type", "application/vnd.git-lfs+json")
+	if header == nil {
+		token, err := githubToken()
+		if err != nil {
+			return err
+		}
+		req.SetBasicAuth("x-access-token", token)
+	}
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := lfsHTTPClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func lfsUpload(action lfsAction, content string) error {
+	req, err := http.NewRequest("PUT", action.Href, strings.NewReader(content))
+	if err != nil {
+		return err
+	}
+	for k, v := range action.Header {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.ContentLength = int64(len(content))
+
+	resp, err := lfsHTTPClient().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("upload returned %s", resp.Status)
+	}
+	return nil
+}
+
+// lfsHTTPClient talks to the LFS endpoints, which are outside the REST API
+// client, while still recording uploads in the audit log.
+func lfsHTTPClient() *http.Client {
+	return newHTTPClient()
+}
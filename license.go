@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- License Headers ---
+
+// licenseYear stands for the year in a -license-header: any year, or range
+// of years, passes the check, and the current one is written by -license-fix.
+const licenseYear = "{year}"
+
+// licenseHeader is the header every source file of a change set must start
+// with, in the file's own comment style.
+type licenseHeader struct {
+	lines []string
+	// patterns match the header lines once their comment markers are gone.
+	patterns []*regexp.Regexp
+	globs    []string
+	fix      bool
+}
+
+// notLicensedExts are the extensions commentSyntax knows that hold data or
+// markup rather than source, which -license-header leaves alone unless a
+// -license-glob names them. Files without an extension, such as Dockerfile,
+// are left alone too.
+var notLicensedExts = map[string]bool{
+	".md": true, ".yml": true, ".yaml": true, ".toml": true, ".cfg": true, ".conf": true,
+	".ini": true, ".env": true, ".html": true, ".htm": true, ".xml": true, ".svg": true,
+	".gitignore": true, ".gitattributes": true, ".dockerignore": true,
+}
+
+func loadLicenseHeader(p string, globs []string, fix bool) (*licenseHeader, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read license header: %w", err)
+	}
+	h := &licenseHeader{globs: globs, fix: fix}
+	h.lines = strings.Split(strings.TrimRight(strings.ReplaceAll(string(b), "\r\n", "\n"), "\n"), "\n")
+	for _, line := range h.lines {
+		quoted := regexp.QuoteMeta(strings.TrimSpace(line))
+		quoted = strings.ReplaceAll(quoted, regexp.QuoteMeta(licenseYear), `\d{4}(?:\s*-\s*\d{4})?`)
+		h.patterns = append(h.patterns, regexp.MustCompile(`^`+quoted+`$`))
+	}
+	if len(h.lines) == 1 && h.lines[0] == "" {
+		return nil, fmt.Errorf("license header %s is empty", p)
+	}
+	return h, nil
+}
+
+// applies reports whether p needs the header: a -license-glob match, or
+// without globs any source file with a known comment syntax.
+func (h *licenseHeader) applies(p string) bool {
+	if _, _, ok := commentSyntax(p); !ok {
+		return false
+	}
+	if len(h.globs) == 0 {
+		ext := strings.ToLower(path.Ext(p))
+		return ext != "" && !notLicensedExts[ext]
+	}
+	for _, glob := range h.globs {
+		if matchAttrPattern(glob, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitPrologue separates the lines that have to stay first in a file, a #!
+// line or an XML declaration, from the rest.
+func splitPrologue(content string) (string, string) {
+	if strings.HasPrefix(content, "<?xml") {
+		if end := strings.IndexByte(content, '\n'); end >= 0 {
+			return content[:end+1], content[end+1:]
+		}
+	}
+	return splitShebang(content)
+}
+
+// has reports whether content carries the header in its leading comments,
+// in any comment style and with any blank decoration around it.
+func (h *licenseHeader) has(content string) bool {
+	_, body := splitPrologue(content)
+	// Headers may sit below a build constraint or a blank line, so a few
+	// more lines than the header are searched.
+	lines := strings.SplitN(body, "\n", len(h.lines)+8)
+	var text []string
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		for _, marker := range []string{"<!--", "-->", "/*", "*/", "//", "--", "#", "*"} {
+			line = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(line, marker), marker))
+		}
+		text = append(text, line)
+	}
+	for start := 0; start+len(h.patterns) <= len(text); start++ {
+		match := true
+		for i, re := range h.patterns {
+			if !re.MatchString(text[start+i]) {
+				match = false
+				break
+			}
+		}
+		if match {
+			return true
+		}
+	}
+	return false
+}
+
+// render returns the header as comments in p's language, with a blank line
+// after it.
+func (h *licenseHeader) render(p string, year int) string {
+	open, close, _ := commentSyntax(p)
+	var b strings.Builder
+	for _, line := range h.lines {
+		line = strings.ReplaceAll(line, licenseYear, strconv.Itoa(year))
+		if line == "" {
+			fmt.Fprintf(&b, "%s%s\n", open, close)
+			continue
+		}
+		fmt.Fprintf(&b, "%s %s%s\n", open, line, close)
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// licenseHeaderHook checks every source file of the change set for the
+// header, and either refuses the run over the files without it or, with
+// fix, adds it to them.
+func licenseHeaderHook(h *licenseHeader) hookFunc {
+	return func(hc *hookContext) error {
+		var missing []string
+		for p, content := range hc.Files {
+			if content == "" || isBinary(content) || !h.applies(p) || h.has(content) {
+				continue
+			}
+			if h.fix {
+				prologue, body := splitPrologue(content)
+				hc.Files[p] = prologue + h.render(p, time.Now().Year()) + body
+				continue
+			}
+			missing = append(missing, p)
+		}
+		if len(missing) > 0 {
+			sort.Strings(missing)
+			return fmt.Errorf("files without the license header, use -license-fix to add it:\n  %s", strings.Join(missing, "\n  "))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// --- Local Tree ---
+
+// gitKeepFile is the placeholder added to empty directories, which git trees
+// cannot otherwise hold.
+const gitKeepFile = ".gitkeep"
+
+// How the directory walk treats symbolic links.
+const (
+	symlinksSkip   = "skip"
+	symlinksFollow = "follow"
+	symlinksLink   = "link"
+)
+
+// walkOptions shapes readLocalTree's walk.
+type walkOptions struct {
+	// MaxDepth is how many directory levels to read, 1 being only root's
+	// own files; 0 means no limit.
+	MaxDepth int
+	// Symlinks is skip, follow (commit what they point to, descending into
+	// linked directories) or link (commit them as symlinks).
+	Symlinks string
+	// KeepEmpty gives every empty directory an empty gitKeepFile.
+	KeepEmpty bool
+}
+
+// localWalk is the state of one readLocalTree call.
+type localWalk struct {
+	root  string
+	opts  walkOptions
+	files map[string]string
+	links map[string]bool
+	dirs  []string
+}
+
+// readLocalTree reads every regular file below root, keyed by its
+// slash-separated path relative to root. The .git directory is skipped. With
+// opts.Symlinks set to link, it also returns which paths are symlinks, whose
+// content is their target.
+func readLocalTree(root string, opts walkOptions) (map[string]string, map[string]bool, error) {
+	w := &localWalk{root: root, opts: opts, files: make(map[string]string), links: make(map[string]bool)}
+	real, err := filepath.EvalSymlinks(root)
+	if err == nil {
+		err = w.walk(root, 1, map[string]bool{real: true})
+	}
+	if err == nil && opts.KeepEmpty {
+		err = addGitKeeps(w.files, w.dirs)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s: %w", root, err)
+	}
+	return w.files, w.links, nil
+}
+
+// walk reads the entries of dir, which lies depth levels below root.
+// ancestors holds the resolved paths of the directories above, so following
+// a link back into one of them is caught instead of recursing forever.
+func (w *localWalk) walk(dir string, depth int, ancestors map[string]bool) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, d := range entries {
+		p := filepath.Join(dir, d.Name())
+		mode := d.Type()
+
+		if mode&fs.ModeSymlink != 0 {
+			switch w.opts.Symlinks {
+			case symlinksLink:
+				target, err := os.Readlink(p)
+				if err != nil {
+					return err
+				}
+				repoPath, err := w.add(p, filepath.ToSlash(target))
+				if err != nil {
+					return err
+				}
+				w.links[repoPath] = true
+				continue
+			case symlinksFollow:
+				info, err := os.Stat(p)
+				if err != nil {
+					log.Printf("⚠️ Skipping broken symlink %s: %v", p, err)
+					continue
+				}
+				mode = info.Mode().Type()
+			default:
+				continue
+			}
+		}
+
+		switch {
+		case mode.IsDir():
+			if d.Name() == ".git" || (w.opts.MaxDepth > 0 && depth >= w.opts.MaxDepth) {
+				continue
+			}
+			real, err := filepath.EvalSymlinks(p)
+			if err != nil {
+				return err
+			}
+			if ancestors[real] {
+				log.Printf("⚠️ Skipping %s, a symlink cycle back to %s", p, real)
+				continue
+			}
+			rel, err := filepath.Rel(w.root, p)
+			if err != nil {
+				return err
+			}
+			w.dirs = append(w.dirs, filepath.ToSlash(rel))
+			ancestors[real] = true
+			err = w.walk(p, depth+1, ancestors)
+			delete(ancestors, real)
+			if err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			content, err := os.ReadFile(p)
+			if err != nil {
+				return err
+			}
+			if _, err := w.add(p, string(content)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// add records content for the local file p under its repository path.
+func (w *localWalk) add(p, content string) (string, error) {
+	rel, err := filepath.Rel(w.root, p)
+	if err != nil {
+		return "", err
+	}
+	repoPath, err := normalizeRepoPath(rel)
+	if err != nil {
+		return "", err
+	}
+	if _, exists := w.files[repoPath]; exists {
+		return "", fmt.Errorf("%s and another file both map to %s", p, repoPath)
+	}
+	w.files[repoPath] = content
+	return repoPath, nil
+}
+
+// addGitKeeps adds a gitKeepFile to each of dirs that holds neither a file
+// nor another directory, since only those would vanish from the tree.
+func addGitKeeps(files map[string]string, dirs []string) error {
+	nonEmpty := make(map[string]bool)
+	for p := range files {
+		nonEmpty[path.Dir(p)] = true
+	}
+	for _, dir := range dirs {
+		nonEmpty[path.Dir(dir)] = true
+	}
+	for _, dir := range dirs {
+		if nonEmpty[dir] {
+			continue
+		}
+		repoPath, err := normalizeRepoPath(path.Join(dir, gitKeepFile))
+		if err != nil {
+			return err
+		}
+		files[repoPath] = ""
+	}
+	return nil
+}
+
+// normalizeRepoPath converts a local path to the form stored in the
+// repository: forward slashes and NFC-normalized. macOS file systems hand out
+// NFD names, which would otherwise be committed as distinct, duplicate-looking
+// files next to their NFC twins.
+func normalizeRepoPath(localPath string) (string, error) {
+	// Backslashes are never valid in a repository path, so they are taken
+	// as separators on every platform, not only on Windows.
+	p := strings.ReplaceAll(filepath.ToSlash(localPath), `\`, "/")
+	if !utf8.ValidString(p) {
+		return "", fmt.Errorf("%q is not a valid UTF-8 file name", localPath)
+	}
+	return norm.NFC.String(p), nil
+}
+
+// cleanDestPrefix turns a -dest-prefix value such as "/services/my-service/"
+// into the repository-relative directory "services/my-service". Rooting the
+// path before cleaning it discards any ".." that would escape the repository.
+func cleanDestPrefix(prefix string) string {
+	return strings.Trim(path.Clean("/"+filepath.ToSlash(prefix)), "/")
+}
+
+func applyDestPrefix(files map[string]string, prefix string) map[string]string {
+	if prefix == "" {
+		return files
+	}
+	prefixed := make(map[string]string, len(files))
+	for p, content := range files {
+		prefixed[prefix+"/"+p] = content
+	}
+	return prefixed
+}
+
+// underPrefix reports whether the repository path p lies within prefix. An
+// empty prefix covers the whole repository.
+func underPrefix(p, prefix string) bool {
+	return prefix == "" || strings.HasPrefix(p, prefix+"/")
+}
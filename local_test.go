@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestNormalizeRepoPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{name: "ascii", in: "docs/README.md", want: "docs/README.md"},
+		{name: "nfc unchanged", in: "caf\u00e9.txt", want: "caf\u00e9.txt"},
+		{name: "nfd to nfc", in: "cafe\u0301.txt", want: "caf\u00e9.txt"},
+		{name: "nfd directory", in: "Re\u0301sume\u0301/cv.md", want: "R\u00e9sum\u00e9/cv.md"},
+		{name: "backslash", in: `docs\guide\intro.md`, want: "docs/guide/intro.md"},
+		{name: "backslash and nfd", in: "cafe\u0301\\menu.txt", want: "caf\u00e9/menu.txt"},
+		{name: "invalid utf-8", in: "bad\xffname.txt", wantErr: true},
+		{name: "truncated utf-8", in: "docs/\xc3", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := normalizeRepoPath(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("normalizeRepoPath(%q) = %q, want an error", tt.in, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("normalizeRepoPath(%q): %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Errorf("normalizeRepoPath(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadLocalTree(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   []string
+		want    map[string]string
+		wantErr bool
+		// unix marks file names only Unix file systems can hold.
+		unix bool
+		// twins are names a normalizing file system stores as one file.
+		twins bool
+	}{
+		{
+			name:  "nested",
+			files: []string{"a.txt", "dir/b.txt"},
+			want:  map[string]string{"a.txt": "a.txt", "dir/b.txt": "dir/b.txt"},
+		},
+		{
+			name:  "nfd names",
+			files: []string{"cafe\u0301.txt", "Re\u0301sume\u0301/cv.md"},
+			want:  map[string]string{"caf\u00e9.txt": "cafe\u0301.txt", "R\u00e9sum\u00e9/cv.md": "Re\u0301sume\u0301/cv.md"},
+		},
+		{
+			name:  "backslash name",
+			files: []string{`docs\intro.md`},
+			want:  map[string]string{"docs/intro.md": `docs\intro.md`},
+			unix:  true,
+		},
+		{
+			name:    "nfd and nfc twins",
+			files:   []string{"cafe\u0301.txt", "caf\u00e9.txt"},
+			wantErr: true,
+		},
+		{
+			name:    "invalid utf-8 name",
+			files:   []string{"bad\xffname.txt"},
+			wantErr: true,
+			unix:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.unix && runtime.GOOS == "windows" {
+				t.Skip("file name not representable on Windows")
+			}
+			root := t.TempDir()
+			for _, name := range tt.files {
+				p := filepath.Join(root, filepath.FromSlash(name))
+				if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(p, []byte(name), 0o644); err != nil {
+					t.Skipf("file system cannot hold %q: %v", name, err)
+				}
+			}
+			if tt.twins {
+				if entries, err := os.ReadDir(root); err != nil || len(entries) < len(tt.files) {
+					t.Skip("file system folds NFD and NFC names together")
+				}
+			}
+
+			got, _, err := readLocalTree(root, walkOptions{})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("readLocalTree = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("readLocalTree: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("readLocalTree = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
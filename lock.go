@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Branch Lock ---
+
+// lockRefPrefix is where branch locks live. Refs outside refs/heads and
+// refs/tags are not shown in the UI and are not fetched by default.
+const lockRefPrefix = "refs/gitapis/locks/"
+
+// branchLock is an advisory lock on a branch, held as a ref to a commit whose
+// message names the holder and when the lock expires. Creating a ref fails if
+// it exists and a non-forced update fails unless it fast-forwards, which makes
+// both taking a lock and breaking an expired one atomic.
+type branchLock struct {
+	client      *github.Client
+	owner, repo string
+	ref, sha    string
+}
+
+func lockHolder() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s@%s:%d", runID, host, os.Getpid())
+}
+
+// parseLockMessage returns the holder and expiry recorded in a lock commit.
+func parseLockMessage(message string) (holder string, expires time.Time) {
+	for _, line := range strings.Split(message, "\n") {
+		if v, ok := strings.CutPrefix(line, "Holder: "); ok {
+			holder = v
+		}
+		if v, ok := strings.CutPrefix(line, "Expires: "); ok {
+			expires, _ = time.Parse(time.RFC3339, v)
+		}
+	}
+	return holder, expires
+}
+
+// acquireBranchLock takes the lock on branch, waiting up to wait for another
+// instance to release it. A lock past its expiry is taken over, so a crashed
+// instance blocks others for at most ttl. Locks need a commit to point at, so
+// there is nothing to lock in an empty repository and nil is returned.
+func acquireBranchLock(client *github.Client, owner, repo, branch string, wait, ttl time.Duration) (*branchLock, error) {
+	ctx := context.Background()
+	base, err := branchHead(client, owner, repo, branch)
+	if err != nil {
+		return nil, err
+	}
+	if base == "" {
+		empty, info, err := repositoryIsEmpty(client, owner, repo)
+		if err != nil {
+			return nil, err
+		}
+		if empty {
+			log.Printf("⚠️ Not locking %s: the repository is empty", branch)
+			return nil, nil
+		}
+		if base, err = branchHead(client, owner, repo, info.GetDefaultBranch()); err != nil {
+			return nil, err
+		}
+	}
+	baseCommit, _, err := client.Git.GetCommit(ctx, owner, repo, base)
+	if err != nil {
+		return nil, fmt.Errorf("GetCommit: %w", err)
+	}
+
+	l := &branchLock{client: client, owner: owner, repo: repo, ref: lockRefPrefix + branch}
+	holder := lockHolder()
+	deadline := time.Now().Add(wait)
+	for {
+		current, resp, err := client.Git.GetRef(ctx, owner, repo, l.ref)
+		if err != nil && (resp == nil || resp.StatusCode != 404) {
+			return nil, fmt.Errorf("GetRef %s: %w", l.ref, err)
+		}
+
+		var parents []*github.Commit
+		if current != nil {
+			lockCommit, _, err := client.Git.GetCommit(ctx, owner, repo, current.Object.GetSHA())
+			if err != nil {
+				return nil, fmt.Errorf("GetCommit lock: %w", err)
+			}
+			other, expires := parseLockMessage(lockCommit.GetMessage())
+			if time.Now().Before(expires) {
+				if !time.Now().Before(deadline) {
+					return nil, fmt.Errorf("%s is locked by %s until %s", branch, other, expires.Format(time.RFC3339))
+				}
+				log.Printf("Waiting for the lock on %s, held by %s until %s...", branch, other, expires.Format(time.RFC3339))
+				time.Sleep(min(5*time.Second, time.Until(deadline)))
+				continue
+			}
+			log.Printf("⚠️ Taking over the lock on %s from %s, which expired at %s", branch, other, expires.Format(time.RFC3339))
+			parents = []*github.Commit{{SHA: lockCommit.SHA}}
+		}
+
+		message := fmt.Sprintf("gitapis lock on %s\n\nHolder: %s\nExpires: %s\n", branch, holder, time.Now().Add(ttl).UTC().Format(time.RFC3339))
+		commit := &github.Commit{Message: github.String(message), Tree: &github.Tree{SHA: baseCommit.Tree.SHA}, Parents: parents}
+		created, _, err := client.Git.CreateCommit(ctx, owner, repo, commit)
+		if err != nil {
+			return nil, fmt.Errorf("CreateCommit lock: %w", err)
+		}
+		reference := &github.Reference{Ref: github.String(l.ref), Object: &github.GitObject{SHA: created.SHA}}
+		if current == nil {
+			_, resp, err = client.Git.CreateRef(ctx, owner, repo, reference)
+		} else {
+			_, resp, err = client.Git.UpdateRef(ctx, owner, repo, reference, false)
+		}
+		if err == nil {
+			l.sha = created.GetSHA()
+			log.Printf("Locked %s", branch)
+			return l, nil
+		}
+		// Another instance got there first; look again.
+		if resp == nil || resp.StatusCode != 422 {
+			return nil, fmt.Errorf("taking lock %s: %w", l.ref, err)
+		}
+	}
+}
+
+// release deletes the lock if it is still this instance's; a lock that was
+// taken over after expiring belongs to someone else by then.
+func (l *branchLock) release() error {
+	if l == nil {
+		return nil
+	}
+	ctx := context.Background()
+	current, _, err := l.client.Git.GetRef(ctx, l.owner, l.repo, l.ref)
+	if err != nil {
+		return fmt.Errorf("GetRef %s: %w", l.ref, err)
+	}
+	if current.Object.GetSHA() != l.sha {
+		return errors.New("the lock expired and was taken over before it was released")
+	}
+	if _, err := l.client.Git.DeleteRef(ctx, l.owner, l.repo, l.ref); err != nil {
+		return fmt.Errorf("DeleteRef %s: %w", l.ref, err)
+	}
+	return nil
+}
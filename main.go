@@ -2,183 +2,86 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
 
 	"github.com/google/go-github/v55/github"
-	"golang.org/x/oauth2"
 )
 
 // --- Upsert Multiple Files Function (safe & detailed) ---
 
+// upsertOptions tunes upsertMultipleFilesSafe beyond the basic file set.
+type upsertOptions struct {
+	// Prune deletes remote files below PrunePrefix that are not in files.
+	Prune       bool
+	PrunePrefix string
+	// Base is the branch, tag or SHA a missing branch is created from,
+	// defaulting to the repository's default branch.
+	Base string
+	// Verify is the verifyCommit level applied to every commit made.
+	Verify string
+	// Plan, when set, is filled in with the commit that would be made
+	// instead of making it.
+	Plan *syncPlan
+	// Provenance, when set, adds a provenance file to every commit made.
+	Provenance *provenanceConfig
+	// Checksums, when set, adds a manifest of the synced files' digests.
+	Checksums *checksumConfig
+	// Links holds the paths of files that are symlinks, their content being
+	// the link target.
+	Links map[string]bool
+	// GitKeep deletes remote gitKeepFiles from directories the synced files
+	// leave non-empty.
+	GitKeep bool
+	// Encryption, when set, commits the files it matches encrypted.
+	Encryption *encryptionConfig
+	// Stamp, when set, puts a header on the files it matches.
+	Stamp *stampConfig
+	// Regions, when set, syncs the files it matches into their managed
+	// region rather than over the whole file.
+	Regions *regionConfig
+	// Merge, when set, deep-merges the JSON and YAML files it matches into
+	// the remote ones.
+	Merge *mergeConfig
+	// ReplaceTypes deletes remote files that are in the way of a synced
+	// path of the other type, rather than failing with a type mismatch.
+	ReplaceTypes bool
+	// Protect, protectFlag or protectPR, holds back files modified remotely
+	// since the last sync instead of overwriting them.
+	Protect string
+}
+
 func upsertMultipleFilesSafe(
 	client *github.Client,
 	owner, repo, branch string,
 	files map[string]string,
 	commitMessage string,
-) (map[string]string, error) {
-	ctx := context.Background()
-	result := make(map[string]string)
-
-	ref, _, err := client.Git.GetRef(ctx, owner, repo, "refs/heads/"+branch)
-	if err != nil {
-		if ghErr, ok := err.(*github.ErrorResponse); ok && (ghErr.Response.StatusCode == 404 || ghErr.Response.StatusCode == 409) {
-			log.Println("Branch doesn't exist — repo may be empty. Creating initial commit...")
-
-			var treeEntries []*github.TreeEntry
-			for path, content := range files {
-				result[path] = "created"
-				blob, _, err := client.Git.CreateBlob(ctx, owner, repo, &github.Blob{
-					Content:  github.String(content),
-					Encoding: github.String("utf-8"),
-				})
-
-				if err != nil {
-
-					result[path] = "error"
-					return result, fmt.Errorf("CreateBlob (init): %w", err)
-				}
-				treeEntries = append(treeEntries, &github.TreeEntry{
-					Path: github.String(path),
-					Mode: github.String("100644"),
-					Type: github.String("blob"),
-					SHA:  blob.SHA,
-				})
-			}
-
-			tree, _, err := client.Git.CreateTree(ctx, owner, repo, "", treeEntries)
-			if err != nil {
-				return result, fmt.Errorf("CreateTree (init): %w", err)
-			}
-
-			commit := &github.Commit{
-				Message: github.String("Initial commit"),
-				Tree:    tree,
-			}
-
-			newCommit, _, err := client.Git.CreateCommit(ctx, owner, repo, commit)
-			if err != nil {
-				return result, fmt.Errorf("CreateCommit (init): %w", err)
-			}
-
-			ref := &github.Reference{
-				Ref: github.String("refs/heads/" + branch),
-				Object: &github.GitObject{
-					SHA: newCommit.SHA,
-				},
-			}
-			_, _, err = client.Git.CreateRef(ctx, owner, repo, ref)
-			if err != nil {
-				return result, fmt.Errorf("CreateRef (init): %w", err)
-			}
-
-			log.Println("Initial commit and branch created.")
-			return result, nil
-		}
-		return result, fmt.Errorf("GetRef: %w", err)
-	}
-
-	originalHeadSHA := ref.Object.GetSHA()
-
-	baseCommit, resp, err := client.Repositories.GetCommit(ctx, owner, repo, originalHeadSHA, nil)
-	if err != nil {
-		body := ""
-		if resp != nil {
-			b, _ := os.ReadFile(resp.Request.URL.Path)
-			body = string(b)
-		}
-		return result, fmt.Errorf("GetCommit error: %w\nStatus: %v\nBody: %s", err, resp.Status, body)
-	}
+	opts upsertOptions,
+) (map[string]string, *github.Commit, error) {
+	f := newGitHubForge(client, owner, repo)
+	f.plan, f.verify = opts.Plan, opts.Verify
+	result, commit, err := upsertFiles(f, branch, files, commitMessage, opts)
+	return result, gitHubCommit(commit), err
+}
 
-	if baseCommit == nil || baseCommit.Commit == nil {
-		return result, fmt.Errorf("baseCommit or baseCommit.Commit is nil — SHA might be invalid or repo in bad state")
+// applyPreCommitHooks runs the pre-commit hooks over changes, marking any file
+// a hook dropped from the change set as skipped.
+func applyPreCommitHooks(owner, repo, branch string, changes, result map[string]string) error {
+	if err := runHooks(&hookContext{Stage: hookPreCommit, Owner: owner, Repo: repo, Branch: branch, Files: changes, Result: result}); err != nil {
+		return err
 	}
-
-	baseTreeSHA := baseCommit.Commit.Tree.GetSHA()
-
-	var treeEntries []*github.TreeEntry
-
-	for path, newContent := range files {
-		result[path] = "error"
-
-		current, _, resp, err := client.Repositories.GetContents(ctx, owner, repo, path, &github.RepositoryContentGetOptions{Ref: branch})
-		if resp != nil && resp.StatusCode == 404 {
-			result[path] = "created"
-		} else if err == nil && current != nil {
-			decoded, err := current.GetContent()
-			if err != nil {
-				continue
-			}
-			if decoded == newContent {
-				result[path] = "skipped"
-				continue
-			}
-			result[path] = "updated"
-		} else if err != nil {
-			continue
-		}
-
-		blob, _, err := client.Git.CreateBlob(ctx, owner, repo, &github.Blob{
-			Content:  github.String(newContent),
-			Encoding: github.String("utf-8"),
-		})
-		if err != nil {
-			continue
+	for path, status := range result {
+		if _, ok := changes[path]; !ok && (status == "created" || status == "updated") {
+			result[path] = "skipped"
 		}
-
-		treeEntries = append(treeEntries, &github.TreeEntry{
-			Path: github.String(path),
-			Mode: github.String("100644"),
-			Type: github.String("blob"),
-			SHA:  blob.SHA,
-		})
-	}
-
-	if len(treeEntries) == 0 {
-		fmt.Println("No changes to commit.")
-		return result, nil
-	}
-
-	refCheck, _, err := client.Git.GetRef(ctx, owner, repo, "refs/heads/"+branch)
-	if err != nil {
-		return result, fmt.Errorf("Recheck GetRef: %w", err)
-	}
-	if refCheck.Object.GetSHA() != originalHeadSHA {
-		return result, fmt.Errorf("Branch was updated during operation (SHA mismatch)")
-	}
-
-	newTree, _, err := client.Git.CreateTree(ctx, owner, repo, baseTreeSHA, treeEntries)
-	if err != nil {
-		return result, fmt.Errorf("CreateTree: %w", err)
-	}
-
-	if baseCommit.Commit == nil {
-		return result, fmt.Errorf("baseCommit.Commit is nil, cannot create new commit")
-	}
-
-	newCommit := &github.Commit{
-		Message: github.String(commitMessage),
-		Tree:    newTree,
-		Parents: []*github.Commit{
-			{
-				SHA: github.String(originalHeadSHA),
-			},
-		},
 	}
-	commit, _, err := client.Git.CreateCommit(ctx, owner, repo, newCommit)
-	if err != nil {
-		return result, fmt.Errorf("CreateCommit: %w", err)
-	}
-
-	ref.Object.SHA = commit.SHA
-	_, _, err = client.Git.UpdateRef(ctx, owner, repo, ref, false)
-	if err != nil {
-		return result, fmt.Errorf("UpdateRef: %w", err)
-	}
-
-	fmt.Println("Commit created:", commit.GetHTMLURL())
-	return result, nil
+	return nil
 }
 
 func createRepo(client *github.Client, owner, repoName string) error {
@@ -202,7 +105,15 @@ func createRepo(client *github.Client, owner, repoName string) error {
 		Description: github.String("Auto-created with Go script"),
 	}
 
-	createdRepo, _, err := client.Repositories.Create(ctx, "", repo)
+	// Repositories of an organization are created in it, and any other
+	// owner can only be the authenticated user.
+	org := ""
+	if isOrg, err := isOrganization(client, owner); err != nil {
+		return err
+	} else if isOrg {
+		org = owner
+	}
+	createdRepo, _, err := client.Repositories.Create(ctx, org, repo)
 	if err != nil {
 		return fmt.Errorf("Error creating repo: %w", err)
 	}
@@ -265,23 +176,454 @@ func createInitialMainBranch(client *github.Client, owner, repo string, files ma
 	return nil
 }
 
+// stringList collects the values of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
 func main() {
+	actionMode := len(os.Args) > 1 && os.Args[1] == actionCommand
+	configMode := len(os.Args) > 1 && os.Args[1] == configCommand
+	if len(os.Args) > 1 && !actionMode && !configMode {
+		if command, ok := commands[os.Args[1]]; ok {
+			if err := command(os.Args[2:]); err != nil {
+				log.Fatal(explainError(err, nil, "", ""))
+			}
+			return
+		}
+	}
+
+	ownerFlag := flag.String("owner", defaultOwner, "repository owner")
+	repoFlag := flag.String("repo", defaultRepo, "repository name")
+	branchFlag := flag.String("branch", defaultBranch, "branch to upsert into, or a comma-separated list of branches and globs such as release/*")
+	messageFlag := flag.String("message", "Upsert files from Go script", "commit message")
+	postComment := flag.Bool("comment", false, "post a commit comment summarizing the synced files")
+	notifyURL := flag.String("notify-url", "", "webhook URL to POST the run summary to (Slack-compatible)")
+	notifyOn := flag.String("notify-on", "failure", "when to send the notification: success, failure or always")
+	notifyTemplate := flag.String("notify-template", "", "path to a Go template for the JSON notification payload")
+	var hookFlags stringList
+	flag.Var(&hookFlags, "hook", "external hook as stage=command (pre-compare, pre-commit, post-commit); repeatable")
+	teamsPath := flag.String("teams", "", "JSON file of {name, permission, members, maintainers} teams to create in each repository's organization and grant access to it")
+	securityFlag := flag.String("security", "", "security features to enable on each repository, comma-separated: "+securityAlerts+", "+securityUpdates+", "+securitySecretScanning+", "+securityPushProtection+" or "+securityAll)
+	policyMode := flag.Bool("policy", false, "distribute .github policy files (workflows, dependabot.yml, CODEOWNERS) through labeled pull requests, placed where each repository keeps its own")
+	var prLabels, prAssignees, prReviewers stringList
+	flag.Var(&prLabels, "pr-label", "label for the pull requests a sync opens; repeatable")
+	flag.Var(&prAssignees, "pr-assignee", "user to assign the pull requests a sync opens to; repeatable")
+	flag.Var(&prReviewers, "pr-reviewer", "user, or org/team-slug team, to request reviews of the pull requests a sync opens from; repeatable")
+	var prChecklist stringList
+	flag.Var(&prChecklist, "pr-checklist", "item of the checklist in pull request bodies, replacing the default items; repeatable")
+	var policyLabels stringList
+	flag.Var(&policyLabels, "policy-label", "label for -policy pull requests (default "+defaultPolicyLabel+"); repeatable")
+	policyStatus := flag.String("policy-status", "", "JSON file tracking which repositories have adopted the -policy files, updated on each run")
+	environmentsPath := flag.String("environments", "", "JSON file of {name, wait_timer, reviewers, branches, secrets} deployment environments to create or update on each repository, secrets naming the variables holding their values")
+	settingsPath := flag.String("repo-settings", "", "JSON file of autolinks, custom property definitions and custom property values to reconcile on each repository")
+	rulesetsPath := flag.String("rulesets", "", "JSON file of repository rulesets, as the rulesets API takes them, to create or update by name on each repository")
+	transformsPath := flag.String("transforms", "", "JSON file of {glob, steps} rules transforming matching files before they are compared and committed")
+	contentPolicyPath := flag.String("content-policy", "", "JSON file of rules every change set must pass (max_file_bytes, forbidden, headers, required), and whether violations block the run or open a pull request")
+	licenseHeaderPath := flag.String("license-header", "", "file with the license header every source file must start with, in plain text with "+licenseYear+" standing for any year")
+	var licenseGlobs stringList
+	flag.Var(&licenseGlobs, "license-glob", "require the -license-header on files matching this .gitattributes-style pattern instead of on every source file; repeatable")
+	licenseFix := flag.Bool("license-fix", false, "add the -license-header, in each language's comment style, to files without it instead of failing")
+	formatFiles := flag.Bool("format", false, "format Go (gofmt), JSON and YAML files before comparing them, so commits pass format checks")
+	var formatCommands stringList
+	flag.Var(&formatCommands, "format-command", "format files matching a .gitattributes-style pattern with a command as pattern=command, file on stdin and result on stdout; repeatable")
+	scanForSecrets := flag.Bool("scan-secrets", true, "refuse to commit files that look like they contain credentials")
+	secretRulesPath := flag.String("secret-rules", "", "JSON file of {name, pattern} rules replacing the built-in secret patterns")
+	checkWorkflows := flag.Bool("check-workflows", true, "refuse to commit .github/workflows files that are not valid YAML")
+	lintWorkflows := flag.Bool("lint-workflows", false, "also refuse workflow files that are not shaped like a workflow: unknown keys, no trigger, jobs without runs-on or steps")
+	allowSecrets := flag.Bool("allow-secrets", false, "commit even if the secret scanner finds matches")
+	valuesPath := flag.String("values", "", "JSON file of template variables (\"vars\" plus per-repo \"repos\" overrides)")
+	var templateVars stringList
+	flag.Var(&templateVars, "var", "template variable as key=value; repeatable")
+	var templateEnv stringList
+	flag.Var(&templateEnv, "template-env", "environment variable templates may read as .Env.NAME; repeatable (default none)")
+	eol := flag.String("eol", "keep", "line endings for text files: keep, lf, crlf or gitattributes (from the target branch)")
+	finalNewline := flag.Bool("final-newline", false, "ensure text files end with a newline")
+	toUTF8 := flag.Bool("utf8", false, "transcode UTF-16 and Windows-1252 files to UTF-8")
+	srcDir := flag.String("src", "", "local directory to mirror instead of the listed files")
+	maxDepth := flag.Int("max-depth", 0, "with -src, how many directory levels to read, 1 being only its own files (0 for no limit)")
+	symlinks := flag.String("symlinks", symlinksSkip, "with -src, what to do with symbolic links: skip, follow (commit their targets' content) or link (commit them as links)")
+	gitKeep := flag.Bool("gitkeep", false, "with -src, add a "+gitKeepFile+" to every empty directory, and delete remote ones from directories that have other files")
+	destPrefix := flag.String("dest-prefix", "", "repository directory to place the files under, e.g. services/my-service/")
+	prune := flag.Bool("prune", false, "delete remote files under -dest-prefix that are not present locally")
+	protect := flag.String("protect-external", "", "hold back files modified remotely since the last sync (tracked in "+managedStatePath+"): flag (leave them and report them) or pr (open a pull request instead of committing)")
+	replaceMismatched := flag.Bool("replace-type-mismatch", false, "delete a remote directory where a file is synced, or a remote file where a directory is, instead of failing")
+	archivePath := flag.String("archive", "", "commit the contents of a .tar, .tar.gz or .zip archive instead of the listed files")
+	archiveMaxBytes := flag.Int64("archive-max-bytes", 512<<20, "maximum total uncompressed size of -archive contents")
+	archiveStrip := flag.Int("archive-strip", 0, "leading path components to strip from -archive entries")
+	prMode := flag.Bool("pr", false, "push to a head branch and open a pull request instead of committing to -branch")
+	prBranch := flag.String("pr-branch", "", "head branch for -pr (default gitapis/sync-<branch>)")
+	prTitle := flag.String("pr-title", "", "pull request title (default the commit message)")
+	prBodyTemplate := flag.String("pr-body-template", "", "text/template file for pull request bodies (default a change table, diffs, provenance and a checklist)")
+	prMilestone := flag.String("pr-milestone", "", "open milestone, by title or number, for the pull requests a sync opens")
+	prDraft := flag.Bool("pr-draft", false, "open pull requests as drafts")
+	mergeQueue := flag.Bool("merge-queue", false, "with -pr, add the pull request to the base branch's merge queue, once its checks and reviews pass")
+	mergeQueueWait := flag.Duration("merge-queue-wait", 0, "with -merge-queue, wait up to this long for the pull request to merge, failing if it leaves the queue unmerged")
+	prDiffLines := flag.Int("pr-diff-lines", defaultPRDiffLines, "lines of each file's diff a pull request body shows (0 for no diffs)")
+	forkIfNeeded := flag.Bool("fork", false, "when the token cannot push to the repo, push to a fork and open a cross-repository pull request")
+	annotate := flag.Bool("annotate", false, "report who last changed each file that gets overwritten")
+	orphan := flag.Bool("orphan", false, "replace -branch with a single parentless commit of the files (gh-pages style)")
+	pages := flag.Bool("pages", false, "serve -branch with GitHub Pages after publishing")
+	pagesPath := flag.String("pages-path", "/", "directory of -branch to serve: / or /docs")
+	pagesCNAME := flag.String("pages-cname", "", "custom domain for the Pages site")
+	pagesHTTPS := flag.Bool("pages-https", false, "enforce HTTPS for the Pages site")
+	pagesWait := flag.Duration("pages-wait", 0, "wait up to this long for the Pages build to go live")
+	maxFiles := flag.Int("max-files", 1000, "maximum number of files per run (0 for no limit)")
+	skipCI := flag.Bool("skip-ci", false, "add [skip ci] to the commit message so workflows don't run")
+	signoff := flag.String("signoff", "", "add a Signed-off-by trailer for this \"Name <email>\"")
+	var trailerFlags stringList
+	flag.Var(&trailerFlags, "trailer", "commit trailer as \"Key: value\"; repeatable")
+	groupBy := flag.String("group-by", groupSingle, "commit grouping: single, directory (one commit per top-level directory) or file")
+	var landFirst, landLast stringList
+	flag.Var(&landFirst, "land-first", "commit files matching this .gitattributes-style pattern before the rest, in a separate commit, like -group-by; repeatable")
+	flag.Var(&landLast, "land-last", "commit files matching this .gitattributes-style pattern after the rest, in a separate commit, like -group-by; repeatable")
+	groupMessage := flag.String("group-message", defaultGroupMessage, "commit message template per group (.Message, .Group, .Files, .Count)")
+	idempotencyKey := flag.String("idempotency-key", "", "record this key (e.g. the CI run ID) in a "+idempotencyTrailer+" trailer, and skip branches that already have a commit with it")
+	lockBranch := flag.Bool("lock", false, "hold a lock ref ("+lockRefPrefix+"<branch>) while syncing, so concurrent runs on a branch queue up")
+	lockWait := flag.Duration("lock-wait", 10*time.Minute, "how long -lock waits for another run to release the lock")
+	lockTTL := flag.Duration("lock-ttl", 15*time.Minute, "how long a -lock is held at most before others may take it over")
+	baseRef := flag.String("base", "", "branch, tag or SHA to create -branch from when it doesn't exist (default the repo's default branch)")
+	verify := flag.String("verify", verifyOff, "read back each commit and check its ref and tree (tree), and its signature (signed)")
+	flag.StringVar(&auditLogPath, "audit-log", "", auditLogUsage)
+	tokenFlags(flag.CommandLine)
+	cacheFlags(flag.CommandLine)
+	httpClientFlags(flag.CommandLine)
+	encryption := encryptionFlags(flag.CommandLine)
+	planPath := flag.String("plan", "", "write the commit that would be made to this plan file instead of making it")
+	snapshotPath := flag.String("snapshot", "", "with -plan, compare against this snapshot from the snapshot command instead of the remote, offline")
+	rollbackFile := flag.String("rollback-file", defaultRollbackFile, "record the branch's previous head here for the rollback command (empty to disable)")
+	runsFile := flag.String("runs-file", defaultRunsFile, "record what the run did to each repository in this database, for the status command (empty to disable)")
+	notes := flag.Bool("notes", false, "attach sync metadata to each created commit as a note in "+notesRef)
+	withProvenance := flag.Bool("provenance", false, "add a provenance file with source digests and builder identity to each commit")
+	provenancePath := flag.String("provenance-path", defaultProvenancePath, "repository path of the -provenance file")
+	var regionGlobs stringList
+	flag.Var(&regionGlobs, "managed-region", "only rewrite the region between \"# "+regionBegin+"\" and \"# "+regionEnd+"\" comments of files matching this .gitattributes-style pattern, adding one if missing; repeatable")
+	var generatedGlobs stringList
+	flag.Var(&generatedGlobs, "linguist-generated", "mark synced files matching this .gitattributes-style pattern linguist-generated=true in a managed region of the root .gitattributes, in the same commit; repeatable")
+	var mergeGlobs stringList
+	flag.Var(&mergeGlobs, "merge", "deep-merge JSON and YAML files matching this .gitattributes-style pattern into the remote ones, keeping remote-only keys and YAML comments; repeatable")
+	var stampGlobs stringList
+	flag.Var(&stampGlobs, "stamp", "stamp files matching this .gitattributes-style pattern with a -stamp-template header; repeatable")
+	stampTemplate := flag.String("stamp-template", defaultStampTemplate, "header for -stamp files (.Tool, .Version, .Repo, .Branch, .Path, .Source, .Time, .RunID), ignored when comparing")
+	checksumsPath := flag.String("checksums", "", "add a manifest of SHA-256 digests of the synced files at this repository path, e.g. "+defaultChecksumsPath+" (JSON for .json)")
+	flag.IntVar(&compareParallel, "compare-parallel", compareParallel, "files to compare with the remote at once")
+	flag.IntVar(&maxTreeBytes, "max-tree-bytes", maxTreeBytes, "split tree creation into requests of at most this many bytes")
+	flag.StringVar(&blobJournalPath, "blob-journal", "", blobJournalUsage)
+	flag.StringVar(&fileErrorPolicy, "on-error", fileErrorPolicy, fileErrorPolicyUsage)
+	reposFlag := flag.String("repos", "", "sync to several repositories: comma-separated owner/repo list, or @file with one per line")
+	reposSearch := flag.String("repos-search", "", "sync to the repositories matching this search query, e.g. \"org:acme filename:.travis.yml\", along with any -repos")
+	reposSearchType := flag.String("repos-search-type", searchCode, "search API for -repos-search: code, issues or repositories")
+	parallel := flag.Int("parallel", 4, "repositories to sync at once with -repos")
+	canary := flag.String("canary", "", "with -repos, sync these repositories first, as a count of leading targets or an owner/repo list, before the rest")
+	waveSize := flag.Int("wave-size", 0, "with -repos, sync the repositories after -canary this many at a time (0 for all at once)")
+	waveChecks := flag.Bool("wave-checks", false, "after each wave, wait for the checks of its commits, counting failed checks as failed repositories")
+	waveChecksTimeout := flag.Duration("wave-checks-timeout", 30*time.Minute, "how long -wave-checks waits for a commit's checks")
+	waveSoak := flag.Duration("wave-soak", 0, "how long to wait after each wave before starting the next")
+	waveMaxFailures := flag.Float64("wave-max-failures", 0, "fraction of a wave's repositories that may fail without stopping the rollout")
+	reportPath := flag.String("report", "", "write a report of every repository and branch synced to this file")
+	reportFormat := flag.String("report-format", "", "format of -report: markdown or html (default from the file extension)")
+	flag.IntVar(&rateFloor, "rate-floor", 100, "pause all requests when fewer than this many remain in the rate limit window (0 to disable)")
+	flag.IntVar(&repoRequestBudget, "repo-budget", 0, "maximum API requests per repository (0 for no limit)")
+	forgeName := flag.String("forge", forgeGitHub, "hosting platform to sync to: github, gitlab, bitbucket, gitea (or forgejo), or git to clone and push without an API")
+	forgeURL := flag.String("forge-url", "", "API base URL of the -forge (default the platform's public API), or the remote URL for git")
+	configPath := flag.String("config", "", "YAML or TOML (.toml) file of flag settings (flag name: value, a list for repeatable flags, files: to sync, and overrides: of branch, files, exclude and vars per owner/repo); flags given on the command line take precedence")
+	if configMode {
+		if err := runConfigCommand(flag.CommandLine, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	var inputFiles []string
+	if actionMode {
+		flag.CommandLine.Parse(os.Args[2:])
+		var err error
+		if inputFiles, err = applyActionInputs(flag.CommandLine); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		flag.Parse()
+	}
+	var overrides map[repoTarget]*repoOverride
+	if *configPath != "" {
+		configFiles, configOverrides, err := applyConfig(flag.CommandLine, *configPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		overrides = configOverrides
+		if len(inputFiles) == 0 && flag.NArg() == 0 {
+			inputFiles = configFiles
+		}
+	}
+
+	if err := checkFlagConflicts(flag.CommandLine); err != nil {
+		log.Fatal(err)
+	}
+
+	enc, err := encryption()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *policyMode {
+		// Policy goes through review, and its workflows had better run.
+		if *forgeName != forgeGitHub {
+			log.Fatal("-policy needs -forge github")
+		}
+		*prMode, *lintWorkflows = true, true
+		if len(policyLabels) == 0 {
+			policyLabels = stringList{defaultPolicyLabel}
+		}
+	}
+	if *symlinks != symlinksSkip && *symlinks != symlinksFollow && *symlinks != symlinksLink {
+		log.Fatalf("-symlinks must be %q, %q or %q", symlinksSkip, symlinksFollow, symlinksLink)
+	}
+	if *symlinks == symlinksLink && *orphan {
+		log.Fatal("-symlinks link cannot be combined with -orphan")
+	}
+	if !validFileErrorPolicy(fileErrorPolicy) {
+		log.Fatalf("-on-error must be %q, %q or %q", onErrorFailFast, onErrorCommitSucceeded, onErrorAllOrNothing)
+	}
+	if *verify != verifyOff && *verify != verifyTree && *verify != verifySigned {
+		log.Fatalf("-verify must be %q or %q", verifyTree, verifySigned)
+	}
+	if *reportFormat != "" && *reportFormat != reportMarkdown && *reportFormat != reportHTML {
+		log.Fatalf("-report-format must be %q or %q", reportMarkdown, reportHTML)
+	}
+	for _, value := range hookFlags {
+		stage, command, err := parseHookFlag(value)
+		if err != nil {
+			log.Fatal(err)
+		}
+		registerHook(stage, externalHook(command))
+	}
+	if *licenseHeaderPath != "" {
+		header, err := loadLicenseHeader(*licenseHeaderPath, licenseGlobs, *licenseFix)
+		if err != nil {
+			log.Fatal(err)
+		}
+		registerHook(hookPreCompare, licenseHeaderHook(header))
+	}
+	if *formatFiles || len(formatCommands) > 0 {
+		var commands []formatCommand
+		for _, value := range formatCommands {
+			c, err := parseFormatCommand(value)
+			if err != nil {
+				log.Fatal(err)
+			}
+			commands = append(commands, c)
+		}
+		registerHook(hookPreCompare, formatHook(*formatFiles, commands))
+	}
+	if *transformsPath != "" {
+		rules, err := loadTransforms(*transformsPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		registerHook(hookPreCompare, transformHook(rules))
+	}
+	// Registered after the external hooks so they see their final content.
+	if *checkWorkflows || *lintWorkflows {
+		registerHook(hookPreCommit, workflowCheckHook(*lintWorkflows))
+	}
+	if *scanForSecrets {
+		rules, err := loadSecretRules(*secretRulesPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		registerHook(hookPreCommit, secretScanHook(rules, *allowSecrets))
+	}
 
-	token := os.Getenv("GITHUB_TOKEN")
-	if token == "" {
-		log.Fatal("GITHUB_TOKEN is not set in the environment")
+	owner := *ownerFlag
+	repo := *repoFlag
+	branches := splitList(*branchFlag)
+	if len(branches) == 0 {
+		log.Fatal("-branch must name at least one branch")
+	}
+	trailers := []string(trailerFlags)
+	if *signoff != "" {
+		trailers = append(trailers, "Signed-off-by: "+*signoff)
+	}
+	if *idempotencyKey != "" {
+		trailers = append(trailers, idempotencyTrailer+": "+*idempotencyKey)
+	}
+	commitMessage, err := buildCommitMessage(*messageFlag, *skipCI, trailers)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Landing order splits a run into commits just like a grouping policy,
+	// and so rules out the same options.
+	landing := landingOrder{First: landFirst, Last: landLast}
+	grouped := *groupBy != groupSingle || landing.set()
+	switch *protect {
+	case "", protectFlag:
+	case protectPR:
+		if grouped || *forgeName != forgeGitHub {
+			log.Fatal("-protect-external pr cannot be combined with -group-by, and needs -forge github")
+		}
+	default:
+		log.Fatalf("invalid -protect-external %q: want flag or pr", *protect)
+	}
+	switch *notifyOn {
+	case "success", "failure", "always":
+	default:
+		log.Fatalf("invalid -notify-on %q: want success, failure or always", *notifyOn)
+	}
+	var notifyTmpl *template.Template
+	if *notifyURL != "" || *notifyTemplate != "" {
+		if notifyTmpl, err = loadNotifyTemplate(*notifyTemplate); err != nil {
+			log.Fatal(err)
+		}
 	}
 
-	owner := "Santosh-etailify" // change this
-	repo := "gitapis10"         // change this
-	branch := "main"            // change if needed
-	commitMessage := "Upsert files from Go script"
+	cfg := &syncConfig{
+		Message:        *messageFlag,
+		CommitMessage:  commitMessage,
+		Trailers:       trailers,
+		SkipCI:         *skipCI,
+		ValuesPath:     *valuesPath,
+		TemplateVars:   templateVars,
+		TemplateEnv:    templateEnv,
+		Normalize:      normalizeOptions{EOL: *eol, FinalNewline: *finalNewline, UTF8: *toUTF8},
+		DestPrefix:     *destPrefix,
+		MaxFiles:       *maxFiles,
+		Prune:          *prune,
+		ReplaceTypes:   *replaceMismatched,
+		GitKeep:        *gitKeep,
+		Protect:        *protect,
+		Encryption:     enc,
+		Base:           *baseRef,
+		Verify:         *verify,
+		PR:             *prMode,
+		PRBranch:       *prBranch,
+		PRTitle:        *prTitle,
+		Policy:         *policyMode,
+		Fork:           *forkIfNeeded,
+		Annotate:       *annotate,
+		Orphan:         *orphan,
+		IdempotencyKey: *idempotencyKey,
+		Lock:           *lockBranch,
+		LockWait:       *lockWait,
+		LockTTL:        *lockTTL,
+		GroupBy:        *groupBy,
+		Landing:        landing,
+		GroupMessage:   *groupMessage,
+		PagesWait:      *pagesWait,
+		PostComment:    *postComment,
+		RollbackFile:   *rollbackFile,
+		NotifyURL:      *notifyURL,
+		NotifyOn:       *notifyOn,
+		NotifyTemplate: notifyTmpl,
+	}
+	if *withProvenance {
+		if reason := validatePath(*provenancePath); reason != "" {
+			log.Fatalf("invalid -provenance-path: %s", reason)
+		}
+		cfg.ProvenancePath = *provenancePath
+	}
+	if *checksumsPath != "" {
+		if reason := validatePath(*checksumsPath); reason != "" {
+			log.Fatalf("invalid -checksums: %s", reason)
+		}
+		cfg.ChecksumsPath = *checksumsPath
+	}
+	if len(regionGlobs) > 0 {
+		cfg.Regions = &regionConfig{Globs: regionGlobs}
+	}
+	if len(generatedGlobs) > 0 {
+		cfg.Generated = generatedGlobs
+	}
+	if len(mergeGlobs) > 0 {
+		cfg.Merge = &mergeConfig{Globs: mergeGlobs}
+	}
+	if len(stampGlobs) > 0 {
+		if cfg.Stamp, err = newStampConfig(stampGlobs, *stampTemplate); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *securityFlag != "" {
+		if cfg.Security, err = parseSecuritySettings(*securityFlag); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *teamsPath != "" {
+		if cfg.Teams, err = loadTeams(*teamsPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *environmentsPath != "" {
+		if cfg.Environments, err = loadEnvironments(*environmentsPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *settingsPath != "" {
+		if cfg.Settings, err = loadRepoSettings(*settingsPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *rulesetsPath != "" {
+		if cfg.Rulesets, err = loadRulesets(*rulesetsPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *policyMode {
+		prLabels = append(prLabels, policyLabels...)
+	}
+	if len(prLabels) > 0 || len(prAssignees) > 0 || len(prReviewers) > 0 || *prMilestone != "" || *prDraft {
+		cfg.PRRouting = &prRouting{Labels: prLabels, Assignees: prAssignees, Reviewers: prReviewers, Milestone: *prMilestone, Draft: *prDraft}
+	}
+	if *mergeQueue {
+		if !*prMode {
+			log.Fatal("-merge-queue needs -pr")
+		}
+		cfg.MergeQueue, cfg.MergeQueueWait = true, *mergeQueueWait
+	}
+	if cfg.PRBody, err = loadPRBody(*prBodyTemplate, *prDiffLines, prChecklist); err != nil {
+		log.Fatal(err)
+	}
+	if *contentPolicyPath != "" {
+		if cfg.ContentPolicy, err = loadContentPolicy(*contentPolicyPath); err != nil {
+			log.Fatal(err)
+		}
+		if cfg.ContentPolicy.Action == contentPolicyPR && (*orphan || *planPath != "" || *forgeName != forgeGitHub) {
+			log.Fatal("a content policy with action pr cannot be combined with -orphan or -plan, and needs -forge github")
+		}
+	}
+	if *pages {
+		cfg.Pages = &pagesConfig{Path: *pagesPath, CNAME: *pagesCNAME, EnforceHTTPS: *pagesHTTPS}
+	}
 
 	localFiles := []string{
 		"main.go",
 	}
+	if flag.NArg() > 0 {
+		localFiles = flag.Args()
+	}
+	if len(inputFiles) > 0 {
+		localFiles = inputFiles
+	}
 
 	files := make(map[string]string)
+	if *srcDir != "" {
+		walk := walkOptions{MaxDepth: *maxDepth, Symlinks: *symlinks, KeepEmpty: *gitKeep}
+		tree, links, err := readLocalTree(*srcDir, walk)
+		if err != nil {
+			log.Fatal(err)
+		}
+		files, cfg.Links = tree, links
+		localFiles = nil
+	}
+	if *archivePath != "" {
+		expanded, err := readArchive(*archivePath, *archiveMaxBytes, *archiveStrip)
+		if err != nil {
+			log.Fatal(err)
+		}
+		files = expanded
+		localFiles = nil
+	}
 
 	for _, localPath := range localFiles {
 		content, err := os.ReadFile(localPath)
@@ -290,35 +632,259 @@ func main() {
 		}
 
 		// Use forward slashes even on Windows for GitHub paths
-		//repoPath := filepath.ToSlash(localPath)
+		repoPath, err := normalizeRepoPath(localPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, exists := files[repoPath]; exists {
+			log.Fatalf("%s and another file both map to %s", localPath, repoPath)
+		}
+
+		files[repoPath] = string(content)
+	}
+	if err := loadOverrideFiles(overrides); err != nil {
+		log.Fatal(err)
+	}
+	cfg.Overrides = overrides
+
+	if *policyMode {
+		if err := checkPolicyFiles(files); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *snapshotPath != "" {
+		if *planPath == "" || *forgeName != forgeGitHub || *reposFlag != "" || *reposSearch != "" || *notes || *pages || *orphan || *prMode || *forkIfNeeded || grouped || len(branches) > 1 {
+			log.Fatal("-snapshot needs -plan and a single -branch, and cannot be combined with -forge, -repos, -repos-search, -notes, -pages, -orphan, -pr, -fork or -group-by")
+		}
+		if cfg.Snapshot, err = readSnapshot(*snapshotPath); err != nil {
+			log.Fatal(err)
+		}
+		if cfg.Snapshot.Owner != owner || cfg.Snapshot.Repo != repo {
+			log.Fatalf("%s is a snapshot of %s/%s, not %s/%s", *snapshotPath, cfg.Snapshot.Owner, cfg.Snapshot.Repo, owner, repo)
+		}
+		if err := planOffline(cfg, branches[0], files, *planPath); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-		files[localPath] = string(content)
+	if *forgeName != forgeGitHub {
+		if *reposFlag != "" || *reposSearch != "" {
+			log.Fatal("-repos and -repos-search need -forge github")
+		}
+		if *prMode || *forkIfNeeded || *orphan || *pages || *planPath != "" || *notes || *annotate || *postComment ||
+			grouped || *verify != verifyOff || *lockBranch || *idempotencyKey != "" || *securityFlag != "" || *teamsPath != "" || *environmentsPath != "" || *settingsPath != "" || *rulesetsPath != "" {
+			log.Fatalf("-forge %s cannot be combined with -pr, -fork, -orphan, -pages, -plan, -notes, -annotate, -comment, -group-by, -verify, -lock, -idempotency-key, -security, -teams, -environments, -repo-settings or -rulesets", *forgeName)
+		}
+		if len(cfg.Links) > 0 && *forgeName != forgeGit {
+			log.Fatalf("-symlinks link needs -forge github or git; %s cannot commit symlinks", *forgeName)
+		}
+		f, err := newForge(*forgeName, *forgeURL, owner, repo)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// Without a GitHub client, only the synced .gitattributes apply.
+		prepared := make([]*preparedBranch, 0, len(branches))
+		for _, branch := range branches {
+			if strings.ContainsAny(branch, "*?[") {
+				log.Fatalf("branch patterns like %q need -forge github", branch)
+			}
+			p, err := prepareBranch(nil, cfg, owner, repo, branch, files)
+			if err != nil {
+				log.Fatalf("%s: %v", branch, err)
+			}
+			prepared = append(prepared, p)
+		}
+		failed := 0
+		for _, p := range prepared {
+			if out := syncForgeBranch(f, cfg, p); out.Err != nil {
+				log.Printf("%s: %v", p.Branch, out.Err)
+				failed++
+			}
+		}
+		if failed > 0 {
+			log.Fatalf("%d of %d branches failed", failed, len(branches))
+		}
+		return
 	}
 
 	// === GitHub Client ===
-	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
-	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
+	client, err := newGitHubClient()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *notes {
+		registerNoteHooks(client)
+	}
+
+	targets := []repoTarget{{Owner: owner, Repo: repo}}
+	if *reposFlag != "" {
+		if targets, err = parseTargets(*reposFlag, owner); err != nil {
+			log.Fatal(err)
+		}
+		if len(targets) == 0 && *reposSearch == "" {
+			log.Fatal("-repos names no repositories")
+		}
+	}
+	if *reposSearch != "" {
+		found, err := searchTargets(client, *reposSearchType, *reposSearch)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *reposFlag == "" {
+			targets = nil
+		}
+		listed := make(map[repoTarget]bool)
+		for _, t := range targets {
+			listed[t] = true
+		}
+		for _, t := range found {
+			if !listed[t] {
+				targets = append(targets, t)
+			}
+		}
+		if len(targets) == 0 {
+			log.Fatal("-repos-search matches no repositories")
+		}
+	}
+
+	targeted := make(map[repoTarget]bool, len(targets))
+	for _, t := range targets {
+		targeted[t] = true
+	}
+	for t := range overrides {
+		if !targeted[t] {
+			log.Printf("⚠️ %s is overridden in %s but is not a target of this run", t, *configPath)
+		}
+	}
+
+	if *planPath != "" {
+		if len(targets) > 1 {
+			log.Fatal("-plan takes a single repository")
+		}
+		t := targets[0]
+		planCfg, planBranches, planFiles := cfg, branches, files
+		if o := cfg.Overrides[t]; o != nil {
+			planCfg, planBranches, planFiles = o.apply(cfg, branches, files)
+		}
+		prepared, err := prepareRepo(client, planCfg, t.Owner, t.Repo, planBranches, planFiles)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *orphan || *prMode || *forkIfNeeded || grouped || len(prepared) > 1 {
+			log.Fatal("-plan takes a single -branch and cannot be combined with -orphan, -pr, -fork or -group-by")
+		}
+		if err := planBranch(client, cfg, t.Owner, t.Repo, prepared[0], *planPath); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if (*waveChecks || *waveSoak > 0 || *waveMaxFailures > 0) && *canary == "" && *waveSize == 0 {
+		log.Fatal("-wave-checks, -wave-soak and -wave-max-failures need -canary or -wave-size")
+	}
 
 	// === Run Upsert ===
-	err := createRepo(client, owner, repo)
-	if err != nil {
-		log.Fatalf("Failed to create repo: %v", err)
+	var outcomes []repoOutcome
+	if len(targets) == 1 {
+		outcomes = []repoOutcome{syncRepo(client, cfg, targets[0], branches, files)}
+	} else if *canary != "" || *waveSize > 0 {
+		plan := &rolloutPlan{Canary: *canary, WaveSize: *waveSize, Checks: *waveChecks, ChecksTimeout: *waveChecksTimeout, Soak: *waveSoak, MaxFailures: *waveMaxFailures}
+		waves, err := plan.waves(targets, owner)
+		if err != nil {
+			log.Fatal(err)
+		}
+		outcomes = rollout(client, cfg, plan, waves, branches, files, *parallel)
+	} else {
+		outcomes = fanOut(client, cfg, targets, branches, files, *parallel)
+	}
+	if *reportPath != "" {
+		if err := writeReport(*reportPath, *reportFormat, outcomes); err != nil {
+			log.Printf("Failed to write report: %v", err)
+		}
+	}
+	if *runsFile != "" {
+		if err := recordRuns(*runsFile, outcomes, time.Now().UTC()); err != nil {
+			log.Printf("Failed to record run history: %v", err)
+		}
+	}
+	if inActions() {
+		reportToActions(outcomes)
+	}
+	if *policyMode {
+		if err := recordPolicyAdoption(*policyStatus, outcomes, time.Now().UTC()); err != nil {
+			log.Printf("Failed to record policy adoption: %v", err)
+		}
 	}
-	// err = createInitialMainBranch(client, owner, repo, files)
-	// if err != nil {
-	// 	log.Fatalf("❌ Error: %v", err)
-	// }
 
-	result, err := upsertMultipleFilesSafe(client, owner, repo, branch, files, commitMessage)
-	if err != nil {
-		log.Fatalf("Failed to upsert files: %v", err)
+	if len(targets) == 1 {
+		out := outcomes[0]
+		if out.Err != nil {
+			log.Fatal(out.Err)
+		}
+		if len(out.Branches) > 1 {
+			printBranchReport(out.Branches)
+		}
+		failed := 0
+		for _, b := range out.Branches {
+			if b.Err != nil {
+				failed++
+			}
+		}
+		if failed > 0 {
+			log.Fatalf("%d of %d branches failed", failed, len(out.Branches))
+		}
+		return
+	}
+
+	printRepoReport(outcomes)
+	failed := 0
+	for _, out := range outcomes {
+		if out.failed() {
+			failed++
+		}
+	}
+	if failed > 0 {
+		log.Fatalf("%d of %d repositories failed", failed, len(outcomes))
+	}
+}
+
+// splitList splits a comma-separated flag value, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// printLastChanges reports the previous author of every overwritten file.
+func printLastChanges(result map[string]string, previous map[string]logEntry) {
+	for file, status := range result {
+		last, ok := previous[file]
+		if !ok || status != "updated" {
+			continue
+		}
+		fmt.Printf("  %s was last changed by %s on %s (%s)\n", file, last.Author, last.Date.Format("2006-01-02"), shortSHA(last.SHA))
 	}
+}
 
+func printSummary(result map[string]string) {
 	//=== Print Summary ===
 	fmt.Println("File Update Summary:")
+	var failed []string
 	for file, status := range result {
 		fmt.Printf("  %s → %s\n", file, status)
+		if status == "error" || status == compareFailed {
+			failed = append(failed, file)
+		}
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		fmt.Printf("⚠️ %d files failed and were not committed: %s\n", len(failed), strings.Join(failed, ", "))
 	}
 }
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// --- Managed State ---
+
+// managedStatePath records, in the repository itself, the blob each synced
+// file had when the tool last wrote it. A file whose blob has changed since
+// was edited by someone else.
+const managedStatePath = ".gitapis/managed.json"
+
+// What a sync does with files edited by someone else since the last sync:
+// leave them be and flag them, or propose the whole sync as a pull request.
+const (
+	protectFlag = "flag"
+	protectPR   = "pr"
+)
+
+const externallyModified = "externally modified"
+
+type managedState struct {
+	Files map[string]string `json:"files"`
+	// raw is the state file as read, to tell whether it changed.
+	raw string
+}
+
+// externalChanges is the error a sync with protectPR stops with, so the
+// caller can open a pull request instead.
+type externalChanges struct {
+	Paths []string
+}
+
+func (e *externalChanges) Error() string {
+	return fmt.Sprintf("%d files were modified since the last sync: %s", len(e.Paths), strings.Join(e.Paths, ", "))
+}
+
+// readManagedState reads the state file of commit head, returning an empty
+// state when there is none yet.
+func readManagedState(f forge, head string, tree *forgeTree) (*managedState, error) {
+	state := &managedState{Files: make(map[string]string)}
+	if _, ok := tree.Entries[managedStatePath]; !ok {
+		return state, nil
+	}
+	reader, ok := f.(contentReader)
+	if !ok {
+		return nil, fmt.Errorf("protecting external changes needs a forge that can read %s", managedStatePath)
+	}
+	content, err := reader.ReadFile(head, managedStatePath)
+	if err != nil {
+		return nil, err
+	}
+	state.raw = content
+	if err := json.Unmarshal([]byte(content), state); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", managedStatePath, err)
+	}
+	if state.Files == nil {
+		state.Files = make(map[string]string)
+	}
+	return state, nil
+}
+
+// modified reports whether the remote blob sha of path differs from the one
+// the tool last wrote. Files it never wrote, and blobs the forge does not
+// list, count as unmodified.
+func (s *managedState) modified(path, sha string) bool {
+	if s == nil || sha == "" {
+		return false
+	}
+	recorded, ok := s.Files[path]
+	return ok && recorded != sha
+}
+
+// holdExternalChanges takes files modified since the last sync out of
+// changes and marks them in result, except those exempt says others may edit.
+func (s *managedState) holdExternalChanges(tree *forgeTree, changes, result map[string]string, exempt func(string) bool) {
+	for path := range changes {
+		if result[path] == "updated" && !exempt(path) && s.modified(path, tree.Entries[path].SHA) {
+			delete(changes, path)
+			result[path] = externallyModified
+		}
+	}
+}
+
+// reportExternalChanges warns about the files held back in result, or, with
+// protectPR, stops the sync with an externalChanges error.
+func reportExternalChanges(result map[string]string, mode string) error {
+	var held []string
+	for path, status := range result {
+		if status == externallyModified {
+			held = append(held, path)
+		}
+	}
+	if len(held) == 0 {
+		return nil
+	}
+	sort.Strings(held)
+	if mode == protectPR {
+		return &externalChanges{Paths: held}
+	}
+	log.Printf("⚠️ Not overwriting %d files modified since the last sync: %s", len(held), strings.Join(held, ", "))
+	return nil
+}
+
+// change returns the updated state file for a commit of changes on top of
+// tree, or false when it would not change. Files that are still there but
+// not synced this time, and held files, keep their old blob, so the latter
+// stay flagged until someone reverts them or a sync without protection
+// overwrites them.
+func (s *managedState) change(tree *forgeTree, files, changes, result map[string]string) (fileChange, bool, error) {
+	next := managedState{Files: make(map[string]string, len(s.Files)+len(files))}
+	for path, sha := range s.Files {
+		if _, ok := tree.Entries[path]; ok && result[path] != "deleted" {
+			next.Files[path] = sha
+		}
+	}
+	for path := range files {
+		switch {
+		case result[path] == externallyModified || result[path] == compareFailed:
+		case changes[path] != "":
+			next.Files[path] = gitBlobSHA(changes[path])
+		case tree.Entries[path].SHA != "":
+			next.Files[path] = tree.Entries[path].SHA
+		}
+	}
+	b, err := json.MarshalIndent(next, "", "  ")
+	if err != nil {
+		return fileChange{}, false, err
+	}
+	content := string(b) + "\n"
+	_, exists := tree.Entries[managedStatePath]
+	if exists && content == s.raw {
+		return fileChange{}, false, nil
+	}
+	return fileChange{Path: managedStatePath, Content: content, Mode: "100644", Exists: exists}, true, nil
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// --- Structured Merge ---
+
+// mergeConfig deep-merges the synced content of JSON and YAML files matching
+// Globs into the remote document instead of replacing it: objects are merged
+// key by key, and anything else, arrays included, is taken from the synced
+// file. Keys only the remote has are kept, in their place, and so are YAML
+// comments.
+type mergeConfig struct {
+	Globs []string
+}
+
+func (c *mergeConfig) matches(p string) bool {
+	if c == nil {
+		return false
+	}
+	for _, glob := range c.Globs {
+		if matchAttrPattern(glob, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// mergeChange returns the status and content to commit for a file that
+// matches the merge globs.
+func (c *mergeConfig) mergeChange(f forge, head, p, content string, exists bool) (string, string, error) {
+	if !exists {
+		return "created", content, nil
+	}
+	reader, ok := f.(contentReader)
+	if !ok {
+		return "", "", fmt.Errorf("merging files needs a forge that can read them")
+	}
+	remote, err := readRemoteFile(reader, head, p)
+	if err != nil {
+		return "", "", err
+	}
+	var merged string
+	switch strings.ToLower(path.Ext(p)) {
+	case ".json":
+		merged, err = mergeJSON(remote, content)
+	case ".yml", ".yaml":
+		merged, err = mergeYAML(remote, content)
+	default:
+		err = errors.New("only .json, .yml and .yaml files can be merged")
+	}
+	if err != nil {
+		return "", "", &fileError{Path: p, Err: fmt.Errorf("merging: %w", err)}
+	}
+	if merged == remote {
+		return "skipped", "", nil
+	}
+	return "updated", merged, nil
+}
+
+// jsonObject is a JSON object that remembers the order of its keys, so a
+// merged file only changes where the synced content does.
+type jsonObject struct {
+	keys   []string
+	values map[string]any
+}
+
+func decodeJSON(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch tok {
+	case json.Delim('{'):
+		obj := &jsonObject{values: make(map[string]any)}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			if _, dup := obj.values[key.(string)]; !dup {
+				obj.keys = append(obj.keys, key.(string))
+			}
+			obj.values[key.(string)] = value
+		}
+		_, err := dec.Token()
+		return obj, err
+	case json.Delim('['):
+		list := []any{}
+		for dec.More() {
+			value, err := decodeJSON(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err := dec.Token()
+		return list, err
+	}
+	return tok, nil
+}
+
+func parseJSON(content string) (any, error) {
+	dec := json.NewDecoder(strings.NewReader(content))
+	dec.UseNumber()
+	value, err := decodeJSON(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("trailing data after the JSON document")
+	}
+	return value, nil
+}
+
+func mergeJSONValues(remote, local any) any {
+	r, ok := remote.(*jsonObject)
+	l, ok2 := local.(*jsonObject)
+	if !ok || !ok2 {
+		return local
+	}
+	for _, key := range l.keys {
+		if existing, found := r.values[key]; found {
+			r.values[key] = mergeJSONValues(existing, l.values[key])
+			continue
+		}
+		r.keys = append(r.keys, key)
+		r.values[key] = l.values[key]
+	}
+	return r
+}
+
+// mergeJSON merges local into remote, written with remote's indentation.
+func mergeJSON(remote, local string) (string, error) {
+	r, err := parseJSON(remote)
+	if err != nil {
+		return "", fmt.Errorf("remote: %w", err)
+	}
+	l, err := parseJSON(local)
+	if err != nil {
+		return "", fmt.Errorf("local: %w", err)
+	}
+	var b strings.Builder
+	if err := writeJSON(&b, mergeJSONValues(r, l), jsonIndent(remote), ""); err != nil {
+		return "", err
+	}
+	if strings.HasSuffix(remote, "\n") {
+		b.WriteByte('\n')
+	}
+	return b.String(), nil
+}
+
+// jsonIndent returns the indentation of the first indented line of content,
+// or two spaces.
+func jsonIndent(content string) string {
+	for _, line := range strings.Split(content, "\n")[1:] {
+		if trimmed := strings.TrimLeft(line, " \t"); trimmed != line && trimmed != "" {
+			return line[:len(line)-len(trimmed)]
+		}
+	}
+	return "  "
+}
+
+func writeJSON(b *strings.Builder, value any, indent, prefix string) error {
+	inner := prefix + indent
+	switch v := value.(type) {
+	case *jsonObject:
+		if len(v.keys) == 0 {
+			b.WriteString("{}")
+			return nil
+		}
+		b.WriteString("{\n")
+		for i, key := range v.keys {
+			b.WriteString(inner)
+			if err := writeJSONScalar(b, key); err != nil {
+				return err
+			}
+			b.WriteString(": ")
+			if err := writeJSON(b, v.values[key], indent, inner); err != nil {
+				return err
+			}
+			if i < len(v.keys)-1 {
+				b.WriteByte(',')
+			}
+			b.WriteByte('\n')
+		}
+		b.WriteString(prefix + "}")
+	case []any:
+		if len(v) == 0 {
+			b.WriteString("[]")
+			return nil
+		}
+		b.WriteString("[\n")
+		for i, item := range v {
+			b.WriteString(inner)
+			if err := writeJSON(b, item, indent, inner); err != nil {
+				return err
+			}
+			if i < len(v)-1 {
+				b.WriteByte(',')
+			}
+			b.WriteByte('\n')
+		}
+		b.WriteString(prefix + "]")
+	default:
+		return writeJSONScalar(b, v)
+	}
+	return nil
+}
+
+// writeJSONScalar writes v without escaping <, > and &, which config files
+// have no reason to.
+func writeJSONScalar(b *strings.Builder, v any) error {
+	var out bytes.Buffer
+	enc := json.NewEncoder(&out)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	b.Write(bytes.TrimSuffix(out.Bytes(), []byte("\n")))
+	return nil
+}
+
+func parseYAML(content string) (*yaml.Node, error) {
+	var doc yaml.Node
+	dec := yaml.NewDecoder(strings.NewReader(content))
+	if err := dec.Decode(&doc); err != nil && err != io.EOF {
+		return nil, err
+	}
+	var extra yaml.Node
+	if err := dec.Decode(&extra); err != io.EOF {
+		return nil, errors.New("multi-document YAML cannot be merged")
+	}
+	return &doc, nil
+}
+
+// mergeYAMLNodes merges local into remote in place. A replaced value keeps
+// the remote value's comments unless the synced one has its own.
+func mergeYAMLNodes(remote, local *yaml.Node) {
+	for i := 0; i+1 < len(local.Content); i += 2 {
+		key, value := local.Content[i], local.Content[i+1]
+		found := false
+		for j := 0; j+1 < len(remote.Content); j += 2 {
+			if remote.Content[j].Value != key.Value {
+				continue
+			}
+			found = true
+			existing := remote.Content[j+1]
+			if existing.Kind == yaml.MappingNode && value.Kind == yaml.MappingNode {
+				mergeYAMLNodes(existing, value)
+				break
+			}
+			if value.HeadComment == "" && value.LineComment == "" && value.FootComment == "" {
+				value.HeadComment, value.LineComment, value.FootComment = existing.HeadComment, existing.LineComment, existing.FootComment
+			}
+			remote.Content[j+1] = value
+			break
+		}
+		if !found {
+			remote.Content = append(remote.Content, key, value)
+		}
+	}
+}
+
+// mergeYAML merges local into remote. The result is re-encoded, so remote is
+// normalized to two-space indentation the first time it is merged.
+func mergeYAML(remote, local string) (string, error) {
+	r, err := parseYAML(remote)
+	if err != nil {
+		return "", fmt.Errorf("remote: %w", err)
+	}
+	l, err := parseYAML(local)
+	if err != nil {
+		return "", fmt.Errorf("local: %w", err)
+	}
+	switch {
+	case len(l.Content) == 0:
+		return remote, nil
+	case len(r.Content) == 0:
+		return local, nil
+	}
+	if r.Content[0].Kind == yaml.MappingNode && l.Content[0].Kind == yaml.MappingNode {
+		mergeYAMLNodes(r.Content[0], l.Content[0])
+	} else {
+		r.Content[0] = l.Content[0]
+	}
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(r); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Merge Queue ---
+
+// mergeQueuePoll is how often a queued pull request is checked on.
+const mergeQueuePoll = 15 * time.Second
+
+// errNoMergeQueue is returned for a base branch without a merge queue.
+var errNoMergeQueue = errors.New("no merge queue")
+
+// graphQL runs query with vars and decodes its data into out. Merge queue
+// operations have no REST equivalent.
+func graphQL(client *github.Client, query string, vars map[string]any, out any) error {
+	payload, err := json.Marshal(map[string]any{"query": query, "variables": vars})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, graphQLURL(client), bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+	var body struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return err
+	}
+	if len(body.Errors) > 0 {
+		return errors.New(body.Errors[0].Message)
+	}
+	return json.Unmarshal(body.Data, out)
+}
+
+const mergeQueueQuery = `query($owner: String!, $repo: String!, $branch: String!) {
+  repository(owner: $owner, name: $repo) {
+    mergeQueue(branch: $branch) { id }
+  }
+}`
+
+const enqueueMutation = `mutation($id: ID!) {
+  enqueuePullRequest(input: {pullRequestId: $id}) {
+    mergeQueueEntry { position }
+  }
+}`
+
+// autoMergeMutation asks for the pull request to join the queue once its
+// required checks and reviews pass, which is what GitHub's "Merge when
+// ready" does on a branch with a merge queue.
+const autoMergeMutation = `mutation($id: ID!) {
+  enablePullRequestAutoMerge(input: {pullRequestId: $id}) {
+    pullRequest { number }
+  }
+}`
+
+// enqueuePullRequest adds pr to the merge queue of base, right away if it
+// can merge already, otherwise once it can. It returns errNoMergeQueue if
+// base has none.
+func enqueuePullRequest(client *github.Client, owner, repo, base string, pr *github.PullRequest) error {
+	var queue struct {
+		Repository struct {
+			MergeQueue *struct {
+				ID string `json:"id"`
+			} `json:"mergeQueue"`
+		} `json:"repository"`
+	}
+	if err := graphQL(client, mergeQueueQuery, map[string]any{"owner": owner, "repo": repo, "branch": base}, &queue); err != nil {
+		return fmt.Errorf("GraphQL mergeQueue: %w", err)
+	}
+	if queue.Repository.MergeQueue == nil {
+		return errNoMergeQueue
+	}
+
+	var entry struct {
+		EnqueuePullRequest struct {
+			MergeQueueEntry struct {
+				Position int `json:"position"`
+			} `json:"mergeQueueEntry"`
+		} `json:"enqueuePullRequest"`
+	}
+	err := graphQL(client, enqueueMutation, map[string]any{"id": pr.GetNodeID()}, &entry)
+	if err == nil {
+		fmt.Printf("Pull request #%d queued at position %d\n", pr.GetNumber(), entry.EnqueuePullRequest.MergeQueueEntry.Position)
+		return nil
+	}
+	// A pull request still waiting on checks or reviews cannot join yet.
+	var ignored struct{}
+	if autoErr := graphQL(client, autoMergeMutation, map[string]any{"id": pr.GetNodeID()}, &ignored); autoErr != nil {
+		return fmt.Errorf("GraphQL enqueuePullRequest: %w; enablePullRequestAutoMerge: %v", err, autoErr)
+	}
+	fmt.Printf("Pull request #%d will join the merge queue once it can merge\n", pr.GetNumber())
+	return nil
+}
+
+const queuedPullRequestQuery = `query($owner: String!, $repo: String!, $number: Int!) {
+  repository(owner: $owner, name: $repo) {
+    pullRequest(number: $number) {
+      state
+      mergeCommit { oid }
+      mergeQueueEntry { state }
+      autoMergeRequest { enabledAt }
+    }
+  }
+}`
+
+// waitForMerge waits up to timeout for pr to land through the queue and
+// returns its merge commit SHA. A pull request that leaves the queue without
+// merging, because its checks failed or someone removed it, fails the wait.
+func waitForMerge(client *github.Client, owner, repo string, pr *github.PullRequest, timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	queued := false
+	for {
+		var out struct {
+			Repository struct {
+				PullRequest struct {
+					State       string `json:"state"`
+					MergeCommit *struct {
+						OID string `json:"oid"`
+					} `json:"mergeCommit"`
+					MergeQueueEntry *struct {
+						State string `json:"state"`
+					} `json:"mergeQueueEntry"`
+					AutoMergeRequest *struct{} `json:"autoMergeRequest"`
+				} `json:"pullRequest"`
+			} `json:"repository"`
+		}
+		err := graphQL(client, queuedPullRequestQuery, map[string]any{"owner": owner, "repo": repo, "number": pr.GetNumber()}, &out)
+		if err != nil {
+			log.Printf("⚠️ Failed to check on pull request #%d: %v", pr.GetNumber(), err)
+		} else {
+			p := out.Repository.PullRequest
+			switch {
+			case p.State == "MERGED" && p.MergeCommit != nil:
+				return p.MergeCommit.OID, nil
+			case p.State == "CLOSED":
+				return "", fmt.Errorf("pull request #%d was closed without merging", pr.GetNumber())
+			case p.MergeQueueEntry != nil:
+				queued = true
+			case queued || p.AutoMergeRequest == nil:
+				return "", fmt.Errorf("pull request #%d left the merge queue without merging", pr.GetNumber())
+			}
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("pull request #%d did not merge within %s", pr.GetNumber(), timeout)
+		}
+		time.Sleep(mergeQueuePoll)
+	}
+}
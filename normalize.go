@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/unicode"
+)
+
+// --- Line Ending and Encoding Normalization ---
+
+type normalizeOptions struct {
+	// EOL is "keep", "lf", "crlf", or "gitattributes" to follow the text and
+	// eol attributes of each path.
+	EOL          string
+	FinalNewline bool
+	UTF8         bool
+}
+
+// isBinary uses git's heuristic: a NUL byte in the first 8000 bytes.
+func isBinary(content string) bool {
+	head := content
+	if len(head) > 8000 {
+		head = head[:8000]
+	}
+	return strings.IndexByte(head, 0) >= 0
+}
+
+// hasUTF16BOM reports whether content starts with a UTF-16 byte order mark.
+func hasUTF16BOM(content string) bool {
+	return strings.HasPrefix(content, "\xFF\xFE") || strings.HasPrefix(content, "\xFE\xFF")
+}
+
+// toUTF8 transcodes UTF-16 (detected by BOM) and non-UTF-8 content, assumed
+// to be Windows-1252, to UTF-8 and strips any UTF-8 BOM. Only text may be
+// passed: binary content is never valid UTF-8 and would be mangled.
+func toUTF8(content string) (string, error) {
+	b := []byte(content)
+	switch {
+	case hasUTF16BOM(content):
+		decoded, err := unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM).NewDecoder().Bytes(b)
+		if err != nil {
+			return "", err
+		}
+		return string(decoded), nil
+	case bytes.HasPrefix(b, []byte{0xEF, 0xBB, 0xBF}):
+		return string(b[3:]), nil
+	case !utf8.Valid(b):
+		decoded, err := charmap.Windows1252.NewDecoder().Bytes(b)
+		if err != nil {
+			return "", err
+		}
+		return string(decoded), nil
+	}
+	return content, nil
+}
+
+// eolFor resolves the line ending to use for p, or "" to leave it alone.
+func eolFor(p string, opts normalizeOptions, attrs *gitAttributes) string {
+	if opts.EOL != "gitattributes" {
+		if opts.EOL == "keep" {
+			return ""
+		}
+		return opts.EOL
+	}
+	if attrs.lookup(p, "text") == "unset" {
+		return ""
+	}
+	// Git stores every text path with LF endings; eol only affects checkouts.
+	if text := attrs.lookup(p, "text"); text == "set" || text == "auto" || attrs.lookup(p, "eol") != "" {
+		return "lf"
+	}
+	return ""
+}
+
+func normalizeContent(p, content string, opts normalizeOptions, attrs *gitAttributes) (string, error) {
+	// LFS objects are stored byte for byte, so only the pointer is text.
+	if attrs.isLFS(p) {
+		return content, nil
+	}
+	// UTF-16 text contains NUL bytes, so it is told from binary content by
+	// its BOM and transcoded before the binary check.
+	text := hasUTF16BOM(content) || !isBinary(content) && attrs.lookup(p, "text") != "unset"
+	if opts.UTF8 && text {
+		var err error
+		if content, err = toUTF8(content); err != nil {
+			return "", fmt.Errorf("failed to transcode %s to UTF-8: %w", p, err)
+		}
+	}
+	if isBinary(content) {
+		return content, nil
+	}
+
+	switch eolFor(p, opts, attrs) {
+	case "lf":
+		content = strings.ReplaceAll(content, "\r\n", "\n")
+	case "crlf":
+		content = strings.ReplaceAll(content, "\r\n", "\n")
+		content = strings.ReplaceAll(content, "\n", "\r\n")
+	}
+
+	if opts.FinalNewline && content != "" && !strings.HasSuffix(content, "\n") {
+		if strings.Contains(content, "\r\n") {
+			content += "\r\n"
+		} else {
+			content += "\n"
+		}
+	}
+	return content, nil
+}
+
+func normalizeFiles(files map[string]string, opts normalizeOptions, attrs *gitAttributes) (map[string]string, error) {
+	normalized := make(map[string]string, len(files))
+	for p, content := range files {
+		out, err := normalizeContent(p, content, opts, attrs)
+		if err != nil {
+			return nil, err
+		}
+		normalized[p] = out
+	}
+	return normalized, nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Git Notes ---
+
+const notesRef = "refs/notes/gitapis"
+
+// runID identifies this run in notes and logs: the Actions run when there is
+// one, a random ID otherwise.
+var runID = newRunID()
+
+func newRunID() string {
+	if id := os.Getenv("GITHUB_RUN_ID"); id != "" {
+		if attempt := os.Getenv("GITHUB_RUN_ATTEMPT"); attempt != "" {
+			return id + "-" + attempt
+		}
+		return id
+	}
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// syncNote is the machine-readable metadata attached to each commit.
+type syncNote struct {
+	Tool           string    `json:"tool"`
+	Version        string    `json:"version"`
+	RunID          string    `json:"run_id"`
+	Branch         string    `json:"branch"`
+	SourceChecksum string    `json:"source_checksum"`
+	SourceFiles    int       `json:"source_files"`
+	Time           time.Time `json:"time"`
+}
+
+// sourceChecksum hashes paths and contents in a stable order, so the same
+// source tree always yields the same value.
+func sourceChecksum(files map[string]string) string {
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	h := sha256.New()
+	for _, p := range paths {
+		fmt.Fprintf(h, "%s\x00%d\x00", p, len(files[p]))
+		h.Write([]byte(files[p]))
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// registerNoteHooks attaches a syncNote to every commit the run creates. The
+// checksum covers the whole source seen before comparison, not just the
+// files that changed.
+func registerNoteHooks(client *github.Client) {
+	var mu sync.Mutex
+	sources := make(map[string]*syncNote)
+	key := func(hc *hookContext) string { return hc.Owner + "/" + hc.Repo + "@" + hc.Branch }
+
+	registerHook(hookPreCompare, func(hc *hookContext) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sources[key(hc)] = &syncNote{SourceChecksum: sourceChecksum(hc.Files), SourceFiles: len(hc.Files)}
+		return nil
+	})
+	registerHook(hookPostCommit, func(hc *hookContext) error {
+		var note syncNote
+		mu.Lock()
+		if source := sources[key(hc)]; source != nil {
+			note = *source
+		}
+		mu.Unlock()
+		note.Tool, note.Version, note.RunID = "gitapis", version, runID
+		note.Branch, note.Time = hc.Branch, time.Now().UTC()
+
+		content, err := json.MarshalIndent(note, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := addNote(client, hc.Owner, hc.Repo, hc.CommitSHA, string(content)+"\n"); err != nil {
+			// The commit is already pushed; a missing note is not worth failing for.
+			log.Printf("⚠️ Failed to attach note to %s: %v", shortSHA(hc.CommitSHA), err)
+		}
+		return nil
+	})
+}
+
+// addNote sets the note for commitSHA in notesRef, replacing any existing
+// one, and retries when another writer moves the notes ref concurrently.
+func addNote(client *github.Client, owner, repo, commitSHA, content string) error {
+	ctx := context.Background()
+	blob, err := newBlobUploader(client, owner, repo, nil).upload(content)
+	if err != nil {
+		return fmt.Errorf("CreateBlob: %w", err)
+	}
+	entry := &github.TreeEntry{Path: github.String(commitSHA), Mode: github.String("100644"), Type: github.String("blob"), SHA: github.String(blob)}
+
+	for attempt := 1; ; attempt++ {
+		ref, resp, err := client.Git.GetRef(ctx, owner, repo, notesRef)
+		if err != nil && (resp == nil || resp.StatusCode != 404) {
+			return fmt.Errorf("GetRef: %w", err)
+		}
+
+		baseTree := ""
+		var parents []*github.Commit
+		if ref != nil {
+			parent, _, err := client.Git.GetCommit(ctx, owner, repo, ref.Object.GetSHA())
+			if err != nil {
+				return fmt.Errorf("GetCommit: %w", err)
+			}
+			baseTree = parent.Tree.GetSHA()
+			parents = []*github.Commit{{SHA: parent.SHA}}
+		}
+
+		tree, _, err := client.Git.CreateTree(ctx, owner, repo, baseTree, []*github.TreeEntry{entry})
+		if err != nil {
+			return fmt.Errorf("CreateTree: %w", err)
+		}
+		commit, _, err := client.Git.CreateCommit(ctx, owner, repo, &github.Commit{
+			Message: github.String("Notes added by 'gitapis'"),
+			Tree:    tree,
+			Parents: parents,
+		})
+		if err != nil {
+			return fmt.Errorf("CreateCommit: %w", err)
+		}
+
+		if ref == nil {
+			_, resp, err = client.Git.CreateRef(ctx, owner, repo, &github.Reference{Ref: github.String(notesRef), Object: &github.GitObject{SHA: commit.SHA}})
+		} else {
+			ref.Object.SHA = commit.SHA
+			_, resp, err = client.Git.UpdateRef(ctx, owner, repo, ref, false)
+		}
+		if err == nil {
+			return nil
+		}
+		if attempt == 3 || resp == nil || resp.StatusCode != 422 {
+			return fmt.Errorf("updating %s: %w", notesRef, err)
+		}
+	}
+}
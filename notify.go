@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"text/template"
+	"time"
+)
+
+// --- Completion Notifications ---
+
+// runSummary is the outcome of a single run, as exposed to notification
+// templates.
+type runSummary struct {
+	Owner     string
+	Repo      string
+	Branch    string
+	Success   bool
+	Error     string
+	CommitSHA string
+	CommitURL string
+	Results   map[string]string
+	Counts    map[string]int
+}
+
+func newRunSummary(owner, repo, branch string, result map[string]string, commitSHA, commitURL string, runErr error) runSummary {
+	s := runSummary{
+		Owner:     owner,
+		Repo:      repo,
+		Branch:    branch,
+		Success:   runErr == nil,
+		CommitSHA: commitSHA,
+		CommitURL: commitURL,
+		Results:   result,
+		Counts:    make(map[string]int),
+	}
+	if runErr != nil {
+		s.Error = runErr.Error()
+	}
+	for _, status := range result {
+		s.Counts[status]++
+	}
+	return s
+}
+
+// defaultNotifyTemplate produces a Slack-compatible incoming webhook payload.
+const defaultNotifyTemplate = `{"text": {{ json (printf "%s sync of %s/%s@%s: %d created, %d updated, %d skipped, %d error%s%s" (status .) .Owner .Repo .Branch (index .Counts "created") (index .Counts "updated") (index .Counts "skipped") (index .Counts "error") (commitSuffix .) (errorSuffix .)) }}}`
+
+var notifyFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"status": func(s runSummary) string {
+		if s.Success {
+			return "✅"
+		}
+		return "❌"
+	},
+	"commitSuffix": func(s runSummary) string {
+		if s.CommitURL == "" {
+			return ""
+		}
+		return " — " + s.CommitURL
+	},
+	"errorSuffix": func(s runSummary) string {
+		if s.Error == "" {
+			return ""
+		}
+		return "\nError: " + s.Error
+	},
+}
+
+// shouldNotify reports whether a run with the given outcome matches the
+// -notify-on setting ("success", "failure" or "always"), which is checked
+// when the flags are parsed.
+func shouldNotify(on string, success bool) bool {
+	switch on {
+	case "always":
+		return true
+	case "success":
+		return success
+	case "failure":
+		return !success
+	}
+	return false
+}
+
+// loadNotifyTemplate parses the -notify-template file, or the default
+// template when path is empty. It runs when the flags are checked, so a
+// broken template stops the run before anything is committed.
+func loadNotifyTemplate(path string) (*template.Template, error) {
+	text := defaultNotifyTemplate
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read notification template: %w", err)
+		}
+		text = string(b)
+	}
+	tmpl, err := template.New("notify").Funcs(notifyFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse notification template: %w", err)
+	}
+	return tmpl, nil
+}
+
+func sendNotification(url string, tmpl *template.Template, summary runSummary) error {
+	var payload bytes.Buffer
+	if err := tmpl.Execute(&payload, summary); err != nil {
+		return fmt.Errorf("failed to render notification template: %w", err)
+	}
+
+	httpClient := &http.Client{Transport: baseTransport(), Timeout: 15 * time.Second}
+	resp, err := httpClient.Post(url, "application/json", &payload)
+	if err != nil {
+		return fmt.Errorf("failed to send notification: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("notification endpoint returned %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// --- OIDC Token Exchange ---
+
+// tokenBroker, set by -token-broker, is an endpoint that trades the CI job's
+// OIDC token for a short-lived GitHub App installation token, so pipelines
+// need no long-lived token. oidcAudience is the audience asked for, and
+// oidcTokenEnv the variable holding a token the CI system issued already.
+var (
+	tokenBroker  string
+	oidcAudience string
+	oidcTokenEnv string
+)
+
+// The broker is sent the OIDC token as a bearer token in an empty POST, and
+// answers like GitHub's own installation token endpoint:
+//
+//	{"token": "ghs_...", "expires_at": "2024-01-01T00:00:00Z"}
+//
+// Which installation and permissions the token has is up to the broker,
+// from the claims of the OIDC token: its repository, branch or project.
+type brokerResponse struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// brokerTokenSource exchanges a fresh OIDC token each time it is asked,
+// which oauth2.ReuseTokenSource limits to when the last one expires.
+type brokerTokenSource struct{}
+
+func (brokerTokenSource) Token() (*oauth2.Token, error) {
+	audience := oidcAudience
+	if audience == "" {
+		audience = tokenBroker
+	}
+	idToken, err := ciIDToken(audience)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, tokenBroker, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+idToken)
+	req.Header.Set("Accept", "application/json")
+	// The request carries the CI identity token, which -header and the
+	// middleware, meant for the forge's API, have no business seeing.
+	client := &http.Client{Transport: baseTransport(), Timeout: httpTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("token broker: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("token broker: %w", readAPIError(resp))
+	}
+	var out brokerResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("token broker: %w", err)
+	}
+	if out.Token == "" {
+		return nil, errors.New("token broker answered without a token")
+	}
+	token := &oauth2.Token{AccessToken: out.Token}
+	if !out.ExpiresAt.IsZero() {
+		// Renew a minute early, so no request goes out with a token that
+		// expires on the way.
+		token.Expiry = out.ExpiresAt.Add(-time.Minute)
+	}
+	return token, nil
+}
+
+var (
+	brokerSourceOnce sync.Once
+	brokerSource     oauth2.TokenSource
+)
+
+// brokerTokens returns the run's source of broker tokens, which every client
+// shares so that the exchange happens once per token lifetime.
+func brokerTokens() oauth2.TokenSource {
+	brokerSourceOnce.Do(func() {
+		brokerSource = oauth2.ReuseTokenSource(nil, brokerTokenSource{})
+	})
+	return brokerSource
+}
+
+// ciIDToken returns an OIDC token for the current CI job. GitHub Actions
+// issues one on request to jobs with the id-token: write permission; GitLab
+// CI and others put one in a variable named in the pipeline, read from
+// oidcTokenEnv.
+func ciIDToken(audience string) (string, error) {
+	if requestURL := os.Getenv("ACTIONS_ID_TOKEN_REQUEST_URL"); requestURL != "" {
+		return actionsIDToken(requestURL, os.Getenv("ACTIONS_ID_TOKEN_REQUEST_TOKEN"), audience)
+	}
+	if oidcTokenEnv != "" {
+		if token := os.Getenv(oidcTokenEnv); token != "" {
+			return token, nil
+		}
+	}
+	return "", fmt.Errorf("no OIDC token: in GitHub Actions grant the job id-token: write, elsewhere set %s", oidcTokenEnv)
+}
+
+func actionsIDToken(requestURL, requestToken, audience string) (string, error) {
+	u, err := url.Parse(requestURL)
+	if err != nil {
+		return "", fmt.Errorf("ACTIONS_ID_TOKEN_REQUEST_URL: %w", err)
+	}
+	if audience != "" {
+		q := u.Query()
+		q.Set("audience", audience)
+		u.RawQuery = q.Encode()
+	}
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+requestToken)
+	// The runner's endpoint is no API of the sync's, so -header and the
+	// middleware stay out of it.
+	client := &http.Client{Transport: baseTransport(), Timeout: httpTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("requesting the Actions OIDC token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("requesting the Actions OIDC token: %w", readAPIError(resp))
+	}
+	var out struct {
+		Value string `json:"value"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", fmt.Errorf("requesting the Actions OIDC token: %w", err)
+	}
+	return out.Value, nil
+}
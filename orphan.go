@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Orphan Branch Publishing ---
+
+// publishOrphan replaces branch with a single parentless commit holding
+// exactly files, as is customary for generated sites on gh-pages. Nothing is
+// published when the branch already has identical content. Files are
+// committed as given: the options that encrypt, stamp, merge or link them
+// are rejected together with -orphan.
+func publishOrphan(client *github.Client, owner, repo, branch string, files map[string]string, commitMessage string) (map[string]string, *github.Commit, error) {
+	ctx := context.Background()
+	result := make(map[string]string)
+
+	if err := runHooks(&hookContext{Stage: hookPreCompare, Owner: owner, Repo: repo, Branch: branch, Files: files, Result: result}); err != nil {
+		return result, nil, err
+	}
+
+	existing := make(map[string]*github.TreeEntry)
+	ref, resp, err := client.Git.GetRef(ctx, owner, repo, "refs/heads/"+branch)
+	if err == nil {
+		head, _, err := client.Git.GetCommit(ctx, owner, repo, ref.Object.GetSHA())
+		if err != nil {
+			return result, nil, fmt.Errorf("GetCommit: %w", err)
+		}
+		if existing, err = treeEntries(client, owner, repo, head.Tree.GetSHA()); err != nil {
+			return result, nil, err
+		}
+	} else if resp == nil || resp.StatusCode != 404 {
+		return result, nil, fmt.Errorf("GetRef: %w", err)
+	}
+
+	changed := false
+	for path, content := range files {
+		entry, ok := existing[path]
+		switch {
+		case !ok:
+			result[path] = "created"
+			changed = true
+		case entry.GetSHA() != gitBlobSHA(content):
+			result[path] = "updated"
+			changed = true
+		default:
+			result[path] = "skipped"
+		}
+	}
+	for path := range existing {
+		if _, ok := files[path]; !ok {
+			result[path] = "deleted"
+			changed = true
+		}
+	}
+	if !changed {
+		fmt.Println("No changes to commit.")
+		return result, nil, nil
+	}
+
+	// The whole tree is rewritten, so every file goes through the hooks.
+	if err := runHooks(&hookContext{Stage: hookPreCommit, Owner: owner, Repo: repo, Branch: branch, Files: files, Result: result}); err != nil {
+		return result, nil, err
+	}
+
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	known := make([]*github.TreeEntry, 0, len(existing))
+	for _, entry := range existing {
+		known = append(known, entry)
+	}
+	blobs := newBlobUploader(client, owner, repo, known)
+
+	var entries []*github.TreeEntry
+	for _, path := range paths {
+		sha, err := blobs.upload(files[path])
+		if err != nil {
+			result[path] = "error"
+			return result, nil, fmt.Errorf("CreateBlob %s: %w", path, err)
+		}
+		entries = append(entries, &github.TreeEntry{
+			Path: github.String(path),
+			Mode: github.String("100644"),
+			Type: github.String("blob"),
+			SHA:  github.String(sha),
+		})
+	}
+	blobs.logStats()
+
+	tree, err := createTree(client, owner, repo, "", entries)
+	if err != nil {
+		return result, nil, fmt.Errorf("CreateTree: %w", err)
+	}
+	commit, _, err := client.Git.CreateCommit(ctx, owner, repo, &github.Commit{
+		Message: github.String(commitMessage),
+		Tree:    tree,
+	})
+	if err != nil {
+		return result, nil, fmt.Errorf("CreateCommit: %w", err)
+	}
+	if err := setRef(client, owner, repo, "refs/heads/"+branch, commit.GetSHA()); err != nil {
+		return result, nil, err
+	}
+
+	fmt.Println("Published orphan commit:", commit.GetHTMLURL())
+	if err := runHooks(&hookContext{Stage: hookPostCommit, Owner: owner, Repo: repo, Branch: branch, Files: files, Result: result, CommitSHA: commit.GetSHA()}); err != nil {
+		return result, commit, err
+	}
+	return result, commit, nil
+}
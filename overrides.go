@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// --- Per-Repository Overrides ---
+
+// configOverridesKey holds the per-repository overrides of a config file,
+// keyed by owner/repo:
+//
+//	repos: acme/api,acme/web,acme/legacy
+//	files: [.editorconfig, .github/workflows/ci.yml]
+//	overrides:
+//	  acme/legacy:
+//	    branch: master
+//	    exclude: [".github/workflows/*"]
+//	    files: [legacy/ci.yml]
+//	    vars: {go_version: "1.20"}
+const configOverridesKey = "overrides"
+
+// repoOverride adjusts the shared settings of a run for one repository.
+type repoOverride struct {
+	// Branch replaces -branch, in the same comma-separated form.
+	Branch string
+	// Files are synced to the repository on top of the shared ones, and
+	// Exclude patterns leave shared ones out.
+	Files   []string
+	Exclude []string
+	// Vars are key=value template variables, taking precedence over -var.
+	Vars []string
+
+	// contents are the contents of Files, by repository path.
+	contents map[string]string
+}
+
+// parseOverrides reads the overrides mapping of a config file.
+func parseOverrides(n *yaml.Node) (map[repoTarget]*repoOverride, []configProblem) {
+	var problems []configProblem
+	problem := func(line int, format string, a ...any) {
+		problems = append(problems, configProblem{Line: line, Msg: fmt.Sprintf(format, a...)})
+	}
+	if n.Kind != yaml.MappingNode {
+		problem(n.Line, "%s must be a mapping of owner/repo to settings", configOverridesKey)
+		return nil, problems
+	}
+	overrides := make(map[repoTarget]*repoOverride)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		key, value := n.Content[i], n.Content[i+1]
+		owner, repo, ok := strings.Cut(key.Value, "/")
+		if !ok || owner == "" || repo == "" {
+			problem(key.Line, "override %q must be keyed by owner/repo", key.Value)
+			continue
+		}
+		t := repoTarget{Owner: owner, Repo: repo}
+		if _, dup := overrides[t]; dup {
+			problem(key.Line, "%s is overridden twice", t)
+			continue
+		}
+		if value.Kind != yaml.MappingNode {
+			problem(value.Line, "override of %s must be a mapping", t)
+			continue
+		}
+		o := &repoOverride{}
+		for j := 0; j+1 < len(value.Content); j += 2 {
+			field, v := value.Content[j], value.Content[j+1]
+			var err error
+			switch field.Value {
+			case "branch":
+				err = v.Decode(&o.Branch)
+			case "files":
+				err = v.Decode(&o.Files)
+			case "exclude":
+				err = v.Decode(&o.Exclude)
+			case "vars":
+				var vars map[string]string
+				if err = v.Decode(&vars); err == nil {
+					for k, val := range vars {
+						o.Vars = append(o.Vars, k+"="+val)
+					}
+					sort.Strings(o.Vars)
+				}
+			default:
+				problem(field.Line, "unknown override setting %s, expected branch, files, exclude or vars", field.Value)
+				continue
+			}
+			if err != nil {
+				problem(v.Line, "invalid %s override of %s", field.Value, t)
+			}
+		}
+		overrides[t] = o
+	}
+	return overrides, problems
+}
+
+// loadOverrideFiles reads the extra files of every override.
+func loadOverrideFiles(overrides map[repoTarget]*repoOverride) error {
+	for t, o := range overrides {
+		o.contents = make(map[string]string, len(o.Files))
+		for _, localPath := range o.Files {
+			content, err := os.ReadFile(localPath)
+			if err != nil {
+				return fmt.Errorf("override of %s: failed to read %s: %w", t, localPath, err)
+			}
+			repoPath, err := normalizeRepoPath(localPath)
+			if err != nil {
+				return fmt.Errorf("override of %s: %w", t, err)
+			}
+			o.contents[repoPath] = string(content)
+		}
+	}
+	return nil
+}
+
+// apply returns the settings, branch patterns and files of the run for the
+// overridden repository. The shared ones are left as they are.
+func (o *repoOverride) apply(cfg *syncConfig, patterns []string, source map[string]string) (*syncConfig, []string, map[string]string) {
+	if o.Branch != "" {
+		patterns = splitList(o.Branch)
+	}
+	if len(o.Vars) > 0 {
+		c := *cfg
+		c.TemplateVars = append(append([]string(nil), cfg.TemplateVars...), o.Vars...)
+		cfg = &c
+	}
+	if len(o.Exclude) > 0 || len(o.contents) > 0 {
+		files := make(map[string]string, len(source)+len(o.contents))
+		for p, content := range source {
+			if !anyPatternMatches(o.Exclude, p) {
+				files[p] = content
+			}
+		}
+		for p, content := range o.contents {
+			files[p] = content
+		}
+		source = files
+	}
+	return cfg, patterns, source
+}
+
+func anyPatternMatches(patterns []string, p string) bool {
+	for _, pattern := range patterns {
+		if matchAttrPattern(pattern, p) {
+			return true
+		}
+	}
+	return false
+}
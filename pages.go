@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- GitHub Pages ---
+
+type pagesConfig struct {
+	Branch string
+	// Path is "/" or "/docs".
+	Path         string
+	CNAME        string
+	EnforceHTTPS bool
+}
+
+// configurePages enables Pages for the repository if needed and points it at
+// the configured branch and path. An empty CNAME keeps the current domain.
+func configurePages(client *github.Client, owner, repo string, cfg pagesConfig) error {
+	ctx := context.Background()
+	source := &github.PagesSource{Branch: github.String(cfg.Branch), Path: github.String(cfg.Path)}
+
+	info, resp, err := client.Repositories.GetPagesInfo(ctx, owner, repo)
+	if err != nil {
+		if resp == nil || resp.StatusCode != 404 {
+			return fmt.Errorf("GetPagesInfo: %w", err)
+		}
+		info, _, err = client.Repositories.EnablePages(ctx, owner, repo, &github.Pages{Source: source})
+		if err != nil {
+			return fmt.Errorf("EnablePages: %w", err)
+		}
+		log.Println("GitHub Pages enabled:", info.GetHTMLURL())
+	}
+
+	cname := cfg.CNAME
+	if cname == "" {
+		// Omitting the domain from an update removes it.
+		cname = info.GetCNAME()
+	}
+	update := &github.PagesUpdate{Source: source, BuildType: github.String("legacy")}
+	if cname != "" {
+		update.CNAME = github.String(cname)
+	}
+	if _, err := client.Repositories.UpdatePages(ctx, owner, repo, update); err != nil {
+		return fmt.Errorf("UpdatePages: %w", err)
+	}
+
+	if cfg.EnforceHTTPS {
+		// GitHub rejects enforcement until the certificate for a custom domain
+		// has been issued, which can take a while after the domain is set.
+		_, err := client.Repositories.UpdatePages(ctx, owner, repo, &github.PagesUpdate{
+			CNAME:         update.CNAME,
+			HTTPSEnforced: github.Bool(true),
+		})
+		if err != nil {
+			log.Printf("Could not enforce HTTPS yet, retry once the certificate is issued: %v", err)
+		}
+	}
+	return nil
+}
+
+// waitForPagesBuild polls the latest Pages build until it has built
+// commitSHA, failing if the build errors or timeout passes.
+func waitForPagesBuild(client *github.Client, owner, repo, commitSHA string, timeout time.Duration) error {
+	ctx := context.Background()
+	deadline := time.Now().Add(timeout)
+
+	for {
+		build, resp, err := client.Repositories.GetLatestPagesBuild(ctx, owner, repo)
+		if err != nil && (resp == nil || resp.StatusCode != 404) {
+			return fmt.Errorf("GetLatestPagesBuild: %w", err)
+		}
+		if err == nil && build.GetCommit() == commitSHA {
+			switch build.GetStatus() {
+			case "built":
+				info, _, err := client.Repositories.GetPagesInfo(ctx, owner, repo)
+				if err != nil {
+					return fmt.Errorf("GetPagesInfo: %w", err)
+				}
+				fmt.Println("✅ Site is live:", info.GetHTMLURL())
+				return nil
+			case "errored":
+				return fmt.Errorf("Pages build failed: %s", build.GetError().GetMessage())
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Pages build of %s did not finish within %s", shortSHA(commitSHA), timeout)
+		}
+		time.Sleep(5 * time.Second)
+	}
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// --- Patch ---
+
+// filePatch is the diff of one file. OldPath is empty for a new file and
+// NewPath for a deleted one.
+type filePatch struct {
+	OldPath, NewPath string
+	// Mode is the mode a new file is created with.
+	Mode  string
+	Hunks []patchHunk
+}
+
+func (p *filePatch) path() string {
+	if p.NewPath != "" {
+		return p.NewPath
+	}
+	return p.OldPath
+}
+
+type patchHunk struct {
+	Header   string
+	OldStart int
+	// Lines keep their leading ' ', '-' or '+'. A line not ending in a newline
+	// is followed in the diff by "\ No newline at end of file".
+	Lines []string
+}
+
+// hunkReject is a hunk whose lines could not be found in the file.
+type hunkReject struct {
+	Path   string
+	Header string
+}
+
+// parsePatch reads a unified diff, as written by diff -u or git diff and
+// git format-patch. It also returns the subject of a format-patch mail, if
+// the diff is one.
+func parsePatch(r io.Reader) ([]*filePatch, string, error) {
+	var patches []*filePatch
+	var current *filePatch
+	var hunk *patchHunk
+	var subject string
+	// oldLeft and newLeft count the lines of the hunk still to come, so a
+	// removed line starting "-- " is not taken for a file header.
+	var oldLeft, newLeft int
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 16<<20)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if hunk != nil && (oldLeft > 0 || newLeft > 0) {
+			switch {
+			case strings.HasPrefix(line, "+"):
+				newLeft--
+			case strings.HasPrefix(line, "-"):
+				oldLeft--
+			case strings.HasPrefix(line, " "), line == "":
+				line = " " + strings.TrimPrefix(line, " ")
+				oldLeft--
+				newLeft--
+			case strings.HasPrefix(line, `\`):
+			default:
+				return nil, "", fmt.Errorf("line %d: unexpected %q in hunk %s", n, line, hunk.Header)
+			}
+			hunk.Lines = append(hunk.Lines, line)
+			continue
+		}
+		if strings.HasPrefix(line, `\`) && hunk != nil {
+			hunk.Lines = append(hunk.Lines, line)
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "Subject: ") && current == nil && subject == "":
+			subject = strings.TrimPrefix(line, "Subject: ")
+			if strings.HasPrefix(subject, "[") {
+				if i := strings.Index(subject, "] "); i >= 0 {
+					subject = subject[i+2:]
+				}
+			}
+		case strings.HasPrefix(line, "diff --git "):
+			current, hunk = &filePatch{}, nil
+			patches = append(patches, current)
+		case strings.HasPrefix(line, "new file mode ") && current != nil:
+			current.Mode = strings.TrimPrefix(line, "new file mode ")
+		case strings.HasPrefix(line, "rename from ") && current != nil:
+			current.OldPath = strings.TrimPrefix(line, "rename from ")
+		case strings.HasPrefix(line, "rename to ") && current != nil:
+			current.NewPath = strings.TrimPrefix(line, "rename to ")
+		case strings.HasPrefix(line, "Binary files ") || strings.HasPrefix(line, "GIT binary patch"):
+			return nil, "", fmt.Errorf("line %d: binary patches are not supported", n)
+		case strings.HasPrefix(line, "--- "):
+			if current == nil || len(current.Hunks) > 0 {
+				current = &filePatch{}
+				patches = append(patches, current)
+			}
+			hunk = nil
+			current.OldPath = patchPath(line[4:], "a/")
+		case strings.HasPrefix(line, "+++ ") && current != nil:
+			current.NewPath = patchPath(line[4:], "b/")
+		case strings.HasPrefix(line, "@@ ") && current != nil:
+			h, oldCount, newCount, err := parseHunkHeader(line)
+			if err != nil {
+				return nil, "", fmt.Errorf("line %d: %w", n, err)
+			}
+			current.Hunks = append(current.Hunks, h)
+			hunk = &current.Hunks[len(current.Hunks)-1]
+			oldLeft, newLeft = oldCount, newCount
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, "", err
+	}
+	if hunk != nil && (oldLeft > 0 || newLeft > 0) {
+		return nil, "", fmt.Errorf("hunk %s of %s is truncated", hunk.Header, current.path())
+	}
+	return patches, subject, nil
+}
+
+// patchPath strips the a/ or b/ prefix git puts on paths, and any timestamp
+// diff -u puts after them. /dev/null becomes "".
+func patchPath(field, prefix string) string {
+	if i := strings.IndexByte(field, '\t'); i >= 0 {
+		field = field[:i]
+	}
+	if field == "/dev/null" {
+		return ""
+	}
+	return strings.TrimPrefix(field, prefix)
+}
+
+// parseHunkHeader parses "@@ -l,s +l,s @@", where a missing count means 1.
+func parseHunkHeader(line string) (patchHunk, int, int, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || fields[3] != "@@" && !strings.HasPrefix(fields[3], "@@") {
+		return patchHunk{}, 0, 0, fmt.Errorf("malformed hunk header %q", line)
+	}
+	oldStart, oldCount, err := parseRange(fields[1], "-")
+	if err != nil {
+		return patchHunk{}, 0, 0, fmt.Errorf("malformed hunk header %q: %w", line, err)
+	}
+	_, newCount, err := parseRange(fields[2], "+")
+	if err != nil {
+		return patchHunk{}, 0, 0, fmt.Errorf("malformed hunk header %q: %w", line, err)
+	}
+	header := strings.Join(fields[:4], " ")
+	return patchHunk{Header: header, OldStart: oldStart}, oldCount, newCount, nil
+}
+
+func parseRange(field, sign string) (start, count int, err error) {
+	field, ok := strings.CutPrefix(field, sign)
+	if !ok {
+		return 0, 0, fmt.Errorf("range %q does not start with %s", field, sign)
+	}
+	startText, countText, hasCount := strings.Cut(field, ",")
+	if start, err = strconv.Atoi(startText); err != nil {
+		return 0, 0, err
+	}
+	count = 1
+	if hasCount {
+		if count, err = strconv.Atoi(countText); err != nil {
+			return 0, 0, err
+		}
+	}
+	return start, count, nil
+}
+
+// sides returns the lines a hunk expects to find and those it leaves, each
+// with its newline unless the diff said there was none.
+func (h *patchHunk) sides() (old, new []string) {
+	for i, line := range h.Lines {
+		if strings.HasPrefix(line, `\`) {
+			continue
+		}
+		text := line[1:]
+		if i+1 >= len(h.Lines) || !strings.HasPrefix(h.Lines[i+1], `\`) {
+			text += "\n"
+		}
+		if line[0] != '+' {
+			old = append(old, text)
+		}
+		if line[0] != '-' {
+			new = append(new, text)
+		}
+	}
+	return old, new
+}
+
+// applyHunks applies hunks to content in order. A hunk is looked for where
+// its header says, shifted by how far earlier hunks moved, then at growing
+// distances from there; hunks found nowhere are returned as rejected.
+func applyHunks(content string, hunks []patchHunk) (string, []patchHunk) {
+	lines := strings.SplitAfter(content, "\n")
+	if len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	var rejected []patchHunk
+	offset, floor := 0, 0
+	for _, h := range hunks {
+		old, new := h.sides()
+		want := h.OldStart - 1 + offset
+		if len(old) == 0 {
+			// A hunk that only adds lines adds them after line OldStart.
+			want = h.OldStart + offset
+		}
+		at := findLines(lines, old, want, floor)
+		if at < 0 {
+			rejected = append(rejected, h)
+			continue
+		}
+		lines = append(lines[:at], append(append([]string(nil), new...), lines[at+len(old):]...)...)
+		offset += at - want + len(new) - len(old)
+		floor = at + len(new)
+	}
+	return strings.Join(lines, ""), rejected
+}
+
+// findLines returns the index nearest want, and not before floor, at which
+// lines holds old, or -1.
+func findLines(lines, old []string, want, floor int) int {
+	matches := func(at int) bool {
+		if at < floor || at+len(old) > len(lines) {
+			return false
+		}
+		for i, line := range old {
+			if lines[at+i] != line {
+				return false
+			}
+		}
+		return true
+	}
+	for distance := 0; want-distance >= floor || want+distance <= len(lines); distance++ {
+		if matches(want - distance) {
+			return want - distance
+		}
+		if distance > 0 && matches(want+distance) {
+			return want + distance
+		}
+	}
+	return -1
+}
+
+// applyPatches applies patches to the tree of head, returning the changes to
+// commit, the per-file result and the hunks that did not apply. A file with
+// rejected hunks is left out unless partial is set, in which case it gets the
+// hunks that did apply.
+func applyPatches(f forge, head string, patches []*filePatch, partial bool) ([]fileChange, map[string]string, []hunkReject, error) {
+	reader, ok := f.(contentReader)
+	if !ok {
+		return nil, nil, nil, errors.New("applying patches needs a forge that can read files")
+	}
+	tree, err := f.Tree(head)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	result := make(map[string]string)
+	var changes []fileChange
+	var rejects []hunkReject
+	for _, p := range patches {
+		entry, exists := tree.Entries[p.OldPath]
+		if p.OldPath == "" && p.NewPath == "" {
+			return nil, nil, nil, errors.New("patch has a file without paths")
+		}
+		if p.OldPath != "" && (!exists || entry.Type != "blob") {
+			return nil, nil, nil, fmt.Errorf("%s does not exist at %s", p.OldPath, shortSHA(head))
+		}
+		if _, taken := tree.Entries[p.NewPath]; taken && p.NewPath != p.OldPath {
+			return nil, nil, nil, fmt.Errorf("%s already exists at %s", p.NewPath, shortSHA(head))
+		}
+
+		var content string
+		if p.OldPath != "" {
+			if content, err = reader.ReadFile(head, p.OldPath); err != nil {
+				return nil, nil, nil, err
+			}
+		}
+		patched, rejected := applyHunks(content, p.Hunks)
+		for _, h := range rejected {
+			rejects = append(rejects, hunkReject{Path: p.path(), Header: h.Header})
+		}
+		if len(rejected) > 0 && (!partial || len(rejected) == len(p.Hunks)) {
+			result[p.path()] = "error"
+			continue
+		}
+
+		mode := entry.Mode
+		if p.OldPath == "" {
+			mode = p.Mode
+			if mode == "" {
+				mode = "100644"
+			}
+		}
+		switch {
+		case p.NewPath == "":
+			if patched != "" {
+				rejects = append(rejects, hunkReject{Path: p.OldPath, Header: "deleted file still has content"})
+				result[p.OldPath] = "error"
+				continue
+			}
+			changes = append(changes, fileChange{Path: p.OldPath, Mode: mode, Delete: true, Exists: true})
+			result[p.OldPath] = "deleted"
+		case p.OldPath != "" && p.OldPath != p.NewPath:
+			changes = append(changes,
+				fileChange{Path: p.OldPath, Mode: mode, Delete: true, Exists: true},
+				fileChange{Path: p.NewPath, Content: patched, Mode: mode})
+			result[p.OldPath] = "deleted"
+			result[p.NewPath] = "created"
+		case p.OldPath == "":
+			changes = append(changes, fileChange{Path: p.NewPath, Content: patched, Mode: mode})
+			result[p.NewPath] = "created"
+		case patched == content:
+			result[p.NewPath] = "skipped"
+		default:
+			changes = append(changes, fileChange{Path: p.NewPath, Content: patched, Mode: mode, Exists: true})
+			result[p.NewPath] = "updated"
+		}
+	}
+	return changes, result, rejects, nil
+}
+
+// runPatchCommand applies a unified diff to a branch and commits the result,
+// without a clone.
+func runPatchCommand(args []string) error {
+	fs := flag.NewFlagSet("patch", flag.ExitOnError)
+	owner, repo := repoFlags(fs)
+	branch := fs.String("branch", defaultBranch, "branch to apply the patch to")
+	message := fs.String("m", "", "commit message (default the patch's Subject, or \"Apply patch\")")
+	partial := fs.Bool("partial", false, "commit the hunks that apply even if others are rejected")
+	viaPR := fs.Bool("pr", false, "commit to a new branch and open a pull request")
+	fs.Parse(args)
+
+	if fs.NArg() > 1 {
+		return fmt.Errorf("usage: patch [flags] [file|-]")
+	}
+	in := io.Reader(os.Stdin)
+	if name := fs.Arg(0); name != "" && name != "-" {
+		file, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		in = file
+	}
+	patches, subject, err := parsePatch(in)
+	if err != nil {
+		return fmt.Errorf("failed to parse patch: %w", err)
+	}
+	if len(patches) == 0 {
+		return errors.New("the patch changes no files")
+	}
+	if *message == "" {
+		*message = subject
+	}
+	if *message == "" {
+		*message = "Apply patch"
+	}
+
+	client, err := newGitHubClient()
+	if err != nil {
+		return err
+	}
+	target := prTarget{Owner: *owner, Repo: *repo, Branch: *branch}
+	if *viaPR {
+		if target, err = setupPullRequestBranch(client, *owner, *repo, *branch, "gitapis/patch-"+runID, false); err != nil {
+			return err
+		}
+	}
+	f := newGitHubForge(client, target.Owner, target.Repo)
+	head, err := f.BranchHead(target.Branch)
+	if err != nil {
+		return err
+	}
+	if head == "" {
+		return fmt.Errorf("branch %s does not exist", target.Branch)
+	}
+
+	changes, result, rejects, err := applyPatches(f, head, patches, *partial)
+	if err != nil {
+		return err
+	}
+	printSummary(result)
+	for _, r := range rejects {
+		fmt.Printf("  ✗ %s: hunk %s rejected\n", r.Path, r.Header)
+	}
+	if len(rejects) > 0 && !*partial {
+		return fmt.Errorf("%d hunks did not apply, nothing was committed", len(rejects))
+	}
+	if len(changes) == 0 {
+		fmt.Println("No changes to commit.")
+		return nil
+	}
+
+	commit, err := f.Commit(target.Branch, head, *message, changes)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Commit created:", commit.URL)
+	if *viaPR {
+		body := formatChangeSummary(target.Owner, target.Repo, result, commit.SHA, nil)
+		if _, err := openPullRequest(client, *owner, *repo, *branch, target, *message, body); err != nil {
+			return err
+		}
+	}
+	if len(rejects) > 0 {
+		return fmt.Errorf("committed without %d rejected hunks", len(rejects))
+	}
+	return nil
+}
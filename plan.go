@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Plan and Apply ---
+
+const planVersion = 1
+
+// syncPlan is the exact commit a run would make: the blobs to create, the
+// tree entries to apply on top of BaseTree, and the commit on top of BaseSHA.
+type syncPlan struct {
+	Version  int    `json:"version"`
+	Owner    string `json:"owner"`
+	Repo     string `json:"repo"`
+	Branch   string `json:"branch"`
+	BaseSHA  string `json:"base_sha"`
+	BaseTree string `json:"base_tree"`
+	// NewBranch means Branch did not exist and is created at the commit.
+	NewBranch bool              `json:"new_branch,omitempty"`
+	Message   string            `json:"message"`
+	Entries   []planEntry       `json:"entries"`
+	Blobs     map[string]string `json:"blobs"`
+	Result    map[string]string `json:"result"`
+}
+
+type planEntry struct {
+	Path string `json:"path"`
+	Mode string `json:"mode"`
+	Type string `json:"type"`
+	// SHA is empty for deletions.
+	SHA string `json:"sha,omitempty"`
+}
+
+func (p *syncPlan) fill(owner, repo, branch, baseSHA, baseTree, message string, entries []*github.TreeEntry, blobs map[string]string) {
+	p.Version = planVersion
+	p.Owner, p.Repo, p.Branch = owner, repo, branch
+	p.BaseSHA, p.BaseTree = baseSHA, baseTree
+	p.Message = message
+
+	p.Entries = make([]planEntry, 0, len(entries))
+	for _, entry := range entries {
+		p.Entries = append(p.Entries, planEntry{Path: entry.GetPath(), Mode: entry.GetMode(), Type: entry.GetType(), SHA: entry.GetSHA()})
+	}
+	sort.Slice(p.Entries, func(i, j int) bool { return p.Entries[i].Path < p.Entries[j].Path })
+
+	p.Blobs = make(map[string]string, len(blobs))
+	for sha, content := range blobs {
+		p.Blobs[sha] = base64.StdEncoding.EncodeToString([]byte(content))
+	}
+}
+
+func writePlan(path string, plan *syncPlan) error {
+	b, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+func readPlan(path string) (*syncPlan, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var plan syncPlan
+	if err := json.Unmarshal(b, &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan %s: %w", path, err)
+	}
+	if plan.Version != planVersion {
+		return nil, fmt.Errorf("plan %s has version %d, expected %d", path, plan.Version, planVersion)
+	}
+	return &plan, nil
+}
+
+// printPlan describes the plan for review.
+func printPlan(plan *syncPlan) {
+	fmt.Printf("Plan for %s/%s@%s on top of %s:\n", plan.Owner, plan.Repo, plan.Branch, shortSHA(plan.BaseSHA))
+	if plan.NewBranch {
+		fmt.Printf("  creates branch %s\n", plan.Branch)
+	}
+	for _, entry := range plan.Entries {
+		fmt.Printf("  %-8s %s\n", plan.Result[entry.Path], entry.Path)
+	}
+	fmt.Printf("  %d new blob(s)\n", len(plan.Blobs))
+}
+
+func runApplyCommand(args []string) error {
+	fs := flag.NewFlagSet("apply", flag.ExitOnError)
+	verify := fs.String("verify", verifyOff, "read back the commit and check its ref and tree (tree), and its signature (signed)")
+	fs.StringVar(&auditLogPath, "audit-log", "", auditLogUsage)
+	fs.IntVar(&maxTreeBytes, "max-tree-bytes", maxTreeBytes, "split tree creation into requests of at most this many bytes")
+	fs.StringVar(&blobJournalPath, "blob-journal", "", blobJournalUsage)
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: apply [flags] <plan>")
+	}
+	plan, err := readPlan(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	client, err := newGitHubClient()
+	if err != nil {
+		return err
+	}
+
+	commit, err := applyPlan(client, plan)
+	if err == nil {
+		err = verifyCommit(client, plan.Owner, plan.Repo, plan.Branch, commit, *verify)
+	}
+	printSummary(plan.Result)
+	return err
+}
+
+// applyPlan makes exactly the commit the plan describes, refusing if the
+// branch has moved since the plan was made.
+func applyPlan(client *github.Client, plan *syncPlan) (*github.Commit, error) {
+	ctx := context.Background()
+	o, r := plan.Owner, plan.Repo
+
+	ref, resp, err := client.Git.GetRef(ctx, o, r, "refs/heads/"+plan.Branch)
+	switch {
+	case plan.NewBranch && err == nil:
+		return nil, fmt.Errorf("%s was created since the plan was made; plan again", plan.Branch)
+	case plan.NewBranch && (resp == nil || resp.StatusCode != 404):
+		return nil, fmt.Errorf("GetRef: %w", err)
+	case !plan.NewBranch && err != nil:
+		return nil, fmt.Errorf("GetRef: %w", err)
+	case !plan.NewBranch && ref.Object.GetSHA() != plan.BaseSHA:
+		return nil, fmt.Errorf("%s moved from %s to %s since the plan was made; plan again",
+			plan.Branch, shortSHA(plan.BaseSHA), shortSHA(ref.Object.GetSHA()))
+	}
+
+	shas := make([]string, 0, len(plan.Blobs))
+	for sha := range plan.Blobs {
+		shas = append(shas, sha)
+	}
+	sort.Strings(shas)
+	journaled := journaledBlobs(o, r)
+	for _, sha := range shas {
+		if journaled[sha] {
+			continue
+		}
+		blob, _, err := client.Git.CreateBlob(ctx, o, r, &github.Blob{
+			Content:  github.String(plan.Blobs[sha]),
+			Encoding: github.String("base64"),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("CreateBlob: %w", err)
+		}
+		if blob.GetSHA() != sha {
+			return nil, fmt.Errorf("blob %s was created as %s; the plan is corrupt", sha, blob.GetSHA())
+		}
+		journalBlob(o, r, sha)
+	}
+
+	entries := make([]*github.TreeEntry, 0, len(plan.Entries))
+	for _, e := range plan.Entries {
+		entry := &github.TreeEntry{Path: github.String(e.Path), Mode: github.String(e.Mode), Type: github.String(e.Type)}
+		if e.SHA != "" {
+			entry.SHA = github.String(e.SHA)
+		}
+		entries = append(entries, entry)
+	}
+	tree, err := createTree(client, o, r, plan.BaseTree, entries)
+	if err != nil {
+		return nil, fmt.Errorf("CreateTree: %w", err)
+	}
+	commit, _, err := client.Git.CreateCommit(ctx, o, r, &github.Commit{
+		Message: github.String(plan.Message),
+		Tree:    tree,
+		Parents: []*github.Commit{{SHA: github.String(plan.BaseSHA)}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("CreateCommit: %w", err)
+	}
+
+	if plan.NewBranch {
+		_, _, err = client.Git.CreateRef(ctx, o, r, &github.Reference{
+			Ref:    github.String("refs/heads/" + plan.Branch),
+			Object: &github.GitObject{SHA: commit.SHA},
+		})
+	} else {
+		// Not forced, so a push that raced the check above is rejected.
+		ref.Object.SHA = commit.SHA
+		_, _, err = client.Git.UpdateRef(ctx, o, r, ref, false)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("updating %s: %w", plan.Branch, err)
+	}
+
+	fmt.Println("Commit created:", commit.GetHTMLURL())
+	return commit, nil
+}
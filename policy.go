@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Policy Distribution ---
+
+// Policy mode (-policy) distributes an organization's .github files, such as
+// workflows, dependabot.yml and CODEOWNERS, to its repositories. Each
+// repository gets a labeled pull request, so its owners adopt the policy by
+// merging it, and the run records which ones have.
+
+// defaultPolicyLabel labels policy pull requests unless -policy-label is set.
+const defaultPolicyLabel = "policy"
+
+// codeownersPaths are where GitHub looks for CODEOWNERS, in the order it
+// looks: only the first one found applies.
+var codeownersPaths = []string{".github/CODEOWNERS", "CODEOWNERS", "docs/CODEOWNERS"}
+
+// isPolicyFile reports whether p is a file policy mode distributes.
+func isPolicyFile(p string) bool {
+	return strings.HasPrefix(p, ".github/") || path.Base(p) == "CODEOWNERS"
+}
+
+// checkPolicyFiles returns an error naming the files that are not policy
+// files, which policy mode does not distribute.
+func checkPolicyFiles(files map[string]string) error {
+	var others []string
+	for p := range files {
+		if !isPolicyFile(p) {
+			others = append(others, p)
+		}
+	}
+	if len(others) == 0 {
+		return nil
+	}
+	sort.Strings(others)
+	return fmt.Errorf("-policy distributes .github files and CODEOWNERS only, not %s", strings.Join(others, ", "))
+}
+
+// placePolicyFiles moves policy files to where branch already has them:
+// CODEOWNERS to the location the repository uses, and dependabot.yml to
+// dependabot.yaml if that is its name. A second copy elsewhere would
+// silently not apply.
+func placePolicyFiles(client *github.Client, owner, repo, branch string, files map[string]string) (map[string]string, error) {
+	existing := make(map[string]bool)
+	tree, resp, err := client.Git.GetTree(context.Background(), owner, repo, branch, true)
+	switch {
+	case err == nil:
+		for _, entry := range tree.Entries {
+			if entry.GetType() == "blob" {
+				existing[entry.GetPath()] = true
+			}
+		}
+	case resp != nil && (resp.StatusCode == 404 || resp.StatusCode == 409):
+		// A new repository or branch takes the files where they are.
+	default:
+		return nil, fmt.Errorf("GetTree: %w", err)
+	}
+
+	placed := make(map[string]string, len(files))
+	for p, content := range files {
+		target := p
+		switch {
+		case path.Base(p) == "CODEOWNERS":
+			for _, candidate := range codeownersPaths {
+				if existing[candidate] {
+					target = candidate
+					break
+				}
+			}
+		case p == ".github/dependabot.yml" && existing[".github/dependabot.yaml"]:
+			target = ".github/dependabot.yaml"
+		case p == ".github/dependabot.yaml" && existing[".github/dependabot.yml"]:
+			target = ".github/dependabot.yml"
+		}
+		if _, taken := placed[target]; taken {
+			return nil, fmt.Errorf("%s and another policy file both go to %s in %s/%s", p, target, owner, repo)
+		}
+		if target != p {
+			log.Printf("Placing %s at %s, where %s/%s keeps it", p, target, owner, repo)
+		}
+		placed[target] = content
+	}
+	return placed, nil
+}
+
+// policyAdoption is where one repository stands with the policy.
+type policyAdoption struct {
+	Status string `json:"status"`
+	PR     string `json:"pr,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// Since is when the repository reached its status.
+	Since   time.Time `json:"since"`
+	Checked time.Time `json:"checked"`
+}
+
+const (
+	policyAdopted = "adopted"
+	policyPending = "pending"
+	policyFailed  = "failed"
+)
+
+// adoptionOf tells where a repository stands from its run: adopted when its
+// branches already match the policy, pending while a pull request is open.
+func adoptionOf(out repoOutcome) policyAdoption {
+	if out.Err != nil {
+		return policyAdoption{Status: policyFailed, Error: out.Err.Error()}
+	}
+	a := policyAdoption{Status: policyAdopted}
+	var errs []string
+	for _, b := range out.Branches {
+		switch {
+		case b.Err != nil:
+			errs = append(errs, b.Err.Error())
+		case b.PR != nil && a.Status == policyAdopted:
+			a.Status, a.PR = policyPending, b.PR.GetHTMLURL()
+		}
+	}
+	if len(errs) > 0 {
+		a = policyAdoption{Status: policyFailed, Error: strings.Join(errs, "; ")}
+	}
+	return a
+}
+
+// recordPolicyAdoption updates the adoption status file at p, if set, with
+// the run's outcomes, and prints where every repository of the run stands.
+// Repositories the run left out keep their last status.
+func recordPolicyAdoption(p string, outcomes []repoOutcome, now time.Time) error {
+	status := make(map[string]policyAdoption)
+	if p != "" {
+		b, err := os.ReadFile(p)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			return fmt.Errorf("failed to read policy status: %w", err)
+		default:
+			if err := json.Unmarshal(b, &status); err != nil {
+				return fmt.Errorf("failed to parse policy status: %w", err)
+			}
+		}
+	}
+
+	counts := make(map[string]int)
+	fmt.Println("Policy Adoption:")
+	sort.Slice(outcomes, func(i, j int) bool { return outcomes[i].Target.String() < outcomes[j].Target.String() })
+	for _, out := range outcomes {
+		key := out.Target.String()
+		a := adoptionOf(out)
+		a.Since, a.Checked = now, now
+		if last, ok := status[key]; ok && last.Status == a.Status {
+			a.Since = last.Since
+		}
+		status[key] = a
+		counts[a.Status]++
+
+		line := a.Status
+		switch a.Status {
+		case policyPending:
+			line += " " + a.PR
+		case policyFailed:
+			line += ": " + a.Error
+		}
+		fmt.Printf("  %s → %s\n", key, line)
+	}
+	fmt.Printf("%d of %d repositories adopted, %d pending, %d failed\n", counts[policyAdopted], len(outcomes), counts[policyPending], counts[policyFailed])
+
+	if p == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(status, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(p, append(b, '\n')); err != nil {
+		return fmt.Errorf("failed to write policy status: %w", err)
+	}
+	return nil
+}
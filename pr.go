@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Pull Request Mode ---
+
+// prTarget is where the commit is pushed in PR mode: a head branch in the
+// target repository or in the user's fork of it.
+type prTarget struct {
+	Owner  string
+	Repo   string
+	Branch string
+}
+
+// setupPullRequestBranch resets the head branch to the current head of base
+// so the pull request always shows exactly the changes of this run. When the
+// token cannot push to owner/repo and allowFork is set, the head branch is
+// created in a fork instead.
+func setupPullRequestBranch(client *github.Client, owner, repo, base, head string, allowFork bool) (prTarget, error) {
+	target, err := pullRequestTarget(client, owner, repo, head, allowFork)
+	if err != nil {
+		return target, err
+	}
+	return target, resetPullRequestBranch(client, owner, repo, base, target)
+}
+
+// pullRequestTarget returns where the head branch of a pull request into
+// owner/repo lives: in owner/repo itself or, when the token cannot push there
+// and allowFork is set, in the user's fork of it.
+func pullRequestTarget(client *github.Client, owner, repo, head string, allowFork bool) (prTarget, error) {
+	target := prTarget{Owner: owner, Repo: repo, Branch: head}
+	repository, _, err := client.Repositories.Get(context.Background(), owner, repo)
+	if err != nil {
+		return target, fmt.Errorf("Get repository: %w", err)
+	}
+	if !repository.GetPermissions()["push"] {
+		if !allowFork {
+			return target, fmt.Errorf("token cannot push to %s/%s, use -fork to contribute through a fork", owner, repo)
+		}
+		fork, err := ensureFork(client, owner, repo)
+		if err != nil {
+			return target, err
+		}
+		target.Owner, target.Repo = fork.GetOwner().GetLogin(), fork.GetName()
+	}
+	return target, nil
+}
+
+// resetPullRequestBranch points the head branch of target at the current
+// head of base in owner/repo.
+func resetPullRequestBranch(client *github.Client, owner, repo, base string, target prTarget) error {
+	baseRef, _, err := client.Git.GetRef(context.Background(), owner, repo, "refs/heads/"+base)
+	if err != nil {
+		return fmt.Errorf("GetRef %s: %w", base, err)
+	}
+	// Forks share the object store of their parent, so the upstream SHA can be
+	// referenced from the fork directly.
+	return setRef(client, target.Owner, target.Repo, "refs/heads/"+target.Branch, baseRef.Object.GetSHA())
+}
+
+// ensureFork returns the authenticated user's fork of owner/repo, creating it
+// and waiting for it to become available if needed.
+func ensureFork(client *github.Client, owner, repo string) (*github.Repository, error) {
+	ctx := context.Background()
+
+	user, _, err := client.Users.Get(ctx, "")
+	if err != nil {
+		return nil, fmt.Errorf("Get authenticated user: %w", err)
+	}
+	upstream := owner + "/" + repo
+
+	existing, _, err := client.Repositories.Get(ctx, user.GetLogin(), repo)
+	if err == nil {
+		if existing.GetFork() && existing.GetParent().GetFullName() == upstream {
+			log.Println("Reusing fork:", existing.GetHTMLURL())
+			return existing, nil
+		}
+		return nil, fmt.Errorf("%s exists but is not a fork of %s", existing.GetFullName(), upstream)
+	}
+
+	// Fork creation is asynchronous and answers 202 Accepted.
+	fork, _, err := client.Repositories.CreateFork(ctx, owner, repo, &github.RepositoryCreateForkOptions{})
+	if _, accepted := err.(*github.AcceptedError); err != nil && !accepted {
+		return nil, fmt.Errorf("CreateFork: %w", err)
+	}
+	name := repo
+	if fork != nil && fork.GetName() != "" {
+		name = fork.GetName()
+	}
+
+	for attempt := 0; attempt < 30; attempt++ {
+		fork, _, err = client.Repositories.Get(ctx, user.GetLogin(), name)
+		if err == nil {
+			if _, _, err := client.Git.GetRef(ctx, user.GetLogin(), name, "refs/heads/"+fork.GetDefaultBranch()); err == nil {
+				log.Println("Fork created:", fork.GetHTMLURL())
+				return fork, nil
+			}
+		}
+		time.Sleep(2 * time.Second)
+	}
+	return nil, fmt.Errorf("fork of %s did not become available in time", upstream)
+}
+
+// openPullRequest opens a pull request from target into base, or updates the
+// body of the one already open for the same head branch.
+func openPullRequest(client *github.Client, owner, repo, base string, target prTarget, title, body string) (*github.PullRequest, error) {
+	return openPullRequestAs(client, owner, repo, base, target, title, body, false)
+}
+
+// openPullRequestAs is openPullRequest, opening a new pull request as a
+// draft if draft is set. An open pull request keeps its state.
+func openPullRequestAs(client *github.Client, owner, repo, base string, target prTarget, title, body string, draft bool) (*github.PullRequest, error) {
+	ctx := context.Background()
+	head := target.Owner + ":" + target.Branch
+
+	open, _, err := client.PullRequests.List(ctx, owner, repo, &github.PullRequestListOptions{State: "open", Head: head, Base: base})
+	if err != nil {
+		return nil, fmt.Errorf("List pull requests: %w", err)
+	}
+	if len(open) > 0 {
+		pr, _, err := client.PullRequests.Edit(ctx, owner, repo, open[0].GetNumber(), &github.PullRequest{Body: github.String(body)})
+		if err != nil {
+			return nil, fmt.Errorf("Edit pull request: %w", err)
+		}
+		fmt.Println("Pull request updated:", pr.GetHTMLURL())
+		return pr, nil
+	}
+
+	pr, _, err := client.PullRequests.Create(ctx, owner, repo, &github.NewPullRequest{
+		Title:               github.String(title),
+		Head:                github.String(head),
+		Base:                github.String(base),
+		Body:                github.String(body),
+		MaintainerCanModify: github.Bool(true),
+		Draft:               github.Bool(draft),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Create pull request: %w", err)
+	}
+	fmt.Println("Pull request opened:", pr.GetHTMLURL())
+	return pr, nil
+}
+
+// prRouting is what the pull requests a sync opens are labeled and assigned
+// with, for triage automation to pick them up.
+type prRouting struct {
+	Labels    []string
+	Assignees []string
+	// Reviewers are user logins and org/team-slug teams, with or without a
+	// leading @, as in CODEOWNERS.
+	Reviewers []string
+	// Milestone is a milestone title or number.
+	Milestone string
+	Draft     bool
+}
+
+func (r *prRouting) empty() bool {
+	return r == nil || len(r.Labels) == 0 && len(r.Assignees) == 0 && len(r.Reviewers) == 0 && r.Milestone == ""
+}
+
+// route applies the routing to pull request number. Each step is tried even
+// if an earlier one fails, and the failures are returned together.
+func (r *prRouting) route(client *github.Client, owner, repo string, number int) error {
+	if r.empty() {
+		return nil
+	}
+	ctx := context.Background()
+	var errs []error
+	if len(r.Labels) > 0 {
+		if err := labelPullRequest(client, owner, repo, number, r.Labels); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(r.Assignees) > 0 {
+		if _, _, err := client.Issues.AddAssignees(ctx, owner, repo, number, r.Assignees); err != nil {
+			errs = append(errs, fmt.Errorf("AddAssignees: %w", err))
+		}
+	}
+	if len(r.Reviewers) > 0 {
+		var req github.ReviewersRequest
+		for _, reviewer := range r.Reviewers {
+			reviewer = strings.TrimPrefix(reviewer, "@")
+			if _, slug, ok := strings.Cut(reviewer, "/"); ok {
+				req.TeamReviewers = append(req.TeamReviewers, slug)
+			} else {
+				req.Reviewers = append(req.Reviewers, reviewer)
+			}
+		}
+		if _, _, err := client.PullRequests.RequestReviewers(ctx, owner, repo, number, req); err != nil {
+			errs = append(errs, fmt.Errorf("RequestReviewers: %w", err))
+		}
+	}
+	if r.Milestone != "" {
+		milestone, err := findMilestone(client, owner, repo, r.Milestone)
+		if err == nil {
+			_, _, err = client.Issues.Edit(ctx, owner, repo, number, &github.IssueRequest{Milestone: github.Int(milestone)})
+			if err != nil {
+				err = fmt.Errorf("Edit issue: %w", err)
+			}
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// findMilestone returns the number of the open milestone titled name, or
+// name itself if it is a number.
+func findMilestone(client *github.Client, owner, repo, name string) (int, error) {
+	if n, err := strconv.Atoi(name); err == nil {
+		return n, nil
+	}
+	opts := &github.MilestoneListOptions{State: "open", ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		milestones, resp, err := client.Issues.ListMilestones(context.Background(), owner, repo, opts)
+		if err != nil {
+			return 0, fmt.Errorf("ListMilestones: %w", err)
+		}
+		for _, m := range milestones {
+			if m.GetTitle() == name {
+				return m.GetNumber(), nil
+			}
+		}
+		if resp.NextPage == 0 {
+			return 0, fmt.Errorf("%s/%s has no open milestone %q", owner, repo, name)
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// labelPullRequest adds labels to pull request number, creating any the
+// repository does not have yet.
+func labelPullRequest(client *github.Client, owner, repo string, number int, labels []string) error {
+	if _, _, err := client.Issues.AddLabelsToIssue(context.Background(), owner, repo, number, labels); err != nil {
+		return fmt.Errorf("AddLabelsToIssue: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Pull Request Bodies ---
+
+const (
+	// defaultPRDiffLines is how many lines of each file's diff a pull
+	// request body shows.
+	defaultPRDiffLines = 40
+	// prDiffBudget caps the diffs of a body as a whole, well below the
+	// 65536 characters GitHub takes.
+	prDiffBudget = 48 << 10
+)
+
+var defaultPRChecklist = []string{
+	"The changes match what the source intended",
+	"Required checks pass",
+}
+
+// prBodyConfig describes the bodies of the pull requests a sync opens.
+type prBodyConfig struct {
+	tmpl      *template.Template
+	DiffLines int
+	Checklist []string
+}
+
+// prBodyData is what a body template renders.
+type prBodyData struct {
+	Owner, Repo, Base, Head string
+	// Summary is the change table, as -comment posts it.
+	Summary string
+	Counts  map[string]int
+	// Files are the diffs shown; Omitted counts the ones left out to keep
+	// the body within GitHub's limit.
+	Files   []prBodyFile
+	Omitted int
+
+	Builder        provenanceBuilder
+	RunID          string
+	SourceChecksum string
+	// SourceURL links the commit the run synced from, inside Actions.
+	SourceURL string
+
+	Checklist  []string
+	Violations string
+}
+
+type prBodyFile struct {
+	Path                 string
+	Status               string
+	Additions, Deletions int
+	Patch                string
+	Truncated            bool
+}
+
+const defaultPRBodyTemplate = `{{.Summary}}
+{{- if .Files}}
+### Diffs
+{{range .Files}}
+<details><summary><code>{{.Path}}</code> ({{.Status}}, +{{.Additions}} −{{.Deletions}})</summary>
+
+~~~diff
+{{.Patch}}
+~~~
+{{- if .Truncated}}
+
+_Truncated, the Files changed tab has the rest._
+{{- end}}
+
+</details>
+{{end}}
+{{- if .Omitted}}
+_{{.Omitted}} more diff(s) left out to keep this description short._
+{{end}}
+{{- end}}
+### Provenance
+
+- Run ` + "`{{.RunID}}`" + ` by {{.Builder.Tool}} {{.Builder.Version}} on {{if .SourceURL}}[{{.Builder.ID}}]({{.Builder.ID}}){{else}}` + "`{{.Builder.ID}}`" + `{{end}}
+{{- if .Builder.Actor}}, for @{{.Builder.Actor}}{{end}}
+{{- if .SourceURL}}
+- Source: {{.SourceURL}}{{end}}
+- Source checksum: ` + "`{{.SourceChecksum}}`" + `
+{{- if .Checklist}}
+
+### Checklist
+{{range .Checklist}}
+- [ ] {{.}}
+{{- end}}
+{{- end}}
+{{.Violations}}`
+
+func loadPRBody(templatePath string, diffLines int, checklist []string) (*prBodyConfig, error) {
+	text := defaultPRBodyTemplate
+	if templatePath != "" {
+		b, err := os.ReadFile(templatePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pull request template: %w", err)
+		}
+		text = string(b)
+	}
+	tmpl, err := template.New("pr").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse pull request template: %w", err)
+	}
+	if len(checklist) == 0 {
+		checklist = defaultPRChecklist
+	}
+	return &prBodyConfig{tmpl: tmpl, DiffLines: diffLines, Checklist: checklist}, nil
+}
+
+// render returns the body of the pull request from target into base for a
+// branch's outcome. Diffs are best-effort: without them the body still has
+// everything else.
+func (c *prBodyConfig) render(client *github.Client, owner, repo, base string, target prTarget, out branchOutcome, p *preparedBranch) (string, error) {
+	data := prBodyData{
+		Owner:          owner,
+		Repo:           repo,
+		Base:           base,
+		Head:           target.Branch,
+		Summary:        formatChangeSummary(target.Owner, target.Repo, out.Result, out.Commit.GetSHA(), p.Attrs),
+		Counts:         make(map[string]int),
+		Builder:        currentBuilder(),
+		RunID:          runID,
+		SourceChecksum: sourceChecksum(p.Files),
+		Checklist:      c.Checklist,
+	}
+	for _, status := range out.Result {
+		data.Counts[status]++
+	}
+	if inActions() {
+		data.SourceURL = os.Getenv("GITHUB_SERVER_URL") + "/" + os.Getenv("GITHUB_REPOSITORY") + "/commit/" + os.Getenv("GITHUB_SHA")
+	}
+	if len(p.Violations) > 0 {
+		data.Violations = formatViolations(p.Violations)
+	}
+	if c.DiffLines > 0 {
+		head := target.Branch
+		if target.Owner != owner {
+			head = target.Owner + ":" + target.Branch
+		}
+		if cmp, err := compareRefs(client, owner, repo, base, head, true); err != nil {
+			log.Printf("⚠️ Failed to fetch diffs for the pull request body: %v", err)
+		} else {
+			data.Files, data.Omitted = c.diffs(cmp.Files, p.Attrs)
+		}
+	}
+
+	var b bytes.Buffer
+	if err := c.tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("failed to render pull request template: %w", err)
+	}
+	return b.String(), nil
+}
+
+// diffs cuts each file's patch to DiffLines lines, leaving out generated
+// files, which the summary already collapses, and files without a textual
+// patch. Once prDiffBudget is spent, the remaining files are only counted.
+func (c *prBodyConfig) diffs(files []compareFile, attrs *gitAttributes) ([]prBodyFile, int) {
+	var shown []prBodyFile
+	omitted, spent := 0, 0
+	for _, f := range files {
+		if f.Patch == "" || attrs.isGenerated(f.Filename) {
+			continue
+		}
+		file := prBodyFile{Path: f.Filename, Status: f.Status, Additions: f.Additions, Deletions: f.Deletions, Patch: f.Patch}
+		if lines := strings.SplitAfter(file.Patch, "\n"); len(lines) > c.DiffLines {
+			file.Patch = strings.Join(lines[:c.DiffLines], "")
+			file.Truncated = true
+		}
+		file.Patch = strings.TrimRight(file.Patch, "\n")
+		if spent+len(file.Patch) > prDiffBudget {
+			omitted++
+			continue
+		}
+		spent += len(file.Patch)
+		shown = append(shown, file)
+	}
+	return shown, omitted
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"os/user"
+	"time"
+)
+
+// --- Provenance ---
+
+const defaultProvenancePath = ".gitapis/provenance.json"
+
+// provenanceConfig asks for a provenance file in every sync commit.
+type provenanceConfig struct {
+	Path string
+	// Source is the full change set the file describes, which may be more
+	// than one commit holds when commits are grouped.
+	Source map[string]string
+}
+
+type provenance struct {
+	Builder   provenanceBuilder `json:"builder"`
+	RunID     string            `json:"run_id"`
+	Timestamp time.Time         `json:"timestamp"`
+	Target    struct {
+		Repository string `json:"repository"`
+		Branch     string `json:"branch"`
+	} `json:"target"`
+	Source struct {
+		Checksum string            `json:"checksum"`
+		Digests  map[string]string `json:"digests"`
+	} `json:"source"`
+}
+
+type provenanceBuilder struct {
+	ID       string `json:"id"`
+	Tool     string `json:"tool"`
+	Version  string `json:"version"`
+	Workflow string `json:"workflow,omitempty"`
+	Actor    string `json:"actor,omitempty"`
+}
+
+// currentBuilder identifies what is running the sync: the Actions run when
+// inside one, otherwise the local user and host.
+func currentBuilder() provenanceBuilder {
+	b := provenanceBuilder{Tool: "gitapis", Version: version}
+	if inActions() {
+		b.ID = os.Getenv("GITHUB_SERVER_URL") + "/" + os.Getenv("GITHUB_REPOSITORY") + "/actions/runs/" + os.Getenv("GITHUB_RUN_ID")
+		b.Workflow = os.Getenv("GITHUB_WORKFLOW_REF")
+		b.Actor = os.Getenv("GITHUB_ACTOR")
+		return b
+	}
+	host, _ := os.Hostname()
+	b.ID = "local:" + host
+	if u, err := user.Current(); err == nil {
+		b.Actor = u.Username
+	}
+	return b
+}
+
+// buildProvenance renders the provenance file for files synced to
+// owner/repo@branch. The file itself is left out of the digests.
+func buildProvenance(cfg *provenanceConfig, owner, repo, branch string, files map[string]string) (string, error) {
+	source := cfg.Source
+	if source == nil {
+		source = files
+	}
+	p := provenance{Builder: currentBuilder(), RunID: runID, Timestamp: time.Now().UTC()}
+	p.Target.Repository = owner + "/" + repo
+	p.Target.Branch = branch
+
+	digests := make(map[string]string, len(source))
+	withoutSelf := make(map[string]string, len(source))
+	for path, content := range source {
+		if path == cfg.Path {
+			continue
+		}
+		sum := sha256.Sum256([]byte(content))
+		digests[path] = "sha256:" + hex.EncodeToString(sum[:])
+		withoutSelf[path] = content
+	}
+	p.Source.Checksum = sourceChecksum(withoutSelf)
+	p.Source.Digests = digests
+
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(b) + "\n", nil
+}
+
+// provenanceChange renders the provenance file for a commit on top of tree,
+// recording it in result.
+func provenanceChange(cfg *provenanceConfig, owner, repo, branch string, files map[string]string, tree *forgeTree, result map[string]string) (fileChange, error) {
+	content, err := buildProvenance(cfg, owner, repo, branch, files)
+	if err != nil {
+		return fileChange{}, err
+	}
+	_, exists := tree.Entries[cfg.Path]
+	result[cfg.Path] = "created"
+	if exists {
+		result[cfg.Path] = "updated"
+	}
+	return fileChange{Path: cfg.Path, Content: content, Mode: "100644", Exists: exists}, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Rate Budget ---
+
+// rateFloor is the remaining quota below which requests wait for the limit
+// to reset, and repoRequestBudget caps the requests one repository may use;
+// zero disables either.
+var (
+	rateFloor         int
+	repoRequestBudget int
+)
+
+// rateBudget is a transport shared by every worker of a run. It tracks the
+// quota GitHub reports for each rate limit resource and holds requests back
+// once it drops below rateFloor, until the window resets.
+type rateBudget struct {
+	base http.RoundTripper
+
+	mu        sync.Mutex
+	remaining map[string]int
+	reset     map[string]time.Time
+	perRepo   map[string]int
+}
+
+func newRateBudget(base http.RoundTripper) http.RoundTripper {
+	if rateFloor <= 0 && repoRequestBudget <= 0 {
+		return base
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &rateBudget{
+		base:      base,
+		remaining: make(map[string]int),
+		reset:     make(map[string]time.Time),
+		perRepo:   make(map[string]int),
+	}
+}
+
+// rateResource names the rate limit req counts against, matching GitHub's
+// X-RateLimit-Resource values for the common cases.
+func rateResource(req *http.Request) string {
+	switch {
+	case strings.HasSuffix(req.URL.Path, "/graphql"):
+		return "graphql"
+	case strings.HasPrefix(req.URL.Path, "/search/"):
+		return "search"
+	default:
+		return "core"
+	}
+}
+
+// requestRepo returns "owner/repo" for requests under /repos/, or "".
+func requestRepo(req *http.Request) string {
+	parts := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/"), "/", 4)
+	if len(parts) < 3 || parts[0] != "repos" {
+		return ""
+	}
+	return parts[1] + "/" + parts[2]
+}
+
+func (b *rateBudget) RoundTrip(req *http.Request) (*http.Response, error) {
+	if repo := requestRepo(req); repo != "" && repoRequestBudget > 0 {
+		b.mu.Lock()
+		b.perRepo[repo]++
+		used := b.perRepo[repo]
+		b.mu.Unlock()
+		if used > repoRequestBudget {
+			return nil, fmt.Errorf("%s has used its budget of %d requests", repo, repoRequestBudget)
+		}
+	}
+
+	resource := rateResource(req)
+	b.wait(resource)
+	resp, err := b.base.RoundTrip(req)
+	if err == nil {
+		b.update(resource, resp.Header)
+	}
+	return resp, err
+}
+
+// wait blocks while the resource's quota is below the floor and its window
+// has not reset yet.
+func (b *rateBudget) wait(resource string) {
+	if rateFloor <= 0 {
+		return
+	}
+	for {
+		b.mu.Lock()
+		remaining, known := b.remaining[resource]
+		reset := b.reset[resource]
+		b.mu.Unlock()
+		if !known || remaining >= rateFloor || !time.Now().Before(reset) {
+			return
+		}
+		pause := time.Until(reset) + time.Second
+		log.Printf("⏸ %d %s requests left (floor %d); pausing %s until the limit resets",
+			remaining, resource, rateFloor, pause.Round(time.Second))
+		time.Sleep(pause)
+
+		b.mu.Lock()
+		// The next response reports the new window.
+		if b.reset[resource].Equal(reset) {
+			delete(b.remaining, resource)
+		}
+		b.mu.Unlock()
+	}
+}
+
+func (b *rateBudget) update(resource string, header http.Header) {
+	remaining, err := strconv.Atoi(header.Get("X-RateLimit-Remaining"))
+	if err != nil {
+		return
+	}
+	reset, err := strconv.ParseInt(header.Get("X-RateLimit-Reset"), 10, 64)
+	if err != nil {
+		return
+	}
+	if r := header.Get("X-RateLimit-Resource"); r != "" {
+		resource = r
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.remaining[resource] = remaining
+	b.reset[resource] = time.Unix(reset, 0)
+}
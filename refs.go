@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Refs ---
+
+// listRefs returns every ref starting with prefix (e.g. "heads/" or "tags/";
+// "" for all), following pagination.
+func listRefs(client *github.Client, owner, repo, prefix string) ([]*github.Reference, error) {
+	ctx := context.Background()
+	opts := &github.ReferenceListOptions{Ref: prefix, ListOptions: github.ListOptions{PerPage: 100}}
+
+	var refs []*github.Reference
+	for {
+		page, resp, err := client.Git.ListMatchingRefs(ctx, owner, repo, opts)
+		if err != nil {
+			return nil, fmt.Errorf("ListMatchingRefs: %w", err)
+		}
+		refs = append(refs, page...)
+		if resp.NextPage == 0 {
+			return refs, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// peelRef resolves a ref to the commit it points at, following annotated tags.
+func peelRef(client *github.Client, owner, repo string, ref *github.Reference) (string, error) {
+	ctx := context.Background()
+	sha := ref.Object.GetSHA()
+	objType := ref.Object.GetType()
+	for objType == "tag" {
+		tag, _, err := client.Git.GetTag(ctx, owner, repo, sha)
+		if err != nil {
+			return "", fmt.Errorf("GetTag: %w", err)
+		}
+		sha = tag.Object.GetSHA()
+		objType = tag.Object.GetType()
+	}
+	return sha, nil
+}
+
+// setRef points ref (e.g. "refs/heads/main") at sha, creating it if needed and
+// force-updating it otherwise.
+func setRef(client *github.Client, owner, repo, ref, sha string) error {
+	ctx := context.Background()
+	reference := &github.Reference{
+		Ref:    github.String(ref),
+		Object: &github.GitObject{SHA: github.String(sha)},
+	}
+
+	_, resp, err := client.Git.GetRef(ctx, owner, repo, ref)
+	if err != nil {
+		if resp == nil || resp.StatusCode != 404 {
+			return fmt.Errorf("GetRef %s: %w", ref, err)
+		}
+		if _, _, err := client.Git.CreateRef(ctx, owner, repo, reference); err != nil {
+			return fmt.Errorf("CreateRef %s: %w", ref, err)
+		}
+		return nil
+	}
+	if _, _, err := client.Git.UpdateRef(ctx, owner, repo, reference, true); err != nil {
+		return fmt.Errorf("UpdateRef %s: %w", ref, err)
+	}
+	return nil
+}
+
+// repositoryIsEmpty reports whether the repository has no commits at all, as
+// opposed to merely lacking a particular branch.
+func repositoryIsEmpty(client *github.Client, owner, repo string) (bool, *github.Repository, error) {
+	ctx := context.Background()
+
+	repository, _, err := client.Repositories.Get(ctx, owner, repo)
+	if err != nil {
+		return false, nil, fmt.Errorf("Get repository: %w", err)
+	}
+	// On an empty repository the Git Data API answers 409 Conflict.
+	_, resp, err := client.Git.ListMatchingRefs(ctx, owner, repo, &github.ReferenceListOptions{Ref: "heads/"})
+	if err != nil {
+		if resp != nil && resp.StatusCode == 409 {
+			return true, repository, nil
+		}
+		return false, repository, fmt.Errorf("ListMatchingRefs: %w", err)
+	}
+	return false, repository, nil
+}
+
+// resolveRef returns the commit SHA that name refers to, trying it as a
+// branch, then a tag, then a commit SHA.
+func resolveRef(client *github.Client, owner, repo, name string) (string, error) {
+	ctx := context.Background()
+
+	for _, prefix := range []string{"refs/heads/", "refs/tags/"} {
+		ref, resp, err := client.Git.GetRef(ctx, owner, repo, prefix+name)
+		if err == nil {
+			return peelRef(client, owner, repo, ref)
+		}
+		if resp == nil || resp.StatusCode != 404 {
+			return "", fmt.Errorf("GetRef %s: %w", prefix+name, err)
+		}
+	}
+	commit, _, err := client.Git.GetCommit(ctx, owner, repo, name)
+	if err != nil {
+		return "", fmt.Errorf("%q is not a branch, tag or commit: %w", name, err)
+	}
+	return commit.GetSHA(), nil
+}
+
+// expandBranches replaces each glob in patterns (release/*, env/*) with the
+// remote branches it matches. As in path.Match, * stays within one path
+// segment; a trailing /** matches any depth. Plain names pass through, so
+// they can still name branches that don't exist yet.
+func expandBranches(client *github.Client, owner, repo string, patterns []string) ([]string, error) {
+	var remote []string
+	seen := make(map[string]bool)
+	var branches []string
+	add := func(branch string) {
+		if !seen[branch] {
+			seen[branch] = true
+			branches = append(branches, branch)
+		}
+	}
+
+	for _, pattern := range patterns {
+		if !strings.ContainsAny(pattern, "*?[") {
+			add(pattern)
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid branch pattern %q: %w", pattern, err)
+		}
+		if remote == nil {
+			refs, err := listRefs(client, owner, repo, "heads/")
+			if err != nil {
+				return nil, err
+			}
+			remote = make([]string, 0, len(refs))
+			for _, ref := range refs {
+				remote = append(remote, strings.TrimPrefix(ref.GetRef(), "refs/heads/"))
+			}
+			sort.Strings(remote)
+		}
+
+		matched := 0
+		for _, branch := range remote {
+			ok, _ := path.Match(pattern, branch)
+			if prefix, deep := strings.CutSuffix(pattern, "/**"); deep {
+				ok = strings.HasPrefix(branch, prefix+"/")
+			}
+			if ok {
+				add(branch)
+				matched++
+			}
+		}
+		if matched == 0 {
+			log.Printf("⚠️ Branch pattern %q matches no branches", pattern)
+		}
+	}
+	return branches, nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// --- Managed Regions ---
+
+const (
+	regionBegin = "BEGIN gitapis-managed"
+	// regionEnd may also be written as a bare END.
+	regionEnd = "END gitapis-managed"
+)
+
+// regionConfig makes the synced content of files matching Globs replace only
+// the region between marker comments in the remote file, leaving the lines
+// people edit around it alone.
+type regionConfig struct {
+	Globs []string
+}
+
+func (c *regionConfig) matches(p string) bool {
+	if c == nil {
+		return false
+	}
+	for _, glob := range c.Globs {
+		if matchAttrPattern(glob, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// findRegion returns the byte offsets of the managed region in content: the
+// start of the BEGIN marker line, the end of that line, the start of the END
+// marker line and the end of that line. ok is false when content has no
+// complete region.
+func findRegion(content string) (begin, bodyStart, bodyEnd, end int, ok bool) {
+	begin, bodyStart = -1, -1
+	for offset := 0; offset < len(content); {
+		next := strings.IndexByte(content[offset:], '\n')
+		lineEnd := len(content)
+		if next >= 0 {
+			lineEnd = offset + next + 1
+		}
+		line := strings.TrimSpace(content[offset:lineEnd])
+		switch {
+		case bodyStart < 0 && isRegionMarker(line, regionBegin):
+			begin, bodyStart = offset, lineEnd
+		case bodyStart >= 0 && isRegionMarker(line, regionEnd):
+			return begin, bodyStart, offset, lineEnd, true
+		}
+		offset = lineEnd
+	}
+	return 0, 0, 0, 0, false
+}
+
+// isRegionMarker reports whether line is a comment holding just marker, in
+// any comment syntax, so files keep whatever markers they were given.
+func isRegionMarker(line, marker string) bool {
+	text := strings.TrimLeft(line, "#/-;*<!%")
+	if text == line {
+		return false
+	}
+	text = strings.TrimSpace(strings.TrimRight(text, "*/->"))
+	return text == marker || marker == regionEnd && text == "END"
+}
+
+// regionMarkers renders the marker lines for p in its comment syntax,
+// falling back to # for unknown extensions.
+func regionMarkers(p string) (begin, end string) {
+	open, close, ok := commentSyntax(p)
+	if !ok {
+		open = "#"
+	}
+	return open + " " + regionBegin + close + "\n", open + " " + regionEnd + close + "\n"
+}
+
+// mergeRegion puts body into remote's managed region, appending a region
+// when remote has none. A local file written with its own markers
+// contributes only what is between them.
+func mergeRegion(p, remote, body string) string {
+	if _, start, stop, _, ok := findRegion(body); ok {
+		body = body[start:stop]
+	}
+	if body != "" && !strings.HasSuffix(body, "\n") {
+		body += "\n"
+	}
+	if _, start, stop, _, ok := findRegion(remote); ok {
+		return remote[:start] + body + remote[stop:]
+	}
+	begin, end := regionMarkers(p)
+	if remote != "" && !strings.HasSuffix(remote, "\n") {
+		remote += "\n"
+	}
+	if remote != "" {
+		remote += "\n"
+	}
+	return remote + begin + body + end
+}
+
+// regionChange returns the status and content to commit for a file that
+// matches the region globs.
+func (c *regionConfig) regionChange(f forge, head, p, content string, exists bool) (string, string, error) {
+	if !exists {
+		return "created", mergeRegion(p, "", content), nil
+	}
+	reader, ok := f.(contentReader)
+	if !ok {
+		return "", "", fmt.Errorf("managed regions need a forge that can read files back to merge them")
+	}
+	remote, err := readRemoteFile(reader, head, p)
+	if err != nil {
+		return "", "", err
+	}
+	merged := mergeRegion(p, remote, content)
+	if merged == remote {
+		return "skipped", "", nil
+	}
+	return "updated", merged, nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Review Reminders ---
+
+// The markers of the comments remind posts, by which later passes find when
+// a pull request was last reminded and whether it was escalated. Keeping the
+// state in the pull requests lets a scheduled job run remind statelessly.
+const (
+	reminderMarker   = "<!-- gitapis:reminder -->"
+	escalationMarker = "<!-- gitapis:escalation -->"
+)
+
+// reminderPolicy is when and how stalled sync pull requests are chased.
+type reminderPolicy struct {
+	Prefixes []string
+	// After is how long a pull request may wait for a review before it gets
+	// a reminder, and then between reminders.
+	After time.Duration
+	// EscalateAfter is how old a pull request gets before review is asked
+	// of FallbackTeam, an org/team-slug team, too.
+	EscalateAfter time.Duration
+	FallbackTeam  string
+	DryRun        bool
+}
+
+// runRemindCommand reminds the reviewers of the tool's open pull requests
+// that have waited too long, and escalates old ones to a fallback team. With
+// -every it keeps doing so, for running as a long-lived process; otherwise
+// it makes one pass, for a scheduled job.
+func runRemindCommand(args []string) error {
+	fs := flag.NewFlagSet("remind", flag.ExitOnError)
+	owner, repo := repoFlags(fs)
+	reposFlag := fs.String("repos", "", "comma-separated owner/repo list, or @file with one per line, to check instead of -owner/-repo")
+	var prefixes stringList
+	fs.Var(&prefixes, "prefix", "head branch prefix of the tool's pull requests (default "+defaultCleanupPrefix+"); repeatable")
+	after := fs.Duration("after", 72*time.Hour, "remind reviewers of pull requests that have waited this long, and again each time this passes")
+	escalateAfter := fs.Duration("escalate-after", 0, "also request a review from -fallback-team once a pull request is this old (0 never)")
+	fallbackTeam := fs.String("fallback-team", "", "org/team-slug team to escalate to")
+	every := fs.Duration("every", 0, "check again at this interval instead of exiting after one pass")
+	dryRun := fs.Bool("dry-run", false, "list the reminders and escalations without posting them")
+	fs.Parse(args)
+
+	if len(prefixes) == 0 {
+		prefixes = stringList{defaultCleanupPrefix}
+	}
+	if (*escalateAfter > 0) != (*fallbackTeam != "") {
+		return errors.New("-escalate-after and -fallback-team go together")
+	}
+	if _, _, ok := strings.Cut(strings.TrimPrefix(*fallbackTeam, "@"), "/"); *fallbackTeam != "" && !ok {
+		return fmt.Errorf("invalid -fallback-team %q, expected org/team-slug", *fallbackTeam)
+	}
+	targets := []repoTarget{{Owner: *owner, Repo: *repo}}
+	if *reposFlag != "" {
+		var err error
+		if targets, err = parseTargets(*reposFlag, *owner); err != nil {
+			return fmt.Errorf("invalid -repos: %w", err)
+		}
+	}
+	policy := &reminderPolicy{
+		Prefixes:      prefixes,
+		After:         *after,
+		EscalateAfter: *escalateAfter,
+		FallbackTeam:  strings.TrimPrefix(*fallbackTeam, "@"),
+		DryRun:        *dryRun,
+	}
+
+	client, err := newGitHubClient()
+	if err != nil {
+		return err
+	}
+	for {
+		failed := 0
+		for _, t := range targets {
+			if err := policy.remind(client, t.Owner, t.Repo, time.Now()); err != nil {
+				log.Printf("%s: %v", t, err)
+				failed++
+			}
+		}
+		if *every == 0 {
+			if failed > 0 {
+				return fmt.Errorf("%d of %d repositories failed", failed, len(targets))
+			}
+			return nil
+		}
+		time.Sleep(*every)
+	}
+}
+
+// remind chases the stalled pull requests of owner/repo as of now.
+func (p *reminderPolicy) remind(client *github.Client, owner, repo string, now time.Time) error {
+	ctx := context.Background()
+	opts := &github.PullRequestListOptions{State: "open", ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		prs, resp, err := client.PullRequests.List(ctx, owner, repo, opts)
+		if err != nil {
+			return fmt.Errorf("List pull requests: %w", err)
+		}
+		for _, pr := range prs {
+			if pr.GetDraft() || !hasAnyPrefix(pr.GetHead().GetRef(), p.Prefixes) {
+				continue
+			}
+			if err := p.chase(client, owner, repo, pr, now); err != nil {
+				return fmt.Errorf("pull request #%d: %w", pr.GetNumber(), err)
+			}
+		}
+		if resp.NextPage == 0 {
+			return nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+// chase reminds, or escalates, one pull request if it is due.
+func (p *reminderPolicy) chase(client *github.Client, owner, repo string, pr *github.PullRequest, now time.Time) error {
+	ctx := context.Background()
+	lastReminder, escalated, err := reminderState(client, owner, repo, pr.GetNumber())
+	if err != nil {
+		return err
+	}
+	since := pr.GetCreatedAt().Time
+	if lastReminder.After(since) {
+		since = lastReminder
+	}
+	if now.Sub(since) < p.After {
+		return nil
+	}
+	age := now.Sub(pr.GetCreatedAt().Time)
+	days := int(age.Hours() / 24)
+
+	if p.EscalateAfter > 0 && age >= p.EscalateAfter && !escalated {
+		_, slug, _ := strings.Cut(p.FallbackTeam, "/")
+		fmt.Printf("%s/%s#%d: escalating to @%s after %d days\n", owner, repo, pr.GetNumber(), p.FallbackTeam, days)
+		if p.DryRun {
+			return nil
+		}
+		if _, _, err := client.PullRequests.RequestReviewers(ctx, owner, repo, pr.GetNumber(), github.ReviewersRequest{TeamReviewers: []string{slug}}); err != nil {
+			return fmt.Errorf("RequestReviewers: %w", err)
+		}
+		body := fmt.Sprintf("%s%s\n@%s, this sync pull request has waited %d days for a review without one. Could you take a look, or route it to whoever should?", reminderMarker, escalationMarker, p.FallbackTeam, days)
+		return postReminder(client, owner, repo, pr.GetNumber(), body)
+	}
+
+	var mentions, users, teams []string
+	for _, u := range pr.RequestedReviewers {
+		mentions = append(mentions, "@"+u.GetLogin())
+		users = append(users, u.GetLogin())
+	}
+	for _, t := range pr.RequestedTeams {
+		mentions = append(mentions, "@"+owner+"/"+t.GetSlug())
+		teams = append(teams, t.GetSlug())
+	}
+	fmt.Printf("%s/%s#%d: reminding %s after %d days\n", owner, repo, pr.GetNumber(), orNone(mentions), days)
+	if p.DryRun {
+		return nil
+	}
+	if len(users) > 0 || len(teams) > 0 {
+		// Re-requesting notifies the reviewers again.
+		if _, _, err := client.PullRequests.RequestReviewers(ctx, owner, repo, pr.GetNumber(), github.ReviewersRequest{Reviewers: users, TeamReviewers: teams}); err != nil {
+			return fmt.Errorf("RequestReviewers: %w", err)
+		}
+	}
+	body := fmt.Sprintf("%s\nThis sync pull request has waited %d days for a review.", reminderMarker, days)
+	if len(mentions) > 0 {
+		body += " " + strings.Join(mentions, " ") + ", could you take a look?"
+	}
+	return postReminder(client, owner, repo, pr.GetNumber(), body)
+}
+
+// reminderState finds when pull request number was last reminded, and
+// whether it was escalated, from the comments remind posted on it.
+func reminderState(client *github.Client, owner, repo string, number int) (time.Time, bool, error) {
+	var last time.Time
+	escalated := false
+	opts := &github.IssueListCommentsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	for {
+		comments, resp, err := client.Issues.ListComments(context.Background(), owner, repo, number, opts)
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("ListComments: %w", err)
+		}
+		for _, c := range comments {
+			if !strings.HasPrefix(c.GetBody(), reminderMarker) {
+				continue
+			}
+			if created := c.GetCreatedAt().Time; created.After(last) {
+				last = created
+			}
+			if strings.Contains(c.GetBody(), escalationMarker) {
+				escalated = true
+			}
+		}
+		if resp.NextPage == 0 {
+			return last, escalated, nil
+		}
+		opts.Page = resp.NextPage
+	}
+}
+
+func postReminder(client *github.Client, owner, repo string, number int, body string) error {
+	if _, _, err := client.Issues.CreateComment(context.Background(), owner, repo, number, &github.IssueComment{Body: github.String(body)}); err != nil {
+		return fmt.Errorf("CreateComment: %w", err)
+	}
+	return nil
+}
+
+func orNone(items []string) string {
+	if len(items) == 0 {
+		return "no requested reviewers"
+	}
+	return strings.Join(items, " ")
+}
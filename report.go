@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"sort"
+	"strings"
+)
+
+// --- Run Report ---
+
+const (
+	reportMarkdown = "markdown"
+	reportHTML     = "html"
+)
+
+// reportRow is one branch of one repository in the run report.
+type reportRow struct {
+	Repo    string
+	Branch  string
+	Status  string
+	Link    string
+	Changed int
+	Error   string
+}
+
+// reportRows flattens outcomes into rows sorted by repository and branch.
+// A repository that failed before any branch was synced gets a single row.
+func reportRows(outcomes []repoOutcome) []reportRow {
+	var rows []reportRow
+	for _, out := range outcomes {
+		if out.Err != nil {
+			rows = append(rows, reportRow{Repo: out.Target.String(), Status: "failed", Error: out.Err.Error()})
+			continue
+		}
+		for _, b := range out.Branches {
+			row := reportRow{Repo: out.Target.String(), Branch: b.Branch}
+			for _, status := range b.Result {
+				if status == "created" || status == "updated" || status == "deleted" {
+					row.Changed++
+				}
+			}
+			switch {
+			case b.Err != nil:
+				// A commit made without some files still gets its link.
+				row.Status, row.Error, row.Link = "failed", b.Err.Error(), b.Commit.GetHTMLURL()
+			case b.PR != nil:
+				row.Status, row.Link = "pull request", b.PR.GetHTMLURL()
+			case b.Commit != nil:
+				row.Status, row.Link = "committed", b.Commit.GetHTMLURL()
+			default:
+				row.Status = "no changes"
+			}
+			rows = append(rows, row)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Repo != rows[j].Repo {
+			return rows[i].Repo < rows[j].Repo
+		}
+		return rows[i].Branch < rows[j].Branch
+	})
+	return rows
+}
+
+// reportCounts tallies rows by status for the report's heading.
+func reportCounts(rows []reportRow) string {
+	counts := make(map[string]int)
+	for _, row := range rows {
+		counts[row.Status]++
+	}
+	return fmt.Sprintf("%d committed, %d pull requests, %d unchanged, %d failed",
+		counts["committed"], counts["pull request"], counts["no changes"], counts["failed"])
+}
+
+// formatMarkdownReport renders rows as a Markdown table, for tracking issues
+// and job summaries.
+func formatMarkdownReport(rows []reportRow) string {
+	cell := func(s string) string {
+		return strings.NewReplacer("|", "\\|", "\n", " ").Replace(s)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "### Sync report\n\n%s\n\n", reportCounts(rows))
+	b.WriteString("| Repository | Branch | Status | Link | Files changed | Error |\n")
+	b.WriteString("| --- | --- | --- | --- | --- | --- |\n")
+	for _, row := range rows {
+		link := ""
+		if row.Link != "" {
+			link = fmt.Sprintf("[view](%s)", row.Link)
+		}
+		fmt.Fprintf(&b, "| %s | %s | %s | %s | %d | %s |\n",
+			cell(row.Repo), cell(row.Branch), row.Status, link, row.Changed, cell(row.Error))
+	}
+	return b.String()
+}
+
+var htmlReport = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sync report</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+.failed { background: #fdd; }
+</style>
+</head>
+<body>
+<h1>Sync report</h1>
+<p>{{.Counts}}</p>
+<table>
+<tr><th>Repository</th><th>Branch</th><th>Status</th><th>Link</th><th>Files changed</th><th>Error</th></tr>
+{{- range .Rows}}
+<tr{{if eq .Status "failed"}} class="failed"{{end}}><td>{{.Repo}}</td><td>{{.Branch}}</td><td>{{.Status}}</td><td>{{if .Link}}<a href="{{.Link}}">view</a>{{end}}</td><td>{{.Changed}}</td><td>{{.Error}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
+
+// writeReport writes the run report to path in format, which defaults to
+// HTML for .html files and Markdown otherwise.
+func writeReport(path, format string, outcomes []repoOutcome) error {
+	if format == "" {
+		format = reportMarkdown
+		if strings.HasSuffix(path, ".html") || strings.HasSuffix(path, ".htm") {
+			format = reportHTML
+		}
+	}
+	rows := reportRows(outcomes)
+
+	var b strings.Builder
+	switch format {
+	case reportMarkdown:
+		b.WriteString(formatMarkdownReport(rows))
+	case reportHTML:
+		if err := htmlReport.Execute(&b, struct {
+			Counts string
+			Rows   []reportRow
+		}{reportCounts(rows), rows}); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown report format %q, expected %s or %s", format, reportMarkdown, reportHTML)
+	}
+	return os.WriteFile(path, []byte(b.String()), 0o644)
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Autolinks and Custom Properties ---
+
+// repoSettings are the autolink references and custom properties every
+// synced repository gets:
+//
+//	{
+//	  "autolinks": [{"key_prefix": "JIRA-", "url_template": "https://jira.example.com/browse/JIRA-<num>"}],
+//	  "property_definitions": [{"property_name": "team", "value_type": "string", "required": false}],
+//	  "properties": {"team": "platform"}
+//	}
+//
+// Property definitions are taken as the org custom properties API takes
+// them, and set once per organization; property values are set on each
+// repository. Autolinks and properties the file does not name are left
+// alone.
+type repoSettings struct {
+	Autolinks           []autolinkSpec   `json:"autolinks,omitempty"`
+	PropertyDefinitions []map[string]any `json:"property_definitions,omitempty"`
+	Properties          map[string]any   `json:"properties,omitempty"`
+
+	mu   sync.Mutex
+	orgs map[string]bool
+}
+
+type autolinkSpec struct {
+	KeyPrefix   string `json:"key_prefix"`
+	URLTemplate string `json:"url_template"`
+	// IsAlphanumeric, true unless set, matches letters as well as digits
+	// after the prefix, as GitHub does by default.
+	IsAlphanumeric *bool `json:"is_alphanumeric,omitempty"`
+}
+
+func (a autolinkSpec) alphanumeric() bool {
+	return a.IsAlphanumeric == nil || *a.IsAlphanumeric
+}
+
+func loadRepoSettings(path string) (*repoSettings, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repo settings: %w", err)
+	}
+	s := &repoSettings{orgs: make(map[string]bool)}
+	if err := json.Unmarshal(b, s); err != nil {
+		return nil, fmt.Errorf("failed to parse repo settings: %w", err)
+	}
+	seen := make(map[string]bool)
+	for i, a := range s.Autolinks {
+		if a.KeyPrefix == "" || !strings.Contains(a.URLTemplate, "<num>") {
+			return nil, fmt.Errorf("autolink %d: needs a key_prefix and a url_template containing <num>", i+1)
+		}
+		if seen[a.KeyPrefix] {
+			return nil, fmt.Errorf("autolink %s is listed twice", a.KeyPrefix)
+		}
+		seen[a.KeyPrefix] = true
+	}
+	for i, d := range s.PropertyDefinitions {
+		if name, _ := d["property_name"].(string); name == "" {
+			return nil, fmt.Errorf("property definition %d: missing property_name", i+1)
+		}
+	}
+	return s, nil
+}
+
+// apply reconciles the autolinks and custom properties of owner/repo.
+func (s *repoSettings) apply(client *github.Client, owner, repo string) error {
+	if s == nil {
+		return nil
+	}
+	if err := reconcileAutolinks(client, owner, repo, s.Autolinks); err != nil {
+		return err
+	}
+	if len(s.PropertyDefinitions) > 0 {
+		if err := s.defineProperties(client, owner); err != nil {
+			return err
+		}
+	}
+	return setCustomProperties(client, owner, repo, s.Properties)
+}
+
+// reconcileAutolinks adds the autolinks missing from owner/repo. One whose
+// prefix exists with another template is replaced, there being no way to
+// edit an autolink.
+func reconcileAutolinks(client *github.Client, owner, repo string, specs []autolinkSpec) error {
+	if len(specs) == 0 {
+		return nil
+	}
+	ctx := context.Background()
+	existing := make(map[string]*github.Autolink)
+	opts := &github.ListOptions{PerPage: 100}
+	for {
+		page, resp, err := client.Repositories.ListAutolinks(ctx, owner, repo, opts)
+		if err != nil {
+			return fmt.Errorf("ListAutolinks: %w", err)
+		}
+		for _, a := range page {
+			existing[a.GetKeyPrefix()] = a
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+
+	for _, spec := range specs {
+		if current, ok := existing[spec.KeyPrefix]; ok {
+			if current.GetURLTemplate() == spec.URLTemplate && current.GetIsAlphanumeric() == spec.alphanumeric() {
+				continue
+			}
+			if _, err := client.Repositories.DeleteAutolink(ctx, owner, repo, current.GetID()); err != nil {
+				return fmt.Errorf("DeleteAutolink %s: %w", spec.KeyPrefix, err)
+			}
+		}
+		add := &github.AutolinkOptions{KeyPrefix: github.String(spec.KeyPrefix), URLTemplate: github.String(spec.URLTemplate), IsAlphanumeric: github.Bool(spec.alphanumeric())}
+		if _, _, err := client.Repositories.AddAutolink(ctx, owner, repo, add); err != nil {
+			return fmt.Errorf("AddAutolink %s: %w", spec.KeyPrefix, err)
+		}
+		log.Printf("Set autolink %s on %s/%s", spec.KeyPrefix, owner, repo)
+	}
+	return nil
+}
+
+// defineProperties creates or updates the property definitions in org, the
+// first time each organization is seen in the run. The client library has
+// no custom properties API yet, so requests are made directly.
+func (s *repoSettings) defineProperties(client *github.Client, org string) error {
+	key := strings.ToLower(org)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.orgs[key] {
+		return nil
+	}
+
+	ctx := context.Background()
+	base := fmt.Sprintf("orgs/%s/properties/schema", org)
+	var current []map[string]any
+	req, err := client.NewRequest("GET", base, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := client.Do(ctx, req, &current); err != nil {
+		return fmt.Errorf("GetCustomProperties %s: %w", org, err)
+	}
+	byName := make(map[string]map[string]any, len(current))
+	for _, d := range current {
+		name, _ := d["property_name"].(string)
+		byName[name] = d
+	}
+
+	var changed []any
+	var names []string
+	for _, d := range s.PropertyDefinitions {
+		name := d["property_name"].(string)
+		if have, ok := byName[name]; ok && jsonSubset(d, have) {
+			continue
+		}
+		changed = append(changed, d)
+		names = append(names, name)
+	}
+	if len(changed) > 0 {
+		req, err := client.NewRequest("PATCH", base, map[string]any{"properties": changed})
+		if err != nil {
+			return err
+		}
+		if _, err := client.Do(ctx, req, nil); err != nil {
+			return fmt.Errorf("CreateOrUpdateCustomProperties %s: %w", org, err)
+		}
+		log.Printf("Defined custom properties %s in %s", strings.Join(names, ", "), org)
+	}
+	s.orgs[key] = true
+	return nil
+}
+
+// setCustomProperties sets the properties of owner/repo that differ from
+// values.
+func setCustomProperties(client *github.Client, owner, repo string, values map[string]any) error {
+	if len(values) == 0 {
+		return nil
+	}
+	ctx := context.Background()
+	path := fmt.Sprintf("repos/%s/%s/properties/values", owner, repo)
+	var current []struct {
+		Name  string `json:"property_name"`
+		Value any    `json:"value"`
+	}
+	req, err := client.NewRequest("GET", path, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := client.Do(ctx, req, &current); err != nil {
+		return fmt.Errorf("GetCustomPropertyValues: %w", err)
+	}
+	have := make(map[string]any, len(current))
+	for _, p := range current {
+		have[p.Name] = p.Value
+	}
+
+	names := make([]string, 0, len(values))
+	for name, value := range values {
+		if !reflect.DeepEqual(value, have[name]) {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	sort.Strings(names)
+	changed := make([]map[string]any, 0, len(names))
+	for _, name := range names {
+		changed = append(changed, map[string]any{"property_name": name, "value": values[name]})
+	}
+	if req, err = client.NewRequest("PATCH", path, map[string]any{"properties": changed}); err != nil {
+		return err
+	}
+	if _, err := client.Do(ctx, req, nil); err != nil {
+		return fmt.Errorf("CreateOrUpdateCustomPropertyValues: %w", err)
+	}
+	log.Printf("Set custom properties %s on %s/%s", strings.Join(names, ", "), owner, repo)
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Revert ---
+
+func runRevertCommand(args []string) error {
+	fs := flag.NewFlagSet("revert", flag.ExitOnError)
+	owner, repo := repoFlags(fs)
+	branch := fs.String("branch", defaultBranch, "branch to revert the commit on")
+	viaPR := fs.Bool("pr", false, "commit the revert to a new branch and open a pull request")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: revert [flags] <sha>")
+	}
+	sha := fs.Arg(0)
+	client, err := newGitHubClient()
+	if err != nil {
+		return err
+	}
+
+	target := prTarget{Owner: *owner, Repo: *repo, Branch: *branch}
+	if *viaPR {
+		target, err = setupPullRequestBranch(client, *owner, *repo, *branch, "gitapis/revert-"+shortSHA(sha), false)
+		if err != nil {
+			return err
+		}
+	}
+
+	result, commit, err := revertCommit(client, target.Owner, target.Repo, target.Branch, sha)
+	printSummary(result)
+	if err != nil || commit == nil || !*viaPR {
+		return err
+	}
+
+	title, _, _ := strings.Cut(commit.GetMessage(), "\n")
+	body := formatChangeSummary(target.Owner, target.Repo, result, commit.GetSHA(), nil)
+	_, err = openPullRequest(client, *owner, *repo, *branch, target, title, body)
+	return err
+}
+
+// revertCommit commits the inverse of sha's file changes onto branch.
+func revertCommit(client *github.Client, owner, repo, branch, sha string) (map[string]string, *github.Commit, error) {
+	ctx := context.Background()
+
+	commit, _, err := client.Git.GetCommit(ctx, owner, repo, sha)
+	if err != nil {
+		return nil, nil, fmt.Errorf("GetCommit: %w", err)
+	}
+	if len(commit.Parents) != 1 {
+		return nil, nil, fmt.Errorf("commit %s has %d parents, only single-parent commits can be reverted", sha, len(commit.Parents))
+	}
+	parentSHA := commit.Parents[0].GetSHA()
+
+	parent, _, err := client.Git.GetCommit(ctx, owner, repo, parentSHA)
+	if err != nil {
+		return nil, nil, fmt.Errorf("GetCommit parent: %w", err)
+	}
+	paths, err := changedPaths(client, owner, repo, parentSHA, commit.GetSHA())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	subject, _, _ := strings.Cut(commit.GetMessage(), "\n")
+	message := fmt.Sprintf("Revert %q\n\nThis reverts commit %s.", subject, commit.GetSHA())
+	return applyTreeDelta(client, owner, repo, branch, paths, commit.Tree.GetSHA(), parent.Tree.GetSHA(), message)
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
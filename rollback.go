@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Rollback ---
+
+const defaultRollbackFile = "gitapis-rollback.json"
+
+// pushRecord is where a branch was before and after one run. An empty Before
+// means the run created the branch.
+type pushRecord struct {
+	Owner  string    `json:"owner"`
+	Repo   string    `json:"repo"`
+	Branch string    `json:"branch"`
+	Before string    `json:"before"`
+	After  string    `json:"after"`
+	Time   time.Time `json:"time"`
+}
+
+func pushRecordKey(owner, repo, branch string) string {
+	return owner + "/" + repo + "@" + branch
+}
+
+func readPushRecords(path string) (map[string]pushRecord, error) {
+	records := make(map[string]pushRecord)
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return records, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &records); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return records, nil
+}
+
+// recordPushMu serializes recordPush across the workers of a fan-out run.
+var recordPushMu sync.Mutex
+
+// recordPush stores rec in the file at path, replacing the previous record for
+// the same branch.
+func recordPush(path string, rec pushRecord) error {
+	recordPushMu.Lock()
+	defer recordPushMu.Unlock()
+	records, err := readPushRecords(path)
+	if err != nil {
+		return err
+	}
+	records[pushRecordKey(rec.Owner, rec.Repo, rec.Branch)] = rec
+	b, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
+
+// branchHead returns the commit branch points at, or "" if it doesn't exist.
+func branchHead(client *github.Client, owner, repo, branch string) (string, error) {
+	ref, resp, err := client.Git.GetRef(context.Background(), owner, repo, "refs/heads/"+branch)
+	if err != nil {
+		if resp != nil && (resp.StatusCode == 404 || resp.StatusCode == 409) {
+			return "", nil
+		}
+		return "", fmt.Errorf("GetRef: %w", err)
+	}
+	return ref.Object.GetSHA(), nil
+}
+
+func runRollbackCommand(args []string) error {
+	fs := flag.NewFlagSet("rollback", flag.ExitOnError)
+	owner, repo := repoFlags(fs)
+	branch := fs.String("branch", defaultBranch, "branch to roll back")
+	file := fs.String("file", defaultRollbackFile, "file the sync recorded its pushes in")
+	force := fs.Bool("force", false, "roll back even if the branch has moved since the sync")
+	viaPR := fs.Bool("pr", false, "open a pull request restoring the old tree instead of resetting the branch")
+	fs.Parse(args)
+
+	records, err := readPushRecords(*file)
+	if err != nil {
+		return err
+	}
+	rec, ok := records[pushRecordKey(*owner, *repo, *branch)]
+	if !ok {
+		return fmt.Errorf("no push to %s/%s@%s is recorded in %s", *owner, *repo, *branch, *file)
+	}
+	client, err := newGitHubClient()
+	if err != nil {
+		return err
+	}
+
+	head, err := branchHead(client, rec.Owner, rec.Repo, rec.Branch)
+	if err != nil {
+		return err
+	}
+	if head != rec.After && !*force {
+		return fmt.Errorf("%s is at %s, not at %s pushed on %s; use -force to roll back anyway",
+			rec.Branch, shortSHA(head), shortSHA(rec.After), rec.Time.Format(time.RFC3339))
+	}
+
+	if !*viaPR {
+		protected, err := branchIsProtected(client, rec.Owner, rec.Repo, rec.Branch)
+		if err != nil {
+			return err
+		}
+		if !protected {
+			return resetBranch(client, rec, head)
+		}
+		fmt.Printf("%s is protected, opening a pull request instead.\n", rec.Branch)
+	}
+	if rec.Before == "" {
+		return fmt.Errorf("%s was created by the sync; delete it instead of opening a pull request", rec.Branch)
+	}
+	return rollbackPullRequest(client, rec, head)
+}
+
+func branchIsProtected(client *github.Client, owner, repo, branch string) (bool, error) {
+	b, _, err := client.Repositories.GetBranch(context.Background(), owner, repo, branch, true)
+	if err != nil {
+		return false, fmt.Errorf("GetBranch: %w", err)
+	}
+	return b.GetProtected(), nil
+}
+
+// resetBranch force-moves the branch back to rec.Before, or deletes it when
+// the sync created it.
+func resetBranch(client *github.Client, rec pushRecord, head string) error {
+	ctx := context.Background()
+	ref := "refs/heads/" + rec.Branch
+	if rec.Before == "" {
+		if _, err := client.Git.DeleteRef(ctx, rec.Owner, rec.Repo, ref); err != nil {
+			return fmt.Errorf("DeleteRef: %w", err)
+		}
+		fmt.Printf("Deleted %s, which the sync created.\n", rec.Branch)
+		return nil
+	}
+	if err := setRef(client, rec.Owner, rec.Repo, ref, rec.Before); err != nil {
+		return err
+	}
+	fmt.Printf("Reset %s from %s to %s.\n", rec.Branch, shortSHA(head), shortSHA(rec.Before))
+	return nil
+}
+
+// rollbackPullRequest commits the tree of rec.Before on top of head in a new
+// branch and opens a pull request for it, for branches that cannot be reset.
+func rollbackPullRequest(client *github.Client, rec pushRecord, head string) error {
+	ctx := context.Background()
+
+	before, _, err := client.Git.GetCommit(ctx, rec.Owner, rec.Repo, rec.Before)
+	if err != nil {
+		return fmt.Errorf("GetCommit %s: %w", shortSHA(rec.Before), err)
+	}
+	current, _, err := client.Git.GetCommit(ctx, rec.Owner, rec.Repo, head)
+	if err != nil {
+		return fmt.Errorf("GetCommit %s: %w", shortSHA(head), err)
+	}
+	paths, err := changedPaths(client, rec.Owner, rec.Repo, rec.Before, head)
+	if err != nil {
+		return err
+	}
+
+	target, err := setupPullRequestBranch(client, rec.Owner, rec.Repo, rec.Branch, "gitapis/rollback-"+shortSHA(rec.After), false)
+	if err != nil {
+		return err
+	}
+	message := fmt.Sprintf("Roll back %s to %s\n\nThis undoes the sync that pushed %s.", rec.Branch, shortSHA(rec.Before), rec.After)
+	result, commit, err := applyTreeDelta(client, target.Owner, target.Repo, target.Branch, paths, current.Tree.GetSHA(), before.Tree.GetSHA(), message)
+	printSummary(result)
+	if err != nil || commit == nil {
+		return err
+	}
+
+	body := formatChangeSummary(target.Owner, target.Repo, result, commit.GetSHA(), nil)
+	_, err = openPullRequest(client, rec.Owner, rec.Repo, rec.Branch, target, fmt.Sprintf("Roll back %s to %s", rec.Branch, shortSHA(rec.Before)), body)
+	return err
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Staged Rollout ---
+
+const (
+	// checksPoll is how often the checks of a wave's commits are looked at.
+	checksPoll = 15 * time.Second
+	// checksGrace is how long a commit may go without any check before it
+	// counts as having none, since workflows take a moment to start.
+	checksGrace = time.Minute
+)
+
+// rolloutPlan stages a fan-out run in waves: the canary repositories first,
+// then the rest WaveSize at a time. After each wave the run waits for the
+// checks of its commits and for Soak, and stops if more than MaxFailures of
+// the wave's repositories failed.
+type rolloutPlan struct {
+	// Canary is the first wave, a count of leading targets or a list.
+	Canary string
+	// WaveSize is how many repositories each later wave takes, 0 for all.
+	WaveSize      int
+	Checks        bool
+	ChecksTimeout time.Duration
+	Soak          time.Duration
+	// MaxFailures is the fraction of a wave's repositories that may fail
+	// without stopping the rollout.
+	MaxFailures float64
+}
+
+// waves splits targets into the plan's waves, in order.
+func (p *rolloutPlan) waves(targets []repoTarget, defaultOwner string) ([][]repoTarget, error) {
+	var canary []repoTarget
+	rest := targets
+	if n, err := strconv.Atoi(p.Canary); err == nil {
+		if n < 0 {
+			return nil, fmt.Errorf("invalid -canary %d", n)
+		}
+		n = min(n, len(targets))
+		canary, rest = targets[:n], targets[n:]
+	} else if p.Canary != "" {
+		if canary, err = parseTargets(p.Canary, defaultOwner); err != nil {
+			return nil, fmt.Errorf("invalid -canary: %w", err)
+		}
+		inCanary := make(map[repoTarget]bool)
+		for _, t := range canary {
+			inCanary[t] = true
+		}
+		seen := make(map[repoTarget]bool)
+		rest = nil
+		for _, t := range targets {
+			seen[t] = true
+			if !inCanary[t] {
+				rest = append(rest, t)
+			}
+		}
+		for _, t := range canary {
+			if !seen[t] {
+				return nil, fmt.Errorf("canary %s is not one of the targets", t)
+			}
+		}
+	}
+
+	var waves [][]repoTarget
+	if len(canary) > 0 {
+		waves = append(waves, canary)
+	}
+	size := p.WaveSize
+	if size <= 0 {
+		size = len(rest)
+	}
+	for len(rest) > 0 {
+		n := min(size, len(rest))
+		waves = append(waves, rest[:n])
+		rest = rest[n:]
+	}
+	return waves, nil
+}
+
+// rollout syncs targets wave by wave. The targets of waves that never ran,
+// because an earlier one failed, get outcomes saying so.
+func rollout(client *github.Client, cfg *syncConfig, plan *rolloutPlan, waves [][]repoTarget, patterns []string, source map[string]string, parallel int) []repoOutcome {
+	var outcomes []repoOutcome
+	for i, wave := range waves {
+		fmt.Printf("🌊 Wave %d of %d: %d repositories\n", i+1, len(waves), len(wave))
+		results := fanOut(client, cfg, wave, patterns, source, parallel)
+		if plan.Checks {
+			for j := range results {
+				waitForWaveChecks(client, &results[j], plan.ChecksTimeout)
+			}
+		}
+		outcomes = append(outcomes, results...)
+
+		failed := 0
+		for _, out := range results {
+			if out.failed() {
+				failed++
+			}
+		}
+		if i == len(waves)-1 {
+			break
+		}
+		if float64(failed) > plan.MaxFailures*float64(len(wave)) {
+			log.Printf("❌ %d of %d repositories of wave %d failed; stopping the rollout", failed, len(wave), i+1)
+			for _, rest := range waves[i+1:] {
+				for _, t := range rest {
+					outcomes = append(outcomes, repoOutcome{Target: t, Err: fmt.Errorf("not synced, the rollout stopped after wave %d", i+1)})
+				}
+			}
+			break
+		}
+		if plan.Soak > 0 {
+			fmt.Printf("Wave %d done; soaking for %s\n", i+1, plan.Soak)
+			time.Sleep(plan.Soak)
+		}
+	}
+	return outcomes
+}
+
+// waitForWaveChecks waits for the checks of every commit out made, failing
+// the branches whose checks fail or do not finish within timeout.
+func waitForWaveChecks(client *github.Client, out *repoOutcome, timeout time.Duration) {
+	for i := range out.Branches {
+		b := &out.Branches[i]
+		if b.Err != nil || b.Commit == nil {
+			continue
+		}
+		owner, repo := out.Target.Owner, out.Target.Repo
+		if b.PR != nil {
+			// The commit is on the head branch, which may be in a fork.
+			owner, repo = b.PR.GetHead().GetRepo().GetOwner().GetLogin(), b.PR.GetHead().GetRepo().GetName()
+		}
+		if err := waitForChecks(client, owner, repo, b.Commit.GetSHA(), timeout); err != nil {
+			b.Err = fmt.Errorf("%s: %w", shortSHA(b.Commit.GetSHA()), err)
+			log.Printf("%s@%s: %v", out.Target, b.Branch, b.Err)
+		}
+	}
+}
+
+// waitForChecks waits up to timeout for the check runs and commit statuses
+// of sha to finish, and fails if any of them did not pass. A commit that
+// gets no checks at all passes once checksGrace is over.
+func waitForChecks(client *github.Client, owner, repo, sha string, timeout time.Duration) error {
+	ctx := context.Background()
+	start := time.Now()
+	for {
+		pending, total := 0, 0
+		var failed []string
+
+		opts := &github.ListCheckRunsOptions{ListOptions: github.ListOptions{PerPage: 100}}
+		for {
+			runs, resp, err := client.Checks.ListCheckRunsForRef(ctx, owner, repo, sha, opts)
+			if err != nil {
+				return fmt.Errorf("ListCheckRunsForRef: %w", err)
+			}
+			for _, run := range runs.CheckRuns {
+				total++
+				switch {
+				case run.GetStatus() != "completed":
+					pending++
+				case run.GetConclusion() == "success" || run.GetConclusion() == "neutral" || run.GetConclusion() == "skipped":
+				default:
+					failed = append(failed, run.GetName()+" "+run.GetConclusion())
+				}
+			}
+			if resp.NextPage == 0 {
+				break
+			}
+			opts.Page = resp.NextPage
+		}
+		combined, _, err := client.Repositories.GetCombinedStatus(ctx, owner, repo, sha, nil)
+		if err != nil {
+			return fmt.Errorf("GetCombinedStatus: %w", err)
+		}
+		for _, s := range combined.Statuses {
+			total++
+			switch s.GetState() {
+			case "pending":
+				pending++
+			case "success":
+			default:
+				failed = append(failed, s.GetContext()+" "+s.GetState())
+			}
+		}
+
+		switch {
+		case len(failed) > 0:
+			return fmt.Errorf("checks failed: %s", strings.Join(failed, ", "))
+		case pending == 0 && (total > 0 || time.Since(start) >= checksGrace):
+			return nil
+		case time.Since(start) >= timeout:
+			return fmt.Errorf("%d of %d checks still running after %s", pending, total, timeout)
+		}
+		time.Sleep(checksPoll)
+	}
+}
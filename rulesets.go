@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Rulesets ---
+
+// rulesetSpec is a repository ruleset as the rulesets API takes it: name,
+// target (branch, tag or push), enforcement, bypass_actors, conditions and
+// rules. It is kept as raw JSON so that rule types the client library does
+// not know yet, such as push rules and required workflows, pass through.
+type rulesetSpec map[string]any
+
+func (r rulesetSpec) name() string {
+	name, _ := r["name"].(string)
+	return name
+}
+
+func loadRulesets(path string) ([]rulesetSpec, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rulesets: %w", err)
+	}
+	var specs []rulesetSpec
+	if err := json.Unmarshal(b, &specs); err != nil {
+		return nil, fmt.Errorf("failed to parse rulesets: %w", err)
+	}
+	seen := make(map[string]bool)
+	for i, r := range specs {
+		name := r.name()
+		if name == "" {
+			return nil, fmt.Errorf("ruleset %d: missing name", i+1)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("ruleset %s is listed twice", name)
+		}
+		seen[name] = true
+		switch r["target"] {
+		case nil, "branch", "tag", "push":
+		default:
+			return nil, fmt.Errorf("ruleset %s: target must be branch, tag or push", name)
+		}
+		switch r["enforcement"] {
+		case "active", "evaluate", "disabled":
+		default:
+			return nil, fmt.Errorf("ruleset %s: enforcement must be active, evaluate or disabled", name)
+		}
+	}
+	return specs, nil
+}
+
+// reconcileRulesets makes the repository's own rulesets named in specs match
+// them, creating those that are missing. Rulesets it does not name, and
+// those inherited from the organization, are left alone.
+func reconcileRulesets(client *github.Client, owner, repo string, specs []rulesetSpec) error {
+	if len(specs) == 0 {
+		return nil
+	}
+	ctx := context.Background()
+	base := fmt.Sprintf("repos/%s/%s/rulesets", owner, repo)
+
+	var existing []struct {
+		ID         int64  `json:"id"`
+		Name       string `json:"name"`
+		SourceType string `json:"source_type"`
+	}
+	req, err := client.NewRequest("GET", base+"?includes_parents=false&per_page=100", nil)
+	if err != nil {
+		return err
+	}
+	if _, err := client.Do(ctx, req, &existing); err != nil {
+		return fmt.Errorf("ListRulesets: %w", err)
+	}
+	ids := make(map[string]int64)
+	for _, r := range existing {
+		if r.SourceType == "Repository" {
+			ids[r.Name] = r.ID
+		}
+	}
+
+	for _, spec := range specs {
+		id, ok := ids[spec.name()]
+		if !ok {
+			if req, err = client.NewRequest("POST", base, spec); err == nil {
+				_, err = client.Do(ctx, req, nil)
+			}
+			if err != nil {
+				return fmt.Errorf("CreateRuleset %s: %w", spec.name(), err)
+			}
+			log.Printf("Created ruleset %s on %s/%s", spec.name(), owner, repo)
+			continue
+		}
+
+		var current map[string]any
+		path := fmt.Sprintf("%s/%d", base, id)
+		if req, err = client.NewRequest("GET", path, nil); err == nil {
+			_, err = client.Do(ctx, req, &current)
+		}
+		if err != nil {
+			return fmt.Errorf("GetRuleset %s: %w", spec.name(), err)
+		}
+		if jsonSubset(map[string]any(spec), current) {
+			continue
+		}
+		if req, err = client.NewRequest("PUT", path, spec); err == nil {
+			_, err = client.Do(ctx, req, nil)
+		}
+		if err != nil {
+			return fmt.Errorf("UpdateRuleset %s: %w", spec.name(), err)
+		}
+		log.Printf("Updated ruleset %s on %s/%s", spec.name(), owner, repo)
+	}
+	return nil
+}
+
+// jsonSubset reports whether every value in want is also in have, so that a
+// ruleset only counts as changed where it differs from its spec and not by
+// the defaults GitHub fills in.
+func jsonSubset(want, have any) bool {
+	switch w := want.(type) {
+	case map[string]any:
+		h, ok := have.(map[string]any)
+		if !ok {
+			return false
+		}
+		for key, value := range w {
+			if !jsonSubset(value, h[key]) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		h, ok := have.([]any)
+		if !ok || len(h) != len(w) {
+			return false
+		}
+		for i := range w {
+			if !jsonSubset(w[i], h[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(want, have)
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// --- Run History ---
+
+// defaultRunsFile is the bolt database every sync records what it did in:
+// one record per repository branch, and the latest status of each branch
+// folded in the same transaction, so reading the status never means reading
+// the whole history.
+const defaultRunsFile = "gitapis-runs.db"
+
+// runsBucket holds every record under its sequence number, branchesBucket
+// the branchStatus of each repo@branch, and errorsBucket the sequence
+// numbers of the latest failed records.
+var (
+	runsBucket     = []byte("runs")
+	branchesBucket = []byte("branches")
+	errorsBucket   = []byte("errors")
+)
+
+const (
+	// recentErrors is how many of the latest failures are kept at hand.
+	recentErrors = 20
+	// runsLockWait is how long a run waits for another to finish recording.
+	// Bolt locks the whole file, so the status command and the dashboard,
+	// which only open it to read, wait for the writer as well.
+	runsLockWait = 30 * time.Second
+)
+
+// runRecord is what one run did to one branch of one repository.
+type runRecord struct {
+	RunID  string    `json:"run_id"`
+	Time   time.Time `json:"time"`
+	Repo   string    `json:"repo"`
+	Branch string    `json:"branch,omitempty"`
+	// Status is one of the statuses of the run report.
+	Status   string `json:"status"`
+	Commit   string `json:"commit,omitempty"`
+	PR       int    `json:"pr,omitempty"`
+	Link     string `json:"link,omitempty"`
+	Changed  int    `json:"changed"`
+	Error    string `json:"error,omitempty"`
+	MergeSHA string `json:"merge_sha,omitempty"`
+}
+
+// synced reports whether the branch matched the source after the run.
+func (r runRecord) synced() bool {
+	return r.Status == "committed" || r.Status == "no changes" || r.MergeSHA != ""
+}
+
+// openRuns opens the run history at path, waiting up to runsLockWait for a
+// run that is recording.
+func openRuns(path string, readOnly bool) (*bolt.DB, error) {
+	if readOnly {
+		// Opening read-only does not create a missing history.
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+	}
+	db, err := bolt.Open(path, 0o644, &bolt.Options{Timeout: runsLockWait, ReadOnly: readOnly})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("%s is held by another run", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the run history: %w", err)
+	}
+	return db, nil
+}
+
+// recordRuns adds the outcomes of this run to the history at path and folds
+// them into the status of their branches, in one transaction.
+func recordRuns(path string, outcomes []repoOutcome, now time.Time) error {
+	byBranch := make(map[string]branchOutcome)
+	for _, out := range outcomes {
+		for _, b := range out.Branches {
+			byBranch[out.Target.String()+"@"+b.Branch] = b
+		}
+	}
+	var records []runRecord
+	for _, row := range reportRows(outcomes) {
+		rec := runRecord{RunID: runID, Time: now, Repo: row.Repo, Branch: row.Branch, Status: row.Status, Link: row.Link, Changed: row.Changed, Error: row.Error}
+		if b, ok := byBranch[row.Repo+"@"+row.Branch]; ok {
+			rec.Commit, rec.PR, rec.MergeSHA = b.Commit.GetSHA(), b.PR.GetNumber(), b.Merged
+		}
+		records = append(records, rec)
+	}
+
+	db, err := openRuns(path, false)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Update(func(tx *bolt.Tx) error {
+		buckets := make([]*bolt.Bucket, 3)
+		for i, name := range [][]byte{runsBucket, branchesBucket, errorsBucket} {
+			if buckets[i], err = tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		runs, branches, errs := buckets[0], buckets[1], buckets[2]
+		for _, rec := range records {
+			seq, err := runs.NextSequence()
+			if err != nil {
+				return err
+			}
+			b, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+			if err := runs.Put(runKey(seq), b); err != nil {
+				return err
+			}
+
+			key := []byte(rec.Repo + "@" + rec.Branch)
+			status := &branchStatus{}
+			if v := branches.Get(key); v != nil {
+				if err := json.Unmarshal(v, status); err != nil {
+					return fmt.Errorf("status of %s: %w", key, err)
+				}
+			}
+			status.fold(rec)
+			if b, err = json.Marshal(status); err != nil {
+				return err
+			}
+			if err := branches.Put(key, b); err != nil {
+				return err
+			}
+			if rec.Error != "" {
+				if err := errs.Put(runKey(seq), nil); err != nil {
+					return err
+				}
+			}
+		}
+		return trimErrors(errs)
+	})
+}
+
+// runKey is the key of the record with sequence number seq; big-endian, so
+// that keys sort in the order the records were added.
+func runKey(seq uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, seq)
+}
+
+// trimErrors drops all but the latest recentErrors failures from the
+// index; their records stay in the history.
+func trimErrors(errs *bolt.Bucket) error {
+	var old [][]byte
+	c := errs.Cursor()
+	n := 0
+	for k, _ := c.Last(); k != nil; k, _ = c.Prev() {
+		if n++; n > recentErrors {
+			old = append(old, append([]byte(nil), k...))
+		}
+	}
+	for _, k := range old {
+		if err := errs.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// branchStatus is the latest state of one repository branch in the history.
+type branchStatus struct {
+	Last runRecord `json:"last"`
+	// SyncedAt is when a run last left the branch matching the source, and
+	// nil if none did.
+	SyncedAt *time.Time `json:"synced_at,omitempty"`
+	// PendingPR is the pull request of the last run, if it opened one and
+	// no later run superseded it.
+	PendingPR int `json:"pending_pr,omitempty"`
+}
+
+// runState is the latest status of each branch in the history.
+type runState struct {
+	Branches map[string]*branchStatus
+	// Errors are the latest failed records, newest first.
+	Errors []runRecord
+}
+
+// loadRunState reads the status of every branch and the latest failures
+// from the history at path.
+func loadRunState(path string) (*runState, error) {
+	db, err := openRuns(path, true)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	state := &runState{Branches: make(map[string]*branchStatus)}
+	err = db.View(func(tx *bolt.Tx) error {
+		branches, runs, errs := tx.Bucket(branchesBucket), tx.Bucket(runsBucket), tx.Bucket(errorsBucket)
+		if branches == nil || runs == nil || errs == nil {
+			// No run recorded anything yet.
+			return nil
+		}
+		err := branches.ForEach(func(k, v []byte) error {
+			status := &branchStatus{}
+			if err := json.Unmarshal(v, status); err != nil {
+				return fmt.Errorf("status of %s: %w", k, err)
+			}
+			state.Branches[string(k)] = status
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		c := errs.Cursor()
+		for k, _ := c.Last(); k != nil; k, _ = c.Prev() {
+			var rec runRecord
+			if err := json.Unmarshal(runs.Get(k), &rec); err != nil {
+				return fmt.Errorf("run %d: %w", binary.BigEndian.Uint64(k), err)
+			}
+			state.Errors = append(state.Errors, rec)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// fold applies rec to the status. A record older than the last one, of a
+// run that took longer to record, changes nothing.
+func (s *branchStatus) fold(rec runRecord) {
+	if rec.Time.Before(s.Last.Time) {
+		return
+	}
+	s.Last = rec
+	if rec.synced() {
+		t := rec.Time
+		s.SyncedAt = &t
+	}
+	switch {
+	case rec.Status == "pull request" && rec.MergeSHA == "":
+		s.PendingPR = rec.PR
+	case rec.Status != "failed":
+		s.PendingPR = 0
+	}
+}
+
+// drift says how long the branch has been out of sync as of now: since the
+// last run that synced it, if a later one failed or is waiting on a pull
+// request.
+func (s *branchStatus) drift(now time.Time) string {
+	switch {
+	case s.SyncedAt == nil:
+		return "never synced"
+	case s.SyncedAt.Before(s.Last.Time) || s.PendingPR != 0:
+		return formatAge(now.Sub(*s.SyncedAt))
+	}
+	return "-"
+}
+
+// runStatusCommand shows the last result of each repository branch in the
+// run history, the pull requests still waiting and how long each branch
+// has gone without a successful sync.
+func runStatusCommand(args []string) error {
+	fs := flag.NewFlagSet("status", flag.ExitOnError)
+	file := fs.String("file", defaultRunsFile, "run history the syncs recorded to")
+	filter := fs.String("repo", "", "show only repositories matching this owner/repo pattern, e.g. acme/*")
+	format := fs.String("format", "text", "output format: text or json")
+	live := fs.Bool("live", false, "check on GitHub whether the pending pull requests are still open")
+	tokenFlags(fs)
+	httpClientFlags(fs)
+	fs.Parse(args)
+
+	state, err := loadRunState(*file)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("no run history at %s; syncs record it with -runs-file", *file)
+	}
+	if err != nil {
+		return err
+	}
+	statuses := state.Branches
+	keys := make([]string, 0, len(statuses))
+	for key, s := range statuses {
+		if *filter != "" {
+			if ok, _ := path.Match(*filter, s.Last.Repo); !ok {
+				continue
+			}
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	if *live {
+		client, err := newGitHubClient()
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			s := statuses[key]
+			if s.PendingPR == 0 {
+				continue
+			}
+			owner, repo, _ := strings.Cut(s.Last.Repo, "/")
+			pr, _, err := client.PullRequests.Get(context.Background(), owner, repo, s.PendingPR)
+			if err != nil {
+				return fmt.Errorf("%s#%d: Get pull request: %w", s.Last.Repo, s.PendingPR, err)
+			}
+			if pr.GetState() != "open" {
+				if pr.MergedAt != nil {
+					s.SyncedAt = &pr.MergedAt.Time
+				}
+				s.PendingPR = 0
+			}
+		}
+	}
+
+	if *format == "json" {
+		shown := make(map[string]*branchStatus, len(keys))
+		for _, key := range keys {
+			shown[key] = statuses[key]
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(shown)
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "REPOSITORY\tBRANCH\tLAST RUN\tRESULT\tPENDING PR\tOUT OF SYNC FOR")
+	var pending []string
+	for _, key := range keys {
+		s := statuses[key]
+		pr := "-"
+		if s.PendingPR != 0 {
+			pr = fmt.Sprintf("#%d", s.PendingPR)
+			pending = append(pending, fmt.Sprintf("%s#%d", s.Last.Repo, s.PendingPR))
+		}
+		result := s.Last.Status
+		if s.Last.Error != "" {
+			result += ": " + firstLine(s.Last.Error)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s ago\t%s\t%s\t%s\n", s.Last.Repo, s.Last.Branch, formatAge(now.Sub(s.Last.Time)), result, pr, s.drift(now))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		fmt.Printf("\n%d pull requests pending: %s\n", len(pending), strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// formatAge renders d in its largest whole unit, e.g. 3d, 5h or 12m.
+func formatAge(d time.Duration) string {
+	switch {
+	case d >= 48*time.Hour:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
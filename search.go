@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Search Targeting ---
+
+// The kinds of -repos-search query, after the search API they go to.
+const (
+	searchCode         = "code"
+	searchIssues       = "issues"
+	searchRepositories = "repositories"
+)
+
+// searchTargets returns the repositories with a match for query, in the
+// order the search ranks their first match. Search returns at most 1000
+// results, so a query matching more is reported rather than cut short
+// silently.
+func searchTargets(client *github.Client, kind, query string) ([]repoTarget, error) {
+	ctx := context.Background()
+	seen := make(map[repoTarget]bool)
+	var targets []repoTarget
+	add := func(owner, repo string) {
+		t := repoTarget{Owner: owner, Repo: repo}
+		if owner != "" && repo != "" && !seen[t] {
+			seen[t] = true
+			targets = append(targets, t)
+		}
+	}
+
+	opts := &github.SearchOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	total, fetched := 0, 0
+	for {
+		var resp *github.Response
+		var err error
+		switch kind {
+		case searchCode:
+			var result *github.CodeSearchResult
+			if result, resp, err = client.Search.Code(ctx, query, opts); err == nil {
+				total, fetched = result.GetTotal(), fetched+len(result.CodeResults)
+				for _, r := range result.CodeResults {
+					add(r.GetRepository().GetOwner().GetLogin(), r.GetRepository().GetName())
+				}
+			}
+		case searchIssues:
+			var result *github.IssuesSearchResult
+			if result, resp, err = client.Search.Issues(ctx, query, opts); err == nil {
+				total, fetched = result.GetTotal(), fetched+len(result.Issues)
+				for _, issue := range result.Issues {
+					// Issues only link their repository, as
+					// .../repos/{owner}/{repo}.
+					parts := strings.Split(issue.GetRepositoryURL(), "/")
+					if len(parts) >= 2 {
+						add(parts[len(parts)-2], parts[len(parts)-1])
+					}
+				}
+			}
+		case searchRepositories:
+			var result *github.RepositoriesSearchResult
+			if result, resp, err = client.Search.Repositories(ctx, query, opts); err == nil {
+				total, fetched = result.GetTotal(), fetched+len(result.Repositories)
+				for _, r := range result.Repositories {
+					if !r.GetArchived() {
+						add(r.GetOwner().GetLogin(), r.GetName())
+					}
+				}
+			}
+		default:
+			return nil, fmt.Errorf("-repos-search-type must be %q, %q or %q", searchCode, searchIssues, searchRepositories)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Search %s: %w", kind, err)
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	if total > fetched {
+		log.Printf("⚠️ Search matched %d results but returns only the first %d; narrow the query to reach the rest", total, fetched)
+	}
+	log.Printf("Search found %d repositories", len(targets))
+	return targets, nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Search and Replace ---
+
+// searchReplaceMaxShown is how many matches of a file the preview shows.
+const searchReplaceMaxShown = 5
+
+// codeSearchFiles runs a code search and returns the matching paths of each
+// repository, which code search only has for default branches.
+func codeSearchFiles(client *github.Client, query string) (map[repoTarget][]string, error) {
+	ctx := context.Background()
+	files := make(map[repoTarget][]string)
+	opts := &github.SearchOptions{ListOptions: github.ListOptions{PerPage: 100}}
+	total, fetched := 0, 0
+	for {
+		result, resp, err := client.Search.Code(ctx, query, opts)
+		if err != nil {
+			return nil, fmt.Errorf("Search code: %w", err)
+		}
+		total, fetched = result.GetTotal(), fetched+len(result.CodeResults)
+		for _, r := range result.CodeResults {
+			t := repoTarget{Owner: r.GetRepository().GetOwner().GetLogin(), Repo: r.GetRepository().GetName()}
+			files[t] = append(files[t], r.GetPath())
+		}
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	if total > fetched {
+		log.Printf("⚠️ Search matched %d files but returns only the first %d; narrow the query to reach the rest", total, fetched)
+	}
+	return files, nil
+}
+
+// scopedQuery limits query to owner's repositories unless it names its own
+// scope, so a query meant for one organization never edits the whole site.
+func scopedQuery(query, owner string) string {
+	for _, field := range strings.Fields(query) {
+		for _, qualifier := range []string{"org:", "user:", "repo:"} {
+			if strings.HasPrefix(field, qualifier) {
+				return query
+			}
+		}
+	}
+	return query + " user:" + owner
+}
+
+// replaceMatch is one match in a file, with what replaces it.
+type replaceMatch struct {
+	Line     int
+	Old, New string
+}
+
+// replaceAll replaces every match of re in content, expanding $1-style
+// references in replacement, and returns the matches.
+func replaceAll(re *regexp.Regexp, content, replacement string) (string, []replaceMatch) {
+	var b strings.Builder
+	var matches []replaceMatch
+	last := 0
+	for _, m := range re.FindAllStringSubmatchIndex(content, -1) {
+		expanded := string(re.ExpandString(nil, replacement, content, m))
+		matches = append(matches, replaceMatch{
+			Line: strings.Count(content[:m[0]], "\n") + 1,
+			Old:  content[m[0]:m[1]],
+			New:  expanded,
+		})
+		b.WriteString(content[last:m[0]])
+		b.WriteString(expanded)
+		last = m[1]
+	}
+	b.WriteString(content[last:])
+	return b.String(), matches
+}
+
+// previewText quotes s for a one-line preview, shortening it if long.
+func previewText(s string) string {
+	if len(s) > 60 {
+		s = s[:57] + "..."
+	}
+	return strconv.Quote(s)
+}
+
+// runSearchReplaceCommand finds files with a code search, replaces the
+// matches of a regular expression in them and, with -apply, commits the
+// result to each repository, directly or through a pull request.
+func runSearchReplaceCommand(args []string) error {
+	fs := flag.NewFlagSet("search-replace", flag.ExitOnError)
+	owner := fs.String("owner", defaultOwner, "search only this account's repositories, unless the query has an org:, user: or repo: qualifier")
+	query := fs.String("query", "", "code search query selecting the files, e.g. \"filename:renovate.json extends\"")
+	pattern := fs.String("pattern", "", "regular expression to replace (RE2 syntax)")
+	replacement := fs.String("replace", "", "replacement, with $1 or ${name} for submatches")
+	branch := fs.String("branch", "", "branch to change (default each repository's default branch, the one code search covers)")
+	message := fs.String("m", "", "commit message (default describing the replacement)")
+	apply := fs.Bool("apply", false, "commit the replacements; without it the matches are only shown")
+	viaPR := fs.Bool("pr", false, "with -apply, commit to a new branch and open a pull request")
+	fs.StringVar(&auditLogPath, "audit-log", "", auditLogUsage)
+	tokenFlags(fs)
+	httpClientFlags(fs)
+	fs.Parse(args)
+
+	if *query == "" || *pattern == "" {
+		return errors.New("usage: search-replace -query QUERY -pattern REGEXP -replace TEXT [-apply [-pr]]")
+	}
+	re, err := regexp.Compile(*pattern)
+	if err != nil {
+		return fmt.Errorf("invalid -pattern: %w", err)
+	}
+	if *message == "" {
+		*message = fmt.Sprintf("Replace /%s/ with %s", *pattern, strconv.Quote(*replacement))
+	}
+
+	client, err := newGitHubClient()
+	if err != nil {
+		return err
+	}
+	found, err := codeSearchFiles(client, scopedQuery(*query, *owner))
+	if err != nil {
+		return err
+	}
+	targets := make([]repoTarget, 0, len(found))
+	for t := range found {
+		targets = append(targets, t)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].String() < targets[j].String() })
+
+	failed, changed := 0, 0
+	for _, t := range targets {
+		n, err := searchReplaceRepo(client, t, found[t], re, *replacement, *branch, *message, *apply, *viaPR)
+		if err != nil {
+			log.Printf("%s: %v", t, err)
+			failed++
+		}
+		if n > 0 {
+			changed++
+		}
+	}
+	verb := "would change"
+	if *apply {
+		verb = "changed"
+	}
+	fmt.Printf("%d repositories searched, %d %s, %d failed\n", len(targets), changed, verb, failed)
+	if !*apply && changed > 0 {
+		fmt.Println("Run again with -apply to commit the replacements.")
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d repositories failed", failed, len(targets))
+	}
+	return nil
+}
+
+// searchReplaceRepo shows the replacements in paths of one repository and,
+// with apply, commits them. It returns how many files change.
+func searchReplaceRepo(client *github.Client, t repoTarget, paths []string, re *regexp.Regexp, replacement, branch, message string, apply, viaPR bool) (int, error) {
+	f := newGitHubForge(client, t.Owner, t.Repo)
+	if branch == "" {
+		_, defaultBranch, err := f.Repository()
+		if err != nil {
+			return 0, err
+		}
+		branch = defaultBranch
+	}
+	head, err := f.BranchHead(branch)
+	if err != nil {
+		return 0, err
+	}
+	if head == "" {
+		return 0, fmt.Errorf("branch %s does not exist", branch)
+	}
+	tree, err := f.Tree(head)
+	if err != nil {
+		return 0, err
+	}
+
+	sort.Strings(paths)
+	var changes []fileChange
+	result := make(map[string]string)
+	for _, p := range paths {
+		entry, ok := tree.Entries[p]
+		if !ok || entry.Type != "blob" {
+			// The search index lags behind pushes, and may not know -branch.
+			continue
+		}
+		content, err := f.ReadFile(head, p)
+		if err != nil {
+			return 0, err
+		}
+		if isBinary(content) {
+			continue
+		}
+		replaced, matches := replaceAll(re, content, replacement)
+		if replaced == content {
+			continue
+		}
+		if len(changes) == 0 {
+			fmt.Printf("%s@%s:\n", t, branch)
+		}
+		for i, m := range matches {
+			if i == searchReplaceMaxShown {
+				fmt.Printf("    ... %d more\n", len(matches)-i)
+				break
+			}
+			fmt.Printf("  %s:%d: %s → %s\n", p, m.Line, previewText(m.Old), previewText(m.New))
+		}
+		changes = append(changes, fileChange{Path: p, Content: replaced, Mode: entry.Mode, Exists: true})
+		result[p] = "updated"
+	}
+	if len(changes) == 0 || !apply {
+		return len(changes), nil
+	}
+
+	target := prTarget{Owner: t.Owner, Repo: t.Repo, Branch: branch}
+	if viaPR {
+		if target, err = setupPullRequestBranch(client, t.Owner, t.Repo, branch, "gitapis/search-replace-"+runID, false); err != nil {
+			return 0, err
+		}
+		f = newGitHubForge(client, target.Owner, target.Repo)
+	}
+	commit, err := f.Commit(target.Branch, head, message, changes)
+	if err != nil {
+		return 0, err
+	}
+	fmt.Println("Commit created:", commit.URL)
+	if viaPR {
+		body := formatChangeSummary(target.Owner, target.Repo, result, commit.SHA, nil)
+		if _, err := openPullRequest(client, t.Owner, t.Repo, branch, target, message, body); err != nil {
+			return 0, err
+		}
+	}
+	return len(changes), nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// --- Secret Scanning ---
+
+type secretRule struct {
+	Name    string `json:"name"`
+	Pattern string `json:"pattern"`
+	re      *regexp.Regexp
+}
+
+var defaultSecretRules = []secretRule{
+	{Name: "aws-access-key-id", Pattern: `\b(AKIA|ASIA)[0-9A-Z]{16}\b`},
+	{Name: "aws-secret-access-key", Pattern: `(?i)aws_?secret_?access_?key["']?\s*[:=]\s*["']?[A-Za-z0-9/+=]{40}\b`},
+	{Name: "github-token", Pattern: `\bgh[pousr]_[A-Za-z0-9]{36,}\b`},
+	{Name: "github-fine-grained-pat", Pattern: `\bgithub_pat_[A-Za-z0-9_]{82}\b`},
+	{Name: "slack-token", Pattern: `\bxox[abposr]-[A-Za-z0-9-]{10,}`},
+	{Name: "private-key", Pattern: `-----BEGIN ((RSA|DSA|EC|OPENSSH|PGP|ENCRYPTED) )?PRIVATE KEY( BLOCK)?-----`},
+}
+
+// loadSecretRules returns the built-in rules, or the rules from a JSON file of
+// {"name", "pattern"} objects when path is set.
+func loadSecretRules(path string) ([]secretRule, error) {
+	rules := defaultSecretRules
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secret rules: %w", err)
+		}
+		rules = nil
+		if err := json.Unmarshal(b, &rules); err != nil {
+			return nil, fmt.Errorf("failed to parse secret rules: %w", err)
+		}
+	}
+
+	compiled := make([]secretRule, len(rules))
+	for i, rule := range rules {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("secret rule %q: %w", rule.Name, err)
+		}
+		compiled[i] = secretRule{Name: rule.Name, Pattern: rule.Pattern, re: re}
+	}
+	return compiled, nil
+}
+
+// scanSecrets returns, for every file with a match, the names of the rules it
+// matched.
+func scanSecrets(files map[string]string, rules []secretRule) map[string][]string {
+	findings := make(map[string][]string)
+	for path, content := range files {
+		for _, rule := range rules {
+			if rule.re.MatchString(content) {
+				findings[path] = append(findings[path], rule.Name)
+			}
+		}
+	}
+	return findings
+}
+
+// secretScanHook blocks the commit when any outgoing file matches a rule,
+// marking the offending files as "blocked". With allow set, matches are only
+// logged.
+func secretScanHook(rules []secretRule, allow bool) hookFunc {
+	return func(hc *hookContext) error {
+		findings := scanSecrets(hc.Files, rules)
+		if len(findings) == 0 {
+			return nil
+		}
+
+		paths := make([]string, 0, len(findings))
+		for path := range findings {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		var report []string
+		for _, path := range paths {
+			report = append(report, fmt.Sprintf("%s (%s)", path, strings.Join(findings[path], ", ")))
+		}
+		if allow {
+			log.Printf("⚠️ Possible secrets committed anyway: %s", strings.Join(report, "; "))
+			return nil
+		}
+
+		for _, path := range paths {
+			hc.Result[path] = "blocked"
+		}
+		return fmt.Errorf("possible secrets found, refusing to commit: %s", strings.Join(report, "; "))
+	}
+}
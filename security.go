@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Security Settings ---
+
+// The settings -security turns on, each through its own endpoint.
+const (
+	securityAlerts         = "vulnerability-alerts"
+	securityUpdates        = "dependabot-security-updates"
+	securitySecretScanning = "secret-scanning"
+	securityPushProtection = "push-protection"
+	securityAll            = "all"
+)
+
+// securitySettings are the security features to enable on every synced
+// repository. They are only ever turned on: a repository that has more
+// enabled keeps it.
+type securitySettings struct {
+	VulnerabilityAlerts bool
+	SecurityUpdates     bool
+	SecretScanning      bool
+	PushProtection      bool
+}
+
+// parseSecuritySettings reads the -security value, a comma-separated list of
+// settings or all. Settings need what they build on, so security updates
+// bring vulnerability alerts and push protection brings secret scanning.
+func parseSecuritySettings(value string) (*securitySettings, error) {
+	s := &securitySettings{}
+	for _, item := range splitList(value) {
+		switch item {
+		case securityAlerts:
+			s.VulnerabilityAlerts = true
+		case securityUpdates:
+			s.VulnerabilityAlerts, s.SecurityUpdates = true, true
+		case securitySecretScanning:
+			s.SecretScanning = true
+		case securityPushProtection:
+			s.SecretScanning, s.PushProtection = true, true
+		case securityAll:
+			*s = securitySettings{true, true, true, true}
+		default:
+			return nil, fmt.Errorf("invalid -security setting %q: want %s, %s, %s, %s or %s",
+				item, securityAlerts, securityUpdates, securitySecretScanning, securityPushProtection, securityAll)
+		}
+	}
+	return s, nil
+}
+
+// apply enables the settings on owner/repo. Enabling one that is on already
+// changes nothing, so it is safe on every run.
+func (s *securitySettings) apply(client *github.Client, owner, repo string) error {
+	if s == nil {
+		return nil
+	}
+	ctx := context.Background()
+	var enabled []string
+	if s.VulnerabilityAlerts {
+		if _, err := client.Repositories.EnableVulnerabilityAlerts(ctx, owner, repo); err != nil {
+			return fmt.Errorf("EnableVulnerabilityAlerts: %w", err)
+		}
+		enabled = append(enabled, securityAlerts)
+	}
+	// Security updates are opened from alerts, so they come after them.
+	if s.SecurityUpdates {
+		if _, err := client.Repositories.EnableAutomatedSecurityFixes(ctx, owner, repo); err != nil {
+			return fmt.Errorf("EnableAutomatedSecurityFixes: %w", err)
+		}
+		enabled = append(enabled, securityUpdates)
+	}
+	if s.SecretScanning {
+		analysis := &github.SecurityAndAnalysis{SecretScanning: &github.SecretScanning{Status: github.String("enabled")}}
+		if s.PushProtection {
+			analysis.SecretScanningPushProtection = &github.SecretScanningPushProtection{Status: github.String("enabled")}
+		}
+		if _, _, err := client.Repositories.Edit(ctx, owner, repo, &github.Repository{SecurityAndAnalysis: analysis}); err != nil {
+			// Private repositories only have secret scanning with GitHub
+			// Advanced Security, which the error rarely says.
+			return fmt.Errorf("EditRepository security_and_analysis (private repositories need GitHub Advanced Security): %w", err)
+		}
+		enabled = append(enabled, securitySecretScanning)
+		if s.PushProtection {
+			enabled = append(enabled, securityPushProtection)
+		}
+	}
+	if len(enabled) > 0 {
+		log.Printf("Enabled %s on %s/%s", strings.Join(enabled, ", "), owner, repo)
+	}
+	return nil
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Commit Service ---
+
+// serveMaxRequestBytes caps the body of a commit request.
+const serveMaxRequestBytes = 32 << 20
+
+// serviceTokenEnv holds the token callers of serve authenticate with, when
+// no -auth-tokens file is given.
+const serviceTokenEnv = "GITAPIS_SERVICE_TOKEN"
+
+// commitRequest asks for files to be written to a branch in one commit,
+// directly or through a pull request.
+type commitRequest struct {
+	Owner   string            `json:"owner"`
+	Repo    string            `json:"repo"`
+	Branch  string            `json:"branch"`
+	Message string            `json:"message"`
+	Files   map[string]string `json:"files"`
+	// IdempotencyKey makes retries safe: a request whose key is already in
+	// a commit's trailer on the branch is answered with that commit.
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+	PR             bool   `json:"pr,omitempty"`
+	PRTitle        string `json:"pr_title,omitempty"`
+}
+
+// commitResponse is what a commit request did.
+type commitResponse struct {
+	Commit string            `json:"commit,omitempty"`
+	URL    string            `json:"url,omitempty"`
+	PR     string            `json:"pr,omitempty"`
+	Result map[string]string `json:"result,omitempty"`
+	// Applied is set when an earlier request with the same idempotency key
+	// made Commit.
+	Applied bool `json:"applied,omitempty"`
+}
+
+// requestError is a commit request that is wrong in itself, and that no
+// retry will fix.
+type requestError struct{ msg string }
+
+func (e *requestError) Error() string { return e.msg }
+
+// commitService writes commit requests to the repositories it allows.
+type commitService struct {
+	client *github.Client
+	// allow are owner/repo patterns; empty allows every repository the
+	// token can write to.
+	allow []string
+	// maxFiles caps the files of a request, like -max-files of a sync.
+	maxFiles int
+
+	mu       sync.Mutex
+	branches map[string]*sync.Mutex
+}
+
+func newCommitService(client *github.Client, allow []string, maxFiles int) *commitService {
+	return &commitService{client: client, allow: allow, maxFiles: maxFiles, branches: make(map[string]*sync.Mutex)}
+}
+
+// branchLock serializes the requests for one branch, which would otherwise
+// race each other's base commits.
+func (s *commitService) branchLock(key string) *sync.Mutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.branches[key]
+	if !ok {
+		l = &sync.Mutex{}
+		s.branches[key] = l
+	}
+	return l
+}
+
+func (s *commitService) validate(req *commitRequest) error {
+	switch {
+	case req.Owner == "" || req.Repo == "" || req.Branch == "":
+		return &requestError{"owner, repo and branch are required"}
+	case strings.TrimSpace(req.Message) == "":
+		return &requestError{"message is required"}
+	case len(req.Files) == 0:
+		return &requestError{"files is empty"}
+	}
+	// The same limits as for a sync, without the target's .gitattributes,
+	// so LFS files are held to them too.
+	if err := validateChangeSet(req.Files, s.maxFiles, nil); err != nil {
+		return &requestError{err.Error()}
+	}
+	if len(s.allow) == 0 {
+		return nil
+	}
+	for _, pattern := range s.allow {
+		if ok, _ := path.Match(pattern, req.Owner+"/"+req.Repo); ok {
+			return nil
+		}
+	}
+	return &requestError{fmt.Sprintf("%s/%s is not a repository this service writes to", req.Owner, req.Repo)}
+}
+
+// commit carries out req. Requests with the same idempotency key get the
+// commit the first one made, however often they are retried.
+func (s *commitService) commit(req *commitRequest) (*commitResponse, error) {
+	if err := s.validate(req); err != nil {
+		return nil, err
+	}
+	lock := s.branchLock(req.Owner + "/" + req.Repo + "@" + req.Branch)
+	lock.Lock()
+	defer lock.Unlock()
+
+	head := ""
+	if req.PR {
+		// Every request gets a head branch of its own, as setting one up
+		// resets it: one per base and key, so a retry finds the first
+		// attempt's, and a random one without a key.
+		b := make([]byte, 6)
+		if req.IdempotencyKey != "" {
+			sum := sha256.Sum256([]byte(req.Branch + "\x00" + req.IdempotencyKey))
+			copy(b, sum[:])
+		} else if _, err := rand.Read(b); err != nil {
+			return nil, fmt.Errorf("failed to name the pull request branch: %w", err)
+		}
+		head = "gitapis/service-" + hex.EncodeToString(b)
+	}
+
+	var trailers []string
+	if req.IdempotencyKey != "" {
+		for _, branch := range []string{req.Branch, head} {
+			if branch == "" {
+				continue
+			}
+			applied, err := findAppliedCommit(s.client, req.Owner, req.Repo, branch, req.IdempotencyKey)
+			if err != nil {
+				return nil, fmt.Errorf("failed to look for idempotency key: %w", err)
+			}
+			if applied == nil {
+				continue
+			}
+			resp := &commitResponse{Commit: applied.SHA, URL: applied.URL, Applied: true}
+			if branch == head {
+				// The attempt that committed may have failed to open the
+				// pull request.
+				target := prTarget{Owner: req.Owner, Repo: req.Repo, Branch: head}
+				body := fmt.Sprintf("Commits %s, which an earlier attempt of request %s made.", applied.SHA, req.IdempotencyKey)
+				if resp.PR, err = s.pullRequest(req, target, body); err != nil {
+					return nil, err
+				}
+			}
+			return resp, nil
+		}
+		trailers = append(trailers, idempotencyTrailer+": "+req.IdempotencyKey)
+	}
+	message, err := buildCommitMessage(req.Message, false, trailers)
+	if err != nil {
+		return nil, &requestError{err.Error()}
+	}
+
+	target := prTarget{Owner: req.Owner, Repo: req.Repo, Branch: req.Branch}
+	if req.PR {
+		if target, err = setupPullRequestBranch(s.client, req.Owner, req.Repo, req.Branch, head, false); err != nil {
+			return nil, err
+		}
+	}
+	result, commit, err := upsertMultipleFilesSafe(s.client, target.Owner, target.Repo, target.Branch, req.Files, message, upsertOptions{})
+	if err != nil {
+		return nil, err
+	}
+	resp := &commitResponse{Commit: commit.GetSHA(), URL: commit.GetHTMLURL(), Result: result}
+	if req.PR && commit != nil {
+		body := formatChangeSummary(target.Owner, target.Repo, result, commit.GetSHA(), nil)
+		if resp.PR, err = s.pullRequest(req, target, body); err != nil {
+			return nil, err
+		}
+	}
+	return resp, nil
+}
+
+// pullRequest returns the URL of the open pull request from target into the
+// requested branch, opening one with body if there is none. An open one is
+// left as it is, so a retry keeps the summary of the attempt that opened it.
+func (s *commitService) pullRequest(req *commitRequest, target prTarget, body string) (string, error) {
+	open, _, err := s.client.PullRequests.List(context.Background(), req.Owner, req.Repo, &github.PullRequestListOptions{
+		State: "open", Head: target.Owner + ":" + target.Branch, Base: req.Branch,
+	})
+	if err != nil {
+		return "", fmt.Errorf("List pull requests: %w", err)
+	}
+	if len(open) > 0 {
+		return open[0].GetHTMLURL(), nil
+	}
+	title := req.PRTitle
+	if title == "" {
+		title, _, _ = strings.Cut(req.Message, "\n")
+	}
+	pr, err := openPullRequest(s.client, req.Owner, req.Repo, req.Branch, target, title, body)
+	if err != nil {
+		return "", err
+	}
+	return pr.GetHTMLURL(), nil
+}
+
+// loadServiceTokens reads the tokens callers authenticate with, one per
+// line, or takes the one in serviceTokenEnv.
+func loadServiceTokens(p string) ([]string, error) {
+	if p == "" {
+		if token := os.Getenv(serviceTokenEnv); token != "" {
+			return []string{token}, nil
+		}
+		return nil, fmt.Errorf("serve needs -auth-tokens or %s, so that only known callers can commit", serviceTokenEnv)
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read auth tokens: %w", err)
+	}
+	defer f.Close()
+	var tokens []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" && !strings.HasPrefix(line, "#") {
+			tokens = append(tokens, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read auth tokens: %w", err)
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("auth tokens file %s is empty", p)
+	}
+	return tokens, nil
+}
+
+// requireToken lets through requests with one of tokens as their bearer
+// token. Every token is compared, in constant time, so timing tells nothing
+// about which came close.
+func requireToken(tokens []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		match := 0
+		for _, token := range tokens {
+			match |= subtle.ConstantTimeCompare([]byte(given), []byte(token))
+		}
+		if !ok || match == 0 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gitapis"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func respondJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// handleCommit serves POST /v1/commits.
+func (s *commitService) handleCommit(w http.ResponseWriter, r *http.Request) {
+	var req commitRequest
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, serveMaxRequestBytes))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		respondJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request: " + err.Error()})
+		return
+	}
+	if req.IdempotencyKey == "" {
+		req.IdempotencyKey = r.Header.Get("Idempotency-Key")
+	}
+	resp, err := s.commit(&req)
+	var bad *requestError
+	switch {
+	case errors.As(err, &bad):
+		respondJSON(w, http.StatusUnprocessableEntity, map[string]string{"error": err.Error()})
+	case err != nil:
+		log.Printf("%s/%s@%s: %v", req.Owner, req.Repo, req.Branch, err)
+		respondJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+	case resp.Applied:
+		respondJSON(w, http.StatusOK, resp)
+	default:
+		log.Printf("%s/%s@%s: committed %s", req.Owner, req.Repo, req.Branch, shortSHA(resp.Commit))
+		respondJSON(w, http.StatusCreated, resp)
+	}
+}
+
+// runServeCommand serves commit requests over HTTP, so other services can
+// have files written to a repository without linking this package or
+// running the CLI:
+//
+//	POST /v1/commits
+//	Authorization: Bearer <token>
+//	{"owner": "acme", "repo": "api", "branch": "main", "message": "Update schema",
+//	 "files": {"schema.json": "..."}, "idempotency_key": "build-4711"}
+//
+// For producers that would rather fire a request and move on than wait for
+// the commit, it also takes the same requests from a directory queue with
+// -spool (see commitSpool), or from a NATS JetStream stream with -nats (see
+// jetStreamConsumer).
+func runServeCommand(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:8081", "address to listen on, empty to only consume -spool")
+	spoolDir := fs.String("spool", "", "also commit the requests producers drop into this directory, one JSON file each")
+	spoolPoll := fs.Duration("spool-poll", 5*time.Second, "how often to look for new requests in -spool")
+	natsURL := fs.String("nats", "", "also commit the requests published to -nats-stream on these NATS servers, e.g. nats://localhost:4222")
+	natsCreds := fs.String("nats-creds", "", "NATS credentials file for -nats")
+	natsStream := fs.String("nats-stream", "", "JetStream stream of the commit requests, one JSON message each")
+	natsConsumer := fs.String("nats-consumer", "gitapis", "durable consumer of -nats-stream, shared by the instances of serve")
+	natsSubject := fs.String("nats-subject", "", "only take the messages of -nats-stream on this subject")
+	maxFiles := fs.Int("max-files", 1000, "maximum number of files per request (0 for no limit)")
+	tokensPath := fs.String("auth-tokens", "", "file of the bearer tokens callers may use, one per line (default the "+serviceTokenEnv+" variable)")
+	var allow stringList
+	fs.Var(&allow, "allow", "owner/repo pattern, e.g. acme/*, of the repositories requests may write to; repeatable (default any the GitHub token can write to)")
+	fs.StringVar(&auditLogPath, "audit-log", "", auditLogUsage)
+	tokenFlags(fs)
+	httpClientFlags(fs)
+	fs.Parse(args)
+
+	if *addr == "" && *spoolDir == "" && *natsURL == "" {
+		return fmt.Errorf("serve needs -addr, -spool, -nats or several of them")
+	}
+	if (*natsURL == "") != (*natsStream == "") {
+		return fmt.Errorf("-nats and -nats-stream go together")
+	}
+	var tokens []string
+	if *addr != "" {
+		var err error
+		if tokens, err = loadServiceTokens(*tokensPath); err != nil {
+			return err
+		}
+	}
+	client, err := newGitHubClient()
+	if err != nil {
+		return err
+	}
+	if len(allow) == 0 {
+		log.Printf("⚠️ No -allow given; requests may write to any repository the GitHub token can")
+	}
+	s := newCommitService(client, allow, *maxFiles)
+
+	// The consumers run until the process ends; without -addr, serve waits
+	// on the first that fails.
+	failed := make(chan error, 2)
+	if *spoolDir != "" {
+		spool, err := newCommitSpool(*spoolDir, s)
+		if err != nil {
+			return err
+		}
+		log.Printf("Consuming commit requests from %s", *spoolDir)
+		go spool.consume(*spoolPoll)
+	}
+	if *natsURL != "" {
+		consumer, err := newJetStreamConsumer(*natsURL, *natsCreds, *natsStream, *natsConsumer, *natsSubject, s)
+		if err != nil {
+			return err
+		}
+		log.Printf("Consuming commit requests from stream %s on %s", *natsStream, *natsURL)
+		go func() { failed <- consumer.consume() }()
+	}
+	if *addr == "" {
+		return <-failed
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("POST /v1/commits", requireToken(tokens, http.HandlerFunc(s.handleCommit)))
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	log.Printf("Serving commit requests on http://%s/v1/commits", *addr)
+	server := &http.Server{Addr: *addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	return server.ListenAndServe()
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Offline Snapshots ---
+
+const snapshotVersion = 1
+
+// repoSnapshot is everything a plan needs from one branch, exported on a
+// connected machine so the plan can be made where there is no network.
+type repoSnapshot struct {
+	Version int    `json:"version"`
+	Owner   string `json:"owner"`
+	Repo    string `json:"repo"`
+	Branch  string `json:"branch"`
+	Head    string `json:"head"`
+	Tree    string `json:"tree"`
+	// Entries lists every file of the tree by path.
+	Entries map[string]treeFile `json:"entries"`
+	// Attributes holds the content of every .gitattributes file by path.
+	Attributes map[string]string `json:"attributes,omitempty"`
+	Time       time.Time         `json:"time"`
+}
+
+func readSnapshot(path string) (*repoSnapshot, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var snap repoSnapshot
+	if err := json.Unmarshal(b, &snap); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot %s: %w", path, err)
+	}
+	if snap.Version != snapshotVersion {
+		return nil, fmt.Errorf("snapshot %s has version %d, expected %d", path, snap.Version, snapshotVersion)
+	}
+	return &snap, nil
+}
+
+func runSnapshotCommand(args []string) error {
+	fs := flag.NewFlagSet("snapshot", flag.ExitOnError)
+	owner, repo := repoFlags(fs)
+	branch := fs.String("branch", defaultBranch, "branch to snapshot")
+	out := fs.String("o", "", "file to write the snapshot to (default <repo>-<branch>.snapshot.json)")
+	cacheFlags(fs)
+	fs.Parse(args)
+
+	client, err := newGitHubClient()
+	if err != nil {
+		return err
+	}
+	snap, err := takeSnapshot(client, *owner, *repo, *branch)
+	if err != nil {
+		return err
+	}
+	if *out == "" {
+		*out = *repo + "-" + path.Base(*branch) + ".snapshot.json"
+	}
+	b, err := json.MarshalIndent(snap, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(*out, append(b, '\n'), 0o644); err != nil {
+		return err
+	}
+	fmt.Printf("Snapshot of %s/%s@%s at %s written to %s (%d files)\n", *owner, *repo, *branch, shortSHA(snap.Head), *out, len(snap.Entries))
+	return nil
+}
+
+func takeSnapshot(client *github.Client, owner, repo, branch string) (*repoSnapshot, error) {
+	head, err := branchHead(client, owner, repo, branch)
+	if err != nil {
+		return nil, err
+	}
+	if head == "" {
+		return nil, fmt.Errorf("branch %s does not exist", branch)
+	}
+	tree, err := newGitHubForge(client, owner, repo).Tree(head)
+	if err != nil {
+		return nil, err
+	}
+	attributes := make(map[string]string)
+	if err := readRemoteGitAttributes(client, owner, repo, head, attributes); err != nil {
+		return nil, err
+	}
+	return &repoSnapshot{
+		Version:    snapshotVersion,
+		Owner:      owner,
+		Repo:       repo,
+		Branch:     branch,
+		Head:       head,
+		Tree:       tree.SHA,
+		Entries:    tree.Entries,
+		Attributes: attributes,
+		Time:       time.Now().UTC(),
+	}, nil
+}
+
+// snapshotForge implements forge over a snapshot. It can only plan: the
+// snapshot's branch is the one existing branch, and Commit fills in plan.
+type snapshotForge struct {
+	snap *repoSnapshot
+	plan *syncPlan
+}
+
+func (f *snapshotForge) Target() (string, string) { return f.snap.Owner, f.snap.Repo }
+
+func (f *snapshotForge) Repository() (bool, string, error) { return false, f.snap.Branch, nil }
+
+func (f *snapshotForge) BranchHead(branch string) (string, error) {
+	if branch == f.snap.Branch {
+		return f.snap.Head, nil
+	}
+	return "", nil
+}
+
+func (f *snapshotForge) ResolveRef(name string) (string, error) {
+	if name != f.snap.Branch && name != f.snap.Head {
+		return "", fmt.Errorf("the snapshot only has %s", f.snap.Branch)
+	}
+	return f.snap.Head, nil
+}
+
+func (f *snapshotForge) CreateBranch(branch, sha string) error {
+	return fmt.Errorf("cannot create %s from a snapshot", branch)
+}
+
+func (f *snapshotForge) Tree(sha string) (*forgeTree, error) {
+	if sha != f.snap.Head {
+		return nil, fmt.Errorf("the snapshot has no commit %s", shortSHA(sha))
+	}
+	return &forgeTree{SHA: f.snap.Tree, Entries: f.snap.Entries}, nil
+}
+
+func (f *snapshotForge) Commit(branch, parent, message string, changes []fileChange) (*forgeCommit, error) {
+	known := make(map[string]bool, len(f.snap.Entries))
+	for _, entry := range f.snap.Entries {
+		known[entry.SHA] = true
+	}
+
+	blobs := make(map[string]string)
+	entries := make([]*github.TreeEntry, 0, len(changes))
+	for _, change := range changes {
+		entry := &github.TreeEntry{Path: github.String(change.Path), Mode: github.String(change.Mode), Type: github.String("blob")}
+		if !change.Delete {
+			sha := gitBlobSHA(change.Content)
+			// Blobs already in the repository need not be uploaded again.
+			if !known[sha] {
+				blobs[sha] = change.Content
+			}
+			entry.SHA = github.String(sha)
+		}
+		entries = append(entries, entry)
+	}
+	f.plan.fill(f.snap.Owner, f.snap.Repo, branch, parent, f.snap.Tree, message, entries, blobs)
+	return nil, nil
+}
+
+// gitAttributes returns the snapshot's attributes, with the versions being
+// synced in files taking their place.
+func (s *repoSnapshot) gitAttributes(files map[string]string) (*gitAttributes, error) {
+	merged := make(map[string]string, len(s.Attributes))
+	for p, content := range s.Attributes {
+		merged[p] = content
+	}
+	for p, content := range files {
+		if path.Base(p) == ".gitattributes" {
+			merged[p] = content
+		}
+	}
+	return loadGitAttributes(nil, s.Owner, s.Repo, s.Branch, merged)
+}
+
+// planOffline writes the plan for syncing source to branch against
+// cfg.Snapshot, without any network access.
+func planOffline(cfg *syncConfig, branch string, source map[string]string, path string) error {
+	snap := cfg.Snapshot
+	p, err := prepareBranch(nil, cfg, snap.Owner, snap.Repo, branch, source)
+	if err != nil {
+		return err
+	}
+	for file := range p.Files {
+		if p.Attrs.isLFS(file) {
+			return fmt.Errorf("%s is tracked by Git LFS, whose objects cannot be stored offline", file)
+		}
+	}
+	plan := &syncPlan{}
+	return writeBranchPlan(&snapshotForge{snap: snap, plan: plan}, cfg, branch, p.Files, plan, path)
+}
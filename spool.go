@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Commit Request Spool ---
+
+const (
+	// spoolClaimed and spoolFailed are the subdirectories of the spool for
+	// the requests being committed and those that cannot be.
+	spoolClaimed = "claimed"
+	spoolFailed  = "failed"
+	// spoolLease is how long a claimed request may go unfinished before it
+	// is put back, as its consumer presumably died.
+	spoolLease = 10 * time.Minute
+	// spoolAttempts is how often a request is tried before it is failed.
+	spoolAttempts = 5
+)
+
+// spoolAttemptName is the name of a request that was claimed before: the
+// producer's name with the number of claims so far. Counting in the name,
+// rather than in memory, lets a consumer that keeps crashing on a request
+// still give up on it.
+var spoolAttemptName = regexp.MustCompile(`^(.+)\.attempt(\d+)\.json$`)
+
+// spoolAttempt returns the name the producer gave a request and how often
+// it has been claimed.
+func spoolAttempt(name string) (string, int) {
+	if m := spoolAttemptName.FindStringSubmatch(name); m != nil {
+		n, _ := strconv.Atoi(m[2])
+		return m[1] + ".json", n
+	}
+	return name, 0
+}
+
+func spoolName(base string, attempt int) string {
+	return fmt.Sprintf("%s.attempt%d.json", strings.TrimSuffix(base, ".json"), attempt)
+}
+
+// commitSpool is a directory queue of commit requests. Producers write one
+// commitRequest per *.json file into the directory, atomically, by writing
+// it under a dot name and renaming it. A consumer claims a request by
+// renaming it into claimed/ and removes it once committed, so a request is
+// delivered at least once, even to several consumers sharing the directory.
+// Redelivery is safe, as every request is committed with an idempotency key;
+// see commitQueued.
+type commitSpool struct {
+	dir     string
+	service *commitService
+}
+
+func newCommitSpool(dir string, service *commitService) (*commitSpool, error) {
+	for _, sub := range []string{spoolClaimed, spoolFailed} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create the spool: %w", err)
+		}
+	}
+	return &commitSpool{dir: dir, service: service}, nil
+}
+
+// consume drains the spool every poll, forever.
+func (q *commitSpool) consume(poll time.Duration) {
+	for {
+		q.requeueExpired()
+		if err := q.drain(); err != nil {
+			log.Printf("⚠️ Spool %s: %v", q.dir, err)
+		}
+		time.Sleep(poll)
+	}
+}
+
+// drain commits the requests waiting in the spool, oldest first.
+func (q *commitSpool) drain() error {
+	names, err := q.pending()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		// Claiming counts as an attempt, so one that never finishes counts.
+		base, attempt := spoolAttempt(name)
+		claimed := filepath.Join(q.dir, spoolClaimed, spoolName(base, attempt+1))
+		if err := os.Rename(filepath.Join(q.dir, name), claimed); err != nil {
+			// Another consumer claimed it first.
+			continue
+		}
+		now := time.Now()
+		os.Chtimes(claimed, now, now)
+		if attempt >= spoolAttempts {
+			q.fail(base, claimed, fmt.Errorf("gave up after %d attempts", attempt))
+			continue
+		}
+		q.process(base, attempt+1, claimed)
+	}
+	return nil
+}
+
+// pending lists the requests in the spool by age.
+func (q *commitSpool) pending() ([]string, error) {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, err
+	}
+	type request struct {
+		name string
+		mod  time.Time
+	}
+	var requests []request
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		requests = append(requests, request{e.Name(), info.ModTime()})
+	}
+	sort.Slice(requests, func(i, j int) bool { return requests[i].mod.Before(requests[j].mod) })
+	names := make([]string, len(requests))
+	for i, r := range requests {
+		names[i] = r.name
+	}
+	return names, nil
+}
+
+// process makes the given attempt at the claimed request base. A request
+// that fails for a reason no retry fixes, or too often, is moved to failed/;
+// others go back to the spool for the next drain.
+func (q *commitSpool) process(base string, attempt int, claimed string) {
+	err := q.commit(base, claimed)
+	var bad *requestError
+	switch {
+	case err == nil:
+		if err := os.Remove(claimed); err != nil {
+			log.Printf("⚠️ Spool %s: committed %s but failed to remove it: %v", q.dir, base, err)
+		}
+	case errors.As(err, &bad) || attempt >= spoolAttempts:
+		q.fail(base, claimed, err)
+	default:
+		log.Printf("⚠️ Spool %s: %s failed, will retry (attempt %d of %d): %v", q.dir, base, attempt, spoolAttempts, err)
+		if err := os.Rename(claimed, filepath.Join(q.dir, filepath.Base(claimed))); err != nil {
+			log.Printf("⚠️ Spool %s: failed to put back %s: %v", q.dir, base, err)
+		}
+	}
+}
+
+// fail moves the claimed request base to failed/, next to a file with err.
+func (q *commitSpool) fail(base, claimed string, err error) {
+	log.Printf("❌ Spool %s: %s failed: %v", q.dir, base, err)
+	failed := filepath.Join(q.dir, spoolFailed, base)
+	if err := os.Rename(claimed, failed); err != nil {
+		log.Printf("⚠️ Spool %s: failed to move %s to %s: %v", q.dir, base, spoolFailed, err)
+		return
+	}
+	writeFileAtomic(strings.TrimSuffix(failed, ".json")+".error", []byte(err.Error()+"\n"))
+}
+
+func (q *commitSpool) commit(base, claimed string) error {
+	data, err := os.ReadFile(claimed)
+	if err != nil {
+		return err
+	}
+	return commitQueued(q.service, base, data)
+}
+
+// commitQueued commits the JSON commit request data, which name came in as,
+// for a queue consumer. A request without an idempotency key gets one from
+// its content, so one delivered again, or sent twice, is committed once.
+func commitQueued(service *commitService, name string, data []byte) error {
+	var req commitRequest
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		return &requestError{"invalid request: " + err.Error()}
+	}
+	if req.IdempotencyKey == "" {
+		// Encoding sorts the files, so the same request hashes the same.
+		b, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(b)
+		req.IdempotencyKey = "request:" + hex.EncodeToString(sum[:16])
+	}
+	resp, err := service.commit(&req)
+	if err != nil {
+		return err
+	}
+	if resp.Applied {
+		log.Printf("%s: %s/%s@%s already has it in %s", name, req.Owner, req.Repo, req.Branch, shortSHA(resp.Commit))
+	} else {
+		log.Printf("%s: %s/%s@%s: committed %s", name, req.Owner, req.Repo, req.Branch, shortSHA(resp.Commit))
+	}
+	return nil
+}
+
+// requeueExpired puts back the claimed requests whose lease ran out.
+func (q *commitSpool) requeueExpired() {
+	entries, err := os.ReadDir(filepath.Join(q.dir, spoolClaimed))
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		info, err := e.Info()
+		if err != nil || time.Since(info.ModTime()) < spoolLease {
+			continue
+		}
+		if os.Rename(filepath.Join(q.dir, spoolClaimed, e.Name()), filepath.Join(q.dir, e.Name())) == nil {
+			log.Printf("⚠️ Spool %s: lease of %s expired, requeued it", q.dir, e.Name())
+		}
+	}
+}
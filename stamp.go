@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// --- Header Stamping ---
+
+const defaultStampTemplate = "Managed by {{.Tool}} from {{.Source}}; last synced {{.Time}}. DO NOT EDIT."
+
+// stampConfig stamps files matching Globs with a header rendered from
+// Template. The header carries run metadata that changes every run, so files
+// are compared with it stripped from the remote copy.
+type stampConfig struct {
+	Globs    []string
+	Template *template.Template
+	// marker is the template's text up to its first action, which the
+	// first header line must start with to be recognized as a stamp.
+	marker string
+	lines  int
+	time   string
+}
+
+// stampData is what the header template can refer to.
+type stampData struct {
+	Tool, Version string
+	Repo, Branch  string
+	// Path is the repository path, Source the path below -dest-prefix.
+	Path, Source string
+	Time, RunID  string
+}
+
+// newStampConfig parses text, which may span several lines.
+func newStampConfig(globs []string, text string) (*stampConfig, error) {
+	tmpl, err := template.New("stamp").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse stamp template: %w", err)
+	}
+	first, _, _ := strings.Cut(text, "\n")
+	marker, _, _ := strings.Cut(first, "{{")
+	return &stampConfig{
+		Globs:    globs,
+		Template: tmpl,
+		marker:   marker,
+		lines:    strings.Count(strings.TrimRight(text, "\n"), "\n") + 1,
+		time:     time.Now().UTC().Format(time.RFC3339),
+	}, nil
+}
+
+func (c *stampConfig) matches(p string) bool {
+	if c == nil {
+		return false
+	}
+	for _, glob := range c.Globs {
+		if matchAttrPattern(glob, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// commentSyntax returns how a line comment opens and closes in p's language,
+// or ok false when the extension is unknown.
+func commentSyntax(p string) (open, close string, ok bool) {
+	switch strings.ToLower(path.Ext(p)) {
+	case ".sh", ".bash", ".py", ".rb", ".pl", ".yml", ".yaml", ".toml", ".tf", ".r", ".ps1", ".cfg", ".conf", ".ini", ".env":
+		return "#", "", true
+	case ".go", ".js", ".mjs", ".ts", ".tsx", ".jsx", ".java", ".kt", ".c", ".h", ".cc", ".cpp", ".hpp", ".cs", ".swift", ".rs", ".scala", ".proto", ".groovy":
+		return "//", "", true
+	case ".sql", ".lua", ".hs":
+		return "--", "", true
+	case ".css", ".scss", ".less":
+		return "/*", " */", true
+	case ".html", ".htm", ".xml", ".md", ".svg", ".vue":
+		return "<!--", " -->", true
+	}
+	switch path.Base(p) {
+	case "Dockerfile", "Makefile", "CODEOWNERS", ".gitignore", ".gitattributes", ".dockerignore":
+		return "#", "", true
+	}
+	return "", "", false
+}
+
+// header renders the stamp for p as comment lines.
+func (c *stampConfig) header(p string, data stampData) (string, error) {
+	open, close, ok := commentSyntax(p)
+	if !ok {
+		return "", nil
+	}
+	var out bytes.Buffer
+	if err := c.Template.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render stamp for %s: %w", p, err)
+	}
+	var b strings.Builder
+	for _, line := range strings.Split(strings.TrimRight(out.String(), "\n"), "\n") {
+		fmt.Fprintf(&b, "%s %s%s\n", open, line, close)
+	}
+	return b.String(), nil
+}
+
+// splitShebang separates a leading #! line, which has to stay first.
+func splitShebang(content string) (string, string) {
+	if strings.HasPrefix(content, "#!") {
+		if end := strings.IndexByte(content, '\n'); end >= 0 {
+			return content[:end+1], content[end+1:]
+		}
+	}
+	return "", content
+}
+
+// strip removes the stamp from content, if it has one.
+func (c *stampConfig) strip(p, content string) string {
+	open, _, ok := commentSyntax(p)
+	if !ok {
+		return content
+	}
+	shebang, body := splitShebang(content)
+	lines := strings.SplitAfterN(body, "\n", c.lines+1)
+	if len(lines) <= c.lines || !strings.HasPrefix(lines[0], open+" "+c.marker) {
+		return content
+	}
+	for _, line := range lines[:c.lines] {
+		if !strings.HasPrefix(line, open) {
+			return content
+		}
+	}
+	return shebang + lines[c.lines]
+}
+
+// stampData fills in the template data for p, committed to owner/repo@branch
+// below the destination prefix.
+func (c *stampConfig) stampData(owner, repo, branch, prefix, p string) stampData {
+	source := p
+	if prefix != "" {
+		source = strings.TrimPrefix(p, prefix+"/")
+	}
+	return stampData{Tool: "gitapis", Version: version, Repo: owner + "/" + repo, Branch: branch, Path: p, Source: source, Time: c.time, RunID: runID}
+}
+
+// stampChange returns the status and content to commit for a file that
+// matches the stamp globs, or an empty status when p cannot be stamped. A
+// remote copy equal to content once its stamp is stripped is left alone,
+// stamp and all.
+func (c *stampConfig) stampChange(f forge, head, p, content string, exists bool, data stampData) (string, string, error) {
+	header, err := c.header(p, data)
+	if err != nil {
+		return "", "", &fileError{Path: p, Err: err}
+	}
+	if header == "" {
+		log.Printf("⚠️ Not stamping %s: no comment syntax known for it", p)
+		return "", content, nil
+	}
+	if exists {
+		reader, ok := f.(contentReader)
+		if !ok {
+			return "", "", fmt.Errorf("stamped files need a forge that can read files back to compare them")
+		}
+		remote, err := readRemoteFile(reader, head, p)
+		if err != nil {
+			return "", "", err
+		}
+		if c.strip(p, remote) == content {
+			return "skipped", "", nil
+		}
+	}
+	shebang, body := splitShebang(content)
+	status := "created"
+	if exists {
+		status = "updated"
+	}
+	return status, shebang + header + body, nil
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Submodules ---
+
+type submoduleSpec struct {
+	Path string
+	URL  string
+	Ref  string
+	SHA  string
+}
+
+var (
+	fullSHA        = regexp.MustCompile(`^[0-9a-f]{40}$`)
+	githubRepoURL  = regexp.MustCompile(`^(?:https://github\.com/|git@github\.com:)([^/]+)/([^/]+?)(?:\.git)?$`)
+	gitmodulesHead = regexp.MustCompile(`^\[submodule "(.*)"\]$`)
+)
+
+// parseSubmoduleSpec parses "path=url@ref". The ref may be a commit SHA, or a
+// branch or tag when url points at GitHub.
+func parseSubmoduleSpec(value string) (submoduleSpec, error) {
+	p, rest, ok := strings.Cut(value, "=")
+	at := strings.LastIndex(rest, "@")
+	if !ok || p == "" || at <= 0 || at == len(rest)-1 {
+		return submoduleSpec{}, fmt.Errorf("invalid submodule %q, expected path=url@ref", value)
+	}
+	return submoduleSpec{Path: strings.Trim(p, "/"), URL: rest[:at], Ref: rest[at+1:]}, nil
+}
+
+// resolveSubmoduleSHA pins spec to a commit, looking up branch and tag names
+// through the API for GitHub-hosted submodules.
+func resolveSubmoduleSHA(client *github.Client, spec *submoduleSpec) error {
+	if fullSHA.MatchString(spec.Ref) {
+		spec.SHA = spec.Ref
+		return nil
+	}
+	m := githubRepoURL.FindStringSubmatch(spec.URL)
+	if m == nil {
+		return fmt.Errorf("%s: %q must be a full commit SHA for non-GitHub URLs", spec.Path, spec.Ref)
+	}
+	sha, err := resolveRef(client, m[1], m[2], spec.Ref)
+	if err != nil {
+		return fmt.Errorf("%s: %w", spec.Path, err)
+	}
+	spec.SHA = sha
+	return nil
+}
+
+// gitmodulesSection is one [submodule "name"] block of .gitmodules.
+type gitmodulesSection struct {
+	Name  string
+	Lines []string
+}
+
+func parseGitmodules(content string) []gitmodulesSection {
+	var sections []gitmodulesSection
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if m := gitmodulesHead.FindStringSubmatch(trimmed); m != nil {
+			sections = append(sections, gitmodulesSection{Name: m[1]})
+			continue
+		}
+		if trimmed == "" || len(sections) == 0 {
+			continue
+		}
+		sections[len(sections)-1].Lines = append(sections[len(sections)-1].Lines, trimmed)
+	}
+	return sections
+}
+
+func (s gitmodulesSection) value(key string) string {
+	for _, line := range s.Lines {
+		k, v, ok := strings.Cut(line, "=")
+		if ok && strings.TrimSpace(k) == key {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+func formatGitmodules(sections []gitmodulesSection) string {
+	var b strings.Builder
+	for _, s := range sections {
+		fmt.Fprintf(&b, "[submodule %q]\n", s.Name)
+		for _, line := range s.Lines {
+			fmt.Fprintf(&b, "\t%s\n", line)
+		}
+	}
+	return b.String()
+}
+
+// updateGitmodules sets or removes the entries for the given paths, keeping
+// any other keys of existing entries intact.
+func updateGitmodules(content string, set []submoduleSpec, remove []string) string {
+	sections := parseGitmodules(content)
+
+	for _, spec := range set {
+		found := false
+		for i, s := range sections {
+			if s.value("path") != spec.Path {
+				continue
+			}
+			found = true
+			lines := []string{"path = " + spec.Path, "url = " + spec.URL}
+			for _, line := range s.Lines {
+				k, _, _ := strings.Cut(line, "=")
+				if k = strings.TrimSpace(k); k != "path" && k != "url" {
+					lines = append(lines, line)
+				}
+			}
+			sections[i].Lines = lines
+		}
+		if !found {
+			sections = append(sections, gitmodulesSection{
+				Name:  spec.Path,
+				Lines: []string{"path = " + spec.Path, "url = " + spec.URL},
+			})
+		}
+	}
+
+	kept := sections[:0]
+	for _, s := range sections {
+		drop := false
+		for _, p := range remove {
+			drop = drop || s.value("path") == p
+		}
+		if !drop {
+			kept = append(kept, s)
+		}
+	}
+	return formatGitmodules(kept)
+}
+
+func runSubmoduleCommand(args []string) error {
+	fs := flag.NewFlagSet("submodule", flag.ExitOnError)
+	owner, repo := repoFlags(fs)
+	branch := fs.String("branch", defaultBranch, "branch to commit to")
+	message := fs.String("message", "Update submodules", "commit message")
+	var setFlags, removeFlags stringList
+	fs.Var(&setFlags, "set", "add or update a submodule as path=url@ref; repeatable")
+	fs.Var(&removeFlags, "remove", "remove the submodule at this path; repeatable")
+	fs.Parse(args)
+
+	if len(setFlags) == 0 && len(removeFlags) == 0 {
+		return fmt.Errorf("usage: submodule [-set path=url@ref]... [-remove path]...")
+	}
+	client, err := newGitHubClient()
+	if err != nil {
+		return err
+	}
+
+	var specs []submoduleSpec
+	for _, value := range setFlags {
+		spec, err := parseSubmoduleSpec(value)
+		if err != nil {
+			return err
+		}
+		if err := resolveSubmoduleSHA(client, &spec); err != nil {
+			return err
+		}
+		specs = append(specs, spec)
+	}
+
+	result, _, err := commitSubmodules(client, *owner, *repo, *branch, specs, removeFlags, *message)
+	printSummary(result)
+	return err
+}
+
+// commitSubmodules writes gitlink entries for specs, deletes those at
+// remove, and updates .gitmodules to match, all in one commit.
+func commitSubmodules(client *github.Client, owner, repo, branch string, specs []submoduleSpec, remove []string, message string) (map[string]string, *github.Commit, error) {
+	ctx := context.Background()
+	result := make(map[string]string)
+
+	ref, _, err := client.Git.GetRef(ctx, owner, repo, "refs/heads/"+branch)
+	if err != nil {
+		return result, nil, fmt.Errorf("GetRef: %w", err)
+	}
+	head, _, err := client.Git.GetCommit(ctx, owner, repo, ref.Object.GetSHA())
+	if err != nil {
+		return result, nil, fmt.Errorf("GetCommit: %w", err)
+	}
+	current, err := treeEntries(client, owner, repo, head.Tree.GetSHA())
+	if err != nil {
+		return result, nil, err
+	}
+
+	gitmodules := ""
+	if entry, ok := current[".gitmodules"]; ok {
+		b, _, err := client.Git.GetBlobRaw(ctx, owner, repo, entry.GetSHA())
+		if err != nil {
+			return result, nil, fmt.Errorf("GetBlobRaw .gitmodules: %w", err)
+		}
+		gitmodules = string(b)
+	}
+
+	var entries []*github.TreeEntry
+	for _, spec := range specs {
+		existing, ok := current[spec.Path]
+		switch {
+		case ok && existing.GetType() != "commit":
+			return result, nil, fmt.Errorf("%s exists and is not a submodule", spec.Path)
+		case ok && existing.GetSHA() == spec.SHA:
+			result[spec.Path] = "skipped"
+		case ok:
+			result[spec.Path] = "updated"
+		default:
+			result[spec.Path] = "created"
+		}
+		entries = append(entries, &github.TreeEntry{
+			Path: github.String(spec.Path),
+			Mode: github.String("160000"),
+			Type: github.String("commit"),
+			SHA:  github.String(spec.SHA),
+		})
+	}
+	for _, p := range remove {
+		existing, ok := current[p]
+		if !ok || existing.GetType() != "commit" {
+			return result, nil, fmt.Errorf("%s is not a submodule", p)
+		}
+		result[p] = "deleted"
+		entries = append(entries, &github.TreeEntry{Path: github.String(p), Mode: github.String("160000"), Type: github.String("commit")})
+	}
+
+	updated := updateGitmodules(gitmodules, specs, remove)
+	if updated != gitmodules {
+		entry := &github.TreeEntry{Path: github.String(".gitmodules"), Mode: github.String("100644"), Type: github.String("blob")}
+		if updated == "" {
+			result[".gitmodules"] = "deleted"
+		} else {
+			sha, err := newBlobUploader(client, owner, repo, nil).upload(updated)
+			if err != nil {
+				return result, nil, fmt.Errorf("CreateBlob .gitmodules: %w", err)
+			}
+			entry.SHA = github.String(sha)
+			result[".gitmodules"] = "updated"
+		}
+		entries = append(entries, entry)
+	}
+
+	changed := false
+	for _, status := range result {
+		changed = changed || status != "skipped"
+	}
+	if !changed {
+		fmt.Println("No changes to commit.")
+		return result, nil, nil
+	}
+
+	tree, _, err := client.Git.CreateTree(ctx, owner, repo, head.Tree.GetSHA(), entries)
+	if err != nil {
+		return result, nil, fmt.Errorf("CreateTree: %w", err)
+	}
+	commit, _, err := client.Git.CreateCommit(ctx, owner, repo, &github.Commit{
+		Message: github.String(message),
+		Tree:    tree,
+		Parents: []*github.Commit{{SHA: head.SHA}},
+	})
+	if err != nil {
+		return result, nil, fmt.Errorf("CreateCommit: %w", err)
+	}
+	ref.Object.SHA = commit.SHA
+	if _, _, err := client.Git.UpdateRef(ctx, owner, repo, ref, false); err != nil {
+		return result, nil, fmt.Errorf("UpdateRef: %w", err)
+	}
+
+	fmt.Println("Commit created:", commit.GetHTMLURL())
+	return result, commit, nil
+}
@@ -0,0 +1,574 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Sync Run ---
+
+// syncConfig is everything from the command line that shapes how a change set
+// is committed, shared by every branch of a run.
+type syncConfig struct {
+	Message       string
+	CommitMessage string
+	Trailers      []string
+	SkipCI        bool
+
+	ValuesPath   string
+	TemplateVars []string
+	TemplateEnv  []string
+	Normalize    normalizeOptions
+	DestPrefix   string
+	MaxFiles     int
+
+	Prune        bool
+	ReplaceTypes bool
+	GitKeep      bool
+	Protect      string
+	Base         string
+	Verify       string
+	// ContentPolicy, when set, is checked on every branch's change set.
+	ContentPolicy *contentPolicy
+	// Links holds the source paths that are symlinks rather than files.
+	Links map[string]bool
+	// Encryption, when set, commits matching files encrypted.
+	Encryption *encryptionConfig
+	// Stamp, when set, puts a header on matching files.
+	Stamp *stampConfig
+	// Regions, when set, syncs matching files into their managed region.
+	Regions *regionConfig
+	// Merge, when set, deep-merges matching JSON and YAML files.
+	Merge *mergeConfig
+	// Generated are the patterns of synced files to mark linguist-generated
+	// in the managed region of the root .gitattributes.
+	Generated []string
+
+	// IdempotencyKey, when set, skips a branch that already has a commit
+	// made with it.
+	IdempotencyKey string
+
+	// Lock serializes runs on a branch with a branchLock, waiting up to
+	// LockWait for it and holding it for at most LockTTL.
+	Lock     bool
+	LockWait time.Duration
+	LockTTL  time.Duration
+
+	PR       bool
+	PRBranch string
+	PRTitle  string
+	// PRRouting labels, assigns and requests reviews of pull requests.
+	PRRouting *prRouting
+	// PRBody, when set, renders the pull request body; without it the body
+	// is the change summary alone.
+	PRBody *prBodyConfig
+	// MergeQueue adds pull requests to the base branch's merge queue, and
+	// with MergeQueueWait waits for them to land.
+	MergeQueue     bool
+	MergeQueueWait time.Duration
+	Fork           bool
+
+	Annotate     bool
+	Orphan       bool
+	GroupBy      string
+	Landing      landingOrder
+	GroupMessage string
+	Pages        *pagesConfig
+	PagesWait    time.Duration
+	PostComment  bool
+	RollbackFile string
+	// ProvenancePath is where each commit gets a provenance file, if set.
+	ProvenancePath string
+	// ChecksumsPath is where each commit gets a checksum manifest, if set.
+	ChecksumsPath string
+	// Snapshot, when set, stands in for the repository so runs only plan.
+	Snapshot *repoSnapshot
+	// Environments, when set, provisions deployment environments on each
+	// repository.
+	Environments *environmentProvisioner
+	// Teams, when set, provisions teams with access to each repository.
+	Teams *teamProvisioner
+	// Settings, when set, reconciles autolinks and custom properties on
+	// each repository.
+	Settings *repoSettings
+	// Overrides adjust the branches, files and template variables of
+	// individual repositories of a fan-out.
+	Overrides map[repoTarget]*repoOverride
+	// Rulesets are reconciled on each repository before it is synced.
+	Rulesets []rulesetSpec
+	// Security, when set, turns on security features on each repository.
+	Security *securitySettings
+	// Policy places policy files where each repository has its own.
+	Policy bool
+
+	NotifyURL      string
+	NotifyOn       string
+	NotifyTemplate *template.Template
+}
+
+// prHeadBranch is the head branch of the pull request for branch: head, or
+// gitapis/sync-<branch> by default.
+func prHeadBranch(head, branch string) string {
+	if head == "" {
+		return "gitapis/sync-" + branch
+	}
+	return head
+}
+
+// preparedBranch is the change set rendered and checked for one branch.
+type preparedBranch struct {
+	Branch string
+	Files  map[string]string
+	Attrs  *gitAttributes
+	// Violations of a content policy that proposes rather than blocks
+	// turn the branch's commit into a pull request.
+	Violations []contentViolation
+}
+
+// branchOutcome is what happened to one branch of a run.
+type branchOutcome struct {
+	Branch string
+	Result map[string]string
+	Commit *github.Commit
+	PR     *github.PullRequest
+	// Applied is the commit an earlier run with the same idempotency key
+	// made, when this run was skipped for it.
+	Applied string
+	// Merged is the merge commit of the pull request, once it landed
+	// through the merge queue.
+	Merged string
+	Err    error
+}
+
+// notify sends the run summary for one branch if the configuration asks
+// for it.
+func (cfg *syncConfig) notify(owner, repo, branch string, result map[string]string, commit *github.Commit, runErr error) {
+	if cfg.NotifyURL == "" || !shouldNotify(cfg.NotifyOn, runErr == nil) {
+		return
+	}
+	summary := newRunSummary(owner, repo, branch, result, commit.GetSHA(), commit.GetHTMLURL(), runErr)
+	if err := sendNotification(cfg.NotifyURL, cfg.NotifyTemplate, summary); err != nil {
+		log.Printf("Failed to send notification: %v", err)
+	}
+}
+
+// prepareBranch renders, normalizes and validates source for branch without
+// changing anything, so every branch can be checked before the first push.
+func prepareBranch(client *github.Client, cfg *syncConfig, owner, repo, branch string, source map[string]string) (*preparedBranch, error) {
+	data, err := newTemplateData(owner, repo, branch, cfg.ValuesPath, cfg.TemplateVars, cfg.TemplateEnv)
+	if err != nil {
+		return nil, err
+	}
+	// A symlink's content is its target, which is neither a template nor
+	// text to normalize, so links join the files only after both steps.
+	links := make(map[string]string, len(cfg.Links))
+	if len(cfg.Links) > 0 {
+		regular := make(map[string]string, len(source))
+		for p, content := range source {
+			if cfg.Links[p] {
+				links[p] = content
+			} else {
+				regular[p] = content
+			}
+		}
+		source = regular
+	}
+	files, err := renderTemplates(source, data)
+	if err != nil {
+		return nil, err
+	}
+	files = applyDestPrefix(files, cleanDestPrefix(cfg.DestPrefix))
+	links = applyDestPrefix(links, cleanDestPrefix(cfg.DestPrefix))
+	if cfg.Policy {
+		if files, err = placePolicyFiles(client, owner, repo, branch, files); err != nil {
+			return nil, fmt.Errorf("failed to place policy files: %w", err)
+		}
+	}
+
+	// Attributes come from the target branch, overridden by synced files.
+	var attrs *gitAttributes
+	if cfg.Snapshot != nil {
+		attrs, err = cfg.Snapshot.gitAttributes(files)
+	} else {
+		attrs, err = loadGitAttributes(client, owner, repo, branch, files)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .gitattributes: %w", err)
+	}
+	if files, err = normalizeFiles(files, cfg.Normalize, attrs); err != nil {
+		return nil, err
+	}
+	for p, target := range links {
+		if _, exists := files[p]; exists {
+			return nil, fmt.Errorf("symlink %s conflicts with a rendered template", p)
+		}
+		files[p] = target
+	}
+	if len(cfg.Generated) > 0 {
+		if lines := generatedAttributes(files, cfg.Generated); lines != "" {
+			files[".gitattributes"] = addGeneratedAttributes(files[".gitattributes"], lines)
+			attrs.add("", lines)
+		}
+	}
+	if err := validateChangeSet(files, cfg.MaxFiles, attrs); err != nil {
+		return nil, err
+	}
+	var violations []contentViolation
+	if cfg.ContentPolicy != nil {
+		remote := client
+		if cfg.Snapshot != nil {
+			remote = nil
+		}
+		if violations, err = cfg.ContentPolicy.check(remote, owner, repo, branch, files); err != nil {
+			return nil, fmt.Errorf("failed to check content policy: %w", err)
+		}
+		if len(violations) > 0 && cfg.ContentPolicy.Action == contentPolicyBlock {
+			return nil, &contentPolicyError{Violations: violations}
+		}
+	}
+	return &preparedBranch{Branch: branch, Files: files, Attrs: attrs, Violations: violations}, nil
+}
+
+// upsertOptions returns the options for committing source, the branch's
+// whole change set.
+func (cfg *syncConfig) upsertOptions(source map[string]string) upsertOptions {
+	opts := upsertOptions{Prune: cfg.Prune, PrunePrefix: cleanDestPrefix(cfg.DestPrefix), Base: cfg.Base, Verify: cfg.Verify, ReplaceTypes: cfg.ReplaceTypes, GitKeep: cfg.GitKeep, Protect: cfg.Protect, Encryption: cfg.Encryption, Stamp: cfg.Stamp, Regions: cfg.Regions, Merge: cfg.Merge}
+	if len(cfg.Generated) > 0 {
+		// The generated marks share the root .gitattributes with the lines
+		// people maintain, so they are kept to its managed region.
+		regions := &regionConfig{Globs: []string{"/.gitattributes"}}
+		if cfg.Regions != nil {
+			regions.Globs = append(regions.Globs, cfg.Regions.Globs...)
+		}
+		opts.Regions = regions
+	}
+	if len(cfg.Links) > 0 {
+		opts.Links = make(map[string]bool, len(cfg.Links))
+		prefix := cleanDestPrefix(cfg.DestPrefix)
+		for p := range cfg.Links {
+			if prefix != "" {
+				p = prefix + "/" + p
+			}
+			opts.Links[p] = true
+		}
+	}
+	if cfg.ProvenancePath != "" {
+		opts.Provenance = &provenanceConfig{Path: cfg.ProvenancePath, Source: source}
+	}
+	if cfg.ChecksumsPath != "" {
+		opts.Checksums = &checksumConfig{Path: cfg.ChecksumsPath}
+	}
+	return opts
+}
+
+// planBranch writes the commit the run would make on p.Branch to path.
+func planBranch(client *github.Client, cfg *syncConfig, owner, repo string, p *preparedBranch, path string) error {
+	// LFS objects are content-addressed and unreferenced until the plan is
+	// applied, so storing them now changes nothing visible.
+	files, err := storeLFSObjects(owner, repo, p.Files, p.Attrs)
+	if err != nil {
+		return fmt.Errorf("failed to store LFS objects: %w", err)
+	}
+	f := newGitHubForge(client, owner, repo)
+	f.plan = &syncPlan{}
+	return writeBranchPlan(f, cfg, p.Branch, files, f.plan, path)
+}
+
+// writeBranchPlan plans committing files to branch through f, which records
+// the commit in plan, and writes the plan to path.
+func writeBranchPlan(f forge, cfg *syncConfig, branch string, files map[string]string, plan *syncPlan, path string) error {
+	opts := cfg.upsertOptions(files)
+	opts.Plan = plan
+	result, _, err := upsertFiles(f, branch, files, cfg.CommitMessage, opts)
+	if err != nil {
+		printSummary(result)
+		return fmt.Errorf("failed to plan: %w", err)
+	}
+	if plan.Entries == nil {
+		return nil
+	}
+	if err := writePlan(path, plan); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+	printPlan(plan)
+	fmt.Printf("Plan written to %s; run \"apply %s\" to commit it.\n", path, path)
+	return nil
+}
+
+// syncBranch commits a prepared change set to its branch, directly or through
+// a pull request, and runs the follow-up steps for that branch. Failures are
+// returned in the outcome so other branches of the run can proceed.
+func syncBranch(client *github.Client, cfg *syncConfig, owner, repo string, p *preparedBranch) (out branchOutcome) {
+	branch := p.Branch
+	out.Branch = branch
+	defer func() {
+		out.Err = explainError(out.Err, client, owner, repo)
+		cfg.notify(owner, repo, branch, out.Result, out.Commit, out.Err)
+	}()
+
+	target := prTarget{Owner: owner, Repo: repo, Branch: branch}
+	usePR := cfg.PR || cfg.Fork
+	if len(p.Violations) > 0 && !usePR {
+		log.Printf("⚠️ %s breaks the content policy in %d places; opening a pull request instead", branch, len(p.Violations))
+		usePR = true
+	}
+	if usePR {
+		var err error
+		if target, err = pullRequestTarget(client, owner, repo, prHeadBranch(cfg.PRBranch, branch), cfg.Fork); err != nil {
+			out.Err = fmt.Errorf("failed to prepare pull request branch: %w", err)
+			return out
+		}
+	}
+	// An earlier run's commit may be on branch or, still in review, on the
+	// head branch, wherever that ended up. Both are checked before the head
+	// branch is reset to branch, which would drop the commit from it.
+	candidates := []prTarget{{Owner: owner, Repo: repo, Branch: branch}}
+	if usePR {
+		candidates = append(candidates, target)
+	}
+	alreadyApplied := func() bool {
+		if cfg.IdempotencyKey == "" {
+			return false
+		}
+		for _, c := range candidates {
+			applied, err := findAppliedCommit(client, c.Owner, c.Repo, c.Branch, cfg.IdempotencyKey)
+			if err != nil {
+				out.Err = fmt.Errorf("failed to look for idempotency key: %w", err)
+				return true
+			}
+			if applied != nil {
+				log.Printf("Idempotency key %s was already applied to %s in %s", cfg.IdempotencyKey, c.Branch, shortSHA(applied.SHA))
+				out.Applied = applied.SHA
+				return true
+			}
+		}
+		return false
+	}
+	if alreadyApplied() {
+		return out
+	}
+
+	if cfg.Lock {
+		lock, err := acquireBranchLock(client, target.Owner, target.Repo, target.Branch, cfg.LockWait, cfg.LockTTL)
+		if err != nil {
+			out.Err = fmt.Errorf("failed to lock branch: %w", err)
+			return out
+		}
+		defer func() {
+			if err := lock.release(); err != nil {
+				log.Printf("⚠️ Failed to release the lock on %s: %v", target.Branch, err)
+			}
+		}()
+		// A run holding the lock while this one waited may have applied
+		// the same key.
+		if alreadyApplied() {
+			return out
+		}
+	}
+
+	if usePR {
+		if err := resetPullRequestBranch(client, owner, repo, branch, target); err != nil {
+			out.Err = fmt.Errorf("failed to prepare pull request branch: %w", err)
+			return out
+		}
+	}
+
+	files, err := storeLFSObjects(target.Owner, target.Repo, p.Files, p.Attrs)
+	if err != nil {
+		out.Err = fmt.Errorf("failed to store LFS objects: %w", err)
+		return out
+	}
+	headBefore, err := branchHead(client, target.Owner, target.Repo, target.Branch)
+	if err != nil {
+		out.Err = err
+		return out
+	}
+
+	var previous map[string]logEntry
+	if cfg.Annotate {
+		paths := make([]string, 0, len(files))
+		for path := range files {
+			paths = append(paths, path)
+		}
+		if previous, err = lastChanges(client, owner, repo, branch, paths); err != nil {
+			log.Printf("Failed to look up file history: %v", err)
+		}
+	}
+
+	opts := cfg.upsertOptions(files)
+	switch {
+	case cfg.Orphan:
+		out.Result, out.Commit, out.Err = publishOrphan(client, owner, repo, branch, files, cfg.CommitMessage)
+		if out.Err == nil {
+			out.Err = verifyCommit(client, owner, repo, branch, out.Commit, cfg.Verify)
+		}
+	case cfg.GroupBy == groupSingle && !cfg.Landing.set():
+		out.Result, out.Commit, out.Err = upsertMultipleFilesSafe(client, target.Owner, target.Repo, target.Branch, files, cfg.CommitMessage, opts)
+	default:
+		out.Result, out.Commit, out.Err = upsertGrouped(client, target, files, opts, cfg.GroupBy, cfg.Landing, cfg.GroupMessage, cfg.Message, func(message string) (string, error) {
+			return buildCommitMessage(message, cfg.SkipCI, cfg.Trailers)
+		})
+	}
+	var external *externalChanges
+	if !usePR && errors.As(out.Err, &external) {
+		// Someone else's edits are for a reviewer to weigh, so propose the
+		// whole sync instead. The retry notifies through this call.
+		log.Printf("⚠️ %v; opening a pull request instead", external)
+		retry := *cfg
+		retry.PR, retry.Protect, retry.NotifyURL = true, "", ""
+		return syncBranch(client, &retry, owner, repo, p)
+	}
+	// Recorded even on failure, since grouped runs can push part of the way.
+	if cfg.RollbackFile != "" && out.Commit != nil {
+		rec := pushRecord{Owner: target.Owner, Repo: target.Repo, Branch: target.Branch, Before: headBefore, After: out.Commit.GetSHA(), Time: time.Now().UTC()}
+		if err := recordPush(cfg.RollbackFile, rec); err != nil {
+			log.Printf("Failed to record push for rollback: %v", err)
+		}
+	}
+	// Files left out under -on-error commit-succeeded fail the branch, but
+	// the commit stands, so its follow-up steps still run.
+	var skipped fileErrors
+	if out.Commit != nil && errors.As(out.Err, &skipped) {
+		out.Err = nil
+	}
+	if out.Err != nil {
+		out.Err = fmt.Errorf("failed to upsert files: %w", out.Err)
+		printSummary(out.Result)
+		return out
+	}
+
+	if usePR && out.Commit != nil {
+		title := cfg.PRTitle
+		if title == "" {
+			title, _, _ = strings.Cut(cfg.Message, "\n")
+		}
+		var body string
+		if cfg.PRBody != nil {
+			if body, err = cfg.PRBody.render(client, owner, repo, branch, target, out, p); err != nil {
+				out.Err = err
+				return out
+			}
+		} else {
+			body = formatChangeSummary(target.Owner, target.Repo, out.Result, out.Commit.GetSHA(), p.Attrs)
+			if len(p.Violations) > 0 {
+				body += formatViolations(p.Violations)
+			}
+		}
+		if out.PR, err = openPullRequestAs(client, owner, repo, branch, target, title, body, cfg.PRRouting != nil && cfg.PRRouting.Draft); err != nil {
+			out.Err = fmt.Errorf("failed to open pull request: %w", err)
+			return out
+		}
+		if err := cfg.PRRouting.route(client, owner, repo, out.PR.GetNumber()); err != nil {
+			log.Printf("⚠️ Failed to route pull request: %v", err)
+		}
+		if cfg.MergeQueue {
+			err := enqueuePullRequest(client, owner, repo, branch, out.PR)
+			switch {
+			case errors.Is(err, errNoMergeQueue):
+				log.Printf("⚠️ %s/%s@%s has no merge queue, so the pull request waits for a merge", owner, repo, branch)
+			case err != nil:
+				out.Err = fmt.Errorf("failed to queue pull request: %w", err)
+				return out
+			case cfg.MergeQueueWait > 0:
+				if out.Merged, err = waitForMerge(client, owner, repo, out.PR, cfg.MergeQueueWait); err != nil {
+					out.Err = err
+					return out
+				}
+				fmt.Println("Merged through the merge queue:", out.Merged)
+			}
+		}
+	}
+	if cfg.Pages != nil && !usePR {
+		pages := *cfg.Pages
+		pages.Branch = branch
+		if err := configurePages(client, owner, repo, pages); err != nil {
+			out.Err = fmt.Errorf("failed to configure GitHub Pages: %w", err)
+			return out
+		}
+		if cfg.PagesWait > 0 && out.Commit != nil {
+			if err := waitForPagesBuild(client, owner, repo, out.Commit.GetSHA(), cfg.PagesWait); err != nil {
+				out.Err = err
+				return out
+			}
+		}
+	}
+
+	if cfg.PostComment && out.Commit != nil {
+		summary := formatChangeSummary(target.Owner, target.Repo, out.Result, out.Commit.GetSHA(), p.Attrs)
+		if out.PR != nil {
+			err = postPullRequestComment(client, owner, repo, out.PR.GetNumber(), summary)
+		} else {
+			err = postCommitComment(client, target.Owner, target.Repo, out.Commit.GetSHA(), summary)
+		}
+		if err != nil {
+			log.Printf("Failed to post summary comment: %v", err)
+		}
+	}
+
+	if skipped != nil {
+		out.Err = fmt.Errorf("committed without some files: %w", skipped)
+	}
+	printSummary(out.Result)
+	printLastChanges(out.Result, previous)
+	return out
+}
+
+// syncForgeBranch commits a prepared change set through a non-GitHub forge,
+// which supports only the direct, single-commit path.
+func syncForgeBranch(f forge, cfg *syncConfig, p *preparedBranch) (out branchOutcome) {
+	owner, repo := f.Target()
+	out.Branch = p.Branch
+	defer func() { cfg.notify(owner, repo, p.Branch, out.Result, out.Commit, out.Err) }()
+
+	for path := range p.Files {
+		if p.Attrs.isLFS(path) {
+			out.Err = fmt.Errorf("%s is tracked by Git LFS, which needs -forge github", path)
+			return out
+		}
+	}
+	result, commit, err := upsertFiles(f, p.Branch, p.Files, cfg.CommitMessage, cfg.upsertOptions(p.Files))
+	out.Result, out.Commit = result, gitHubCommit(commit)
+	if err != nil {
+		out.Err = fmt.Errorf("failed to upsert files: %w", err)
+	}
+	printSummary(out.Result)
+	return out
+}
+
+// printBranchReport summarizes a run over several branches, one line each.
+func printBranchReport(outcomes []branchOutcome) {
+	sort.Slice(outcomes, func(i, j int) bool { return outcomes[i].Branch < outcomes[j].Branch })
+	fmt.Println("Branch Summary:")
+	for _, out := range outcomes {
+		counts := make(map[string]int)
+		for _, status := range out.Result {
+			counts[status]++
+		}
+		var state string
+		switch {
+		case out.Err != nil:
+			state = "failed: " + out.Err.Error()
+		case out.PR != nil:
+			state = "pull request " + out.PR.GetHTMLURL()
+		case out.Commit != nil:
+			state = "committed " + shortSHA(out.Commit.GetSHA())
+		case out.Applied != "":
+			state = "already applied in " + shortSHA(out.Applied)
+		default:
+			state = "no changes"
+		}
+		held := ""
+		if n := counts[externallyModified]; n > 0 {
+			held = fmt.Sprintf(", %d %s", n, externallyModified)
+		}
+		fmt.Printf("  %s → %s (%d created, %d updated, %d deleted, %d skipped, %d failed%s)\n",
+			out.Branch, state, counts["created"], counts["updated"], counts["deleted"], counts["skipped"], counts["error"]+counts[compareFailed], held)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Teams ---
+
+// teamSpec is a team to stand up in the organization of each synced
+// repository, with access to it. Members and Maintainers, when either is
+// given, are the team's exact membership: anyone else is removed, including
+// the user who created the team. Without them membership is left alone.
+type teamSpec struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Privacy     string   `json:"privacy,omitempty"`
+	Permission  string   `json:"permission"`
+	Members     []string `json:"members,omitempty"`
+	Maintainers []string `json:"maintainers,omitempty"`
+}
+
+// teamProvisioner provisions teams across a run. A team is created and its
+// members set once per organization, however many of its repositories are
+// synced; access is granted on every repository.
+type teamProvisioner struct {
+	teams []teamSpec
+
+	mu    sync.Mutex
+	slugs map[string]string
+}
+
+func loadTeams(path string) (*teamProvisioner, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read teams: %w", err)
+	}
+	var teams []teamSpec
+	if err := json.Unmarshal(b, &teams); err != nil {
+		return nil, fmt.Errorf("failed to parse teams: %w", err)
+	}
+	for i, t := range teams {
+		if t.Name == "" {
+			return nil, fmt.Errorf("team %d: missing name", i+1)
+		}
+		switch t.Permission {
+		case "pull", "triage", "push", "maintain", "admin":
+		default:
+			return nil, fmt.Errorf("team %s: permission must be pull, triage, push, maintain or admin", t.Name)
+		}
+		switch t.Privacy {
+		case "", "closed", "secret":
+		default:
+			return nil, fmt.Errorf("team %s: privacy must be closed or secret", t.Name)
+		}
+	}
+	return &teamProvisioner{teams: teams, slugs: make(map[string]string)}, nil
+}
+
+// provision makes sure every team exists in org with its members, and has
+// its permission on repo.
+func (p *teamProvisioner) provision(client *github.Client, org, repo string) error {
+	if p == nil {
+		return nil
+	}
+	ctx := context.Background()
+	for _, t := range p.teams {
+		slug, err := p.ensure(client, org, t)
+		if err != nil {
+			return fmt.Errorf("team %s: %w", t.Name, err)
+		}
+		opts := &github.TeamAddTeamRepoOptions{Permission: t.Permission}
+		if _, err := client.Teams.AddTeamRepoBySlug(ctx, org, slug, org, repo, opts); err != nil {
+			return fmt.Errorf("AddTeamRepo %s: %w", slug, err)
+		}
+		log.Printf("Granted team %s %s on %s/%s", slug, t.Permission, org, repo)
+	}
+	return nil
+}
+
+// ensure returns the slug of team t in org, creating the team and setting
+// its members the first time org is seen.
+func (p *teamProvisioner) ensure(client *github.Client, org string, t teamSpec) (string, error) {
+	key := strings.ToLower(org) + "/" + t.Name
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if slug, ok := p.slugs[key]; ok {
+		return slug, nil
+	}
+
+	ctx := context.Background()
+	team, resp, err := client.Teams.GetTeamBySlug(ctx, org, teamSlug(t.Name))
+	switch {
+	case err == nil:
+	case resp != nil && resp.StatusCode == 404:
+		isOrg, err := isOrganization(client, org)
+		if err != nil {
+			return "", err
+		}
+		if !isOrg {
+			return "", fmt.Errorf("%s is not an organization, and only organizations have teams", org)
+		}
+		newTeam := github.NewTeam{Name: t.Name, Description: github.String(t.Description)}
+		if t.Privacy != "" {
+			newTeam.Privacy = github.String(t.Privacy)
+		}
+		if team, _, err = client.Teams.CreateTeam(ctx, org, newTeam); err != nil {
+			return "", fmt.Errorf("CreateTeam: %w", err)
+		}
+		log.Printf("Created team %s in %s", team.GetSlug(), org)
+	default:
+		return "", fmt.Errorf("GetTeam: %w", err)
+	}
+
+	if t.Members != nil || t.Maintainers != nil {
+		if err := setTeamMembers(client, org, team.GetSlug(), t); err != nil {
+			return "", err
+		}
+	}
+	p.slugs[key] = team.GetSlug()
+	return team.GetSlug(), nil
+}
+
+// setTeamMembers gives the team exactly the members and maintainers of t.
+func setTeamMembers(client *github.Client, org, slug string, t teamSpec) error {
+	ctx := context.Background()
+	want := make(map[string]string)
+	for _, login := range t.Members {
+		want[strings.ToLower(login)] = "member"
+	}
+	for _, login := range t.Maintainers {
+		want[strings.ToLower(login)] = "maintainer"
+	}
+
+	opts := &github.TeamListTeamMembersOptions{Role: "all", ListOptions: github.ListOptions{PerPage: 100}}
+	var current []*github.User
+	for {
+		page, resp, err := client.Teams.ListTeamMembersBySlug(ctx, org, slug, opts)
+		if err != nil {
+			return fmt.Errorf("ListTeamMembers %s: %w", slug, err)
+		}
+		current = append(current, page...)
+		if resp.NextPage == 0 {
+			break
+		}
+		opts.Page = resp.NextPage
+	}
+	for _, user := range current {
+		if _, ok := want[strings.ToLower(user.GetLogin())]; ok {
+			continue
+		}
+		if _, err := client.Teams.RemoveTeamMembershipBySlug(ctx, org, slug, user.GetLogin()); err != nil {
+			return fmt.Errorf("RemoveTeamMembership %s: %w", user.GetLogin(), err)
+		}
+		log.Printf("Removed %s from team %s", user.GetLogin(), slug)
+	}
+	// Adding an existing member sets their role, so everyone is added.
+	for login, role := range want {
+		opts := &github.TeamAddTeamMembershipOptions{Role: role}
+		if _, _, err := client.Teams.AddTeamMembershipBySlug(ctx, org, slug, login, opts); err != nil {
+			return fmt.Errorf("AddTeamMembership %s: %w", login, err)
+		}
+	}
+	return nil
+}
+
+// teamSlug is the slug GitHub gives a team named name.
+func teamSlug(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '_' {
+			b.WriteRune(r)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
+
+func isOrganization(client *github.Client, owner string) (bool, error) {
+	user, _, err := client.Users.Get(context.Background(), owner)
+	if err != nil {
+		return false, fmt.Errorf("GetUser %s: %w", owner, err)
+	}
+	return user.GetType() == "Organization", nil
+}
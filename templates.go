@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// --- Content Templating ---
+
+// templateSuffix marks a local file as a Go template. It is rendered before
+// upload and committed without the suffix.
+const templateSuffix = ".tmpl"
+
+type templateData struct {
+	Owner  string
+	Repo   string
+	Branch string
+	Vars   map[string]string
+	// Env holds only the environment variables named with -template-env,
+	// as templates render into committed files and the environment holds
+	// tokens.
+	Env map[string]string
+}
+
+// templateValues is the layout of a -values file: shared variables plus
+// per-repository overrides keyed by "owner/repo".
+type templateValues struct {
+	Vars  map[string]string            `json:"vars"`
+	Repos map[string]map[string]string `json:"repos"`
+}
+
+// newTemplateData merges variables from the values file, the entry for
+// owner/repo in it, and -var flags, in increasing order of precedence. Env
+// gets the variables among envNames that are set.
+func newTemplateData(owner, repo, branch, valuesPath string, flagVars, envNames []string) (templateData, error) {
+	data := templateData{
+		Owner:  owner,
+		Repo:   repo,
+		Branch: branch,
+		Vars:   make(map[string]string),
+		Env:    make(map[string]string),
+	}
+	for _, name := range envNames {
+		if v, ok := os.LookupEnv(name); ok {
+			data.Env[name] = v
+		}
+	}
+
+	if valuesPath != "" {
+		b, err := os.ReadFile(valuesPath)
+		if err != nil {
+			return data, fmt.Errorf("failed to read values file: %w", err)
+		}
+		var values templateValues
+		if err := json.Unmarshal(b, &values); err != nil {
+			return data, fmt.Errorf("failed to parse values file: %w", err)
+		}
+		for k, v := range values.Vars {
+			data.Vars[k] = v
+		}
+		for k, v := range values.Repos[owner+"/"+repo] {
+			data.Vars[k] = v
+		}
+	}
+
+	for _, kv := range flagVars {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return data, fmt.Errorf("invalid -var %q, expected key=value", kv)
+		}
+		data.Vars[k] = v
+	}
+	return data, nil
+}
+
+// renderTemplates returns files with every template rendered and renamed to
+// its target path. Any file that fails to render, including references to
+// undefined variables, is reported as an error.
+func renderTemplates(files map[string]string, data templateData) (map[string]string, error) {
+	rendered := make(map[string]string, len(files))
+	for path, content := range files {
+		if !strings.HasSuffix(path, templateSuffix) {
+			rendered[path] = content
+			continue
+		}
+
+		tmpl, err := template.New(path).Option("missingkey=error").Parse(content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse template %s: %w", path, err)
+		}
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, data); err != nil {
+			return nil, fmt.Errorf("failed to render template %s: %w", path, err)
+		}
+
+		target := strings.TrimSuffix(path, templateSuffix)
+		if _, exists := files[target]; exists {
+			return nil, fmt.Errorf("template %s conflicts with existing file %s", path, target)
+		}
+		rendered[target] = out.String()
+	}
+	return rendered, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// --- Commit Trailers ---
+
+// buildCommitMessage adds the [skip ci] marker to the subject line and
+// appends trailers ("Key: value") to the message, extending an existing
+// trailer block rather than starting a second one.
+func buildCommitMessage(message string, skipCI bool, trailers []string) (string, error) {
+	message = strings.TrimRight(message, "\n")
+	if skipCI && !strings.Contains(message, "[skip ci]") {
+		subject, body, hasBody := strings.Cut(message, "\n")
+		message = subject + " [skip ci]"
+		if hasBody {
+			message += "\n" + body
+		}
+	}
+
+	if len(trailers) == 0 {
+		return message, nil
+	}
+	for _, trailer := range trailers {
+		key, value, ok := strings.Cut(trailer, ":")
+		if !ok || strings.TrimSpace(value) == "" || strings.ContainsAny(key, " \t") {
+			return "", fmt.Errorf("invalid trailer %q, expected \"Key: value\"", trailer)
+		}
+	}
+
+	separator := "\n\n"
+	if parseTrailers(message) != nil {
+		separator = "\n"
+	}
+	return message + separator + strings.Join(trailers, "\n"), nil
+}
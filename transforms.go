@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// --- Content Transforms ---
+
+// transformRule runs Steps, in order, over every file matching Glob, a
+// .gitattributes-style pattern.
+type transformRule struct {
+	Glob  string          `json:"glob"`
+	Steps []transformStep `json:"steps"`
+}
+
+// transformStep is one step of a rule. Type selects the step; the other
+// fields are its parameters:
+//
+//	minify-json     compact JSON, dropping insignificant whitespace
+//	header          Text as the first line after any #!, unless it already is
+//	front-matter    Fields added to the YAML front matter, keeping existing keys
+//	strip-comments  drop lines starting with Prefix, except a leading #!
+//	command         Command run through the shell, file on stdin, result on stdout
+//	gzip            compress with a fixed header and rename the file to .gz
+type transformStep struct {
+	Type    string            `json:"type"`
+	Text    string            `json:"text,omitempty"`
+	Fields  map[string]string `json:"fields,omitempty"`
+	Prefix  string            `json:"prefix,omitempty"`
+	Command string            `json:"command,omitempty"`
+}
+
+// loadTransforms reads a JSON array of rules from path.
+func loadTransforms(path string) ([]transformRule, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read transforms: %w", err)
+	}
+	var rules []transformRule
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse transforms: %w", err)
+	}
+	for i, rule := range rules {
+		if rule.Glob == "" {
+			return nil, fmt.Errorf("transform %d: missing glob", i+1)
+		}
+		for _, step := range rule.Steps {
+			switch step.Type {
+			case "minify-json", "front-matter", "gzip":
+			case "header":
+				if step.Text == "" {
+					return nil, fmt.Errorf("transform %s: header needs text", rule.Glob)
+				}
+			case "strip-comments":
+				if step.Prefix == "" {
+					return nil, fmt.Errorf("transform %s: strip-comments needs a prefix", rule.Glob)
+				}
+			case "command":
+				if step.Command == "" {
+					return nil, fmt.Errorf("transform %s: command needs a command", rule.Glob)
+				}
+			default:
+				return nil, fmt.Errorf("transform %s: unknown step %q", rule.Glob, step.Type)
+			}
+		}
+	}
+	return rules, nil
+}
+
+// transformHook applies rules to the local file set before it is compared
+// with the remote, so what is compared is exactly what would be committed.
+// Files are processed in path order and every step is deterministic given its
+// input, so an unchanged source always yields the same blobs.
+func transformHook(rules []transformRule) hookFunc {
+	return func(hc *hookContext) error {
+		paths := make([]string, 0, len(hc.Files))
+		for path := range hc.Files {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		for _, path := range paths {
+			content, target := hc.Files[path], path
+			for _, rule := range rules {
+				if !matchAttrPattern(rule.Glob, path) {
+					continue
+				}
+				for _, step := range rule.Steps {
+					out, err := applyTransform(step, target, content)
+					if err != nil {
+						return fmt.Errorf("%s: %s: %w", path, step.Type, err)
+					}
+					content = out
+					if step.Type == "gzip" {
+						target += ".gz"
+					}
+				}
+			}
+			if target != path {
+				if _, exists := hc.Files[target]; exists {
+					return fmt.Errorf("%s: compressed file %s already exists", path, target)
+				}
+				delete(hc.Files, path)
+			}
+			hc.Files[target] = content
+		}
+		return nil
+	}
+}
+
+func applyTransform(step transformStep, path, content string) (string, error) {
+	switch step.Type {
+	case "minify-json":
+		var out bytes.Buffer
+		if err := json.Compact(&out, []byte(content)); err != nil {
+			return "", err
+		}
+		return out.String(), nil
+	case "header":
+		// A shebang has to stay on the first line.
+		shebang := ""
+		if strings.HasPrefix(content, "#!") {
+			if end := strings.IndexByte(content, '\n'); end >= 0 {
+				shebang, content = content[:end+1], content[end+1:]
+			}
+		}
+		if strings.HasPrefix(content, step.Text+"\n") {
+			return shebang + content, nil
+		}
+		return shebang + step.Text + "\n" + content, nil
+	case "front-matter":
+		return addFrontMatter(content, step.Fields)
+	case "strip-comments":
+		return stripComments(content, step.Prefix), nil
+	case "command":
+		cmd := exec.Command("sh", "-c", step.Command)
+		cmd.Stdin = strings.NewReader(content)
+		cmd.Env = append(os.Environ(), "GITAPIS_PATH="+path)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		if err := cmd.Run(); err != nil {
+			if msg := strings.TrimSpace(stderr.String()); msg != "" {
+				return "", fmt.Errorf("%q failed: %w: %s", step.Command, err, msg)
+			}
+			return "", fmt.Errorf("%q failed: %w", step.Command, err)
+		}
+		return stdout.String(), nil
+	case "gzip":
+		// A zero ModTime and no name keep the output a function of the
+		// content alone.
+		var out bytes.Buffer
+		zw, err := gzip.NewWriterLevel(&out, gzip.BestCompression)
+		if err != nil {
+			return "", err
+		}
+		if _, err := zw.Write([]byte(content)); err != nil {
+			return "", err
+		}
+		if err := zw.Close(); err != nil {
+			return "", err
+		}
+		return out.String(), nil
+	}
+	return "", fmt.Errorf("unknown step")
+}
+
+// addFrontMatter adds fields missing from content's YAML front matter,
+// creating the block if there is none. Keys are written in sorted order with
+// JSON-quoted values, which YAML reads as plain strings.
+func addFrontMatter(content string, fields map[string]string) (string, error) {
+	var block, body string
+	if rest, ok := strings.CutPrefix(content, "---\n"); ok {
+		end := strings.Index(rest, "\n---\n")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated front matter")
+		}
+		block, body = rest[:end+1], rest[end+len("\n---\n"):]
+	} else {
+		body = content
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var added strings.Builder
+	for _, key := range keys {
+		if strings.HasPrefix(block, key+":") || strings.Contains(block, "\n"+key+":") {
+			continue
+		}
+		value, _ := json.Marshal(fields[key])
+		fmt.Fprintf(&added, "%s: %s\n", key, value)
+	}
+	if added.Len() == 0 && block == "" {
+		return content, nil
+	}
+	return "---\n" + block + added.String() + "---\n" + body, nil
+}
+
+// stripComments drops every line whose first non-blank characters are
+// prefix, keeping a shebang on the first line.
+func stripComments(content, prefix string) string {
+	lines := strings.SplitAfter(content, "\n")
+	kept := lines[:0]
+	for i, line := range lines {
+		if i == 0 && strings.HasPrefix(line, "#!") {
+			kept = append(kept, line)
+			continue
+		}
+		if strings.HasPrefix(strings.TrimLeft(line, " \t"), prefix) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, "")
+}
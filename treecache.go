@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Tree Cache ---
+
+// treeCacheDir is where tree listings are cached between runs; empty
+// disables the cache. Listings are keyed by commit SHA, so an entry can only
+// go stale by being evicted, which happens after treeCacheTTL.
+var (
+	treeCacheDir string
+	treeCacheTTL time.Duration
+)
+
+// cacheFlags registers the tree and HTTP cache flags on fs.
+func cacheFlags(fs *flag.FlagSet) {
+	fs.StringVar(&treeCacheDir, "cache-dir", "", "cache remote tree listings by commit in this directory between runs")
+	fs.DurationVar(&treeCacheTTL, "cache-ttl", time.Hour, "how long a -cache-dir entry is used before it is fetched again")
+	fs.StringVar(&httpCacheDir, "http-cache-dir", "", "cache GitHub API responses in this directory, shared between runs, and revalidate them by ETag")
+}
+
+type cachedTree struct {
+	Time time.Time    `json:"time"`
+	Tree *github.Tree `json:"tree"`
+}
+
+func treeCachePath(owner, repo, sha string) string {
+	return filepath.Join(treeCacheDir, owner, repo, sha+".json")
+}
+
+// loadCachedTree returns the cached listing of commit sha, or nil if there
+// is none or it has expired.
+func loadCachedTree(owner, repo, sha string) *github.Tree {
+	if treeCacheDir == "" {
+		return nil
+	}
+	b, err := os.ReadFile(treeCachePath(owner, repo, sha))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	var entry cachedTree
+	if err == nil {
+		err = json.Unmarshal(b, &entry)
+	}
+	if err != nil {
+		log.Printf("⚠️ Ignoring cached tree of %s: %v", shortSHA(sha), err)
+		return nil
+	}
+	if time.Since(entry.Time) > treeCacheTTL {
+		os.Remove(treeCachePath(owner, repo, sha))
+		return nil
+	}
+	return entry.Tree
+}
+
+// storeCachedTree caches the listing of commit sha. A failure only costs a
+// refetch next time, so it is logged rather than returned.
+func storeCachedTree(owner, repo, sha string, tree *github.Tree) {
+	if treeCacheDir == "" {
+		return
+	}
+	p := treeCachePath(owner, repo, sha)
+	b, err := json.Marshal(cachedTree{Time: time.Now(), Tree: tree})
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(p), 0o755)
+	}
+	if err == nil {
+		err = os.WriteFile(p, b, 0o644)
+	}
+	if err != nil {
+		log.Printf("⚠️ Failed to cache tree of %s: %v", shortSHA(sha), err)
+	}
+}
+
+// invalidateCachedTree drops the listing of commit sha.
+func invalidateCachedTree(owner, repo, sha string) {
+	if treeCacheDir != "" {
+		os.Remove(treeCachePath(owner, repo, sha))
+	}
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// --- Pre-flight Validation ---
+
+const (
+	// maxFileSize is GitHub's hard limit for a single file.
+	maxFileSize = 100 << 20
+	// warnFileSize is where GitHub starts warning about large files.
+	warnFileSize = 50 << 20
+)
+
+// validatePath returns why p is not a valid repository path, or "".
+func validatePath(p string) string {
+	switch {
+	case p == "":
+		return "empty path"
+	case strings.HasPrefix(p, "/"):
+		return "leading slash"
+	case strings.HasSuffix(p, "/"):
+		return "trailing slash"
+	case !utf8.ValidString(p):
+		return "invalid UTF-8"
+	case strings.ContainsRune(p, 0):
+		return "NUL byte"
+	case strings.Contains(p, "\\"):
+		return "backslash (use forward slashes)"
+	case !norm.NFC.IsNormalString(p):
+		return "not NFC-normalized"
+	}
+	for _, segment := range strings.Split(p, "/") {
+		switch {
+		case segment == "":
+			return "empty path segment"
+		case segment == "." || segment == "..":
+			return fmt.Sprintf("%q segment", segment)
+		case strings.EqualFold(segment, ".git"):
+			return ".git segment"
+		}
+	}
+	return ""
+}
+
+// validateChangeSet checks files against GitHub's limits and git's path rules
+// without touching the API, reporting every violation at once. Files over
+// warnFileSize only produce a warning, and LFS-tracked files are exempt from
+// both. A maxFiles of 0 disables the count cap.
+func validateChangeSet(files map[string]string, maxFiles int, attrs *gitAttributes) error {
+	paths := make([]string, 0, len(files))
+	for p := range files {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+
+	var violations []string
+	if maxFiles > 0 && len(files) > maxFiles {
+		violations = append(violations, fmt.Sprintf("%d files exceed the limit of %d per commit", len(files), maxFiles))
+	}
+	for _, p := range paths {
+		if reason := validatePath(p); reason != "" {
+			violations = append(violations, fmt.Sprintf("%q: invalid path: %s", p, reason))
+		}
+		switch size := len(files[p]); {
+		case attrs.isLFS(p):
+		case size > maxFileSize:
+			violations = append(violations, fmt.Sprintf("%s: %d MB exceeds GitHub's 100 MB file limit", p, size>>20))
+		case size > warnFileSize:
+			log.Printf("⚠️ %s is %d MB; GitHub recommends files under 50 MB", p, size>>20)
+		}
+	}
+
+	for _, collision := range caseCollisions(nil, paths) {
+		violations = append(violations, "paths differ only by case: "+collision)
+	}
+
+	if len(violations) > 0 {
+		return fmt.Errorf("change set failed validation:\n  - %s", strings.Join(violations, "\n  - "))
+	}
+	return nil
+}
+
+// caseCollisions returns every pair of paths that differ only by case, which
+// case-insensitive file systems such as macOS's and Windows' cannot check out
+// side by side. Directories count too: "Docs/a" collides with "docs/b". Paths
+// are checked against existing, such as the remote tree, and each other, but
+// collisions within existing are not reported. Each is "first and second".
+func caseCollisions(existing, paths []string) []string {
+	fold := cases.Fold()
+	seen := make(map[string]string)
+	add := func(p string) {
+		segments := strings.Split(p, "/")
+		for i := range segments {
+			prefix := strings.Join(segments[:i+1], "/")
+			if _, ok := seen[fold.String(prefix)]; !ok {
+				seen[fold.String(prefix)] = prefix
+			}
+		}
+	}
+	for _, p := range existing {
+		add(p)
+	}
+
+	reported := make(map[string]bool)
+	var collisions []string
+	for _, p := range paths {
+		segments := strings.Split(p, "/")
+		for i := range segments {
+			prefix := strings.Join(segments[:i+1], "/")
+			first, ok := seen[fold.String(prefix)]
+			if ok && first != prefix {
+				// Report only the outermost collision; whatever is below
+				// it collides as a consequence.
+				if pair := first + " and " + prefix; !reported[pair] {
+					reported[pair] = true
+					collisions = append(collisions, pair)
+				}
+				break
+			}
+		}
+		add(p)
+	}
+	return collisions
+}
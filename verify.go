@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/google/go-github/v55/github"
+)
+
+// --- Post-push Verification ---
+
+// Verification levels for -verify.
+const (
+	verifyOff    = ""
+	verifyTree   = "tree"
+	verifySigned = "signed"
+)
+
+// verifyCommit reads back what GitHub recorded for want: the branch must point
+// at it and its tree must be the one we created. At verifySigned the commit
+// must also carry a verified signature, which catches commits that were
+// meant to be signed but were not.
+func verifyCommit(client *github.Client, owner, repo, branch string, want *github.Commit, level string) error {
+	if level == verifyOff || want == nil {
+		return nil
+	}
+	if level != verifyTree && level != verifySigned {
+		return fmt.Errorf("unknown verification level %q", level)
+	}
+	ctx := context.Background()
+
+	ref, _, err := client.Git.GetRef(ctx, owner, repo, "refs/heads/"+branch)
+	if err != nil {
+		return fmt.Errorf("verify GetRef: %w", err)
+	}
+	if ref.Object.GetSHA() != want.GetSHA() {
+		return fmt.Errorf("verification failed: %s points at %s, expected %s", branch, shortSHA(ref.Object.GetSHA()), shortSHA(want.GetSHA()))
+	}
+
+	got, _, err := client.Git.GetCommit(ctx, owner, repo, want.GetSHA())
+	if err != nil {
+		return fmt.Errorf("verify GetCommit: %w", err)
+	}
+	if got.Tree.GetSHA() != want.Tree.GetSHA() {
+		return fmt.Errorf("verification failed: commit %s has tree %s, expected %s", shortSHA(want.GetSHA()), shortSHA(got.Tree.GetSHA()), shortSHA(want.Tree.GetSHA()))
+	}
+	if level == verifySigned && !got.Verification.GetVerified() {
+		return fmt.Errorf("verification failed: commit %s is not signed as verified (reason: %s)", shortSHA(want.GetSHA()), got.Verification.GetReason())
+	}
+
+	log.Printf("Verified commit %s on %s", shortSHA(want.GetSHA()), branch)
+	return nil
+}
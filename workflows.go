@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// --- Workflow Checks ---
+
+// A workflow file that does not parse is not an error GitHub reports where
+// anyone looks: the workflow just stops running, so CI is off for the whole
+// repository until someone notices.
+
+// isWorkflowFile reports whether p is a workflow definition.
+func isWorkflowFile(p string) bool {
+	dir, name := path.Split(p)
+	ext := path.Ext(name)
+	return dir == ".github/workflows/" && (ext == ".yml" || ext == ".yaml")
+}
+
+// workflowTopLevelKeys are the keys of a workflow file.
+var workflowTopLevelKeys = map[string]bool{
+	"name": true, "run-name": true, "on": true, "permissions": true,
+	"env": true, "defaults": true, "concurrency": true, "jobs": true,
+}
+
+// workflowProblem is one thing wrong with a workflow file.
+type workflowProblem struct {
+	Line int
+	Msg  string
+}
+
+// checkWorkflow returns what is wrong with the workflow in content: that it
+// does not parse and, with lint, that it is not shaped like a workflow.
+func checkWorkflow(content string, lint bool) []workflowProblem {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &doc); err != nil {
+		// yaml.v3 puts the line in its message already.
+		return []workflowProblem{{Msg: err.Error()}}
+	}
+	if !lint {
+		return nil
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return []workflowProblem{{Line: 1, Msg: "a workflow must be a mapping"}}
+	}
+
+	var problems []workflowProblem
+	problem := func(n *yaml.Node, format string, a ...any) {
+		problems = append(problems, workflowProblem{Line: n.Line, Msg: fmt.Sprintf(format, a...)})
+	}
+	root := doc.Content[0]
+	top := mappingKeys(root)
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if key := root.Content[i]; !workflowTopLevelKeys[key.Value] {
+			problem(key, "unknown key %q", key.Value)
+		}
+	}
+	if top["on"] == nil {
+		problem(root, "missing \"on\": nothing would trigger the workflow")
+	}
+	jobs := top["jobs"]
+	switch {
+	case jobs == nil:
+		problem(root, "missing \"jobs\"")
+	case jobs.Kind != yaml.MappingNode || len(jobs.Content) == 0:
+		problem(jobs, "\"jobs\" must map job IDs to jobs")
+	default:
+		for i := 0; i+1 < len(jobs.Content); i += 2 {
+			id, job := jobs.Content[i], jobs.Content[i+1]
+			problems = append(problems, checkWorkflowJob(id.Value, job)...)
+		}
+	}
+	return problems
+}
+
+func checkWorkflowJob(id string, job *yaml.Node) []workflowProblem {
+	var problems []workflowProblem
+	problem := func(n *yaml.Node, format string, a ...any) {
+		problems = append(problems, workflowProblem{Line: n.Line, Msg: fmt.Sprintf("job %s: ", id) + fmt.Sprintf(format, a...)})
+	}
+	if job.Kind != yaml.MappingNode {
+		problem(job, "must be a mapping")
+		return problems
+	}
+	keys := mappingKeys(job)
+	// A job calling a reusable workflow has neither runner nor steps.
+	if keys["uses"] != nil {
+		return problems
+	}
+	if keys["runs-on"] == nil {
+		problem(job, "missing \"runs-on\"")
+	}
+	steps := keys["steps"]
+	if steps == nil {
+		problem(job, "missing \"steps\"")
+		return problems
+	}
+	if steps.Kind != yaml.SequenceNode || len(steps.Content) == 0 {
+		problem(steps, "\"steps\" must be a list of steps")
+		return problems
+	}
+	for n, step := range steps.Content {
+		if step.Kind != yaml.MappingNode {
+			problem(step, "step %d must be a mapping", n+1)
+			continue
+		}
+		stepKeys := mappingKeys(step)
+		switch uses, run := stepKeys["uses"] != nil, stepKeys["run"] != nil; {
+		case uses && run:
+			problem(step, "step %d has both \"uses\" and \"run\"", n+1)
+		case !uses && !run:
+			problem(step, "step %d has neither \"uses\" nor \"run\"", n+1)
+		}
+	}
+	return problems
+}
+
+// mappingKeys indexes the values of a mapping node by key.
+func mappingKeys(n *yaml.Node) map[string]*yaml.Node {
+	keys := make(map[string]*yaml.Node, len(n.Content)/2)
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		keys[n.Content[i].Value] = n.Content[i+1]
+	}
+	return keys
+}
+
+// workflowCheckHook refuses to commit workflow files that fail checkWorkflow.
+func workflowCheckHook(lint bool) hookFunc {
+	return func(hc *hookContext) error {
+		var paths []string
+		for p := range hc.Files {
+			if isWorkflowFile(p) {
+				paths = append(paths, p)
+			}
+		}
+		sort.Strings(paths)
+
+		var report []string
+		for _, p := range paths {
+			for _, problem := range checkWorkflow(hc.Files[p], lint) {
+				where := p
+				if problem.Line > 0 {
+					where = fmt.Sprintf("%s:%d", p, problem.Line)
+				}
+				report = append(report, where+": "+problem.Msg)
+				hc.Result[p] = "blocked"
+			}
+		}
+		if len(report) > 0 {
+			return fmt.Errorf("invalid workflow files, refusing to commit:\n  %s", strings.Join(report, "\n  "))
+		}
+		return nil
+	}
+}